@@ -1,12 +1,16 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
+	"os"
 
 	"chirp/models"
 	"chirp/routes"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 
 	_ "chirp/docs"
 
@@ -34,6 +38,13 @@ func main() {
 		dbSQL.Close()
 	}()
 
+	if len(os.Args) > 1 && os.Args[1] == "check-consistency" {
+		if !checkConsistency(db, os.Args[2:]) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	r := gin.Default()
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
@@ -45,3 +56,37 @@ func main() {
 	log.Println("Starting server on :8080")
 	r.Run(":8080")
 }
+
+// Реализует команду check-consistency: выводит висячие ссылки и ответы на комментарии другого поста.
+// С флагом -repair исправляет их по политике удаления внешнего ключа. Возвращает false, если что-то осталось неисправленным.
+func checkConsistency(db *gorm.DB, args []string) bool {
+	flags := flag.NewFlagSet("check-consistency", flag.ExitOnError)
+	repair := flags.Bool("repair", false, "delete orphaned rows or clear their references")
+	flags.Parse(args)
+
+	inconsistencies, unvalidated, err := models.CheckConsistency(db, *repair)
+	if err != nil {
+		log.Println("Consistency check failed:", err)
+		return false
+	}
+
+	consistent := true
+	for _, inconsistency := range inconsistencies {
+		fmt.Printf("%s: %d rows, %s", inconsistency.Check, inconsistency.Found, inconsistency.Description)
+		if *repair {
+			fmt.Printf(" (%d repaired)", inconsistency.Repaired)
+		}
+		fmt.Println()
+		if inconsistency.Repaired < inconsistency.Found {
+			consistent = false
+		}
+	}
+	for _, fk := range unvalidated {
+		fmt.Printf("%s: constraint is still not validated\n", fk.Name())
+		consistent = false
+	}
+	if len(inconsistencies) == 0 {
+		fmt.Println("No inconsistencies found")
+	}
+	return consistent
+}
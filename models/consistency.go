@@ -0,0 +1,112 @@
+package models
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// An inconsistency found by CheckConsistency. Rows whose key restricts deletes are
+// never repaired automatically.
+type Inconsistency struct {
+	Check       string
+	Description string
+	Found       int64
+	Repaired    int64
+}
+
+type consistencyCheck struct {
+	name        string
+	description string
+	query       func(db *gorm.DB) *gorm.DB
+	repair      func(db *gorm.DB) *gorm.DB
+}
+
+// Rows of the key's table whose reference points to a missing row. Soft-deleted rows still exist
+// and are not orphaned.
+func orphanedRows(db *gorm.DB, fk ForeignKey) *gorm.DB {
+	return db.Table(fk.Table).Where(fmt.Sprintf(`%q IS NOT NULL AND NOT EXISTS (SELECT 1 FROM %q ref WHERE ref.id = %q.%q)`,
+		fk.Column, fk.RefTable, fk.Table, fk.Column))
+}
+
+func foreignKeyCheck(fk ForeignKey) consistencyCheck {
+	check := consistencyCheck{
+		name:        fk.Name(),
+		description: fmt.Sprintf("%s.%s references missing %s", fk.Table, fk.Column, fk.RefTable),
+		query:       func(db *gorm.DB) *gorm.DB { return orphanedRows(db, fk) },
+	}
+	switch fk.OnDelete {
+	case OnDeleteCascade:
+		check.repair = func(db *gorm.DB) *gorm.DB {
+			return db.Exec(fmt.Sprintf(`DELETE FROM %q WHERE %q IS NOT NULL AND NOT EXISTS (SELECT 1 FROM %q ref WHERE ref.id = %q.%q)`,
+				fk.Table, fk.Column, fk.RefTable, fk.Table, fk.Column))
+		}
+	case OnDeleteSetNull:
+		check.repair = func(db *gorm.DB) *gorm.DB {
+			return orphanedRows(db, fk).Update(fk.Column, nil)
+		}
+	}
+	return check
+}
+
+// Replies must belong to the post of the comment they answer.
+const crossPostReply = "EXISTS (SELECT 1 FROM comments parent WHERE parent.id = comments.reply_to_id AND parent.post_id <> comments.post_id)"
+
+var crossPostRepliesCheck = consistencyCheck{
+	name:        "comments_reply_post",
+	description: "comments reply to a comment on another post",
+	query: func(db *gorm.DB) *gorm.DB {
+		return db.Table("comments").
+			Where(crossPostReply)
+	},
+	repair: func(db *gorm.DB) *gorm.DB {
+		return db.Table("comments").
+			Where(crossPostReply).
+			Updates(map[string]interface{}{"reply_to_id": nil, "is_reply": false})
+	},
+}
+
+// CheckConsistency counts orphaned rows for every foreign key and replies attached to another post.
+// With repair set, orphans are deleted or their reference cleared according to the key's delete policy,
+// replies to another post become top-level comments, and the constraints are validated afterwards.
+// The returned slice lists only checks that found rows.
+func CheckConsistency(db *gorm.DB, repair bool) ([]Inconsistency, []ForeignKey, error) {
+	checks := make([]consistencyCheck, 0, len(ForeignKeys)+1)
+	for _, fk := range ForeignKeys {
+		checks = append(checks, foreignKeyCheck(fk))
+	}
+	checks = append(checks, crossPostRepliesCheck)
+
+	var inconsistencies []Inconsistency
+	for _, check := range checks {
+		var count int64
+		if err := check.query(db).Count(&count).Error; err != nil {
+			return nil, nil, err
+		}
+		if count == 0 {
+			continue
+		}
+
+		inconsistency := Inconsistency{Check: check.name, Description: check.description, Found: count}
+		if repair && check.repair != nil {
+			// Deleted orphans take the rows referencing them along through the constraints' cascades.
+			result := check.repair(db)
+			if result.Error != nil {
+				return nil, nil, result.Error
+			}
+			inconsistency.Repaired = result.RowsAffected
+		}
+		inconsistencies = append(inconsistencies, inconsistency)
+	}
+
+	if !repair {
+		return inconsistencies, nil, nil
+	}
+	var unvalidated []ForeignKey
+	for _, fk := range ForeignKeys {
+		if validateForeignKey(db, fk) != nil {
+			unvalidated = append(unvalidated, fk)
+		}
+	}
+	return inconsistencies, unvalidated, nil
+}
@@ -0,0 +1,226 @@
+package models
+
+import (
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// Actions taken on rows referencing a deleted row.
+const (
+	// Authors and moderators of content cannot be deleted while the content exists;
+	// accounts are anonymized instead. Groups with a moderation log are kept as tombstones.
+	OnDeleteRestrict = "RESTRICT"
+	OnDeleteCascade  = "CASCADE"
+	OnDeleteSetNull  = "SET NULL"
+)
+
+// A single-column foreign key to the id of RefTable.
+type ForeignKey struct {
+	Table    string
+	Column   string
+	RefTable string
+	OnDelete string
+}
+
+// Name returns the constraint name, fk_<table>_<column>.
+func (fk ForeignKey) Name() string {
+	return fmt.Sprintf("fk_%s_%s", fk.Table, fk.Column)
+}
+
+// ForeignKeys lists every reference between tables with its delete policy. Polymorphic columns,
+// such as the targets of content references and moderator actions, have no constraint.
+var ForeignKeys = []ForeignKey{
+	{"posts", "author_id", "users", OnDeleteRestrict},
+	{"posts", "group_id", "groups", OnDeleteCascade},
+	{"posts", "flair_id", "post_flairs", OnDeleteSetNull},
+	{"posts", "link_preview_id", "link_previews", OnDeleteSetNull},
+	{"posts", "deleted_by_id", "users", OnDeleteSetNull},
+
+	{"comments", "post_id", "posts", OnDeleteCascade},
+	{"comments", "author_id", "users", OnDeleteRestrict},
+	{"comments", "reply_to_id", "comments", OnDeleteSetNull},
+	{"comments", "deleted_by_id", "users", OnDeleteSetNull},
+
+	{"groups", "deleted_by_id", "users", OnDeleteSetNull},
+	{"users", "deleted_by_id", "users", OnDeleteSetNull},
+
+	{"group_users", "group_id", "groups", OnDeleteCascade},
+	{"group_users", "user_id", "users", OnDeleteCascade},
+	{"group_users", "flair_template_id", "user_flair_templates", OnDeleteSetNull},
+	{"group_moderators", "group_id", "groups", OnDeleteCascade},
+	{"group_moderators", "user_id", "users", OnDeleteCascade},
+	{"user_subscriptions", "subscriber_id", "users", OnDeleteCascade},
+	{"user_subscriptions", "target_user_id", "users", OnDeleteCascade},
+
+	{"mod_actions", "group_id", "groups", OnDeleteRestrict},
+	{"mod_actions", "moderator_id", "users", OnDeleteRestrict},
+	{"mod_actions", "rule_id", "group_rules", OnDeleteSetNull},
+	{"group_bans", "group_id", "groups", OnDeleteCascade},
+	{"group_bans", "user_id", "users", OnDeleteCascade},
+	{"group_bans", "banned_by_id", "users", OnDeleteRestrict},
+	{"reports", "group_id", "groups", OnDeleteCascade},
+	{"reports", "post_id", "posts", OnDeleteCascade},
+	{"reports", "comment_id", "comments", OnDeleteCascade},
+	{"reports", "reporter_id", "users", OnDeleteSetNull},
+	{"reports", "rule_id", "group_rules", OnDeleteSetNull},
+	{"auto_mod_rules", "group_id", "groups", OnDeleteCascade},
+	{"auto_mod_rules", "created_by_id", "users", OnDeleteRestrict},
+	{"auto_mod_hits", "rule_id", "auto_mod_rules", OnDeleteCascade},
+	{"auto_mod_hits", "post_id", "posts", OnDeleteCascade},
+	{"auto_mod_hits", "comment_id", "comments", OnDeleteCascade},
+	{"spam_decisions", "post_id", "posts", OnDeleteCascade},
+	{"spam_decisions", "comment_id", "comments", OnDeleteCascade},
+	{"group_rules", "group_id", "groups", OnDeleteCascade},
+	{"post_flairs", "group_id", "groups", OnDeleteCascade},
+	{"user_flair_templates", "group_id", "groups", OnDeleteCascade},
+
+	{"wiki_pages", "group_id", "groups", OnDeleteCascade},
+	{"wiki_pages", "current_revision_id", "wiki_revisions", OnDeleteSetNull},
+	{"wiki_revisions", "page_id", "wiki_pages", OnDeleteCascade},
+	{"wiki_revisions", "author_id", "users", OnDeleteRestrict},
+	{"wiki_revisions", "reverted_to_id", "wiki_revisions", OnDeleteSetNull},
+	{"wiki_contributors", "group_id", "groups", OnDeleteCascade},
+	{"wiki_contributors", "user_id", "users", OnDeleteCascade},
+	{"wiki_contributors", "added_by_id", "users", OnDeleteRestrict},
+
+	{"modmail_threads", "group_id", "groups", OnDeleteCascade},
+	{"modmail_threads", "user_id", "users", OnDeleteRestrict},
+	{"modmail_messages", "thread_id", "modmail_threads", OnDeleteCascade},
+	{"modmail_messages", "author_id", "users", OnDeleteRestrict},
+
+	{"user_blocks", "blocker_id", "users", OnDeleteCascade},
+	{"user_blocks", "blocked_id", "users", OnDeleteCascade},
+
+	{"conversations", "created_by_id", "users", OnDeleteRestrict},
+	{"conversation_members", "conversation_id", "conversations", OnDeleteCascade},
+	{"conversation_members", "user_id", "users", OnDeleteCascade},
+	{"conversation_members", "last_read_message_id", "direct_messages", OnDeleteSetNull},
+	{"direct_messages", "conversation_id", "conversations", OnDeleteCascade},
+	{"direct_messages", "sender_id", "users", OnDeleteRestrict},
+
+	{"notifications", "user_id", "users", OnDeleteCascade},
+	{"notifications", "actor_id", "users", OnDeleteSetNull},
+	{"notifications", "group_id", "groups", OnDeleteCascade},
+	{"notifications", "post_id", "posts", OnDeleteCascade},
+	{"notifications", "comment_id", "comments", OnDeleteCascade},
+	{"notification_preferences", "user_id", "users", OnDeleteCascade},
+	{"vote_milestones", "post_id", "posts", OnDeleteCascade},
+	{"vote_milestones", "comment_id", "comments", OnDeleteCascade},
+
+	{"content_references", "post_id", "posts", OnDeleteCascade},
+	{"content_references", "comment_id", "comments", OnDeleteCascade},
+
+	{"media", "owner_id", "users", OnDeleteCascade},
+	{"media_variants", "media_id", "media", OnDeleteCascade},
+	{"post_media", "post_id", "posts", OnDeleteCascade},
+	{"post_media", "media_id", "media", OnDeleteCascade},
+	{"banned_images", "group_id", "groups", OnDeleteCascade},
+	{"banned_images", "media_id", "media", OnDeleteSetNull},
+	{"banned_images", "post_id", "posts", OnDeleteSetNull},
+	{"banned_images", "banned_by_id", "users", OnDeleteRestrict},
+
+	{"content_revisions", "post_id", "posts", OnDeleteCascade},
+	{"content_revisions", "comment_id", "comments", OnDeleteCascade},
+	{"content_revisions", "editor_id", "users", OnDeleteRestrict},
+
+	{"polls", "post_id", "posts", OnDeleteCascade},
+	{"poll_options", "post_id", "posts", OnDeleteCascade},
+	{"poll_ballots", "post_id", "posts", OnDeleteCascade},
+	{"poll_ballots", "user_id", "users", OnDeleteCascade},
+	{"poll_votes", "post_id", "posts", OnDeleteCascade},
+	{"poll_votes", "user_id", "users", OnDeleteCascade},
+	{"poll_votes", "option_id", "poll_options", OnDeleteCascade},
+
+	{"saved_collections", "user_id", "users", OnDeleteCascade},
+	{"saved_items", "user_id", "users", OnDeleteCascade},
+	{"saved_items", "post_id", "posts", OnDeleteCascade},
+	{"saved_items", "comment_id", "comments", OnDeleteCascade},
+	{"saved_items", "collection_id", "saved_collections", OnDeleteSetNull},
+
+	{"hidden_posts", "user_id", "users", OnDeleteCascade},
+	{"hidden_posts", "post_id", "posts", OnDeleteCascade},
+	{"muted_groups", "user_id", "users", OnDeleteCascade},
+	{"muted_groups", "group_id", "groups", OnDeleteCascade},
+	{"muted_users", "user_id", "users", OnDeleteCascade},
+	{"muted_users", "muted_user_id", "users", OnDeleteCascade},
+	{"content_filters", "user_id", "users", OnDeleteCascade},
+}
+
+// confdeltype codes of pg_constraint.
+var deleteActionCodes = map[string]string{
+	OnDeleteRestrict: "r",
+	OnDeleteCascade:  "c",
+	OnDeleteSetNull:  "n",
+}
+
+type existingConstraint struct {
+	Name      string
+	OnDelete  string
+	Validated bool
+}
+
+// Constraints on a single column of the table, including the ones created by earlier versions of gorm.
+func columnConstraints(db *gorm.DB, table, column string) ([]existingConstraint, error) {
+	var constraints []existingConstraint
+	err := db.Raw(`
+		SELECT con.conname AS name, con.confdeltype::text AS on_delete, con.convalidated AS validated
+		FROM pg_constraint con
+		JOIN pg_class rel ON rel.oid = con.conrelid
+		JOIN pg_namespace nsp ON nsp.oid = rel.relnamespace
+		JOIN pg_attribute att ON att.attrelid = con.conrelid AND att.attnum = con.conkey[1]
+		WHERE con.contype = 'f' AND nsp.nspname = current_schema()
+			AND rel.relname = ? AND att.attname = ? AND array_length(con.conkey, 1) = 1`,
+		table, column).Scan(&constraints).Error
+	return constraints, err
+}
+
+// migrateForeignKeys replaces the constraints of every listed column with one carrying the
+// listed delete policy. New constraints are added NOT VALID so that orphaned rows do not block
+// startup; they still apply to new writes and deletes. It returns the constraints left unvalidated.
+func migrateForeignKeys(db *gorm.DB) ([]ForeignKey, error) {
+	var unvalidated []ForeignKey
+	for _, fk := range ForeignKeys {
+		constraints, err := columnConstraints(db, fk.Table, fk.Column)
+		if err != nil {
+			return nil, err
+		}
+
+		current, validated := false, false
+		for _, constraint := range constraints {
+			if constraint.Name == fk.Name() && constraint.OnDelete == deleteActionCodes[fk.OnDelete] {
+				current, validated = true, constraint.Validated
+				continue
+			}
+			if err := db.Exec(fmt.Sprintf(`ALTER TABLE %q DROP CONSTRAINT %q`, fk.Table, constraint.Name)).Error; err != nil {
+				return nil, err
+			}
+		}
+		if !current {
+			if err := db.Exec(fmt.Sprintf(`ALTER TABLE %q ADD CONSTRAINT %q FOREIGN KEY (%q) REFERENCES %q (id) ON DELETE %s NOT VALID`,
+				fk.Table, fk.Name(), fk.Column, fk.RefTable, fk.OnDelete)).Error; err != nil {
+				return nil, err
+			}
+		}
+		if !validated && validateForeignKey(db, fk) != nil {
+			unvalidated = append(unvalidated, fk)
+		}
+	}
+	return unvalidated, nil
+}
+
+// validateForeignKey checks existing rows against the constraint. It fails while orphaned rows remain.
+func validateForeignKey(db *gorm.DB, fk ForeignKey) error {
+	return db.Exec(fmt.Sprintf(`ALTER TABLE %q VALIDATE CONSTRAINT %q`, fk.Table, fk.Name())).Error
+}
+
+func reportUnvalidatedForeignKeys(unvalidated []ForeignKey) {
+	if len(unvalidated) == 0 {
+		return
+	}
+	for _, fk := range unvalidated {
+		log.Printf("Foreign key %s is not validated: %s.%s has rows referencing missing %s", fk.Name(), fk.Table, fk.Column, fk.RefTable)
+	}
+	log.Println("Run `chirp check-consistency -repair` to remove orphaned rows")
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"log"
 	"time"
 
@@ -21,12 +22,34 @@ type User struct {
 	BannerURL          string
 	Groups             []Group   `gorm:"many2many:group_users"`
 	Subscriptions       []User    `gorm:"many2many:user_subscriptions;joinForeignKey:subscriber_id;joinReferences:target_user_id"`
+	IsAdmin            bool      `gorm:"not null;default:false"`
+	Suspended          bool      `gorm:"not null;default:false"`
+	SuspendedUntil     *time.Time
+	SuspensionReason   string    `gorm:"type:text"`
+	ShadowBanned       bool      `gorm:"not null;default:false;index"`
+	// System accounts, such as AutoModerator, act on behalf of the service and cannot sign in.
+	IsSystem           bool      `gorm:"not null;default:false"`
+	// Deleted accounts can be restored until the retention job purges their personal data.
+	DeletedAt          gorm.DeletedAt `gorm:"index"`
+	DeletedByID        *uuid.UUID     `gorm:"type:uuid"`
+	PurgedAt           *time.Time
+}
+
+// IsSuspended reports whether the account is suspended at the given moment.
+// A suspension without an expiry date is permanent.
+func (u User) IsSuspended(now time.Time) bool {
+	return u.Suspended && (u.SuspendedUntil == nil || u.SuspendedUntil.After(now))
 }
 
 type Post struct {
 	ID         uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
 	AuthorID   uuid.UUID `gorm:"type:uuid;not null"`
 	Author     User      `gorm:"foreignKey:AuthorID"`
+	// Existing posts predate titles and types, hence the defaults.
+	Title        string `gorm:"type:varchar(300);not null;default:''"`
+	Type         string `gorm:"type:varchar(16);not null;default:'text'"`
+	URL          string `gorm:"type:text;not null;default:''"`
+	CanonicalURL string `gorm:"type:text;not null;default:'';index"`
 	Content    string    `gorm:"type:text;not null"`
 	MediaUrls pq.StringArray `gorm:"type:text[]" json:"mediaUrls"`
 	Reputation int       `gorm:"default:0"`
@@ -34,6 +57,17 @@ type Post struct {
 	GroupID    *uuid.UUID
 	Group      *Group
 	Comments   []Comment `gorm:"foreignKey:PostID"`
+	ModStatus  string    `gorm:"type:varchar(16);not null;default:'visible'"`
+	FlairID    *uuid.UUID `gorm:"type:uuid;index"`
+	FlairText  string    `gorm:"type:varchar(64)"`
+	// Rendered markdown cache, rebuilt on read when RenderVersion is behind the renderer.
+	ContentHTML   string     `gorm:"type:text;not null;default:''"`
+	RenderVersion int        `gorm:"not null;default:0"`
+	LinkPreviewID *uuid.UUID `gorm:"type:uuid;index"`
+	// Set by edits made after the grace period.
+	EditedAt      *time.Time
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
+	DeletedByID   *uuid.UUID     `gorm:"type:uuid"`
 }
 
 type Comment struct {
@@ -44,26 +78,41 @@ type Comment struct {
 	Content    string    `gorm:"type:text;not null"`
 	Reputation int       `gorm:"default:0"`
 	IsReply    bool      `gorm:"not null"`
-	ReplyToID  *uuid.UUID
+	ReplyToID  *uuid.UUID `gorm:"type:uuid;index"`
 	CreatedAt  time.Time `gorm:"not null"`
+	ModStatus  string    `gorm:"type:varchar(16);not null;default:'visible'"`
+	ContentHTML   string `gorm:"type:text;not null;default:''"`
+	RenderVersion int    `gorm:"not null;default:0"`
+	EditedAt      *time.Time
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
+	DeletedByID   *uuid.UUID     `gorm:"type:uuid"`
 }
 
 type Group struct {
-	ID           uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
-	GroupName    string    `gorm:"not null;unique"`
-	RegisteredAt time.Time `gorm:"not null"`
-	BannerURL    string
-	Description  string    `gorm:"type:text"`
-	Moderators   []User    `gorm:"many2many:group_moderators"`
-	Users        []User    `gorm:"many2many:group_users"`
+	ID             uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	GroupName      string    `gorm:"not null;unique"`
+	RegisteredAt   time.Time `gorm:"not null"`
+	BannerURL      string
+	Description    string `gorm:"type:text"`
+	Moderators     []User `gorm:"many2many:group_moderators"`
+	Users          []User `gorm:"many2many:group_users"`
+	PublicModLog   bool   `gorm:"default:false"`
+	RequireFlair   bool   `gorm:"default:false"`
+	AllowUserFlair bool   `gorm:"default:false"`
+	// Purged groups stay as tombstones so that the moderation log keeps its entries.
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+	DeletedByID    *uuid.UUID     `gorm:"type:uuid"`
+	PurgedAt       *time.Time
 }
 
 type GroupUser struct {
-	ID       uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
-	GroupID  uuid.UUID `gorm:"type:uuid;not null"`
-	UserID   uuid.UUID `gorm:"type:uuid;not null"`
-	JoinedAt time.Time `gorm:"not null"`
-	Title    string    `gorm:"type:varchar(255)"`
+	ID              uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	GroupID         uuid.UUID  `gorm:"type:uuid;not null"`
+	UserID          uuid.UUID  `gorm:"type:uuid;not null"`
+	JoinedAt        time.Time  `gorm:"not null"`
+	Title           string     `gorm:"type:varchar(255)"`
+	FlairColor      string     `gorm:"type:varchar(7)"`
+	FlairTemplateID *uuid.UUID `gorm:"type:uuid"`
 }
 
 type GroupModerator struct {
@@ -76,12 +125,563 @@ func (GroupModerator) TableName() string {
 	return "group_moderators"
 }
 
+// Post types.
+const (
+	PostTypeText    = "text"
+	PostTypeLink    = "link"
+	PostTypeImage   = "image"
+	PostTypeGallery = "gallery"
+	PostTypePoll    = "poll"
+)
+
+// Moderation states of posts and comments.
+const (
+	ContentVisible  = "visible"
+	ContentRemoved  = "removed"
+	ContentApproved = "approved"
+	ContentFiltered = "filtered"
+)
+
+// Kinds of entries in the moderation log.
+const (
+	ModActionAddModerator    = "add_moderator"
+	ModActionRemoveModerator = "remove_moderator"
+	ModActionRemovePost      = "remove_post"
+	ModActionApprovePost     = "approve_post"
+	ModActionRemoveComment   = "remove_comment"
+	ModActionApproveComment  = "approve_comment"
+	ModActionBanUser         = "ban_user"
+	ModActionUnbanUser       = "unban_user"
+	ModActionEditSettings    = "edit_settings"
+	ModActionFilterPost      = "filter_post"
+	ModActionFilterComment   = "filter_comment"
+	ModActionEditAutoMod     = "edit_automod"
+	ModActionEditRules       = "edit_rules"
+	ModActionEditFlair       = "edit_flair"
+	ModActionSetUserFlair    = "set_user_flair"
+	ModActionEditWiki        = "edit_wiki"
+	ModActionBanImage        = "ban_image"
+	ModActionUnbanImage      = "unban_image"
+	ModActionDeleteGroup     = "delete_group"
+	ModActionRestoreGroup    = "restore_group"
+)
+
+// Types of content a group rule applies to.
+const (
+	RuleAppliesToPosts    = "posts"
+	RuleAppliesToComments = "comments"
+	RuleAppliesToBoth     = "both"
+)
+
+type ModAction struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	GroupID     uuid.UUID  `gorm:"type:uuid;not null;index"`
+	ModeratorID uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Moderator   User       `gorm:"foreignKey:ModeratorID"`
+	Action      string     `gorm:"type:varchar(64);not null;index"`
+	TargetType  string     `gorm:"type:varchar(32)"`
+	TargetID    *uuid.UUID `gorm:"type:uuid"`
+	RuleID      *uuid.UUID `gorm:"type:uuid"`
+	Reason      string     `gorm:"type:text"`
+	Before      string     `gorm:"type:text"`
+	After       string     `gorm:"type:text"`
+	CreatedAt   time.Time  `gorm:"not null;index"`
+}
+
+// The moderation log is append-only: existing entries can never be changed.
+func (ModAction) BeforeUpdate(tx *gorm.DB) error {
+	return errors.New("mod actions are append-only")
+}
+
+func (ModAction) BeforeDelete(tx *gorm.DB) error {
+	return errors.New("mod actions are append-only")
+}
+
+type GroupBan struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	GroupID    uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_group_ban"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_group_ban"`
+	User       User       `gorm:"foreignKey:UserID"`
+	BannedByID uuid.UUID  `gorm:"type:uuid;not null"`
+	Reason     string     `gorm:"type:text"`
+	ExpiresAt  *time.Time
+	CreatedAt  time.Time  `gorm:"not null"`
+}
+
+type Report struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	GroupID    *uuid.UUID `gorm:"type:uuid;index"`
+	PostID     *uuid.UUID `gorm:"type:uuid;index"`
+	CommentID  *uuid.UUID `gorm:"type:uuid;index"`
+	ReporterID *uuid.UUID `gorm:"type:uuid"`
+	RuleID     *uuid.UUID `gorm:"type:uuid"`
+	Reason     string     `gorm:"type:text;not null"`
+	CreatedAt  time.Time  `gorm:"not null"`
+	ResolvedAt *time.Time
+}
+
+type AutoModRule struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	GroupID     uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Name        string     `gorm:"type:varchar(100);not null"`
+	Source      string     `gorm:"type:text;not null"`
+	Enabled     bool       `gorm:"not null;default:true"`
+	Position    int        `gorm:"not null;default:0"`
+	HitCount    int64      `gorm:"not null;default:0"`
+	LastHitAt   *time.Time
+	CreatedByID uuid.UUID  `gorm:"type:uuid;not null"`
+	CreatedAt   time.Time  `gorm:"not null"`
+	UpdatedAt   time.Time
+}
+
+// The first match of a rule on a post or comment. Reports and replies are made once per hit,
+// so editing matched content does not repeat them.
+type AutoModHit struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	RuleID    uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_automod_hit_post,where:comment_id IS NULL;uniqueIndex:idx_automod_hit_comment,where:comment_id IS NOT NULL"`
+	PostID    uuid.UUID  `gorm:"type:uuid;not null;index;uniqueIndex:idx_automod_hit_post,where:comment_id IS NULL"`
+	CommentID *uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_automod_hit_comment,where:comment_id IS NOT NULL"`
+	CreatedAt time.Time  `gorm:"not null"`
+}
+
+type GroupRule struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	GroupID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	Position    int       `gorm:"not null;default:0"`
+	Title       string    `gorm:"type:varchar(100);not null"`
+	Description string    `gorm:"type:text"`
+	AppliesTo   string    `gorm:"type:varchar(16);not null;default:'both'"`
+	CreatedAt   time.Time `gorm:"not null"`
+}
+
+// AppliesToKind reports whether the rule covers "post" or "comment" content.
+func (r GroupRule) AppliesToKind(kind string) bool {
+	switch r.AppliesTo {
+	case RuleAppliesToPosts:
+		return kind == "post"
+	case RuleAppliesToComments:
+		return kind == "comment"
+	default:
+		return true
+	}
+}
+
+type PostFlair struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	GroupID   uuid.UUID `gorm:"type:uuid;not null;index"`
+	Text      string    `gorm:"type:varchar(64);not null"`
+	Color     string    `gorm:"type:varchar(7)"`
+	ModOnly   bool      `gorm:"not null;default:false"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+type UserFlairTemplate struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	GroupID   uuid.UUID `gorm:"type:uuid;not null;index"`
+	Text      string    `gorm:"type:varchar(64);not null"`
+	Color     string    `gorm:"type:varchar(7)"`
+	ModOnly   bool      `gorm:"not null;default:false"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// Who may edit a wiki page.
+const (
+	WikiEditModerators   = "moderators"
+	WikiEditContributors = "contributors"
+	WikiEditEveryone     = "everyone"
+)
+
+type WikiPage struct {
+	ID                uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	GroupID           uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_wiki_page_path"`
+	Path              string     `gorm:"type:varchar(255);not null;uniqueIndex:idx_wiki_page_path"`
+	Content           string     `gorm:"type:text;not null"`
+	EditPermission    string     `gorm:"type:varchar(16);not null;default:'moderators'"`
+	CurrentRevisionID *uuid.UUID `gorm:"type:uuid"`
+	RevisionCount     int        `gorm:"not null;default:0"`
+	CreatedAt         time.Time  `gorm:"not null"`
+	UpdatedAt         time.Time
+}
+
+// Wiki revisions keep the full page text so any two of them can be diffed or restored.
+type WikiRevision struct {
+	ID           uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	PageID       uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Number       int        `gorm:"not null"`
+	AuthorID     uuid.UUID  `gorm:"type:uuid;not null"`
+	Author       User       `gorm:"foreignKey:AuthorID"`
+	Content      string     `gorm:"type:text;not null"`
+	Reason       string     `gorm:"type:varchar(255)"`
+	RevertedToID *uuid.UUID `gorm:"type:uuid"`
+	CreatedAt    time.Time  `gorm:"not null"`
+}
+
+type WikiContributor struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	GroupID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_wiki_contributor"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_wiki_contributor"`
+	User      User      `gorm:"foreignKey:UserID"`
+	AddedByID uuid.UUID `gorm:"type:uuid;not null"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// A modmail thread is a conversation between one user and a group's moderators as a whole.
+type ModmailThread struct {
+	ID            uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	GroupID       uuid.UUID `gorm:"type:uuid;not null;index"`
+	UserID        uuid.UUID `gorm:"type:uuid;not null;index"`
+	User          User      `gorm:"foreignKey:UserID"`
+	Subject       string    `gorm:"type:varchar(200);not null"`
+	Archived      bool      `gorm:"not null;default:false"`
+	Highlighted   bool      `gorm:"not null;default:false"`
+	UserUnread    bool      `gorm:"not null;default:false"`
+	ModUnread     bool      `gorm:"not null;default:false"`
+	LastMessageAt time.Time `gorm:"not null;index"`
+	CreatedAt     time.Time `gorm:"not null"`
+}
+
+type ModmailMessage struct {
+	ID            uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	ThreadID      uuid.UUID `gorm:"type:uuid;not null;index"`
+	AuthorID      uuid.UUID `gorm:"type:uuid;not null"`
+	Author        User      `gorm:"foreignKey:AuthorID"`
+	Body          string    `gorm:"type:text;not null"`
+	FromModerator bool      `gorm:"not null;default:false"`
+	// Internal notes are visible to the group's moderators only.
+	Internal  bool      `gorm:"not null;default:false"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+type UserBlock struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	BlockerID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_user_block"`
+	BlockedID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_user_block;index"`
+	Blocked   User      `gorm:"foreignKey:BlockedID"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// A conversation with exactly two members and IsGroup unset is a one-to-one chat.
+type Conversation struct {
+	ID            uuid.UUID            `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Title         string               `gorm:"type:varchar(100)"`
+	IsGroup       bool                 `gorm:"not null;default:false"`
+	CreatedByID   uuid.UUID            `gorm:"type:uuid;not null"`
+	Members       []ConversationMember `gorm:"foreignKey:ConversationID"`
+	LastMessageAt time.Time            `gorm:"not null;index"`
+	CreatedAt     time.Time            `gorm:"not null"`
+}
+
+type ConversationMember struct {
+	ID                uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	ConversationID    uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_conversation_member"`
+	UserID            uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_conversation_member;index"`
+	User              User       `gorm:"foreignKey:UserID"`
+	Muted             bool       `gorm:"not null;default:false"`
+	LastReadAt        *time.Time
+	LastReadMessageID *uuid.UUID `gorm:"type:uuid"`
+	JoinedAt          time.Time  `gorm:"not null"`
+}
+
+type DirectMessage struct {
+	ID             uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	ConversationID uuid.UUID `gorm:"type:uuid;not null;index:idx_direct_message_page"`
+	SenderID       uuid.UUID `gorm:"type:uuid;not null"`
+	Sender         User      `gorm:"foreignKey:SenderID"`
+	Body           string    `gorm:"type:text;not null"`
+	CreatedAt      time.Time `gorm:"not null;index:idx_direct_message_page"`
+}
+
+// Kinds of entities referenced from post and comment text.
+const (
+	ReferenceUser  = "user"
+	ReferenceGroup = "group"
+)
+
+// A resolved @nickname, u/nickname or g/groupname reference. Offset and Length are in characters (code points).
+type ContentReference struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	PostID    *uuid.UUID `gorm:"type:uuid;index"`
+	CommentID *uuid.UUID `gorm:"type:uuid;index"`
+	Kind      string     `gorm:"type:varchar(16);not null"`
+	TargetID  uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Text      string     `gorm:"type:varchar(128);not null"`
+	Offset    int        `gorm:"not null"`
+	Length    int        `gorm:"not null"`
+}
+
+// Kinds of notifications a user can receive.
+const (
+	NotificationCommentReply   = "comment_reply"
+	NotificationReply          = "reply"
+	NotificationMention        = "mention"
+	NotificationModAction      = "mod_action"
+	NotificationModeratorAdded = "moderator_added"
+	NotificationVoteMilestone  = "vote_milestone"
+	NotificationModmail        = "modmail"
+	NotificationPollClosed     = "poll_closed"
+)
+
+type Notification struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index:idx_notification_inbox"`
+	Type      string     `gorm:"type:varchar(32);not null"`
+	ActorID   *uuid.UUID `gorm:"type:uuid"`
+	Actor     *User      `gorm:"foreignKey:ActorID"`
+	GroupID   *uuid.UUID `gorm:"type:uuid"`
+	PostID    *uuid.UUID `gorm:"type:uuid"`
+	CommentID *uuid.UUID `gorm:"type:uuid"`
+	Message   string     `gorm:"type:text"`
+	Read      bool       `gorm:"not null;default:false"`
+	CreatedAt time.Time  `gorm:"not null;index:idx_notification_inbox"`
+}
+
+// A vote milestone already announced for a post or comment, so that a score that drops
+// and climbs back over the threshold does not notify the author again.
+type VoteMilestone struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	PostID    uuid.UUID  `gorm:"type:uuid;not null;index;uniqueIndex:idx_vote_milestone_post,where:comment_id IS NULL"`
+	CommentID *uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_vote_milestone_comment,where:comment_id IS NOT NULL"`
+	Milestone int        `gorm:"not null;uniqueIndex:idx_vote_milestone_post,where:comment_id IS NULL;uniqueIndex:idx_vote_milestone_comment,where:comment_id IS NOT NULL"`
+	CreatedAt time.Time  `gorm:"not null"`
+}
+
+// Notification types are enabled unless the user has stored a preference saying otherwise.
+type NotificationPreference struct {
+	UserID  uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Type    string    `gorm:"type:varchar(32);primaryKey"`
+	Enabled bool      `gorm:"not null"`
+}
+
+// Link preview states.
+const (
+	PreviewPending = "pending"
+	PreviewReady   = "ready"
+	PreviewFailed  = "failed"
+)
+
+// Unfurled metadata for a URL, cached per canonical URL and shared by every post linking to it.
+type LinkPreview struct {
+	ID           uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	CanonicalURL string     `gorm:"type:text;not null;uniqueIndex"`
+	URL          string     `gorm:"type:text;not null"`
+	Status       string     `gorm:"type:varchar(16);not null;default:'pending'"`
+	Title        string     `gorm:"type:varchar(300)"`
+	Description  string     `gorm:"type:text"`
+	SiteName     string     `gorm:"type:varchar(128)"`
+	// The page's image as published. Clients get the copy stored under ImageKey instead.
+	ImageURL     string     `gorm:"type:text"`
+	ImageKey     string     `gorm:"type:text;not null;default:''"`
+	Type         string     `gorm:"type:varchar(32)"`
+	Error        string     `gorm:"type:text"`
+	FetchedAt    *time.Time
+	// Set while a worker fetches the page. A claim left by a worker that crashed expires at this time.
+	FetchingUntil *time.Time
+	CreatedAt    time.Time  `gorm:"not null"`
+}
+
+// Media upload states.
+const (
+	MediaUploading = "uploading"
+	MediaReady     = "ready"
+)
+
+// An uploaded file. A resumable upload stays in the uploading state, with Received bytes
+// staged on the server, until all Size bytes have arrived.
+type Media struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	OwnerID     uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Status      string     `gorm:"type:varchar(16);not null;default:'uploading'"`
+	ContentType string     `gorm:"type:varchar(64)"`
+	Size        int64      `gorm:"not null"`
+	Received    int64      `gorm:"not null;default:0"`
+	StorageKey  string     `gorm:"type:text"`
+	Filename    string     `gorm:"type:varchar(255)"`
+	CreatedAt   time.Time  `gorm:"not null"`
+	CompletedAt *time.Time
+	// Filled in by image processing; dimensions are as displayed, after EXIF orientation.
+	Width            int
+	Height           int
+	Blurhash         string     `gorm:"type:varchar(64)"`
+	ProcessingStatus string     `gorm:"type:varchar(16);not null;default:''"`
+	ProcessingError  string     `gorm:"type:text"`
+	ProcessingAt     *time.Time
+	// Perceptual hashes of images, stored as the bit pattern of the unsigned 64-bit hash.
+	PHash *int64
+	DHash *int64
+}
+
+// Image processing states. Media that is not processed, such as video, has an empty state.
+const (
+	MediaProcessingPending = "pending"
+	MediaProcessingDone    = "done"
+	MediaProcessingFailed  = "failed"
+)
+
+// A resized copy of an image in one format.
+type MediaVariant struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	MediaID     uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_media_variant"`
+	Name        string    `gorm:"type:varchar(16);not null;uniqueIndex:idx_media_variant"`
+	Format      string    `gorm:"type:varchar(8);not null;uniqueIndex:idx_media_variant"`
+	ContentType string    `gorm:"type:varchar(64);not null"`
+	Width       int       `gorm:"not null"`
+	Height      int       `gorm:"not null"`
+	Size        int64     `gorm:"not null"`
+	StorageKey  string    `gorm:"type:text;not null"`
+}
+
+// An image banned in a group, or site-wide when GroupID is nil. Posts with a near-identical
+// image are rejected or held for review.
+type BannedImage struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	GroupID    *uuid.UUID `gorm:"type:uuid;index"`
+	PHash      int64      `gorm:"not null"`
+	DHash      int64      `gorm:"not null"`
+	MediaID    *uuid.UUID `gorm:"type:uuid"`
+	PostID     *uuid.UUID `gorm:"type:uuid;index"`
+	BannedByID uuid.UUID  `gorm:"type:uuid;not null"`
+	Reason     string     `gorm:"type:text"`
+	CreatedAt  time.Time  `gorm:"not null"`
+}
+
+// A stored version of a post or comment. Revision 1 is the original, saved on the first edit;
+// every edit adds the new version. Comment revisions also carry the post ID.
+type ContentRevision struct {
+	ID        uuid.UUID      `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	PostID    uuid.UUID      `gorm:"type:uuid;not null;index"`
+	CommentID *uuid.UUID     `gorm:"type:uuid;index"`
+	Number    int            `gorm:"not null"`
+	EditorID  uuid.UUID      `gorm:"type:uuid;not null"`
+	Editor    User           `gorm:"foreignKey:EditorID"`
+	Content   string         `gorm:"type:text;not null"`
+	MediaUrls pq.StringArray `gorm:"type:text[]"`
+	CreatedAt time.Time      `gorm:"not null"`
+}
+
+// Media attached to a post, in display order.
+type PostMedia struct {
+	PostID   uuid.UUID `gorm:"type:uuid;primaryKey"`
+	MediaID  uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	Position int       `gorm:"not null"`
+}
+
+// The poll of a poll post. ClosedAt is set once the poll has closed and its notifications are sent.
+type Poll struct {
+	PostID         uuid.UUID `gorm:"type:uuid;primaryKey"`
+	MultipleChoice bool      `gorm:"not null;default:false"`
+	ClosesAt       time.Time `gorm:"not null;index"`
+	Voters         int       `gorm:"not null;default:0"`
+	ClosedAt       *time.Time
+}
+
+type PollOption struct {
+	ID       uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	PostID   uuid.UUID `gorm:"type:uuid;not null;index"`
+	Position int       `gorm:"not null"`
+	Text     string    `gorm:"type:varchar(200);not null"`
+	Votes    int       `gorm:"not null;default:0"`
+}
+
+// A user's ballot in a poll. Each user votes once; the chosen options are stored as PollVote rows.
+type PollBallot struct {
+	PostID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+type PollVote struct {
+	PostID   uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID   uuid.UUID `gorm:"type:uuid;primaryKey"`
+	OptionID uuid.UUID `gorm:"type:uuid;primaryKey"`
+}
+
+// A named collection of saved posts and comments.
+type SavedCollection struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_saved_collection_name"`
+	Name      string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_saved_collection_name"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// Kinds of saved items.
+const (
+	SavedPost    = "post"
+	SavedComment = "comment"
+)
+
+// A post or comment saved by a user. A saved comment also carries its post ID, and an item
+// belongs to at most one collection.
+type SavedItem struct {
+	ID           uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	UserID       uuid.UUID  `gorm:"type:uuid;not null;index:idx_saved_item_page;uniqueIndex:idx_saved_post,where:comment_id IS NULL;uniqueIndex:idx_saved_comment,where:comment_id IS NOT NULL"`
+	PostID       uuid.UUID  `gorm:"type:uuid;not null;index;uniqueIndex:idx_saved_post,where:comment_id IS NULL"`
+	CommentID    *uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_saved_comment,where:comment_id IS NOT NULL"`
+	CollectionID *uuid.UUID `gorm:"type:uuid;index"`
+	CreatedAt    time.Time  `gorm:"not null;index:idx_saved_item_page"`
+}
+
+// A post the user hid from every feed.
+type HiddenPost struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	PostID    uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// A group whose posts the user does not see in the home and global feeds.
+type MutedGroup struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	GroupID   uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	Group     Group     `gorm:"foreignKey:GroupID"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// A user whose posts the muting user does not see in feeds.
+type MutedUser struct {
+	UserID      uuid.UUID `gorm:"type:uuid;primaryKey"`
+	MutedUserID uuid.UUID `gorm:"type:uuid;primaryKey;index"`
+	MutedUser   User      `gorm:"foreignKey:MutedUserID"`
+	CreatedAt   time.Time `gorm:"not null"`
+}
+
+// A keyword hiding posts whose title or text contains it, ignoring case.
+type ContentFilter struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_content_filter_keyword"`
+	Keyword   string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_content_filter_keyword"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+type SpamToken struct {
+	Token     string `gorm:"type:varchar(64);primaryKey"`
+	SpamCount int64  `gorm:"not null;default:0"`
+	HamCount  int64  `gorm:"not null;default:0"`
+}
+
+// The last moderator decision the spam classifier learned for a post or comment, with the text
+// it learned, so that a repeated decision is skipped and a reversed one replaces the old one.
+type SpamDecision struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	PostID    uuid.UUID  `gorm:"type:uuid;not null;index;uniqueIndex:idx_spam_decision_post,where:comment_id IS NULL"`
+	CommentID *uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_spam_decision_comment,where:comment_id IS NOT NULL"`
+	Spam      bool       `gorm:"not null"`
+	Content   string     `gorm:"type:text;not null"`
+	UpdatedAt time.Time  `gorm:"not null"`
+}
+
+type SpamModelStats struct {
+	ID        int   `gorm:"primaryKey"`
+	SpamDocs  int64 `gorm:"not null;default:0"`
+	HamDocs   int64 `gorm:"not null;default:0"`
+	UpdatedAt time.Time
+}
+
 func InitDB() *gorm.DB {
 	dsn := 
 		"host=localhost user=chirp_user password=chirp_password dbname=chirp_db port=5432 sslmode=disable"
 	
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// Foreign keys are managed by migrateForeignKeys with explicit delete policies.
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{DisableForeignKeyConstraintWhenMigrating: true})
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -93,10 +693,56 @@ func InitDB() *gorm.DB {
 		&Group{},
 		&GroupUser{},
 		&GroupModerator{},
+		&ModAction{},
+		&GroupBan{},
+		&Report{},
+		&AutoModRule{},
+		&AutoModHit{},
+		&SpamToken{},
+		&SpamModelStats{},
+		&SpamDecision{},
+		&GroupRule{},
+		&PostFlair{},
+		&UserFlairTemplate{},
+		&WikiPage{},
+		&WikiRevision{},
+		&WikiContributor{},
+		&ModmailThread{},
+		&ModmailMessage{},
+		&UserBlock{},
+		&Conversation{},
+		&ConversationMember{},
+		&DirectMessage{},
+		&Notification{},
+		&NotificationPreference{},
+		&VoteMilestone{},
+		&ContentReference{},
+		&LinkPreview{},
+		&Media{},
+		&PostMedia{},
+		&MediaVariant{},
+		&BannedImage{},
+		&Poll{},
+		&PollOption{},
+		&PollBallot{},
+		&PollVote{},
+		&ContentRevision{},
+		&SavedCollection{},
+		&SavedItem{},
+		&HiddenPost{},
+		&MutedGroup{},
+		&MutedUser{},
+		&ContentFilter{},
 	)
 	if err != nil {
 		log.Fatal("Migration failed:", err)
 	}
 
+	unvalidated, err := migrateForeignKeys(db)
+	if err != nil {
+		log.Fatal("Foreign key migration failed:", err)
+	}
+	reportUnvalidatedForeignKeys(unvalidated)
+
 	return db
 }
@@ -0,0 +1,293 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+// Пропускает только администраторов. Должен вызываться после JWTMiddleware.
+func AdminMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("userId")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+			c.Abort()
+			return
+		}
+
+		adminID, ok := userID.(uuid.UUID)
+		if !ok || !isAdmin(db, adminID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Administrator privileges are required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Проверяет, является ли пользователь администратором.
+func isAdmin(db *gorm.DB, userID uuid.UUID) bool {
+	var count int64
+	db.Model(&models.User{}).Where("id = ? AND is_admin = ?", userID, true).Count(&count)
+	return count > 0
+}
+
+// Выдаёт права администратора аккаунтам из переменной окружения ADMIN_EMAILS (адреса через запятую).
+// Вызывается при запуске, поэтому аккаунт нужно зарегистрировать до перезапуска сервера. Удаление адреса
+// из списка права не отзывает: их снимают в базе данных.
+func grantConfiguredAdmins(db *gorm.DB) {
+	var emails []string
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			emails = append(emails, email)
+		}
+	}
+	if len(emails) == 0 {
+		return
+	}
+
+	result := db.Model(&models.User{}).Where("email IN ? AND is_admin = ?", emails, false).Update("is_admin", true)
+	if result.Error != nil {
+		log.Fatal("Failed to grant administrator privileges: ", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Granted administrator privileges to %d accounts from ADMIN_EMAILS", result.RowsAffected)
+	}
+}
+
+// @Summary Заблокировать аккаунт
+// @Description Блокирует вход и любые изменения от имени пользователя. Без длительности блокировка бессрочная
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID пользователя"
+// @Param data body routes.SuspendUserDTO true "Причина и длительность"
+// @Success 200 {object} routes.UserSanctionDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/users/{id}/suspension [post]
+func suspendUserHandler(c *gin.Context, db *gorm.DB) {
+	var req SuspendUserDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if adminID := optionalUserID(c); adminID != nil && *adminID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot suspend yourself"})
+		return
+	}
+
+	user.Suspended = true
+	user.SuspensionReason = req.Reason
+	user.SuspendedUntil = nil
+	if req.DurationHours != nil {
+		suspendedUntil := time.Now().Add(time.Duration(*req.DurationHours) * time.Hour)
+		user.SuspendedUntil = &suspendedUntil
+	}
+
+	if err := db.Model(&user).Select("suspended", "suspension_reason", "suspended_until").Updates(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to suspend user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toUserSanctionDTO(user))
+}
+
+// @Summary Разблокировать аккаунт
+// @Description Снимает блокировку аккаунта
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID пользователя"
+// @Success 200 {object} routes.UserSanctionDTO
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/users/{id}/suspension [delete]
+func unsuspendUserHandler(c *gin.Context, db *gorm.DB) {
+	var user models.User
+	if err := db.First(&user, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	user.Suspended = false
+	user.SuspensionReason = ""
+	user.SuspendedUntil = nil
+	if err := db.Model(&user).Select("suspended", "suspension_reason", "suspended_until").Updates(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lift suspension"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toUserSanctionDTO(user))
+}
+
+// @Summary Выдать теневой бан
+// @Description Скрывает контент пользователя от всех, кроме него самого
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID пользователя"
+// @Success 200 {object} routes.UserSanctionDTO
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/users/{id}/shadowban [post]
+func shadowBanUserHandler(c *gin.Context, db *gorm.DB) {
+	setShadowBan(c, db, true)
+}
+
+// @Summary Снять теневой бан
+// @Description Возвращает контент пользователя в общие ленты
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID пользователя"
+// @Success 200 {object} routes.UserSanctionDTO
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/users/{id}/shadowban [delete]
+func unshadowBanUserHandler(c *gin.Context, db *gorm.DB) {
+	setShadowBan(c, db, false)
+}
+
+func setShadowBan(c *gin.Context, db *gorm.DB, shadowBanned bool) {
+	var user models.User
+	if err := db.First(&user, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	user.ShadowBanned = shadowBanned
+	if err := db.Model(&user).Update("shadow_banned", shadowBanned).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update shadowban"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toUserSanctionDTO(user))
+}
+
+// @Summary Получить список ограниченных аккаунтов
+// @Description Возвращает заблокированных пользователей и пользователей с теневым баном
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param state query string false "Фильтр (suspended|shadowbanned)"
+// @Success 200 {array} routes.UserSanctionDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /admin/users/sanctions [get]
+func listUserSanctionsHandler(c *gin.Context, db *gorm.DB) {
+	activeSuspension := "suspended = true AND (suspended_until IS NULL OR suspended_until > ?)"
+	query := db.Model(&models.User{})
+	switch c.Query("state") {
+	case "":
+		query = query.Where("("+activeSuspension+") OR shadow_banned = true", time.Now())
+	case "suspended":
+		query = query.Where(activeSuspension, time.Now())
+	case "shadowbanned":
+		query = query.Where("shadow_banned = true")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state filter"})
+		return
+	}
+
+	var users []models.User
+	if err := query.Order("nickname ASC").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+
+	sanctions := make([]UserSanctionDTO, len(users))
+	for i, user := range users {
+		sanctions[i] = toUserSanctionDTO(user)
+	}
+
+	c.JSON(http.StatusOK, sanctions)
+}
+
+func toUserSanctionDTO(user models.User) UserSanctionDTO {
+	return UserSanctionDTO{
+		ID:               user.ID,
+		Nickname:         user.Nickname,
+		Email:            user.Email,
+		Suspended:        user.IsSuspended(time.Now()),
+		SuspendedUntil:   user.SuspendedUntil,
+		SuspensionReason: user.SuspensionReason,
+		ShadowBanned:     user.ShadowBanned,
+	}
+}
+
+func RegisterAdminRoutes(r *gin.RouterGroup, db *gorm.DB) {
+	r.Use(JWTMiddleware(), AdminMiddleware(db))
+
+	r.POST("/spam/retrain", func(c *gin.Context) {
+		retrainSpamHandler(c, db)
+	})
+
+	r.GET("/spam/tokens", func(c *gin.Context) {
+		listSpamTokensHandler(c, db)
+	})
+
+	r.GET("/banned-images", func(c *gin.Context) {
+		listSiteBannedImagesHandler(c, db)
+	})
+
+	r.POST("/banned-images", func(c *gin.Context) {
+		banSiteImageHandler(c, db)
+	})
+
+	r.DELETE("/banned-images/:id", func(c *gin.Context) {
+		unbanSiteImageHandler(c, db)
+	})
+
+	r.GET("/users/sanctions", func(c *gin.Context) {
+		listUserSanctionsHandler(c, db)
+	})
+
+	r.DELETE("/users/:id", func(c *gin.Context) {
+		deleteUserHandler(c, db)
+	})
+
+	r.POST("/users/:id/restore", func(c *gin.Context) {
+		restoreUserHandler(c, db)
+	})
+
+	r.POST("/users/:id/suspension", func(c *gin.Context) {
+		suspendUserHandler(c, db)
+	})
+
+	r.DELETE("/users/:id/suspension", func(c *gin.Context) {
+		unsuspendUserHandler(c, db)
+	})
+
+	r.POST("/users/:id/shadowban", func(c *gin.Context) {
+		shadowBanUserHandler(c, db)
+	})
+
+	r.DELETE("/users/:id/shadowban", func(c *gin.Context) {
+		unshadowBanUserHandler(c, db)
+	})
+}
@@ -29,6 +29,10 @@ func registerHandler(c *gin.Context, db *gorm.DB) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
 		return
 	}
+	if isReservedNickname(req.Nickname) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This nickname is reserved"})
+		return
+	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -59,7 +63,7 @@ func registerHandler(c *gin.Context, db *gorm.DB) {
 }
 
 // @Summary Вход пользователя
-// @Description Аутентификация пользователя и выдача JWT
+// @Description Аутентификация пользователя и выдача JWT. Вход в удалённый владельцем аккаунт в течение SELF_RESTORE_WINDOW восстанавливает его
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -67,6 +71,7 @@ func registerHandler(c *gin.Context, db *gorm.DB) {
 // @Success 200 {object} routes.LoginResponse
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Router /auth/login [post]
 func loginHandler(c *gin.Context, db *gorm.DB) {
 	var req LoginRequest
@@ -76,7 +81,7 @@ func loginHandler(c *gin.Context, db *gorm.DB) {
 	}
 
 	var user models.User
-	if err := db.Where("email = ?", req.Email).First(&user).Error; err != nil {
+	if err := db.Unscoped().Where("email = ?", req.Email).First(&user).Error; err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
@@ -86,6 +91,23 @@ func loginHandler(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	// Signing in to an account its owner deleted restores it while the restore window is open.
+	if user.DeletedAt.Valid {
+		if !canSelfRestore(user.DeletedAt, user.DeletedByID, user.ID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This account has been deleted"})
+			return
+		}
+		if err := restoreDeleted(db, &models.User{}, user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore account"})
+			return
+		}
+	}
+
+	if user.IsSuspended(time.Now()) {
+		c.JSON(http.StatusForbidden, suspensionError(user))
+		return
+	}
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"userId": user.ID,
 		"exp":    time.Now().Add(time.Hour * 24).Unix(),
@@ -0,0 +1,912 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"chirp/models"
+)
+
+const autoModeratorNickname = "AutoModerator"
+
+// Никнейм системного пользователя нельзя занять при регистрации или смене профиля.
+func isReservedNickname(nickname string) bool {
+	return strings.EqualFold(strings.TrimSpace(nickname), autoModeratorNickname)
+}
+
+var linkPattern = regexp.MustCompile(`https?://[^\s<>()\[\]]+`)
+
+// Описание правила автомодерации. Правила хранятся в YAML, JSON также поддерживается.
+type autoModSpec struct {
+	Type         string     `yaml:"type"`
+	ContentRegex stringList `yaml:"content_regex"`
+	Author       struct {
+		AccountAgeDays string `yaml:"account_age_days"`
+		Reputation     string `yaml:"reputation"`
+	} `yaml:"author"`
+	MediaDomains stringList `yaml:"media_domains"`
+	LinkCount    string     `yaml:"link_count"`
+	Action       string     `yaml:"action"`
+	ActionReason string     `yaml:"action_reason"`
+	SetFlair     string     `yaml:"set_flair"`
+	Comment      string     `yaml:"comment"`
+}
+
+// Список строк, который в правиле можно задать и одним значением.
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = stringList{node.Value}
+		return nil
+	}
+	var values []string
+	if err := node.Decode(&values); err != nil {
+		return err
+	}
+	*l = values
+	return nil
+}
+
+// Условие сравнения вида "< 7" или ">= 100".
+type comparison struct {
+	op    string
+	value int
+}
+
+func parseComparison(expr string) (*comparison, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, nil
+	}
+	for _, op := range []string{"<=", ">=", "==", "<", ">"} {
+		if strings.HasPrefix(expr, op) {
+			value, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(expr, op)))
+			if err != nil {
+				return nil, fmt.Errorf("invalid number in %q", expr)
+			}
+			return &comparison{op: op, value: value}, nil
+		}
+	}
+	return nil, fmt.Errorf("comparison %q must start with one of <, <=, >, >=, ==", expr)
+}
+
+func (cmp *comparison) matches(value int) bool {
+	switch cmp.op {
+	case "<":
+		return value < cmp.value
+	case "<=":
+		return value <= cmp.value
+	case ">":
+		return value > cmp.value
+	case ">=":
+		return value >= cmp.value
+	default:
+		return value == cmp.value
+	}
+}
+
+type compiledAutoModRule struct {
+	spec       autoModSpec
+	regexes    []*regexp.Regexp
+	accountAge *comparison
+	reputation *comparison
+	linkCount  *comparison
+}
+
+// Разбирает и проверяет исходный текст правила.
+func compileAutoModRule(source string) (*compiledAutoModRule, error) {
+	var spec autoModSpec
+	decoder := yaml.NewDecoder(strings.NewReader(source))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("invalid rule: %v", err)
+	}
+
+	switch spec.Type {
+	case "", "any", "post", "comment":
+	default:
+		return nil, errors.New("type must be one of post, comment, any")
+	}
+	switch spec.Action {
+	case "", "remove", "filter", "report":
+	default:
+		return nil, errors.New("action must be one of remove, filter, report")
+	}
+	if spec.Action == "" && spec.SetFlair == "" && spec.Comment == "" {
+		return nil, errors.New("rule must define action, set_flair or comment")
+	}
+
+	rule := &compiledAutoModRule{spec: spec}
+	for _, pattern := range spec.ContentRegex {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content_regex %q: %v", pattern, err)
+		}
+		rule.regexes = append(rule.regexes, re)
+	}
+
+	var err error
+	if rule.accountAge, err = parseComparison(spec.Author.AccountAgeDays); err != nil {
+		return nil, fmt.Errorf("author.account_age_days: %v", err)
+	}
+	if rule.reputation, err = parseComparison(spec.Author.Reputation); err != nil {
+		return nil, fmt.Errorf("author.reputation: %v", err)
+	}
+	if rule.linkCount, err = parseComparison(spec.LinkCount); err != nil {
+		return nil, fmt.Errorf("link_count: %v", err)
+	}
+
+	if len(rule.regexes) == 0 && rule.accountAge == nil && rule.reputation == nil &&
+		rule.linkCount == nil && len(spec.MediaDomains) == 0 {
+		return nil, errors.New("rule must define at least one condition")
+	}
+
+	return rule, nil
+}
+
+// Контент, который проверяется правилами автомодерации.
+type autoModItem struct {
+	Kind      string
+	Content   string
+	MediaUrls []string
+	Author    models.User
+}
+
+// Проверяет, выполняются ли все условия правила для контента.
+func (rule *compiledAutoModRule) matches(item autoModItem, now time.Time) bool {
+	if rule.spec.Type != "" && rule.spec.Type != "any" && rule.spec.Type != item.Kind {
+		return false
+	}
+
+	for _, re := range rule.regexes {
+		if !re.MatchString(item.Content) {
+			return false
+		}
+	}
+
+	if rule.accountAge != nil {
+		ageDays := int(now.Sub(item.Author.RegisteredAt).Hours() / 24)
+		if !rule.accountAge.matches(ageDays) {
+			return false
+		}
+	}
+
+	if rule.reputation != nil {
+		if !rule.reputation.matches(item.Author.ReputationPosts + item.Author.ReputationComments) {
+			return false
+		}
+	}
+
+	links := linkPattern.FindAllString(item.Content, -1)
+	if rule.linkCount != nil && !rule.linkCount.matches(len(links)) {
+		return false
+	}
+
+	if len(rule.spec.MediaDomains) > 0 {
+		urls := append(append([]string{}, item.MediaUrls...), links...)
+		if !anyURLInDomains(urls, rule.spec.MediaDomains) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func anyURLInDomains(urls []string, domains []string) bool {
+	for _, rawURL := range urls {
+		parsed, err := url.Parse(rawURL)
+		if err != nil {
+			continue
+		}
+		host := strings.ToLower(parsed.Hostname())
+		for _, domain := range domains {
+			domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Сработавшее правило автомодерации.
+type autoModMatch struct {
+	Rule models.AutoModRule
+	Spec autoModSpec
+}
+
+// Возвращает включённые правила группы, сработавшие для контента.
+func evaluateAutoMod(db *gorm.DB, groupID uuid.UUID, item autoModItem) ([]autoModMatch, error) {
+	var rules []models.AutoModRule
+	if err := db.Where("group_id = ? AND enabled = ?", groupID, true).
+		Order("position ASC, created_at ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var matches []autoModMatch
+	for _, rule := range rules {
+		compiled, err := compileAutoModRule(rule.Source)
+		if err != nil {
+			// Rules are validated on save, so a broken rule is skipped instead of blocking posting.
+			continue
+		}
+		if compiled.matches(item, now) {
+			matches = append(matches, autoModMatch{Rule: rule, Spec: compiled.spec})
+		}
+	}
+	return matches, nil
+}
+
+// Цель, к которой применяются действия автомодерации.
+type autoModTarget struct {
+	GroupID   uuid.UUID
+	PostID    uuid.UUID
+	CommentID *uuid.UUID
+}
+
+// Применяет действия сработавших правил и возвращает новый статус модерации контента.
+func applyAutoMod(tx *gorm.DB, target autoModTarget, currentStatus string, matches []autoModMatch) (string, error) {
+	if len(matches) == 0 {
+		return currentStatus, nil
+	}
+
+	bot, err := autoModeratorUser(tx)
+	if err != nil {
+		return currentStatus, err
+	}
+
+	now := time.Now()
+	status := currentStatus
+	for _, match := range matches {
+		reason := match.Spec.ActionReason
+		if reason == "" {
+			reason = "AutoModerator: " + match.Rule.Name
+		}
+
+		// Edits run the rules again; reports, replies and hit counts apply to the first match only.
+		firstHit, err := recordAutoModHit(tx, match.Rule.ID, target, now)
+		if err != nil {
+			return currentStatus, err
+		}
+
+		switch match.Spec.Action {
+		case "remove":
+			status = models.ContentRemoved
+		case "filter":
+			if status != models.ContentRemoved {
+				status = models.ContentFiltered
+			}
+		case "report":
+			if !firstHit {
+				break
+			}
+			report := models.Report{
+				GroupID:   &target.GroupID,
+				PostID:    &target.PostID,
+				CommentID: target.CommentID,
+				Reason:    reason,
+				CreatedAt: now,
+			}
+			if err := tx.Create(&report).Error; err != nil {
+				return currentStatus, err
+			}
+		}
+
+		if match.Spec.SetFlair != "" && target.CommentID == nil {
+			// A flair defined by the group is linked by its text so that flair filters see the post.
+			var flairID *uuid.UUID
+			var flair models.PostFlair
+			if err := tx.Where("group_id = ? AND text = ?", target.GroupID, match.Spec.SetFlair).First(&flair).Error; err == nil {
+				flairID = &flair.ID
+			}
+			if err := tx.Model(&models.Post{}).Where("id = ?", target.PostID).Updates(map[string]interface{}{
+				"flair_id":   flairID,
+				"flair_text": match.Spec.SetFlair,
+			}).Error; err != nil {
+				return currentStatus, err
+			}
+		}
+
+		if !firstHit {
+			continue
+		}
+
+		if match.Spec.Comment != "" {
+			reply := models.Comment{
+				PostID:    target.PostID,
+				AuthorID:  bot.ID,
+				Content:   match.Spec.Comment,
+				IsReply:   target.CommentID != nil,
+				ReplyToID: target.CommentID,
+				CreatedAt: now,
+			}
+			if err := tx.Create(&reply).Error; err != nil {
+				return currentStatus, err
+			}
+		}
+
+		if err := tx.Model(&models.AutoModRule{}).Where("id = ?", match.Rule.ID).Updates(map[string]interface{}{
+			"hit_count":   gorm.Expr("hit_count + 1"),
+			"last_hit_at": now,
+		}).Error; err != nil {
+			return currentStatus, err
+		}
+	}
+
+	if status == currentStatus {
+		return status, nil
+	}
+
+	action := autoModActionName(status, target.CommentID != nil)
+	targetType, targetID := "post", target.PostID
+	if target.CommentID != nil {
+		targetType, targetID = "comment", *target.CommentID
+	}
+	err = recordModAction(tx, models.ModAction{
+		GroupID:     target.GroupID,
+		ModeratorID: bot.ID,
+		Action:      action,
+		TargetType:  targetType,
+		TargetID:    &targetID,
+		Reason:      "AutoModerator: " + matchedRuleNames(matches),
+	}, gin.H{"modStatus": currentStatus}, gin.H{"modStatus": status})
+	return status, err
+}
+
+func autoModActionName(status string, isComment bool) string {
+	switch {
+	case status == models.ContentRemoved && isComment:
+		return models.ModActionRemoveComment
+	case status == models.ContentRemoved:
+		return models.ModActionRemovePost
+	case isComment:
+		return models.ModActionFilterComment
+	default:
+		return models.ModActionFilterPost
+	}
+}
+
+func matchedRuleNames(matches []autoModMatch) string {
+	names := make([]string, len(matches))
+	for i, match := range matches {
+		names[i] = match.Rule.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// Запоминает срабатывание правила на контенте. Возвращает false, если правило уже срабатывало на нём.
+func recordAutoModHit(tx *gorm.DB, ruleID uuid.UUID, target autoModTarget, now time.Time) (bool, error) {
+	// Hits on posts and hits on comments have separate partial unique indexes.
+	conflict := clause.OnConflict{
+		Columns:     []clause.Column{{Name: "rule_id"}, {Name: "post_id"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "comment_id IS NULL"}}},
+		DoNothing:   true,
+	}
+	if target.CommentID != nil {
+		conflict.Columns = []clause.Column{{Name: "rule_id"}, {Name: "comment_id"}}
+		conflict.TargetWhere = clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "comment_id IS NOT NULL"}}}
+	}
+
+	result := tx.Clauses(conflict).Create(&models.AutoModHit{
+		RuleID:    ruleID,
+		PostID:    target.PostID,
+		CommentID: target.CommentID,
+		CreatedAt: now,
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Находит системного пользователя, от имени которого действует автомодератор.
+// Пользователь определяется флагом IsSystem, а не никнеймом, который мог занять кто-то другой.
+func findAutoModeratorUser(db *gorm.DB) (models.User, error) {
+	var bot models.User
+	err := db.Where("is_system = ? AND nickname = ?", true, autoModeratorNickname).First(&bot).Error
+	return bot, err
+}
+
+// Как findAutoModeratorUser, но создаёт пользователя при первом срабатывании правила.
+func autoModeratorUser(db *gorm.DB) (models.User, error) {
+	bot, err := findAutoModeratorUser(db)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return bot, err
+	}
+
+	bot = models.User{
+		Nickname:     autoModeratorNickname,
+		Email:        "automoderator@chirp.local",
+		PasswordHash: "!",
+		RegisteredAt: time.Now(),
+		IsSystem:     true,
+	}
+	return bot, db.Create(&bot).Error
+}
+
+// Проверяет пост правилами группы и применяет действия. Вызывается при создании и изменении поста.
+func runAutoModForPost(tx *gorm.DB, post *models.Post) error {
+	if post.GroupID == nil {
+		return nil
+	}
+
+	var author models.User
+	if err := tx.First(&author, "id = ?", post.AuthorID).Error; err != nil {
+		return err
+	}
+
+	matches, err := evaluateAutoMod(tx, *post.GroupID, autoModItem{
+		Kind:      "post",
+		Content:   post.Title + "\n\n" + post.Content + "\n\n" + post.URL,
+		MediaUrls: post.MediaUrls,
+		Author:    author,
+	})
+	if err != nil {
+		return err
+	}
+
+	status, err := applyAutoMod(tx, autoModTarget{GroupID: *post.GroupID, PostID: post.ID}, post.ModStatus, matches)
+	if err != nil {
+		return err
+	}
+	if status != post.ModStatus {
+		if err := tx.Model(post).Update("mod_status", status).Error; err != nil {
+			return err
+		}
+	}
+	return tx.First(post, "id = ?", post.ID).Error
+}
+
+// Проверяет комментарий правилами группы поста и применяет действия.
+func runAutoModForComment(tx *gorm.DB, post models.Post, comment *models.Comment) error {
+	if post.GroupID == nil {
+		return nil
+	}
+
+	var author models.User
+	if err := tx.First(&author, "id = ?", comment.AuthorID).Error; err != nil {
+		return err
+	}
+	if author.IsSystem {
+		return nil
+	}
+
+	matches, err := evaluateAutoMod(tx, *post.GroupID, autoModItem{
+		Kind:    "comment",
+		Content: comment.Content,
+		Author:  author,
+	})
+	if err != nil {
+		return err
+	}
+
+	target := autoModTarget{GroupID: *post.GroupID, PostID: post.ID, CommentID: &comment.ID}
+	status, err := applyAutoMod(tx, target, comment.ModStatus, matches)
+	if err != nil {
+		return err
+	}
+	if status != comment.ModStatus {
+		if err := tx.Model(comment).Update("mod_status", status).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// @Summary Получить правила автомодерации
+// @Description Возвращает правила автомодерации группы со статистикой срабатываний
+// @Tags automod
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID группы"
+// @Success 200 {array} routes.AutoModRuleDTO
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/automod [get]
+func listAutoModRulesHandler(c *gin.Context, db *gorm.DB) {
+	groupID := c.Param("id")
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	moderatorID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var group models.Group
+	if err := db.First(&group, "id = ?", groupID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	if !isGroupModerator(db, group.ID, moderatorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to manage rules of this group"})
+		return
+	}
+
+	var rules []models.AutoModRule
+	if err := db.Where("group_id = ?", group.ID).Order("position ASC, created_at ASC").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve rules"})
+		return
+	}
+
+	ruleDTOs := make([]AutoModRuleDTO, len(rules))
+	for i, rule := range rules {
+		ruleDTOs[i] = toAutoModRuleDTO(rule)
+	}
+
+	c.JSON(http.StatusOK, ruleDTOs)
+}
+
+// @Summary Создать правило автомодерации
+// @Description Создаёт правило автомодерации группы из YAML или JSON
+// @Tags automod
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param data body routes.AutoModRuleRequest true "Правило"
+// @Success 201 {object} routes.AutoModRuleDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/automod [post]
+func createAutoModRuleHandler(c *gin.Context, db *gorm.DB) {
+	groupID := c.Param("id")
+	var req AutoModRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	moderatorID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var group models.Group
+	if err := db.First(&group, "id = ?", groupID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	if !isGroupModerator(db, group.ID, moderatorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to manage rules of this group"})
+		return
+	}
+
+	if _, err := compileAutoModRule(req.Source); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := models.AutoModRule{
+		ID:          uuid.New(),
+		GroupID:     group.ID,
+		Name:        req.Name,
+		Source:      req.Source,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+		CreatedByID: moderatorID,
+		CreatedAt:   time.Now(),
+	}
+	if req.Position != nil {
+		rule.Position = *req.Position
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Select keeps an explicit "enabled: false" from being replaced by the column default.
+		if err := tx.Select("*").Create(&rule).Error; err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionEditAutoMod,
+			TargetType:  "automod_rule",
+			TargetID:    &rule.ID,
+		}, nil, autoModRuleSnapshot(rule))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create rule"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, toAutoModRuleDTO(rule))
+}
+
+// @Summary Обновить правило автомодерации
+// @Description Обновляет правило автомодерации группы
+// @Tags automod
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param ruleId path string true "ID правила"
+// @Param data body routes.UpdateAutoModRuleRequest true "Данные для обновления"
+// @Success 200 {object} routes.AutoModRuleDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/automod/{ruleId} [put]
+func updateAutoModRuleHandler(c *gin.Context, db *gorm.DB) {
+	groupID := c.Param("id")
+	ruleID := c.Param("ruleId")
+	var req UpdateAutoModRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	moderatorID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var rule models.AutoModRule
+	if err := db.First(&rule, "id = ? AND group_id = ?", ruleID, groupID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+
+	if !isGroupModerator(db, rule.GroupID, moderatorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to manage rules of this group"})
+		return
+	}
+
+	before := autoModRuleSnapshot(rule)
+	if req.Name != nil {
+		rule.Name = *req.Name
+	}
+	if req.Source != nil {
+		if _, err := compileAutoModRule(*req.Source); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rule.Source = *req.Source
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if req.Position != nil {
+		rule.Position = *req.Position
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&rule).Error; err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     rule.GroupID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionEditAutoMod,
+			TargetType:  "automod_rule",
+			TargetID:    &rule.ID,
+		}, before, autoModRuleSnapshot(rule))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toAutoModRuleDTO(rule))
+}
+
+// @Summary Удалить правило автомодерации
+// @Description Удаляет правило автомодерации группы
+// @Tags automod
+// @Security BearerAuth
+// @Param id path string true "ID группы"
+// @Param ruleId path string true "ID правила"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/automod/{ruleId} [delete]
+func deleteAutoModRuleHandler(c *gin.Context, db *gorm.DB) {
+	groupID := c.Param("id")
+	ruleID := c.Param("ruleId")
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	moderatorID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var rule models.AutoModRule
+	if err := db.First(&rule, "id = ? AND group_id = ?", ruleID, groupID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+
+	if !isGroupModerator(db, rule.GroupID, moderatorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to manage rules of this group"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&rule).Error; err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     rule.GroupID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionEditAutoMod,
+			TargetType:  "automod_rule",
+			TargetID:    &rule.ID,
+		}, autoModRuleSnapshot(rule), nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete rule"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Проверить правила автомодерации
+// @Description Проверяет пример контента правилом из запроса или сохранёнными правилами группы без применения действий
+// @Tags automod
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param data body routes.AutoModTestRequest true "Пример контента"
+// @Success 200 {object} routes.AutoModTestResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/automod/test [post]
+func testAutoModHandler(c *gin.Context, db *gorm.DB) {
+	groupID := c.Param("id")
+	var req AutoModTestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	moderatorID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var group models.Group
+	if err := db.First(&group, "id = ?", groupID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	if !isGroupModerator(db, group.ID, moderatorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to manage rules of this group"})
+		return
+	}
+
+	authorID := moderatorID
+	if req.AuthorID != nil {
+		authorID = *req.AuthorID
+	}
+	var author models.User
+	if err := db.First(&author, "id = ?", authorID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Author not found"})
+		return
+	}
+
+	item := autoModItem{
+		Kind:      req.Kind,
+		Content:   req.Content,
+		MediaUrls: req.MediaUrls,
+		Author:    author,
+	}
+
+	var matches []autoModMatch
+	if req.Source != "" {
+		compiled, err := compileAutoModRule(req.Source)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if compiled.matches(item, time.Now()) {
+			matches = append(matches, autoModMatch{Rule: models.AutoModRule{Name: "test"}, Spec: compiled.spec})
+		}
+	} else {
+		var err error
+		matches, err = evaluateAutoMod(db, group.ID, item)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate rules"})
+			return
+		}
+	}
+
+	resp := AutoModTestResponse{
+		Matches:     make([]AutoModTestMatch, len(matches)),
+		FinalStatus: models.ContentVisible,
+	}
+	for i, match := range matches {
+		resp.Matches[i] = AutoModTestMatch{
+			RuleID:   match.Rule.ID,
+			Name:     match.Rule.Name,
+			Action:   match.Spec.Action,
+			SetFlair: match.Spec.SetFlair,
+			Comment:  match.Spec.Comment,
+		}
+		switch match.Spec.Action {
+		case "remove":
+			resp.FinalStatus = models.ContentRemoved
+		case "filter":
+			if resp.FinalStatus != models.ContentRemoved {
+				resp.FinalStatus = models.ContentFiltered
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func autoModRuleSnapshot(rule models.AutoModRule) gin.H {
+	return gin.H{
+		"name":     rule.Name,
+		"source":   rule.Source,
+		"enabled":  rule.Enabled,
+		"position": rule.Position,
+	}
+}
+
+func toAutoModRuleDTO(rule models.AutoModRule) AutoModRuleDTO {
+	return AutoModRuleDTO{
+		ID:        rule.ID,
+		Name:      rule.Name,
+		Source:    rule.Source,
+		Enabled:   rule.Enabled,
+		Position:  rule.Position,
+		HitCount:  rule.HitCount,
+		LastHitAt: rule.LastHitAt,
+		CreatedAt: rule.CreatedAt,
+		UpdatedAt: rule.UpdatedAt,
+	}
+}
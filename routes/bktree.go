@@ -0,0 +1,57 @@
+package routes
+
+import "chirp/models"
+
+// BK-дерево запрещённых изображений по расстоянию imageDistance. Расстояние — максимум двух расстояний
+// Хэмминга, то есть метрика, поэтому поиск в радиусе обходит только ветви, где совпадение возможно.
+type bkTree struct {
+	root *bkNode
+	size int
+}
+
+type bkNode struct {
+	ban      models.BannedImage
+	children map[int]*bkNode
+}
+
+func (t *bkTree) insert(ban models.BannedImage) {
+	t.size++
+	if t.root == nil {
+		t.root = &bkNode{ban: ban}
+		return
+	}
+	node := t.root
+	for {
+		distance := imageDistance(ban.PHash, ban.DHash, node.ban.PHash, node.ban.DHash)
+		child, ok := node.children[distance]
+		if !ok {
+			if node.children == nil {
+				node.children = map[int]*bkNode{}
+			}
+			node.children[distance] = &bkNode{ban: ban}
+			return
+		}
+		node = child
+	}
+}
+
+// Вызывает visit для каждого изображения не дальше radius от хешей pHash и dHash.
+func (t *bkTree) within(pHash, dHash int64, radius int, visit func(ban models.BannedImage, distance int)) {
+	if t.root == nil {
+		return
+	}
+	pending := []*bkNode{t.root}
+	for len(pending) > 0 {
+		node := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		distance := imageDistance(pHash, dHash, node.ban.PHash, node.ban.DHash)
+		if distance <= radius {
+			visit(node.ban, distance)
+		}
+		for childDistance, child := range node.children {
+			if childDistance >= distance-radius && childDistance <= distance+radius {
+				pending = append(pending, child)
+			}
+		}
+	}
+}
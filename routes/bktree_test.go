@@ -0,0 +1,92 @@
+package routes
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"chirp/models"
+)
+
+// Flips n distinct random bits of hash.
+func flipBits(rng *rand.Rand, hash int64, n int) int64 {
+	for _, bit := range rng.Perm(64)[:n] {
+		hash ^= 1 << bit
+	}
+	return hash
+}
+
+func TestBKTreeMatchesLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var bans []models.BannedImage
+	tree := &bkTree{}
+	// Clusters of near-duplicates among unrelated images, as in a real ban list.
+	for i := 0; i < 2000; i++ {
+		ban := models.BannedImage{ID: uuid.New(), PHash: rng.Int63(), DHash: rng.Int63()}
+		if i%4 != 0 && len(bans) > 0 {
+			base := bans[rng.Intn(len(bans))]
+			ban.PHash, ban.DHash = flipBits(rng, base.PHash, rng.Intn(12)), flipBits(rng, base.DHash, rng.Intn(12))
+		}
+		bans = append(bans, ban)
+		tree.insert(ban)
+	}
+
+	for i := 0; i < 200; i++ {
+		probe := bans[rng.Intn(len(bans))]
+		pHash, dHash := flipBits(rng, probe.PHash, rng.Intn(8)), flipBits(rng, probe.DHash, rng.Intn(8))
+		radius := rng.Intn(16)
+
+		var want, got []string
+		for _, ban := range bans {
+			if imageDistance(pHash, dHash, ban.PHash, ban.DHash) <= radius {
+				want = append(want, ban.ID.String())
+			}
+		}
+		tree.within(pHash, dHash, radius, func(ban models.BannedImage, distance int) {
+			if distance != imageDistance(pHash, dHash, ban.PHash, ban.DHash) {
+				t.Fatalf("reported distance %d for %s is wrong", distance, ban.ID)
+			}
+			got = append(got, ban.ID.String())
+		})
+		sort.Strings(want)
+		sort.Strings(got)
+		if len(got) != len(want) {
+			t.Fatalf("radius %d: tree found %d images, linear scan %d", radius, len(got), len(want))
+		}
+		for j := range want {
+			if got[j] != want[j] {
+				t.Fatalf("radius %d: tree found %v, linear scan %v", radius, got, want)
+			}
+		}
+	}
+}
+
+func TestCheckPostImagesCachesBannedImages(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	groupID := uuid.New()
+	t.Cleanup(func() {
+		resetBannedImages(nil)
+		resetBannedImages(&groupID)
+	})
+	pHash, dHash := int64(0x0f0f), int64(0x00ff)
+	media := []models.Media{{ID: uuid.New(), PHash: &pHash, DHash: &dHash}}
+	bannedQueries := func() int {
+		return len(recorder.matching(`SELECT "id","group_id","p_hash","d_hash" FROM "banned_images"`))
+	}
+
+	checkPostImages(db, &groupID, nil, media)
+	if got := bannedQueries(); got != 2 {
+		t.Fatalf("first check loaded banned images %d times, want once per scope: %v", got, recorder.statements)
+	}
+	checkPostImages(db, &groupID, nil, media)
+	if got := bannedQueries(); got != 2 {
+		t.Errorf("second check reloaded banned images (%d queries)", got)
+	}
+	resetBannedImages(&groupID)
+	checkPostImages(db, &groupID, nil, media)
+	if got := bannedQueries(); got != 3 {
+		t.Errorf("after a reset the group's bans were loaded %d more times, want 1", got-2)
+	}
+}
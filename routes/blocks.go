@@ -0,0 +1,166 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+// @Summary Получить заблокированных пользователей
+// @Description Возвращает пользователей, которых заблокировал текущий пользователь
+// @Tags users
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} routes.UserBlockDTO
+// @Failure 401 {object} map[string]string
+// @Router /users/me/blocks [get]
+func listBlockedUsersHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	var blocks []models.UserBlock
+	if err := db.Preload("Blocked").Where("blocker_id = ?", userID).Order("created_at DESC").Find(&blocks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve blocked users"})
+		return
+	}
+
+	blockDTOs := make([]UserBlockDTO, len(blocks))
+	for i, block := range blocks {
+		blockDTOs[i] = UserBlockDTO{
+			UserID:    block.BlockedID,
+			Nickname:  block.Blocked.Nickname,
+			CreatedAt: block.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, blockDTOs)
+}
+
+// @Summary Заблокировать пользователя
+// @Description Блокирует пользователя: его посты и комментарии скрываются от текущего пользователя, а он не сможет отвечать текущему пользователю, упоминать его, подписываться на него и писать ему личные сообщения. Взаимные подписки отменяются
+// @Tags users
+// @Security BearerAuth
+// @Param id path string true "ID пользователя"
+// @Success 204 {string} string ""
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /users/{id}/block [put]
+func blockUserHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	blockerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var target models.User
+	if err := db.First(&target, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if target.ID == blockerID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot block yourself"})
+		return
+	}
+
+	block := models.UserBlock{BlockerID: blockerID, BlockedID: target.ID, CreatedAt: time.Now()}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(models.UserBlock{BlockerID: blockerID, BlockedID: target.ID}).FirstOrCreate(&block).Error; err != nil {
+			return err
+		}
+		// Blocked users cannot follow each other, so existing subscriptions end in both directions.
+		return tx.Exec("DELETE FROM user_subscriptions WHERE (subscriber_id = ? AND target_user_id = ?) OR (subscriber_id = ? AND target_user_id = ?)",
+			blockerID, target.ID, target.ID, blockerID).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block user"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Разблокировать пользователя
+// @Description Снимает блокировку с пользователя
+// @Tags users
+// @Security BearerAuth
+// @Param id path string true "ID пользователя"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Router /users/{id}/block [delete]
+func unblockUserHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	if err := db.Where("blocker_id = ? AND blocked_id = ?", userID, c.Param("id")).Delete(&models.UserBlock{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unblock user"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Проверяет, заблокировал ли кто-либо из двух пользователей другого.
+func isBlockedEitherWay(db *gorm.DB, a, b uuid.UUID) bool {
+	var count int64
+	db.Model(&models.UserBlock{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", a, b, b, a).
+		Count(&count)
+	return count > 0
+}
+
+// Подзапрос с ID пользователей, которых заблокировал указанный пользователь.
+func blockedByUser(db *gorm.DB, userID uuid.UUID) *gorm.DB {
+	return db.Model(&models.UserBlock{}).Select("blocked_id").Where("blocker_id = ?", userID)
+}
+
+// Проверяет, упоминает ли текст пользователя, который заблокировал автора. Упомянутые раньше
+// пользователи из previous не проверяются, чтобы блокировка не мешала править старый текст.
+func mentionsBlocker(db *gorm.DB, authorID uuid.UUID, content string, previous map[uuid.UUID]bool) bool {
+	refs, err := resolveReferences(db, parseReferences(content))
+	if err != nil {
+		return false
+	}
+	var mentioned []uuid.UUID
+	for _, ref := range refs {
+		if ref.Kind == models.ReferenceUser && !previous[ref.TargetID] {
+			mentioned = append(mentioned, ref.TargetID)
+		}
+	}
+	if len(mentioned) == 0 {
+		return false
+	}
+
+	var count int64
+	db.Model(&models.UserBlock{}).Where("blocker_id IN ? AND blocked_id = ?", mentioned, authorID).Count(&count)
+	return count > 0
+}
+
+// Возвращает ID пользователей, заблокированных указанным пользователем.
+func blockedUserIDs(db *gorm.DB, userID uuid.UUID) map[uuid.UUID]bool {
+	var ids []uuid.UUID
+	blockedByUser(db, userID).Pluck("blocked_id", &ids)
+	blocked := map[uuid.UUID]bool{}
+	for _, id := range ids {
+		blocked[id] = true
+	}
+	return blocked
+}
@@ -1,18 +1,20 @@
 package routes
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"chirp/models"
 )
 
 // @Summary Создать комментарий
-// @Description Создаёт новый комментарий к посту
+// @Description Создаёт новый комментарий к посту. Ответить можно только на комментарий того же поста и только если между пользователями нет блокировки. Текст в формате markdown, в ответе также возвращается очищенный HTML
 // @Tags comments
 // @Security BearerAuth
 // @Accept json
@@ -21,6 +23,9 @@ import (
 // @Success 201 {object} routes.CommentDTO
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 422 {object} map[string]string
 // @Router /comments [post]
 func createCommentHandler(c *gin.Context, db *gorm.DB) {
 	var req CreateCommentRequest
@@ -41,6 +46,55 @@ func createCommentHandler(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	var post models.Post
+	if err := db.First(&post, "id = ?", req.PostID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	if post.GroupID != nil && isBannedFromGroup(db, *post.GroupID, authorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are banned from this group"})
+		return
+	}
+
+	if isBlockedEitherWay(db, authorID, post.AuthorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot reply to this user"})
+		return
+	}
+
+	if req.ReplyToID != nil {
+		var parent models.Comment
+		if err := db.Select("id", "post_id", "author_id").First(&parent, "id = ?", *req.ReplyToID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Parent comment not found"})
+			return
+		}
+		if parent.PostID != post.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Reply must belong to the same post"})
+			return
+		}
+		if isBlockedEitherWay(db, authorID, parent.AuthorID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot reply to this user"})
+			return
+		}
+	}
+
+	if mentionsBlocker(db, authorID, req.Content, nil) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot mention a user who has blocked you"})
+		return
+	}
+
+	contentHTML, err := renderMarkdown(req.Content)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	verdict := checkSpam(req.Content, post.GroupID != nil)
+	if verdict.Reject {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Content was rejected as spam"})
+		return
+	}
+
 	comment := models.Comment{
 		PostID:     req.PostID,
 		AuthorID:   authorID,
@@ -48,25 +102,43 @@ func createCommentHandler(c *gin.Context, db *gorm.DB) {
 		IsReply:    req.ReplyToID != nil,
 		ReplyToID:  req.ReplyToID,
 		CreatedAt:  time.Now(),
+		ContentHTML:   contentHTML,
+		RenderVersion: markdownRenderVersion,
+	}
+	if verdict.Hold {
+		comment.ModStatus = models.ContentFiltered
 	}
 
-	if err := db.Create(&comment).Error; err != nil {
+	var refs []models.ContentReference
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+		if verdict.Hold {
+			if err := reportSpamHold(tx, post.GroupID, post.ID, &comment.ID, verdict.Score); err != nil {
+				return err
+			}
+		}
+		var err error
+		if refs, err = saveContentReferences(tx, &post.ID, &comment.ID, comment.Content); err != nil {
+			return err
+		}
+		return runAutoModForComment(tx, post, &comment)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create comment"})
 		return
 	}
 
-	resp := CommentDTO{
-		ID:         comment.ID,
-		PostID:     comment.PostID,
-		AuthorID:   comment.AuthorID,
-		Content:    comment.Content,
-		Reputation: comment.Reputation,
-		IsReply:    comment.IsReply,
-		ReplyToID:  comment.ReplyToID,
-		CreatedAt:  comment.CreatedAt,
+	resp := []CommentDTO{toCommentDTO(comment)}
+	decorateComments(db, post.GroupID, resp, &authorID)
+	if isPubliclyVisible(db, comment.AuthorID, comment.ModStatus) {
+		publishEvent(postCommentsTopic(post.ID), "comment.created", resp[0])
+		notifyNewComment(db, post, comment)
+		notifyMentions(db, refs, nil, comment.AuthorID, post.GroupID, &post.ID, &comment.ID)
 	}
 
-	c.JSON(http.StatusCreated, resp)
+	c.JSON(http.StatusCreated, resp[0])
 }
 
 // @Summary Получить комментарии к посту
@@ -74,29 +146,46 @@ func createCommentHandler(c *gin.Context, db *gorm.DB) {
 // @Tags comments
 // @Produce json
 // @Param id path string true "ID поста"
-// @Success 200 {array} models.Comment
+// @Success 200 {array} routes.CommentDTO
+// @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /comments/posts/{id}/comments [get]
 func getCommentsForPostHandler(c *gin.Context, db *gorm.DB) {
 	postId := c.Param("id")
+	viewerID := optionalUserID(c)
+	var post models.Post
+	err := db.Scopes(viewablePost(viewerID)).Select("id", "author_id", "group_id", "mod_status").First(&post, "posts.id = ?", postId).Error
+	if err != nil || !canViewModeratedPost(db, post, viewerID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
 	var comments []models.Comment
-	if err := db.Where("post_id = ?", postId).Find(&comments).Error; err != nil {
+	if err := db.Scopes(visibleCommentTree(viewerID)).Where("post_id = ?", post.ID).Find(&comments).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve comments"})
 		return
 	}
+	comments = pruneDeletedComments(comments)
+
+	commentDTOs := make([]CommentDTO, len(comments))
+	for i, comment := range comments {
+		commentDTOs[i] = toCommentDTO(comment)
+	}
 
-	c.JSON(http.StatusOK, comments)
+	decorateComments(db, post.GroupID, commentDTOs, viewerID)
+
+	c.JSON(http.StatusOK, commentDTOs)
 }
 
 // @Summary Обновить комментарий
-// @Description Обновляет комментарий пользователя
+// @Description Обновляет комментарий пользователя. Прежняя версия сохраняется в истории правок; правки после EDIT_GRACE_PERIOD отмечают комментарий изменённым
 // @Tags comments
 // @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param id path string true "ID комментария"
 // @Param data body routes.UpdateCommentDTO true "Данные для обновления"
-// @Success 200 {object} models.Comment
+// @Success 200 {object} routes.CommentDTO
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
 // @Failure 403 {object} map[string]string
@@ -132,17 +221,80 @@ func updateCommentHandler(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	comment.Content = req.Content
-	if err := db.Save(&comment).Error; err != nil {
+	var post models.Post
+	if err := db.First(&post, "id = ?", comment.PostID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	contentHTML, err := renderMarkdown(req.Content)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if mentionsBlocker(db, authorID, req.Content, mentionedUserIDs(db, &post.ID, &comment.ID)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot mention a user who has blocked you"})
+		return
+	}
+
+	previous := mentionedUserIDs(db, &post.ID, &comment.ID)
+	var refs []models.ContentReference
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Concurrent edits must see each other's result, or both would record the same previous version.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&comment, "id = ?", comment.ID).Error; err != nil {
+			return err
+		}
+		original := models.ContentRevision{
+			PostID:    post.ID,
+			CommentID: &comment.ID,
+			EditorID:  comment.AuthorID,
+			Content:   comment.Content,
+			CreatedAt: comment.CreatedAt,
+		}
+		changed := req.Content != comment.Content
+		comment.Content = req.Content
+		comment.ContentHTML = contentHTML
+		comment.RenderVersion = markdownRenderVersion
+		if changed {
+			comment.EditedAt = markEdited(comment.CreatedAt, comment.EditedAt)
+		}
+
+		if err := tx.Save(&comment).Error; err != nil {
+			return err
+		}
+		if changed {
+			if err := saveRevision(tx, original, models.ContentRevision{
+				PostID:    post.ID,
+				CommentID: &comment.ID,
+				EditorID:  authorID,
+				Content:   comment.Content,
+			}); err != nil {
+				return err
+			}
+		}
+		var err error
+		if refs, err = saveContentReferences(tx, &post.ID, &comment.ID, comment.Content); err != nil {
+			return err
+		}
+		return runAutoModForComment(tx, post, &comment)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment"})
 		return
 	}
 
-	c.JSON(http.StatusOK, comment)
+	if isPubliclyVisible(db, comment.AuthorID, comment.ModStatus) {
+		notifyMentions(db, refs, previous, comment.AuthorID, post.GroupID, &post.ID, &comment.ID)
+	}
+
+	resp := []CommentDTO{toCommentDTO(comment)}
+	decorateComments(db, post.GroupID, resp, &authorID)
+	c.JSON(http.StatusOK, resp[0])
 }
 
 // @Summary Удалить комментарий
-// @Description Удаляет комментарий пользователя
+// @Description Удаляет комментарий пользователя. Если на него есть ответы, в дереве остаётся заглушка. Автор может восстановить комментарий в течение SELF_RESTORE_WINDOW
 // @Tags comments
 // @Security BearerAuth
 // @Param id path string true "ID комментария"
@@ -176,7 +328,7 @@ func deleteCommentHandler(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	if err := db.Delete(&models.Comment{}, commentId).Error; err != nil {
+	if err := softDelete(db, &models.Comment{}, comment.ID, authorID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
 		return
 	}
@@ -185,7 +337,7 @@ func deleteCommentHandler(c *gin.Context, db *gorm.DB) {
 }
 
 // @Summary Голосовать за комментарий
-// @Description Голосует за комментарий (лайк/дизлайк)
+// @Description Голосует за комментарий (лайк/дизлайк). Голосовать нельзя, если голосующий или автор заблокировал другого
 // @Tags comments
 // @Security BearerAuth
 // @Accept json
@@ -194,6 +346,8 @@ func deleteCommentHandler(c *gin.Context, db *gorm.DB) {
 // @Param data body routes.VoteDTO true "Голос"
 // @Success 200 {object} models.Comment
 // @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Router /comments/{id}/vote [post]
 func voteCommentHandler(c *gin.Context, db *gorm.DB) {
@@ -210,33 +364,116 @@ func voteCommentHandler(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	voterID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if isBlockedEitherWay(db, voterID, comment.AuthorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot vote on this comment"})
+		return
+	}
+
 	comment.Reputation += req.Value
 	if err := db.Save(&comment).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update comment reputation"})
 		return
 	}
+	if milestone := crossedVoteMilestone(comment.Reputation-req.Value, comment.Reputation); milestone > 0 && firstVoteMilestone(db, comment.PostID, &comment.ID, milestone) {
+		notify(db, models.Notification{
+			UserID:    comment.AuthorID,
+			Type:      models.NotificationVoteMilestone,
+			PostID:    &comment.PostID,
+			CommentID: &comment.ID,
+			Message:   fmt.Sprintf("Your comment reached %d points", milestone),
+		})
+	}
+	publishEvent(postVotesTopic(comment.PostID), "comment.vote", VoteEventDTO{
+		PostID:     comment.PostID,
+		CommentID:  &comment.ID,
+		Reputation: comment.Reputation,
+	})
 
 	c.JSON(http.StatusOK, comment)
 }
 
+// Добавляет к комментариям HTML текста, флеры авторов, ссылки из текста и отметки сохранения.
+func decorateComments(db *gorm.DB, groupID *uuid.UUID, comments []CommentDTO, viewerID *uuid.UUID) {
+	renderStaleComments(comments)
+	attachCommentAuthorFlairs(db, groupID, comments)
+	attachCommentEntities(db, comments)
+	markSavedComments(db, comments, viewerID)
+	redactDeletedComments(comments)
+}
+
+func toCommentDTO(comment models.Comment) CommentDTO {
+	return CommentDTO{
+		ID:         comment.ID,
+		PostID:     comment.PostID,
+		AuthorID:   comment.AuthorID,
+		Content:    comment.Content,
+		ContentHTML: currentHTML(comment.ContentHTML, comment.RenderVersion),
+		Reputation: comment.Reputation,
+		IsReply:    comment.IsReply,
+		ReplyToID:  comment.ReplyToID,
+		CreatedAt:  comment.CreatedAt,
+		ModStatus:  comment.ModStatus,
+		EditedAt:   comment.EditedAt,
+		Deleted:    comment.DeletedAt.Valid,
+	}
+}
+
 func RegisterCommentRoutes(r *gin.RouterGroup, db *gorm.DB) {
-	r.POST("/", func(c *gin.Context) {
+	r.POST("/", JWTMiddleware(), func(c *gin.Context) {
 		createCommentHandler(c, db)
 	})
 
-	r.GET("/posts/:id/comments", func(c *gin.Context) {
+	r.GET("/posts/:id/comments", OptionalJWTMiddleware(), func(c *gin.Context) {
 		getCommentsForPostHandler(c, db)
 	})
 
-	r.PUT("/:id", func(c *gin.Context) {
+	r.PUT("/:id", JWTMiddleware(), func(c *gin.Context) {
 		updateCommentHandler(c, db)
 	})
 
-	r.DELETE("/:id", func(c *gin.Context) {
+	r.DELETE("/:id", JWTMiddleware(), func(c *gin.Context) {
 		deleteCommentHandler(c, db)
 	})
 
-	r.POST("/:id/vote", func(c *gin.Context) {
+	r.POST("/:id/restore", JWTMiddleware(), func(c *gin.Context) {
+		restoreCommentHandler(c, db)
+	})
+
+	r.GET("/:id/revisions", OptionalJWTMiddleware(), func(c *gin.Context) {
+		getCommentRevisionsHandler(c, db)
+	})
+
+	r.POST("/:id/vote", JWTMiddleware(), func(c *gin.Context) {
 		voteCommentHandler(c, db)
 	})
+
+	r.PUT("/:id/save", JWTMiddleware(), func(c *gin.Context) {
+		saveCommentHandler(c, db)
+	})
+
+	r.DELETE("/:id/save", JWTMiddleware(), func(c *gin.Context) {
+		unsaveCommentHandler(c, db)
+	})
+
+	r.POST("/:id/report", JWTMiddleware(), func(c *gin.Context) {
+		reportCommentHandler(c, db)
+	})
+
+	r.POST("/:id/remove", JWTMiddleware(), func(c *gin.Context) {
+		removeCommentHandler(c, db)
+	})
+
+	r.POST("/:id/approve", JWTMiddleware(), func(c *gin.Context) {
+		approveCommentHandler(c, db)
+	})
 }
\ No newline at end of file
@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Кодирует позицию в ленте (время и ID последнего элемента) в непрозрачный курсор.
+func encodeCursor(t time.Time, id uuid.UUID) string {
+	raw := strconv.FormatInt(t.UnixNano(), 10) + ":" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// Разбирает курсор, полученный от encodeCursor.
+func decodeCursor(cursor string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, errInvalidCursor
+	}
+	nanos, idPart, found := strings.Cut(string(raw), ":")
+	if !found {
+		return time.Time{}, uuid.Nil, errInvalidCursor
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, uuid.Nil, errInvalidCursor
+	}
+	id, err := uuid.Parse(idPart)
+	if err != nil {
+		return time.Time{}, uuid.Nil, errInvalidCursor
+	}
+	return time.Unix(0, unixNano), id, nil
+}
@@ -0,0 +1,273 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// statementRecorder collects the SQL that a dry-run session would send to the database.
+type statementRecorder struct {
+	logger.Interface
+	mu         sync.Mutex
+	statements []string
+}
+
+func (r *statementRecorder) LogMode(logger.LogLevel) logger.Interface { return r }
+
+func (r *statementRecorder) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statements = append(r.statements, sql)
+}
+
+// Statements with the given prefix, such as `DELETE FROM "mod_actions"`.
+func (r *statementRecorder) matching(prefix string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var matched []string
+	for _, statement := range r.statements {
+		if strings.HasPrefix(statement, prefix) {
+			matched = append(matched, statement)
+		}
+	}
+	return matched
+}
+
+// dryRunDB builds statements without a database: queries return no rows and hooks still run.
+func dryRunDB(t *testing.T) (*gorm.DB, *statementRecorder) {
+	t.Helper()
+	recorder := &statementRecorder{Interface: logger.Discard}
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost dbname=chirp_test"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 recorder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, recorder
+}
+
+var errStubConn = errors.New("stub database executes no statements")
+
+// stubConn lets a dry-run session open transactions. Dry runs never send it a statement.
+type stubConn struct{}
+
+func (stubConn) PrepareContext(context.Context, string) (*sql.Stmt, error) { return nil, errStubConn }
+func (stubConn) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, errStubConn
+}
+func (stubConn) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, errStubConn
+}
+func (stubConn) QueryRowContext(context.Context, string, ...interface{}) *sql.Row { return nil }
+func (stubConn) BeginTx(context.Context, *sql.TxOptions) (gorm.ConnPool, error) {
+	return &stubTx{}, nil
+}
+
+type stubTx struct{ stubConn }
+
+func (*stubTx) Commit() error   { return nil }
+func (*stubTx) Rollback() error { return nil }
+
+// stubDB is a dry run whose queries return the rows registered with returning, so that handlers can be
+// driven end to end. Inserts assign missing UUID keys; inserts, updates and deletes report a row affected
+// per record unless affecting says otherwise.
+type stubDB struct {
+	*gorm.DB
+	recorder *statementRecorder
+
+	mu       sync.Mutex
+	results  []stubResult
+	affected map[string]int64
+}
+
+type stubResult struct {
+	match string
+	value interface{}
+}
+
+func newStubDB(t *testing.T) *stubDB {
+	t.Helper()
+	recorder := &statementRecorder{Interface: logger.Discard}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: stubConn{}}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 recorder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &stubDB{DB: db, recorder: recorder, affected: map[string]int64{}}
+
+	callbacks := []error{
+		db.Callback().Query().After("gorm:query").Before("gorm:preload").Register("stub:query", stub.query),
+		db.Callback().Create().After("gorm:create").Register("stub:create", stub.create),
+		db.Callback().Update().After("gorm:update").Register("stub:update", stub.write),
+		db.Callback().Delete().After("gorm:delete").Register("stub:delete", stub.write),
+	}
+	for _, err := range callbacks {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return stub
+}
+
+// returning makes queries whose SQL, with values inlined, contains match return value: a struct, a slice
+// of structs or a scalar such as a count. The first registration that matches wins.
+func (s *stubDB) returning(match string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append(s.results, stubResult{match: match, value: value})
+}
+
+// affecting sets the rows that writes to table report, e.g. 0 for an insert that hits ON CONFLICT DO NOTHING.
+func (s *stubDB) affecting(table string, rows int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.affected[table] = rows
+}
+
+func (s *stubDB) query(db *gorm.DB) {
+	if db.Error != nil || db.Statement.SQL.Len() == 0 {
+		return
+	}
+	statement := db.Dialector.Explain(db.Statement.SQL.String(), db.Statement.Vars...)
+	s.mu.Lock()
+	var value interface{}
+	found := false
+	for _, result := range s.results {
+		if strings.Contains(statement, result.match) {
+			value, found = result.value, true
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	dest := reflect.Indirect(reflect.ValueOf(db.Statement.Dest))
+	src := reflect.ValueOf(value)
+	if found && src.Kind() == reflect.Slice && dest.Kind() != reflect.Slice {
+		found = src.Len() > 0
+		if found {
+			src = src.Index(0)
+		}
+	}
+	if !found {
+		if db.Statement.RaiseErrorOnNotFound {
+			db.AddError(gorm.ErrRecordNotFound)
+		}
+		return
+	}
+
+	if dest.Kind() != reflect.Slice {
+		assignStub(dest, src)
+		db.RowsAffected = 1
+		return
+	}
+	if src.Kind() != reflect.Slice {
+		src = reflect.Append(reflect.MakeSlice(reflect.SliceOf(src.Type()), 0, 1), src)
+	}
+	rows := reflect.MakeSlice(dest.Type(), src.Len(), src.Len())
+	for i := 0; i < src.Len(); i++ {
+		assignStub(rows.Index(i), src.Index(i))
+	}
+	dest.Set(rows)
+	db.RowsAffected = int64(src.Len())
+}
+
+func assignStub(dest, src reflect.Value) {
+	switch {
+	case dest.Kind() == reflect.Ptr && src.Kind() != reflect.Ptr:
+		dest.Set(reflect.New(dest.Type().Elem()))
+		dest.Elem().Set(src.Convert(dest.Type().Elem()))
+	case dest.Kind() != reflect.Ptr && src.Kind() == reflect.Ptr:
+		dest.Set(src.Elem().Convert(dest.Type()))
+	default:
+		dest.Set(src.Convert(dest.Type()))
+	}
+}
+
+func (s *stubDB) create(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+	records := 1
+	if db.Statement.ReflectValue.Kind() == reflect.Slice {
+		records = db.Statement.ReflectValue.Len()
+	}
+	if field := primaryUUIDField(db); field != nil {
+		ctx := db.Statement.Context
+		assign := func(record reflect.Value) {
+			if _, zero := field.ValueOf(ctx, record); zero {
+				field.Set(ctx, record, uuid.New())
+			}
+		}
+		if db.Statement.ReflectValue.Kind() == reflect.Slice {
+			for i := 0; i < records; i++ {
+				assign(reflect.Indirect(db.Statement.ReflectValue.Index(i)))
+			}
+		} else {
+			assign(db.Statement.ReflectValue)
+		}
+	}
+	db.RowsAffected = s.rowsAffected(db.Statement.Table, int64(records))
+}
+
+func (s *stubDB) write(db *gorm.DB) {
+	if db.Error == nil {
+		db.RowsAffected = s.rowsAffected(db.Statement.Table, 1)
+	}
+}
+
+func (s *stubDB) rowsAffected(table string, fallback int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rows, ok := s.affected[table]; ok {
+		return rows
+	}
+	return fallback
+}
+
+func primaryUUIDField(db *gorm.DB) *schema.Field {
+	if db.Statement.Schema == nil {
+		return nil
+	}
+	field := db.Statement.Schema.PrioritizedPrimaryField
+	if field == nil || field.FieldType != reflect.TypeOf(uuid.UUID{}) {
+		return nil
+	}
+	return field
+}
+
+// serve sends a request to handler as the given user, or anonymously when userID is nil.
+func serve(db *gorm.DB, method, route, target, body string, userID *uuid.UUID, handler func(*gin.Context, *gorm.DB)) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Handle(method, route, func(c *gin.Context) {
+		if userID != nil {
+			c.Set("userId", *userID)
+		}
+		handler(c, db)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
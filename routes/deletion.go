@@ -0,0 +1,541 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+// Text shown in place of deleted posts and comments.
+const deletedPlaceholder = "[deleted]"
+
+// Purge job settings.
+const (
+	purgeInterval = time.Hour
+	purgeBatch    = 500
+)
+
+// Срок, в течение которого удаливший может сам восстановить пост, комментарий, группу или аккаунт.
+// Задаётся переменной SELF_RESTORE_WINDOW, по умолчанию семь дней.
+func selfRestoreWindow() time.Duration {
+	if window, err := time.ParseDuration(os.Getenv("SELF_RESTORE_WINDOW")); err == nil && window >= 0 {
+		return window
+	}
+	return 7 * 24 * time.Hour
+}
+
+// Срок, после которого удалённое стирается окончательно. Задаётся переменной DELETED_RETENTION_PERIOD, по умолчанию 30 дней.
+func deletedRetentionPeriod() time.Duration {
+	if period, err := time.ParseDuration(os.Getenv("DELETED_RETENTION_PERIOD")); err == nil && period > 0 {
+		return period
+	}
+	return 30 * 24 * time.Hour
+}
+
+// Может ли пользователь восстановить удалённое сам: только то, что удалил он же, и только в течение SELF_RESTORE_WINDOW.
+func canSelfRestore(deletedAt gorm.DeletedAt, deletedByID *uuid.UUID, userID uuid.UUID) bool {
+	return deletedAt.Valid && deletedByID != nil && *deletedByID == userID &&
+		time.Since(deletedAt.Time) <= selfRestoreWindow()
+}
+
+// Помечает запись удалённой и запоминает, кто её удалил.
+func softDelete(tx *gorm.DB, model interface{}, id uuid.UUID, deletedByID uuid.UUID) error {
+	return tx.Model(model).Where("id = ?", id).Updates(map[string]interface{}{
+		"deleted_at":    time.Now(),
+		"deleted_by_id": deletedByID,
+	}).Error
+}
+
+func restoreDeleted(tx *gorm.DB, model interface{}, id uuid.UUID) error {
+	return tx.Unscoped().Model(model).Where("id = ?", id).Updates(map[string]interface{}{
+		"deleted_at":    nil,
+		"deleted_by_id": nil,
+	}).Error
+}
+
+// Оставляет удалённые комментарии, на которые есть ответы, чтобы дерево не распадалось; остальные удалённые убирает.
+// Удалённый комментарий, все ответы на который тоже удалены и убраны, убирается вслед за ними.
+func pruneDeletedComments(comments []models.Comment) []models.Comment {
+	for {
+		replies := map[uuid.UUID]int{}
+		for _, comment := range comments {
+			if comment.ReplyToID != nil {
+				replies[*comment.ReplyToID]++
+			}
+		}
+		kept := comments[:0:0]
+		for _, comment := range comments {
+			if !comment.DeletedAt.Valid || replies[comment.ID] > 0 {
+				kept = append(kept, comment)
+			}
+		}
+		if len(kept) == len(comments) {
+			return kept
+		}
+		comments = kept
+	}
+}
+
+// Скрывает содержимое и автора удалённых постов, оставляя ветку комментариев доступной.
+func redactDeletedPosts(posts []PostDTO) {
+	for i := range posts {
+		if !posts[i].Deleted {
+			continue
+		}
+		posts[i] = PostDTO{
+			ID:          posts[i].ID,
+			Title:       deletedPlaceholder,
+			Type:        posts[i].Type,
+			Content:     deletedPlaceholder,
+			ContentHTML: "<p>" + deletedPlaceholder + "</p>",
+			Reputation:  posts[i].Reputation,
+			CreatedAt:   posts[i].CreatedAt,
+			GroupID:     posts[i].GroupID,
+			ModStatus:   posts[i].ModStatus,
+			Deleted:     true,
+		}
+	}
+}
+
+// Скрывает содержимое и автора удалённых комментариев; сами комментарии остаются на месте в дереве.
+func redactDeletedComments(comments []CommentDTO) {
+	for i := range comments {
+		if !comments[i].Deleted {
+			continue
+		}
+		comments[i] = CommentDTO{
+			ID:          comments[i].ID,
+			PostID:      comments[i].PostID,
+			Content:     deletedPlaceholder,
+			ContentHTML: "<p>" + deletedPlaceholder + "</p>",
+			Reputation:  comments[i].Reputation,
+			IsReply:     comments[i].IsReply,
+			ReplyToID:   comments[i].ReplyToID,
+			CreatedAt:   comments[i].CreatedAt,
+			ModStatus:   comments[i].ModStatus,
+			Deleted:     true,
+		}
+	}
+}
+
+// @Summary Восстановить пост
+// @Description Восстанавливает удалённый пост. Автор может восстановить свой пост в течение SELF_RESTORE_WINDOW после удаления, администратор — до окончательной очистки
+// @Tags posts
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID поста"
+// @Success 200 {object} routes.PostDTO
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /posts/{id}/restore [post]
+func restorePostHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	restorerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var post models.Post
+	if err := db.Unscoped().First(&post, "id = ? AND deleted_at IS NOT NULL", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deleted post not found"})
+		return
+	}
+	if !canSelfRestore(post.DeletedAt, post.DeletedByID, restorerID) && !isAdmin(db, restorerID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to restore this post"})
+		return
+	}
+
+	if err := restoreDeleted(db, &models.Post{}, post.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore post"})
+		return
+	}
+	post.DeletedAt = gorm.DeletedAt{}
+	post.DeletedByID = nil
+
+	c.JSON(http.StatusOK, postResponse(db, post, &restorerID))
+}
+
+// @Summary Восстановить комментарий
+// @Description Восстанавливает удалённый комментарий. Автор может восстановить свой комментарий в течение SELF_RESTORE_WINDOW после удаления, администратор — до окончательной очистки
+// @Tags comments
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID комментария"
+// @Success 200 {object} routes.CommentDTO
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /comments/{id}/restore [post]
+func restoreCommentHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	restorerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var comment models.Comment
+	if err := db.Unscoped().First(&comment, "id = ? AND deleted_at IS NOT NULL", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deleted comment not found"})
+		return
+	}
+	if !canSelfRestore(comment.DeletedAt, comment.DeletedByID, restorerID) && !isAdmin(db, restorerID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to restore this comment"})
+		return
+	}
+
+	if err := restoreDeleted(db, &models.Comment{}, comment.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore comment"})
+		return
+	}
+	comment.DeletedAt = gorm.DeletedAt{}
+	comment.DeletedByID = nil
+
+	var post models.Post
+	db.Unscoped().Select("id", "group_id").First(&post, "id = ?", comment.PostID)
+	resp := []CommentDTO{toCommentDTO(comment)}
+	decorateComments(db, post.GroupID, resp, &restorerID)
+	c.JSON(http.StatusOK, resp[0])
+}
+
+// @Summary Восстановить группу
+// @Description Восстанавливает удалённую группу вместе с её постами. Удаливший группу модератор может восстановить её в течение SELF_RESTORE_WINDOW, администратор — до окончательной очистки
+// @Tags groups
+// @Security BearerAuth
+// @Param id path string true "ID группы"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /groups/{id}/restore [post]
+func restoreGroupHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	restorerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var group models.Group
+	if err := db.Unscoped().First(&group, "id = ? AND deleted_at IS NOT NULL", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deleted group not found"})
+		return
+	}
+	if !canSelfRestore(group.DeletedAt, group.DeletedByID, restorerID) && !isAdmin(db, restorerID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to restore this group"})
+		return
+	}
+	if group.PurgedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "The group has already been purged"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := restoreDeleted(tx, &models.Group{}, group.ID); err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: restorerID,
+			Action:      models.ModActionRestoreGroup,
+			TargetType:  "group",
+			TargetID:    &group.ID,
+		}, nil, nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore group"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Удалить свой аккаунт
+// @Description Удаляет аккаунт текущего пользователя. Посты и комментарии остаются. Аккаунт восстанавливается входом в течение SELF_RESTORE_WINDOW; после DELETED_RETENTION_PERIOD личные данные стираются
+// @Tags users
+// @Security BearerAuth
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Router /users/me [delete]
+func deleteAccountHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	accountID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := softDelete(db, &models.User{}, accountID, accountID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Удалить аккаунт
+// @Description Удаляет аккаунт пользователя. Восстановить его может только администратор
+// @Tags admin
+// @Security BearerAuth
+// @Param id path string true "ID пользователя"
+// @Success 204 {string} string ""
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/users/{id} [delete]
+func deleteUserHandler(c *gin.Context, db *gorm.DB) {
+	var user models.User
+	if err := db.First(&user, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	adminID := *optionalUserID(c)
+	if adminID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use DELETE /users/me to delete your own account"})
+		return
+	}
+
+	if err := softDelete(db, &models.User{}, user.ID, adminID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Восстановить аккаунт
+// @Description Восстанавливает удалённый аккаунт, если его личные данные ещё не стёрты
+// @Tags admin
+// @Security BearerAuth
+// @Param id path string true "ID пользователя"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /admin/users/{id}/restore [post]
+func restoreUserHandler(c *gin.Context, db *gorm.DB) {
+	var user models.User
+	if err := db.Unscoped().First(&user, "id = ? AND deleted_at IS NOT NULL", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deleted user not found"})
+		return
+	}
+	if user.PurgedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "The account data has already been purged"})
+		return
+	}
+
+	if err := restoreDeleted(db, &models.User{}, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore user"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+var startPurgeJob sync.Once
+
+// Запускает фоновую очистку: удалённое старше DELETED_RETENTION_PERIOD стирается окончательно.
+func scheduleDeletedContentPurge(db *gorm.DB) {
+	startPurgeJob.Do(func() {
+		go func() {
+			ticker := time.NewTicker(purgeInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				purgeDeletedContent(db)
+			}
+		}()
+	})
+}
+
+// Стирает группы, посты и комментарии, удалённые раньше срока хранения, и личные данные удалённых аккаунтов.
+// Комментарий с ответами остаётся заглушкой, пока не сотрутся ответы. Ошибки только логируются:
+// необработанное будет стёрто при следующем запуске.
+func purgeDeletedContent(db *gorm.DB) {
+	cutoff := time.Now().Add(-deletedRetentionPeriod())
+
+	var groupIDs []uuid.UUID
+	db.Unscoped().Model(&models.Group{}).Where("deleted_at < ? AND purged_at IS NULL", cutoff).Limit(purgeBatch).Pluck("id", &groupIDs)
+	for _, groupID := range groupIDs {
+		if err := db.Transaction(func(tx *gorm.DB) error { return purgeGroup(tx, groupID) }); err != nil {
+			log.Println("Failed to purge group:", err)
+			continue
+		}
+		resetBannedImages(&groupID)
+	}
+
+	var postIDs []uuid.UUID
+	db.Unscoped().Model(&models.Post{}).Where("deleted_at < ?", cutoff).Limit(purgeBatch).Pluck("id", &postIDs)
+	if len(postIDs) > 0 {
+		if err := db.Transaction(func(tx *gorm.DB) error { return purgePosts(tx, postIDs) }); err != nil {
+			log.Println("Failed to purge posts:", err)
+		}
+	}
+
+	var commentIDs []uuid.UUID
+	db.Unscoped().Model(&models.Comment{}).
+		Where("deleted_at < ? AND NOT EXISTS (SELECT 1 FROM comments replies WHERE replies.reply_to_id = comments.id)", cutoff).
+		Limit(purgeBatch).Pluck("id", &commentIDs)
+	if len(commentIDs) > 0 {
+		if err := db.Transaction(func(tx *gorm.DB) error { return purgeComments(tx, commentIDs) }); err != nil {
+			log.Println("Failed to purge comments:", err)
+		}
+	}
+
+	var userIDs []uuid.UUID
+	db.Unscoped().Model(&models.User{}).Where("deleted_at < ? AND purged_at IS NULL", cutoff).Limit(purgeBatch).Pluck("id", &userIDs)
+	for _, userID := range userIDs {
+		if err := db.Transaction(func(tx *gorm.DB) error { return purgeUser(tx, userID) }); err != nil {
+			log.Println("Failed to purge user:", err)
+		}
+	}
+}
+
+func purgeComments(tx *gorm.DB, ids []uuid.UUID) error {
+	for _, model := range []interface{}{&models.ContentRevision{}, &models.ContentReference{}, &models.AutoModHit{}, &models.VoteMilestone{}, &models.SpamDecision{}} {
+		if err := tx.Where("comment_id IN ?", ids).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Unscoped().Where("id IN ?", ids).Delete(&models.Comment{}).Error
+}
+
+// Стирает посты вместе с комментариями, медиа, опросами и историей правок.
+func purgePosts(tx *gorm.DB, ids []uuid.UUID) error {
+	var commentIDs []uuid.UUID
+	if err := tx.Unscoped().Model(&models.Comment{}).Where("post_id IN ?", ids).Pluck("id", &commentIDs).Error; err != nil {
+		return err
+	}
+	if len(commentIDs) > 0 {
+		if err := purgeComments(tx, commentIDs); err != nil {
+			return err
+		}
+	}
+	for _, model := range []interface{}{
+		&models.PostMedia{},
+		&models.PollVote{},
+		&models.PollBallot{},
+		&models.PollOption{},
+		&models.Poll{},
+		&models.ContentRevision{},
+		&models.ContentReference{},
+		&models.AutoModHit{},
+		&models.VoteMilestone{},
+		&models.SpamDecision{},
+	} {
+		if err := tx.Where("post_id IN ?", ids).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Unscoped().Where("id IN ?", ids).Delete(&models.Post{}).Error
+}
+
+// Стирает посты, участников, правила, вики и переписку модераторов группы. Журнал модерации неизменяем,
+// поэтому строка группы остаётся без названия и описания, а записи журнала ссылаются на неё.
+func purgeGroup(tx *gorm.DB, groupID uuid.UUID) error {
+	var postIDs []uuid.UUID
+	if err := tx.Unscoped().Model(&models.Post{}).Where("group_id = ?", groupID).Pluck("id", &postIDs).Error; err != nil {
+		return err
+	}
+	if len(postIDs) > 0 {
+		if err := purgePosts(tx, postIDs); err != nil {
+			return err
+		}
+	}
+	if err := tx.Where("page_id IN (SELECT id FROM wiki_pages WHERE group_id = ?)", groupID).Delete(&models.WikiRevision{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("thread_id IN (SELECT id FROM modmail_threads WHERE group_id = ?)", groupID).Delete(&models.ModmailMessage{}).Error; err != nil {
+		return err
+	}
+	for _, model := range []interface{}{
+		&models.GroupUser{},
+		&models.GroupModerator{},
+		&models.GroupBan{},
+		&models.Report{},
+		&models.AutoModRule{},
+		&models.GroupRule{},
+		&models.PostFlair{},
+		&models.UserFlairTemplate{},
+		&models.WikiPage{},
+		&models.WikiContributor{},
+		&models.ModmailThread{},
+		&models.BannedImage{},
+		&models.Notification{},
+		&models.MutedGroup{},
+	} {
+		if err := tx.Where("group_id = ?", groupID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Unscoped().Model(&models.Group{}).Where("id = ?", groupID).Updates(map[string]interface{}{
+		"group_name":  "deleted-" + groupID.String(),
+		"banner_url":  "",
+		"description": "",
+		"purged_at":   time.Now(),
+	}).Error
+}
+
+// Стирает личные данные аккаунта. Строка пользователя остаётся, чтобы его посты и комментарии сохранили автора.
+func purgeUser(tx *gorm.DB, userID uuid.UUID) error {
+	if err := tx.Unscoped().Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"nickname":      "deleted-" + userID.String(),
+		"email":         userID.String() + "@deleted.invalid",
+		"password_hash": "",
+		"banner_url":    "",
+		"purged_at":     time.Now(),
+	}).Error; err != nil {
+		return err
+	}
+	for _, model := range []interface{}{
+		&models.GroupUser{},
+		&models.GroupModerator{},
+		&models.Notification{},
+		&models.NotificationPreference{},
+		&models.SavedItem{},
+		&models.SavedCollection{},
+		&models.HiddenPost{},
+		&models.MutedGroup{},
+		&models.ContentFilter{},
+	} {
+		if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Exec("DELETE FROM user_subscriptions WHERE subscriber_id = ? OR target_user_id = ?", userID, userID).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ? OR muted_user_id = ?", userID, userID).Delete(&models.MutedUser{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("blocker_id = ? OR blocked_id = ?", userID, userID).Delete(&models.UserBlock{}).Error
+}
@@ -0,0 +1,119 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+func TestPurgeGroupKeepsModLog(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	groupID := uuid.New()
+
+	if err := purgeGroup(db, groupID); err != nil {
+		t.Fatalf("purgeGroup: %v", err)
+	}
+
+	if deleted := recorder.matching(`DELETE FROM "mod_actions"`); len(deleted) > 0 {
+		t.Errorf("mod actions deleted: %v", deleted)
+	}
+	if deleted := recorder.matching(`DELETE FROM "groups"`); len(deleted) > 0 {
+		t.Errorf("group row deleted: %v", deleted)
+	}
+	for _, table := range []string{"group_users", "group_moderators", "reports", "wiki_pages", "modmail_threads", "notifications"} {
+		if len(recorder.matching(`DELETE FROM "`+table+`"`)) == 0 {
+			t.Errorf("%s not purged", table)
+		}
+	}
+
+	updates := recorder.matching(`UPDATE "groups"`)
+	if len(updates) != 1 {
+		t.Fatalf("group tombstone updates = %v", updates)
+	}
+	for _, want := range []string{`"purged_at"=`, `"group_name"='deleted-` + groupID.String()} {
+		if !strings.Contains(updates[0], want) {
+			t.Errorf("tombstone update %q lacks %s", updates[0], want)
+		}
+	}
+}
+
+func TestRestorePostPermissions(t *testing.T) {
+	author, admin, stranger := uuid.New(), uuid.New(), uuid.New()
+	deleted := func(ago time.Duration) models.Post {
+		return models.Post{
+			ID:          uuid.New(),
+			AuthorID:    author,
+			DeletedAt:   gorm.DeletedAt{Time: time.Now().Add(-ago), Valid: true},
+			DeletedByID: &author,
+		}
+	}
+
+	for _, tc := range []struct {
+		name       string
+		post       models.Post
+		restorer   uuid.UUID
+		wantStatus int
+	}{
+		{"author within the window", deleted(time.Hour), author, http.StatusOK},
+		{"author after the window", deleted(selfRestoreWindow() + time.Hour), author, http.StatusForbidden},
+		{"another user", deleted(time.Hour), stranger, http.StatusForbidden},
+		{"administrator", deleted(selfRestoreWindow() + time.Hour), admin, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newStubDB(t)
+			db.returning(`FROM "posts" WHERE id = '`+tc.post.ID.String()+`' AND deleted_at IS NOT NULL`, tc.post)
+			db.returning(`id = '`+admin.String()+`' AND is_admin = true`, int64(1))
+
+			w := serve(db.DB, http.MethodPost, "/posts/:id/restore", "/posts/"+tc.post.ID.String()+"/restore", "", &tc.restorer, restorePostHandler)
+			if w.Code != tc.wantStatus {
+				t.Fatalf("status %d, want %d; body %s", w.Code, tc.wantStatus, w.Body)
+			}
+			restored := len(db.recorder.matching(`UPDATE "posts" SET "deleted_at"=NULL`)) == 1
+			if restored != (tc.wantStatus == http.StatusOK) {
+				t.Errorf("restored = %v: %v", restored, db.recorder.statements)
+			}
+		})
+	}
+}
+
+func TestDeletedPostDetailKeepsThreadPlaceholder(t *testing.T) {
+	post := models.Post{
+		ID:        uuid.New(),
+		AuthorID:  uuid.New(),
+		Content:   "Deleted text",
+		DeletedAt: gorm.DeletedAt{Time: time.Now(), Valid: true},
+	}
+	reply := models.Comment{ID: uuid.New(), PostID: post.ID, AuthorID: uuid.New(), Content: "Still here"}
+
+	for _, tc := range []struct {
+		name       string
+		comments   []models.Comment
+		wantStatus int
+	}{
+		{"with replies", []models.Comment{reply}, http.StatusOK},
+		{"without replies", nil, http.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newStubDB(t)
+			db.returning(`SELECT * FROM "posts" WHERE`, post)
+			db.returning(`FROM "comments" WHERE`, tc.comments)
+
+			w := serve(db.DB, http.MethodGet, "/posts/:id", "/posts/"+post.ID.String(), "", nil, getPostDetailHandler)
+			if w.Code != tc.wantStatus {
+				t.Fatalf("status %d, want %d; body %s", w.Code, tc.wantStatus, w.Body)
+			}
+			if strings.Contains(w.Body.String(), post.Content) {
+				t.Errorf("deleted post text was shown: %s", w.Body)
+			}
+			if tc.wantStatus == http.StatusOK && !strings.Contains(w.Body.String(), reply.Content) {
+				t.Errorf("reply is missing from the placeholder thread: %s", w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package routes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Строка построчного сравнения: ' ' — без изменений, '-' — удалена, '+' — добавлена.
+type diffLine struct {
+	Kind byte
+	Text string
+}
+
+// Beyond this many edits the Myers trace gets too large; the texts are then shown as fully replaced.
+const maxDiffEdits = 2000
+
+// Сравнивает два набора строк алгоритмом Майерса.
+func diffLines(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	limit := n + m
+	if limit > maxDiffEdits {
+		limit = maxDiffEdits
+	}
+
+	// trace[d] holds the furthest x reached on each diagonal k in [-d-1, d+1] before step d.
+	var trace [][]int
+	v := map[int]int{1: 0}
+	for d := 0; d <= limit; d++ {
+		snapshot := make([]int, 2*d+3)
+		for k := -d - 1; k <= d+1; k++ {
+			snapshot[k+d+1] = v[k]
+		}
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1] < v[k+1]) {
+				x = v[k+1]
+			} else {
+				x = v[k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k] = x
+			if x >= n && y >= m {
+				return backtrackDiff(a, b, trace)
+			}
+		}
+	}
+
+	lines := make([]diffLine, 0, n+m)
+	for _, text := range a {
+		lines = append(lines, diffLine{Kind: '-', Text: text})
+	}
+	for _, text := range b {
+		lines = append(lines, diffLine{Kind: '+', Text: text})
+	}
+	return lines
+}
+
+func backtrackDiff(a, b []string, trace [][]int) []diffLine {
+	var reversed []diffLine
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		at := func(k int) int { return trace[d][k+d+1] }
+		k := x - y
+
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, diffLine{Kind: ' ', Text: a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, diffLine{Kind: '+', Text: b[y-1]})
+			} else {
+				reversed = append(reversed, diffLine{Kind: '-', Text: a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	lines := make([]diffLine, len(reversed))
+	for i, line := range reversed {
+		lines[len(reversed)-1-i] = line
+	}
+	return lines
+}
+
+// Строит unified diff двух текстов с тремя строками контекста.
+func unifiedDiff(fromName, toName, from, to string) (diff string, additions int, deletions int) {
+	lines := diffLines(splitLines(from), splitLines(to))
+
+	// Line numbers in the old and new text before each diff line.
+	aPos := make([]int, len(lines)+1)
+	bPos := make([]int, len(lines)+1)
+	var changes []int
+	for i, line := range lines {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		switch line.Kind {
+		case '-':
+			aPos[i+1]++
+			deletions++
+			changes = append(changes, i)
+		case '+':
+			bPos[i+1]++
+			additions++
+			changes = append(changes, i)
+		default:
+			aPos[i+1]++
+			bPos[i+1]++
+		}
+	}
+	if len(changes) == 0 {
+		return "", 0, 0
+	}
+
+	const context = 3
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+	for i := 0; i < len(changes); {
+		j := i
+		for j+1 < len(changes) && changes[j+1]-changes[j] <= 2*context {
+			j++
+		}
+		start := changes[i] - context
+		if start < 0 {
+			start = 0
+		}
+		end := changes[j] + context + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		aCount, bCount := aPos[end]-aPos[start], bPos[end]-bPos[start]
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aPos[start], aCount), hunkRange(bPos[start], bCount))
+		for _, line := range lines[start:end] {
+			sb.WriteByte(line.Kind)
+			sb.WriteString(line.Text)
+			sb.WriteByte('\n')
+		}
+		i = j + 1
+	}
+	return sb.String(), additions, deletions
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(text, "\r\n", "\n"), "\n"), "\n")
+}
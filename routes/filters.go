@@ -0,0 +1,455 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"chirp/models"
+)
+
+const maxContentFilters = 100
+
+// Keywords are matched as substrings, so LIKE wildcards in them are escaped.
+const keywordFilterMatch = `NOT EXISTS (SELECT 1 FROM content_filters f WHERE f.user_id = ? AND (
+	posts.title ILIKE '%' || replace(replace(replace(f.keyword, '\', '\\'), '%', '\%'), '_', '\_') || '%' OR
+	posts.content ILIKE '%' || replace(replace(replace(f.keyword, '\', '\\'), '%', '\%'), '_', '\_') || '%'))`
+
+// Убирает из ленты скрытые пользователем посты, посты заглушённых авторов и посты с ключевыми словами
+// из его фильтров. Заглушённые группы убираются только из общих лент, а не из ленты самой группы.
+// Условия применяются в запросе, поэтому страницы и общее число постов остаются согласованными.
+func filteredFeed(viewerID uuid.UUID, muteGroups bool) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Where("posts.id NOT IN (SELECT post_id FROM hidden_posts WHERE user_id = ?)", viewerID).
+			Where("posts.author_id NOT IN (SELECT muted_user_id FROM muted_users WHERE user_id = ?)", viewerID).
+			Where(keywordFilterMatch, viewerID)
+		if muteGroups {
+			db = db.Where("(posts.group_id IS NULL OR posts.group_id NOT IN (SELECT group_id FROM muted_groups WHERE user_id = ?))", viewerID)
+		}
+		return db
+	}
+}
+
+// Ограничивает выборку постами групп, в которых состоит пользователь, и пользователей, на которых он подписан.
+func homeFeed(viewerID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(posts.group_id IN (SELECT group_id FROM group_users WHERE user_id = ?) OR posts.author_id IN (SELECT target_user_id FROM user_subscriptions WHERE subscriber_id = ?))",
+			viewerID, viewerID)
+	}
+}
+
+// @Summary Скрыть пост
+// @Description Скрывает пост из всех лент текущего пользователя
+// @Tags posts
+// @Security BearerAuth
+// @Param id path string true "ID поста"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /posts/{id}/hide [put]
+func hidePostHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	viewerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var post models.Post
+	if err := db.Scopes(visiblePosts(&viewerID)).First(&post, "posts.id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	hidden := models.HiddenPost{UserID: viewerID, PostID: post.ID, CreatedAt: time.Now()}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&hidden).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hide post"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Вернуть скрытый пост
+// @Description Возвращает скрытый пост в ленты текущего пользователя
+// @Tags posts
+// @Security BearerAuth
+// @Param id path string true "ID поста"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Router /posts/{id}/hide [delete]
+func unhidePostHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	if err := db.Where("user_id = ? AND post_id = ?", userID, c.Param("id")).Delete(&models.HiddenPost{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unhide post"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Получить скрытые посты
+// @Description Возвращает посты, скрытые текущим пользователем, от недавно скрытых к давним
+// @Tags users
+// @Security BearerAuth
+// @Produce json
+// @Param page query int false "Страница"
+// @Param limit query int false "Лимит"
+// @Success 200 {object} routes.PaginatedPostsResponse
+// @Failure 401 {object} map[string]string
+// @Router /users/me/hidden [get]
+func listHiddenPostsHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	viewerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 25
+	}
+
+	var totalCount int64
+	var posts []models.Post
+	query := db.Model(&models.Post{}).Scopes(visiblePosts(&viewerID)).
+		Joins("JOIN hidden_posts ON hidden_posts.post_id = posts.id AND hidden_posts.user_id = ?", viewerID).
+		Session(&gorm.Session{})
+	query.Count(&totalCount)
+	if err := query.Order("hidden_posts.created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&posts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve hidden posts"})
+		return
+	}
+
+	postDTOs := make([]PostDTO, len(posts))
+	for i, post := range posts {
+		postDTOs[i] = toPostDTO(post)
+	}
+	decoratePosts(db, postDTOs, &viewerID)
+
+	c.JSON(http.StatusOK, PaginatedPostsResponse{
+		Posts:      postDTOs,
+		Page:       page,
+		Limit:      limit,
+		TotalCount: totalCount,
+	})
+}
+
+// @Summary Заглушить группу
+// @Description Убирает посты группы из домашней и общей лент текущего пользователя. Лента самой группы не меняется
+// @Tags groups
+// @Security BearerAuth
+// @Param id path string true "ID группы"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/mute [put]
+func muteGroupHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	muterID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var group models.Group
+	if err := db.First(&group, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	mute := models.MutedGroup{UserID: muterID, GroupID: group.ID, CreatedAt: time.Now()}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&mute).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mute group"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Снять заглушение группы
+// @Description Возвращает посты группы в ленты текущего пользователя
+// @Tags groups
+// @Security BearerAuth
+// @Param id path string true "ID группы"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Router /groups/{id}/mute [delete]
+func unmuteGroupHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	if err := db.Where("user_id = ? AND group_id = ?", userID, c.Param("id")).Delete(&models.MutedGroup{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unmute group"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Заглушить пользователя
+// @Description Убирает посты пользователя из лент текущего пользователя. В отличие от блокировки, заглушённый пользователь об этом не узнаёт и может писать как прежде
+// @Tags users
+// @Security BearerAuth
+// @Param id path string true "ID пользователя"
+// @Success 204 {string} string ""
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /users/{id}/mute [put]
+func muteUserHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	muterID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var target models.User
+	if err := db.First(&target, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if target.ID == muterID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot mute yourself"})
+		return
+	}
+
+	mute := models.MutedUser{UserID: muterID, MutedUserID: target.ID, CreatedAt: time.Now()}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&mute).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mute user"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Снять заглушение пользователя
+// @Description Возвращает посты пользователя в ленты текущего пользователя
+// @Tags users
+// @Security BearerAuth
+// @Param id path string true "ID пользователя"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Router /users/{id}/mute [delete]
+func unmuteUserHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	if err := db.Where("user_id = ? AND muted_user_id = ?", userID, c.Param("id")).Delete(&models.MutedUser{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unmute user"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Получить заглушённые группы и пользователей
+// @Description Возвращает группы и пользователей, заглушённых текущим пользователем
+// @Tags users
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} routes.MutesDTO
+// @Failure 401 {object} map[string]string
+// @Router /users/me/mutes [get]
+func listMutesHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	var groups []models.MutedGroup
+	if err := db.Preload("Group").Where("user_id = ?", userID).Order("created_at DESC").Find(&groups).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve muted groups"})
+		return
+	}
+	var users []models.MutedUser
+	if err := db.Preload("MutedUser").Where("user_id = ?", userID).Order("created_at DESC").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve muted users"})
+		return
+	}
+
+	resp := MutesDTO{
+		Groups: make([]MutedGroupDTO, len(groups)),
+		Users:  make([]MutedUserDTO, len(users)),
+	}
+	for i, mute := range groups {
+		resp.Groups[i] = MutedGroupDTO{
+			GroupID:   mute.GroupID,
+			GroupName: mute.Group.GroupName,
+			CreatedAt: mute.CreatedAt,
+		}
+	}
+	for i, mute := range users {
+		resp.Users[i] = MutedUserDTO{
+			UserID:    mute.MutedUserID,
+			Nickname:  mute.MutedUser.Nickname,
+			CreatedAt: mute.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Получить фильтры по ключевым словам
+// @Description Возвращает ключевые слова, посты с которыми скрыты из лент текущего пользователя
+// @Tags users
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} routes.ContentFilterDTO
+// @Failure 401 {object} map[string]string
+// @Router /users/me/filters [get]
+func listContentFiltersHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	var filters []models.ContentFilter
+	if err := db.Where("user_id = ?", userID).Order("keyword ASC").Find(&filters).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve filters"})
+		return
+	}
+
+	filterDTOs := make([]ContentFilterDTO, len(filters))
+	for i, filter := range filters {
+		filterDTOs[i] = toContentFilterDTO(filter)
+	}
+
+	c.JSON(http.StatusOK, filterDTOs)
+}
+
+// @Summary Добавить фильтр по ключевому слову
+// @Description Скрывает из лент посты, в заголовке или тексте которых встречается ключевое слово, без учёта регистра
+// @Tags users
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param data body routes.CreateContentFilterRequest true "Ключевое слово"
+// @Success 201 {object} routes.ContentFilterDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /users/me/filters [post]
+func createContentFilterHandler(c *gin.Context, db *gorm.DB) {
+	var req CreateContentFilterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	ownerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	keyword := strings.ToLower(strings.TrimSpace(req.Keyword))
+	if keyword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Keyword cannot be empty"})
+		return
+	}
+
+	var count int64
+	db.Model(&models.ContentFilter{}).Where("user_id = ?", ownerID).Count(&count)
+	if count >= maxContentFilters {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many keyword filters"})
+		return
+	}
+
+	filter := models.ContentFilter{UserID: ownerID, Keyword: keyword, CreatedAt: time.Now()}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&filter)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create filter"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This keyword is already filtered"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, toContentFilterDTO(filter))
+}
+
+// @Summary Удалить фильтр по ключевому слову
+// @Description Удаляет фильтр текущего пользователя
+// @Tags users
+// @Security BearerAuth
+// @Param id path string true "ID фильтра"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /users/me/filters/{id} [delete]
+func deleteContentFilterHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	result := db.Where("id = ? AND user_id = ?", c.Param("id"), userID).Delete(&models.ContentFilter{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete filter"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Filter not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func toContentFilterDTO(filter models.ContentFilter) ContentFilterDTO {
+	return ContentFilterDTO{
+		ID:        filter.ID,
+		Keyword:   filter.Keyword,
+		CreatedAt: filter.CreatedAt,
+	}
+}
@@ -0,0 +1,669 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+// @Summary Получить флеры постов группы
+// @Description Возвращает флеры, которые можно назначить постам группы
+// @Tags flairs
+// @Produce json
+// @Param id path string true "ID группы"
+// @Success 200 {array} routes.PostFlairDTO
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/flairs [get]
+func listPostFlairsHandler(c *gin.Context, db *gorm.DB) {
+	var group models.Group
+	if err := db.First(&group, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	var flairs []models.PostFlair
+	if err := db.Where("group_id = ?", group.ID).Order("created_at ASC").Find(&flairs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve flairs"})
+		return
+	}
+
+	flairDTOs := make([]PostFlairDTO, len(flairs))
+	for i, flair := range flairs {
+		flairDTOs[i] = toPostFlairDTO(flair)
+	}
+
+	c.JSON(http.StatusOK, flairDTOs)
+}
+
+// @Summary Создать флер постов
+// @Description Создаёт флер, который можно назначать постам группы
+// @Tags flairs
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param data body routes.PostFlairRequest true "Флер"
+// @Success 201 {object} routes.PostFlairDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/flairs [post]
+func createPostFlairHandler(c *gin.Context, db *gorm.DB) {
+	var req PostFlairRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	group, moderatorID, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	flair := models.PostFlair{
+		GroupID:   group.ID,
+		Text:      req.Text,
+		Color:     req.Color,
+		ModOnly:   req.ModOnly,
+		CreatedAt: time.Now(),
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&flair).Error; err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionEditFlair,
+			TargetType:  "post_flair",
+			TargetID:    &flair.ID,
+		}, nil, toPostFlairDTO(flair))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create flair"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, toPostFlairDTO(flair))
+}
+
+// @Summary Обновить флер постов
+// @Description Обновляет флер постов группы. Текст флера обновляется и в уже отмеченных постах
+// @Tags flairs
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param flairId path string true "ID флера"
+// @Param data body routes.UpdatePostFlairRequest true "Данные для обновления"
+// @Success 200 {object} routes.PostFlairDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/flairs/{flairId} [put]
+func updatePostFlairHandler(c *gin.Context, db *gorm.DB) {
+	var req UpdatePostFlairRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	group, moderatorID, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var flair models.PostFlair
+	if err := db.First(&flair, "id = ? AND group_id = ?", c.Param("flairId"), group.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Flair not found"})
+		return
+	}
+
+	before := toPostFlairDTO(flair)
+	if req.Text != nil {
+		flair.Text = *req.Text
+	}
+	if req.Color != nil {
+		flair.Color = *req.Color
+	}
+	if req.ModOnly != nil {
+		flair.ModOnly = *req.ModOnly
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&flair).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Post{}).Where("flair_id = ?", flair.ID).Update("flair_text", flair.Text).Error; err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionEditFlair,
+			TargetType:  "post_flair",
+			TargetID:    &flair.ID,
+		}, before, toPostFlairDTO(flair))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update flair"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toPostFlairDTO(flair))
+}
+
+// @Summary Удалить флер постов
+// @Description Удаляет флер постов группы и снимает его с постов
+// @Tags flairs
+// @Security BearerAuth
+// @Param id path string true "ID группы"
+// @Param flairId path string true "ID флера"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/flairs/{flairId} [delete]
+func deletePostFlairHandler(c *gin.Context, db *gorm.DB) {
+	group, moderatorID, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var flair models.PostFlair
+	if err := db.First(&flair, "id = ? AND group_id = ?", c.Param("flairId"), group.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Flair not found"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Post{}).Where("flair_id = ?", flair.ID).
+			Updates(map[string]interface{}{"flair_id": nil, "flair_text": ""}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&flair).Error; err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionEditFlair,
+			TargetType:  "post_flair",
+			TargetID:    &flair.ID,
+		}, toPostFlairDTO(flair), nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete flair"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Получить шаблоны флеров пользователей
+// @Description Возвращает шаблоны флеров пользователей группы
+// @Tags flairs
+// @Produce json
+// @Param id path string true "ID группы"
+// @Success 200 {array} routes.UserFlairTemplateDTO
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/user-flairs [get]
+func listUserFlairTemplatesHandler(c *gin.Context, db *gorm.DB) {
+	var group models.Group
+	if err := db.First(&group, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	var templates []models.UserFlairTemplate
+	if err := db.Where("group_id = ?", group.ID).Order("created_at ASC").Find(&templates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve flairs"})
+		return
+	}
+
+	templateDTOs := make([]UserFlairTemplateDTO, len(templates))
+	for i, template := range templates {
+		templateDTOs[i] = toUserFlairTemplateDTO(template)
+	}
+
+	c.JSON(http.StatusOK, templateDTOs)
+}
+
+// @Summary Создать шаблон флера пользователей
+// @Description Создаёт шаблон флера, который пользователи могут выбрать в группе
+// @Tags flairs
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param data body routes.PostFlairRequest true "Флер"
+// @Success 201 {object} routes.UserFlairTemplateDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/user-flairs [post]
+func createUserFlairTemplateHandler(c *gin.Context, db *gorm.DB) {
+	var req PostFlairRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	group, moderatorID, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	template := models.UserFlairTemplate{
+		GroupID:   group.ID,
+		Text:      req.Text,
+		Color:     req.Color,
+		ModOnly:   req.ModOnly,
+		CreatedAt: time.Now(),
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&template).Error; err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionEditFlair,
+			TargetType:  "user_flair",
+			TargetID:    &template.ID,
+		}, nil, toUserFlairTemplateDTO(template))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create flair"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, toUserFlairTemplateDTO(template))
+}
+
+// @Summary Обновить шаблон флера пользователей
+// @Description Обновляет шаблон флера. Флер пользователей, выбравших шаблон, обновляется вместе с ним
+// @Tags flairs
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param flairId path string true "ID шаблона"
+// @Param data body routes.UpdatePostFlairRequest true "Данные для обновления"
+// @Success 200 {object} routes.UserFlairTemplateDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/user-flairs/{flairId} [put]
+func updateUserFlairTemplateHandler(c *gin.Context, db *gorm.DB) {
+	var req UpdatePostFlairRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	group, moderatorID, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var template models.UserFlairTemplate
+	if err := db.First(&template, "id = ? AND group_id = ?", c.Param("flairId"), group.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Flair not found"})
+		return
+	}
+
+	before := toUserFlairTemplateDTO(template)
+	if req.Text != nil {
+		template.Text = *req.Text
+	}
+	if req.Color != nil {
+		template.Color = *req.Color
+	}
+	if req.ModOnly != nil {
+		template.ModOnly = *req.ModOnly
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&template).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.GroupUser{}).Where("flair_template_id = ?", template.ID).Updates(map[string]interface{}{
+			"title":       template.Text,
+			"flair_color": template.Color,
+		}).Error; err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionEditFlair,
+			TargetType:  "user_flair",
+			TargetID:    &template.ID,
+		}, before, toUserFlairTemplateDTO(template))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update flair"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toUserFlairTemplateDTO(template))
+}
+
+// @Summary Удалить шаблон флера пользователей
+// @Description Удаляет шаблон флера. Уже выбранный пользователями флер сохраняется как произвольный
+// @Tags flairs
+// @Security BearerAuth
+// @Param id path string true "ID группы"
+// @Param flairId path string true "ID шаблона"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/user-flairs/{flairId} [delete]
+func deleteUserFlairTemplateHandler(c *gin.Context, db *gorm.DB) {
+	group, moderatorID, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var template models.UserFlairTemplate
+	if err := db.First(&template, "id = ? AND group_id = ?", c.Param("flairId"), group.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Flair not found"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.GroupUser{}).Where("flair_template_id = ?", template.ID).
+			Update("flair_template_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&template).Error; err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionEditFlair,
+			TargetType:  "user_flair",
+			TargetID:    &template.ID,
+		}, toUserFlairTemplateDTO(template), nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete flair"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Выбрать свой флер в группе
+// @Description Устанавливает флер текущего пользователя из шаблона, если он участник группы и группа разрешает самостоятельный выбор. Без шаблона флер снимается
+// @Tags flairs
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param data body routes.SelectUserFlairRequest true "Шаблон флера"
+// @Success 200 {object} routes.AuthorFlairDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/members/me/flair [put]
+func setOwnUserFlairHandler(c *gin.Context, db *gorm.DB) {
+	var req SelectUserFlairRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	memberID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var group models.Group
+	if err := db.First(&group, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	isModerator := isGroupModerator(db, group.ID, memberID)
+	if !group.AllowUserFlair && !isModerator {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This group does not allow users to choose their flair"})
+		return
+	}
+
+	flair := AuthorFlairDTO{}
+	var templateID *uuid.UUID
+	if req.TemplateID != nil {
+		var template models.UserFlairTemplate
+		if err := db.First(&template, "id = ? AND group_id = ?", *req.TemplateID, group.ID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Flair not found in this group"})
+			return
+		}
+		if template.ModOnly && !isModerator {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This flair can only be assigned by moderators"})
+			return
+		}
+		flair = AuthorFlairDTO{Text: template.Text, Color: template.Color}
+		templateID = &template.ID
+	}
+
+	err := saveUserFlair(db, group.ID, memberID, flair, templateID)
+	if errors.Is(err, errNotGroupMember) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only group members can choose a flair"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set flair"})
+		return
+	}
+
+	c.JSON(http.StatusOK, flair)
+}
+
+// @Summary Назначить флер пользователю
+// @Description Модератор назначает участнику группы флер из шаблона или произвольный текст. Пустой запрос снимает флер
+// @Tags flairs
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param userId path string true "ID пользователя"
+// @Param data body routes.AssignUserFlairRequest true "Флер"
+// @Success 200 {object} routes.AuthorFlairDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/members/{userId}/flair [put]
+func assignUserFlairHandler(c *gin.Context, db *gorm.DB) {
+	var req AssignUserFlairRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	group, moderatorID, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var target models.User
+	if err := db.First(&target, "id = ?", c.Param("userId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	flair := AuthorFlairDTO{Text: req.Text, Color: req.Color}
+	var templateID *uuid.UUID
+	if req.TemplateID != nil {
+		var template models.UserFlairTemplate
+		if err := db.First(&template, "id = ? AND group_id = ?", *req.TemplateID, group.ID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Flair not found in this group"})
+			return
+		}
+		flair = AuthorFlairDTO{Text: template.Text, Color: template.Color}
+		templateID = &template.ID
+	}
+
+	var before models.GroupUser
+	db.Where("group_id = ? AND user_id = ?", group.ID, target.ID).Limit(1).Find(&before)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := saveUserFlair(tx, group.ID, target.ID, flair, templateID); err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionSetUserFlair,
+			TargetType:  "user",
+			TargetID:    &target.ID,
+		}, AuthorFlairDTO{Text: before.Title, Color: before.FlairColor}, flair)
+	})
+	if errors.Is(err, errNotGroupMember) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not a member of this group"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set flair"})
+		return
+	}
+
+	c.JSON(http.StatusOK, flair)
+}
+
+var errNotGroupMember = errors.New("user is not a member of this group")
+
+// Сохраняет флер пользователя в его записи участника группы. Флер есть только у участников,
+// поэтому для остальных возвращается errNotGroupMember.
+func saveUserFlair(db *gorm.DB, groupID, userID uuid.UUID, flair AuthorFlairDTO, templateID *uuid.UUID) error {
+	result := db.Model(&models.GroupUser{}).
+		Where("group_id = ? AND user_id = ?", groupID, userID).
+		Updates(map[string]interface{}{
+			"title":             flair.Text,
+			"flair_color":       flair.Color,
+			"flair_template_id": templateID,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errNotGroupMember
+	}
+	return nil
+}
+
+// Ключ для поиска флера автора в конкретной группе.
+type groupMemberKey struct {
+	GroupID uuid.UUID
+	UserID  uuid.UUID
+}
+
+// Загружает флеры авторов в группах одним запросом.
+func loadAuthorFlairs(db *gorm.DB, keys []groupMemberKey) map[groupMemberKey]*AuthorFlairDTO {
+	flairs := map[groupMemberKey]*AuthorFlairDTO{}
+	if len(keys) == 0 {
+		return flairs
+	}
+
+	groupIDs := make([]uuid.UUID, 0, len(keys))
+	userIDs := make([]uuid.UUID, 0, len(keys))
+	for _, key := range keys {
+		groupIDs = append(groupIDs, key.GroupID)
+		userIDs = append(userIDs, key.UserID)
+	}
+
+	var members []models.GroupUser
+	db.Where("group_id IN ? AND user_id IN ? AND title <> ''", groupIDs, userIDs).Find(&members)
+	for _, member := range members {
+		flairs[groupMemberKey{GroupID: member.GroupID, UserID: member.UserID}] = &AuthorFlairDTO{
+			Text:  member.Title,
+			Color: member.FlairColor,
+		}
+	}
+	return flairs
+}
+
+// Добавляет к постам флеры их авторов в группах постов.
+func attachPostAuthorFlairs(db *gorm.DB, posts []PostDTO) {
+	var keys []groupMemberKey
+	for _, post := range posts {
+		if post.GroupID != nil {
+			keys = append(keys, groupMemberKey{GroupID: *post.GroupID, UserID: post.AuthorID})
+		}
+	}
+	flairs := loadAuthorFlairs(db, keys)
+	for i, post := range posts {
+		if post.GroupID != nil {
+			posts[i].AuthorFlair = flairs[groupMemberKey{GroupID: *post.GroupID, UserID: post.AuthorID}]
+		}
+	}
+}
+
+// Добавляет к комментариям флеры их авторов в группе поста.
+func attachCommentAuthorFlairs(db *gorm.DB, groupID *uuid.UUID, comments []CommentDTO) {
+	if groupID == nil {
+		return
+	}
+	keys := make([]groupMemberKey, len(comments))
+	for i, comment := range comments {
+		keys[i] = groupMemberKey{GroupID: *groupID, UserID: comment.AuthorID}
+	}
+	flairs := loadAuthorFlairs(db, keys)
+	for i, comment := range comments {
+		comments[i].AuthorFlair = flairs[groupMemberKey{GroupID: *groupID, UserID: comment.AuthorID}]
+	}
+}
+
+func toUserFlairTemplateDTO(template models.UserFlairTemplate) UserFlairTemplateDTO {
+	return UserFlairTemplateDTO{
+		ID:      template.ID,
+		Text:    template.Text,
+		Color:   template.Color,
+		ModOnly: template.ModOnly,
+	}
+}
+
+// Проверяет, что флер принадлежит группе и доступен пользователю.
+func resolvePostFlair(db *gorm.DB, groupID uuid.UUID, flairID uuid.UUID, userID uuid.UUID) (models.PostFlair, string) {
+	var flair models.PostFlair
+	if err := db.First(&flair, "id = ? AND group_id = ?", flairID, groupID).Error; err != nil {
+		return flair, "Flair not found in this group"
+	}
+	if flair.ModOnly && !isGroupModerator(db, groupID, userID) {
+		return flair, "This flair can only be set by moderators"
+	}
+	return flair, ""
+}
+
+func toPostFlairDTO(flair models.PostFlair) PostFlairDTO {
+	return PostFlairDTO{
+		ID:      flair.ID,
+		Text:    flair.Text,
+		Color:   flair.Color,
+		ModOnly: flair.ModOnly,
+	}
+}
@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"chirp/models"
+)
+
+func TestSaveUserFlairNeverCreatesMembership(t *testing.T) {
+	db, recorder := dryRunDB(t)
+
+	// The dry run matches no rows, as for a user outside the group.
+	err := saveUserFlair(db, uuid.New(), uuid.New(), AuthorFlairDTO{Text: "Regular"}, nil)
+	if !errors.Is(err, errNotGroupMember) {
+		t.Errorf("saveUserFlair for a non-member: %v, want errNotGroupMember", err)
+	}
+	if inserts := recorder.matching(`INSERT INTO "group_users"`); len(inserts) != 0 {
+		t.Errorf("membership was created: %v", inserts)
+	}
+	if len(recorder.matching(`UPDATE "group_users" SET`)) != 1 {
+		t.Errorf("flair was not saved on the membership: %v", recorder.statements)
+	}
+}
+
+func TestAssignUserFlairOnlyToMembers(t *testing.T) {
+	moderator, user := uuid.New(), uuid.New()
+	group := models.Group{ID: uuid.New()}
+
+	for _, tc := range []struct {
+		name       string
+		members    int64
+		wantStatus int
+	}{
+		{"member", 1, http.StatusOK},
+		{"not a member", 0, http.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newStubDB(t)
+			db.returning(`FROM "groups" WHERE id = '`+group.ID.String()+`'`, group)
+			db.returning(`FROM "group_moderators" WHERE group_id = '`+group.ID.String()+`' AND user_id = '`+moderator.String()+`'`, int64(1))
+			db.returning(`FROM "users" WHERE id = '`+user.String()+`'`, models.User{ID: user})
+			db.affecting("group_users", tc.members)
+
+			target := "/groups/" + group.ID.String() + "/members/" + user.String() + "/flair"
+			w := serve(db.DB, http.MethodPut, "/groups/:id/members/:userId/flair", target, `{"text":"Regular"}`, &moderator, assignUserFlairHandler)
+			if w.Code != tc.wantStatus {
+				t.Fatalf("status %d, want %d; body %s", w.Code, tc.wantStatus, w.Body)
+			}
+			if inserts := db.recorder.matching(`INSERT INTO "group_users"`); len(inserts) != 0 {
+				t.Errorf("membership was created: %v", inserts)
+			}
+			logged := len(db.recorder.matching(`INSERT INTO "mod_actions"`)) == 1
+			if logged != (tc.members > 0) {
+				t.Errorf("flair change logged = %v, want %v", logged, tc.members > 0)
+			}
+		})
+	}
+}
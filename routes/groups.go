@@ -41,11 +41,20 @@ func createGroupHandler(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	var bannerURL string
+	if req.BannerMediaID != nil {
+		var errMsg string
+		if bannerURL, errMsg = bannerURLFor(db, authorID, *req.BannerMediaID); errMsg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+			return
+		}
+	}
+
 	group := models.Group{
 		ID:           uuid.New(),
 		GroupName:    req.GroupName,
 		Description:  req.Description,
-		BannerURL:    req.BannerURL,
+		BannerURL:    bannerURL,
 		RegisteredAt: time.Now(),
 		Moderators:   []models.User{{ID: authorID}},
 	}
@@ -56,11 +65,14 @@ func createGroupHandler(c *gin.Context, db *gorm.DB) {
 	}
 
 	resp := GroupDTO{
-		ID:           group.ID,
-		GroupName:    group.GroupName,
-		RegisteredAt: group.RegisteredAt,
-		BannerURL:    group.BannerURL,
-		Description:  group.Description,
+		ID:             group.ID,
+		GroupName:      group.GroupName,
+		RegisteredAt:   group.RegisteredAt,
+		BannerURL:      group.BannerURL,
+		Description:    group.Description,
+		PublicModLog:   group.PublicModLog,
+		RequireFlair:   group.RequireFlair,
+		AllowUserFlair: group.AllowUserFlair,
 	}
 
 	c.JSON(http.StatusCreated, resp)
@@ -83,11 +95,14 @@ func listGroupsHandler(c *gin.Context, db *gorm.DB) {
 	groupDTOs := make([]GroupDTO, len(groups))
 	for i, group := range groups {
 		groupDTOs[i] = GroupDTO{
-			ID:           group.ID,
-			GroupName:    group.GroupName,
-			RegisteredAt: group.RegisteredAt,
-			BannerURL:    group.BannerURL,
-			Description:  group.Description,
+			ID:             group.ID,
+			GroupName:      group.GroupName,
+			RegisteredAt:   group.RegisteredAt,
+			BannerURL:      group.BannerURL,
+			Description:    group.Description,
+			PublicModLog:   group.PublicModLog,
+			RequireFlair:   group.RequireFlair,
+			AllowUserFlair: group.AllowUserFlair,
 		}
 	}
 
@@ -129,16 +144,26 @@ func getGroupDetailsHandler(c *gin.Context, db *gorm.DB) {
 		}
 	}
 
+	rules, err := groupRules(db, group.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve rules"})
+		return
+	}
+
 	resp := GroupDetailDTO{
 		GroupDTO: GroupDTO{
-			ID:           group.ID,
-			GroupName:    group.GroupName,
-			RegisteredAt: group.RegisteredAt,
-			BannerURL:    group.BannerURL,
-			Description:  group.Description,
+			ID:             group.ID,
+			GroupName:      group.GroupName,
+			RegisteredAt:   group.RegisteredAt,
+			BannerURL:      group.BannerURL,
+			Description:    group.Description,
+			PublicModLog:   group.PublicModLog,
+			RequireFlair:   group.RequireFlair,
+			AllowUserFlair: group.AllowUserFlair,
 		},
 		Moderators: moderators,
 		Users:      users,
+		Rules:      rules,
 	}
 
 	c.JSON(http.StatusOK, resp)
@@ -155,6 +180,7 @@ func getGroupDetailsHandler(c *gin.Context, db *gorm.DB) {
 // @Success 200 {object} routes.GroupDTO
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Router /groups/{id} [put]
 func updateGroupHandler(c *gin.Context, db *gorm.DB) {
@@ -165,47 +191,130 @@ func updateGroupHandler(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	moderatorID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
 	var group models.Group
 	if err := db.First(&group, "id = ?", groupID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to find group"})
 		return
 	}
 
+	if !isGroupModerator(db, group.ID, moderatorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to edit this group"})
+		return
+	}
+
+	before := groupSettings(group)
 	if req.Description != nil {
 		group.Description = *req.Description
 	}
-	if req.BannerURL != nil {
-		group.BannerURL = *req.BannerURL
+	if req.BannerMediaID != nil {
+		bannerURL, errMsg := bannerURLFor(db, moderatorID, *req.BannerMediaID)
+		if errMsg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+			return
+		}
+		group.BannerURL = bannerURL
+	}
+	if req.PublicModLog != nil {
+		group.PublicModLog = *req.PublicModLog
+	}
+	if req.RequireFlair != nil {
+		group.RequireFlair = *req.RequireFlair
+	}
+	if req.AllowUserFlair != nil {
+		group.AllowUserFlair = *req.AllowUserFlair
 	}
 
-	if err := db.Save(&group).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&group).Error; err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionEditSettings,
+			TargetType:  "group",
+			TargetID:    &group.ID,
+		}, before, groupSettings(group))
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
 		return
 	}
 
 	resp := GroupDTO{
-		ID:           group.ID,
-		GroupName:    group.GroupName,
-		RegisteredAt: group.RegisteredAt,
-		BannerURL:    group.BannerURL,
-		Description:  group.Description,
+		ID:             group.ID,
+		GroupName:      group.GroupName,
+		RegisteredAt:   group.RegisteredAt,
+		BannerURL:      group.BannerURL,
+		Description:    group.Description,
+		PublicModLog:   group.PublicModLog,
+		RequireFlair:   group.RequireFlair,
+		AllowUserFlair: group.AllowUserFlair,
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
 
 // @Summary Удалить группу
-// @Description Удаляет группу
+// @Description Удаляет группу вместе с её постами. Удалить группу может модератор или администратор; удаливший модератор может восстановить её в течение SELF_RESTORE_WINDOW
 // @Tags groups
 // @Security BearerAuth
 // @Param id path string true "ID группы"
 // @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /groups/{id} [delete]
 func deleteGroupHandler(c *gin.Context, db *gorm.DB) {
 	groupID := c.Param("id")
 
-	if err := db.Delete(&models.Group{}, "id = ?", groupID).Error; err != nil {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	moderatorID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var group models.Group
+	if err := db.First(&group, "id = ?", groupID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	if !isGroupModerator(db, group.ID, moderatorID) && !isAdmin(db, moderatorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to delete this group"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := softDelete(tx, &models.Group{}, group.ID, moderatorID); err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionDeleteGroup,
+			TargetType:  "group",
+			TargetID:    &group.ID,
+		}, nil, nil)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
 		return
 	}
@@ -213,6 +322,17 @@ func deleteGroupHandler(c *gin.Context, db *gorm.DB) {
 	c.Status(http.StatusNoContent)
 }
 
+// Возвращает изменяемые настройки группы для журнала модерации.
+func groupSettings(group models.Group) gin.H {
+	return gin.H{
+		"description":    group.Description,
+		"bannerUrl":      group.BannerURL,
+		"publicModLog":   group.PublicModLog,
+		"requireFlair":   group.RequireFlair,
+		"allowUserFlair": group.AllowUserFlair,
+	}
+}
+
 func RegisterGroupRoutes(r *gin.RouterGroup, db *gorm.DB) {
 	r.POST("/", JWTMiddleware(), func(c *gin.Context) {
 		createGroupHandler(c, db)
@@ -233,4 +353,188 @@ func RegisterGroupRoutes(r *gin.RouterGroup, db *gorm.DB) {
 	r.DELETE("/:id", JWTMiddleware(), func(c *gin.Context) {
 		deleteGroupHandler(c, db)
 	})
+
+	r.PUT("/:id/mute", JWTMiddleware(), func(c *gin.Context) {
+		muteGroupHandler(c, db)
+	})
+
+	r.DELETE("/:id/mute", JWTMiddleware(), func(c *gin.Context) {
+		unmuteGroupHandler(c, db)
+	})
+
+	r.POST("/:id/restore", JWTMiddleware(), func(c *gin.Context) {
+		restoreGroupHandler(c, db)
+	})
+
+	r.GET("/:id/modlog", OptionalJWTMiddleware(), func(c *gin.Context) {
+		getModLogHandler(c, db)
+	})
+
+	r.GET("/:id/bans", JWTMiddleware(), func(c *gin.Context) {
+		listGroupBansHandler(c, db)
+	})
+
+	r.POST("/:id/bans", JWTMiddleware(), func(c *gin.Context) {
+		banUserHandler(c, db)
+	})
+
+	r.DELETE("/:id/bans/:userId", JWTMiddleware(), func(c *gin.Context) {
+		unbanUserHandler(c, db)
+	})
+
+	r.GET("/:id/banned-images", JWTMiddleware(), func(c *gin.Context) {
+		listGroupBannedImagesHandler(c, db)
+	})
+
+	r.POST("/:id/banned-images", JWTMiddleware(), func(c *gin.Context) {
+		banGroupImageHandler(c, db)
+	})
+
+	r.DELETE("/:id/banned-images/:banId", JWTMiddleware(), func(c *gin.Context) {
+		unbanGroupImageHandler(c, db)
+	})
+
+	r.GET("/:id/modqueue", JWTMiddleware(), func(c *gin.Context) {
+		getModQueueHandler(c, db)
+	})
+
+	r.GET("/:id/automod", JWTMiddleware(), func(c *gin.Context) {
+		listAutoModRulesHandler(c, db)
+	})
+
+	r.POST("/:id/automod", JWTMiddleware(), func(c *gin.Context) {
+		createAutoModRuleHandler(c, db)
+	})
+
+	r.POST("/:id/automod/test", JWTMiddleware(), func(c *gin.Context) {
+		testAutoModHandler(c, db)
+	})
+
+	r.PUT("/:id/automod/:ruleId", JWTMiddleware(), func(c *gin.Context) {
+		updateAutoModRuleHandler(c, db)
+	})
+
+	r.DELETE("/:id/automod/:ruleId", JWTMiddleware(), func(c *gin.Context) {
+		deleteAutoModRuleHandler(c, db)
+	})
+
+	r.GET("/:id/rules", func(c *gin.Context) {
+		listGroupRulesHandler(c, db)
+	})
+
+	r.POST("/:id/rules", JWTMiddleware(), func(c *gin.Context) {
+		createGroupRuleHandler(c, db)
+	})
+
+	r.PUT("/:id/rules/order", JWTMiddleware(), func(c *gin.Context) {
+		reorderGroupRulesHandler(c, db)
+	})
+
+	r.PUT("/:id/rules/:ruleId", JWTMiddleware(), func(c *gin.Context) {
+		updateGroupRuleHandler(c, db)
+	})
+
+	r.DELETE("/:id/rules/:ruleId", JWTMiddleware(), func(c *gin.Context) {
+		deleteGroupRuleHandler(c, db)
+	})
+
+	r.GET("/:id/flairs", func(c *gin.Context) {
+		listPostFlairsHandler(c, db)
+	})
+
+	r.POST("/:id/flairs", JWTMiddleware(), func(c *gin.Context) {
+		createPostFlairHandler(c, db)
+	})
+
+	r.PUT("/:id/flairs/:flairId", JWTMiddleware(), func(c *gin.Context) {
+		updatePostFlairHandler(c, db)
+	})
+
+	r.DELETE("/:id/flairs/:flairId", JWTMiddleware(), func(c *gin.Context) {
+		deletePostFlairHandler(c, db)
+	})
+
+	r.GET("/:id/user-flairs", func(c *gin.Context) {
+		listUserFlairTemplatesHandler(c, db)
+	})
+
+	r.POST("/:id/user-flairs", JWTMiddleware(), func(c *gin.Context) {
+		createUserFlairTemplateHandler(c, db)
+	})
+
+	r.PUT("/:id/user-flairs/:flairId", JWTMiddleware(), func(c *gin.Context) {
+		updateUserFlairTemplateHandler(c, db)
+	})
+
+	r.DELETE("/:id/user-flairs/:flairId", JWTMiddleware(), func(c *gin.Context) {
+		deleteUserFlairTemplateHandler(c, db)
+	})
+
+	r.PUT("/:id/members/me/flair", JWTMiddleware(), func(c *gin.Context) {
+		setOwnUserFlairHandler(c, db)
+	})
+
+	r.PUT("/:id/members/:userId/flair", JWTMiddleware(), func(c *gin.Context) {
+		assignUserFlairHandler(c, db)
+	})
+
+	r.GET("/:id/wiki", func(c *gin.Context) {
+		listWikiPagesHandler(c, db)
+	})
+
+	r.GET("/:id/wiki/*path", OptionalJWTMiddleware(), func(c *gin.Context) {
+		getWikiPageHandler(c, db)
+	})
+
+	r.PUT("/:id/wiki/*path", JWTMiddleware(), func(c *gin.Context) {
+		editWikiPageHandler(c, db)
+	})
+
+	r.GET("/:id/wiki-history/*path", func(c *gin.Context) {
+		getWikiHistoryHandler(c, db)
+	})
+
+	r.GET("/:id/wiki-diff/*path", func(c *gin.Context) {
+		getWikiDiffHandler(c, db)
+	})
+
+	r.POST("/:id/wiki-revert/*path", JWTMiddleware(), func(c *gin.Context) {
+		revertWikiPageHandler(c, db)
+	})
+
+	r.PUT("/:id/wiki-permissions/*path", JWTMiddleware(), func(c *gin.Context) {
+		updateWikiPermissionHandler(c, db)
+	})
+
+	r.GET("/:id/wiki-contributors", JWTMiddleware(), func(c *gin.Context) {
+		listWikiContributorsHandler(c, db)
+	})
+
+	r.PUT("/:id/wiki-contributors/:userId", JWTMiddleware(), func(c *gin.Context) {
+		addWikiContributorHandler(c, db)
+	})
+
+	r.DELETE("/:id/wiki-contributors/:userId", JWTMiddleware(), func(c *gin.Context) {
+		removeWikiContributorHandler(c, db)
+	})
+
+	r.POST("/:id/modmail", JWTMiddleware(), func(c *gin.Context) {
+		createModmailThreadHandler(c, db)
+	})
+
+	r.GET("/:id/modmail", JWTMiddleware(), func(c *gin.Context) {
+		listGroupModmailHandler(c, db)
+	})
+
+	r.GET("/:id/modmail/:threadId", JWTMiddleware(), func(c *gin.Context) {
+		getModmailThreadHandler(c, db)
+	})
+
+	r.POST("/:id/modmail/:threadId/messages", JWTMiddleware(), func(c *gin.Context) {
+		replyModmailHandler(c, db)
+	})
+
+	r.PUT("/:id/modmail/:threadId/state", JWTMiddleware(), func(c *gin.Context) {
+		updateModmailStateHandler(c, db)
+	})
 }
\ No newline at end of file
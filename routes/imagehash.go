@@ -0,0 +1,598 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"math/bits"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+// How far back in a group reposts of an image are looked for, and how many images are compared.
+const (
+	repostWindow    = 30 * 24 * time.Hour
+	maxRepostImages = 5000
+)
+
+// Вычисляет перцептивные хеши изображения: pHash (по низким частотам DCT) и dHash (по градиентам яркости).
+// Похожие изображения дают хеши, отличающиеся в немногих битах, даже после пересжатия и изменения размера.
+func perceptualHashes(img image.Image) (uint64, uint64) {
+	return phash(grayscale(resizeImage(img, 32, 32))), dhash(grayscale(resizeImage(img, 9, 8)))
+}
+
+// Декодирует изображение и вычисляет его хеши.
+func hashImage(data []byte, contentType string) (uint64, uint64, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, errInvalidImage
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return 0, 0, errTooManyPixels
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, errInvalidImage
+	}
+	if contentType == "image/jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	p, d := perceptualHashes(img)
+	return p, d, nil
+}
+
+func grayscale(img *image.RGBA) [][]float64 {
+	bounds := img.Bounds()
+	rows := make([][]float64, bounds.Dy())
+	for y := range rows {
+		rows[y] = make([]float64, bounds.Dx())
+		for x := range rows[y] {
+			offset := img.PixOffset(x, y)
+			rows[y][x] = 0.299*float64(img.Pix[offset]) + 0.587*float64(img.Pix[offset+1]) + 0.114*float64(img.Pix[offset+2])
+		}
+	}
+	return rows
+}
+
+// Each bit says whether a pixel of the 9x8 thumbnail is brighter than its right neighbour.
+func dhash(gray [][]float64) uint64 {
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if gray[y][x] > gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// Each bit says whether one of the 8x8 lowest DCT frequencies of the 32x32 thumbnail is above their median.
+func phash(gray [][]float64) uint64 {
+	const size, low = 32, 8
+	var coefficients [low][low]float64
+	for v := 0; v < low; v++ {
+		for u := 0; u < low; u++ {
+			sum := 0.0
+			for y := 0; y < size; y++ {
+				for x := 0; x < size; x++ {
+					sum += gray[y][x] *
+						math.Cos(float64(2*x+1)*float64(u)*math.Pi/(2*size)) *
+						math.Cos(float64(2*y+1)*float64(v)*math.Pi/(2*size))
+				}
+			}
+			coefficients[v][u] = sum
+		}
+	}
+
+	// The DC term only reflects overall brightness, so it is left out of the median.
+	values := make([]float64, 0, low*low-1)
+	for v := 0; v < low; v++ {
+		for u := 0; u < low; u++ {
+			if u != 0 || v != 0 {
+				values = append(values, coefficients[v][u])
+			}
+		}
+	}
+	sort.Float64s(values)
+	median := values[len(values)/2]
+
+	var hash uint64
+	for v := 0; v < low; v++ {
+		for u := 0; u < low; u++ {
+			hash <<= 1
+			if coefficients[v][u] > median {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// Distance between two images: the larger of the pHash and dHash Hamming distances, so both must agree.
+func imageDistance(pa, da, pb, db int64) int {
+	return max(bits.OnesCount64(uint64(pa^pb)), bits.OnesCount64(uint64(da^db)))
+}
+
+// Пороги расстояния между изображениями: не больше reject изображение считается тем же, не больше hold — похожим.
+func imageMatchThresholds() (hold int, reject int) {
+	hold, reject = 10, 4
+	if value, err := strconv.Atoi(os.Getenv("IMAGE_MATCH_HOLD_DISTANCE")); err == nil {
+		hold = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("IMAGE_MATCH_REJECT_DISTANCE")); err == nil {
+		reject = value
+	}
+	return hold, reject
+}
+
+// Решение проверки изображений нового поста.
+type imageVerdict struct {
+	Hold   bool
+	Reject bool
+	Reason string
+}
+
+// Сравнивает изображения поста с запрещёнными в группе и на всём сайте, а в группе — и с недавними постами.
+// Совпадение с запрещённым изображением отклоняет пост, похожее изображение или повтор отправляют пост модераторам.
+// Вне групп модераторов нет, поэтому там действует только отклонение.
+func checkPostImages(db *gorm.DB, groupID *uuid.UUID, excludePostID *uuid.UUID, media []models.Media) imageVerdict {
+	var hashed []models.Media
+	for _, item := range media {
+		if item.PHash != nil && item.DHash != nil {
+			hashed = append(hashed, item)
+		}
+	}
+	if len(hashed) == 0 {
+		return imageVerdict{}
+	}
+	hold, reject := imageMatchThresholds()
+
+	scopes := []*uuid.UUID{nil}
+	radius := reject
+	if groupID != nil {
+		scopes = append(scopes, groupID)
+		radius = hold
+	}
+
+	verdict := imageVerdict{}
+	for _, scope := range scopes {
+		banned, err := bannedImagesIn(db, scope)
+		if err != nil {
+			log.Println("Failed to load banned images:", err)
+			continue
+		}
+		where := "the site"
+		if scope != nil {
+			where = "this group"
+		}
+		for _, item := range hashed {
+			closest := radius + 1
+			banned.within(*item.PHash, *item.DHash, radius, func(_ models.BannedImage, distance int) {
+				closest = min(closest, distance)
+			})
+			switch {
+			case closest <= reject:
+				return imageVerdict{Reject: true, Reason: "An image in this post is banned on " + where}
+			case closest <= hold && groupID != nil && !verdict.Hold:
+				verdict = imageVerdict{Hold: true, Reason: fmt.Sprintf("Image resembles an image banned on %s (distance %d)", where, closest)}
+			}
+		}
+	}
+	if verdict.Hold || groupID == nil {
+		return verdict
+	}
+
+	type recentImage struct {
+		PostID uuid.UUID
+		PHash  int64
+		DHash  int64
+	}
+	var recent []recentImage
+	recentQuery := db.Table("post_media").
+		Select("post_media.post_id, media.p_hash, media.d_hash").
+		Joins("JOIN media ON media.id = post_media.media_id").
+		Joins("JOIN posts ON posts.id = post_media.post_id").
+		Where("posts.group_id = ? AND posts.mod_status <> ? AND posts.deleted_at IS NULL AND posts.created_at > ? AND media.p_hash IS NOT NULL",
+			*groupID, models.ContentRemoved, time.Now().Add(-repostWindow))
+	if excludePostID != nil {
+		recentQuery = recentQuery.Where("post_media.post_id <> ?", *excludePostID)
+	}
+	recentQuery.Order("posts.created_at DESC").Limit(maxRepostImages).Scan(&recent)
+	for _, item := range hashed {
+		for _, other := range recent {
+			if imageDistance(*item.PHash, *item.DHash, other.PHash, other.DHash) <= reject {
+				return imageVerdict{Hold: true, Reason: "Possible repost of post " + other.PostID.String()}
+			}
+		}
+	}
+	return verdict
+}
+
+// Запрещённые изображения сайта и групп кешируются в BK-деревьях, чтобы не загружать их при каждом посте.
+// Кеш сбрасывается при изменении запретов на этом сервере, а изменения на других серверах
+// становятся видны не позже чем через bannedImagesTTL.
+const bannedImagesTTL = time.Minute
+
+type cachedBannedImages struct {
+	tree     *bkTree
+	loadedAt time.Time
+}
+
+var (
+	bannedImagesMu    sync.Mutex
+	bannedImagesCache = map[uuid.UUID]cachedBannedImages{}
+)
+
+// Возвращает дерево изображений, запрещённых в группе или, если группа не указана, на всём сайте.
+func bannedImagesIn(db *gorm.DB, groupID *uuid.UUID) (*bkTree, error) {
+	key := uuid.Nil
+	if groupID != nil {
+		key = *groupID
+	}
+	bannedImagesMu.Lock()
+	cached, ok := bannedImagesCache[key]
+	bannedImagesMu.Unlock()
+	if ok && time.Since(cached.loadedAt) < bannedImagesTTL {
+		return cached.tree, nil
+	}
+
+	loadedAt := time.Now()
+	var bans []models.BannedImage
+	query := db.Select("id", "group_id", "p_hash", "d_hash").Where("group_id IS NULL")
+	if groupID != nil {
+		query = db.Select("id", "group_id", "p_hash", "d_hash").Where("group_id = ?", *groupID)
+	}
+	if err := query.Find(&bans).Error; err != nil {
+		return nil, err
+	}
+	tree := &bkTree{}
+	for _, ban := range bans {
+		tree.insert(ban)
+	}
+
+	bannedImagesMu.Lock()
+	// A reset made while the bans were loading means they may already be outdated.
+	if current, ok := bannedImagesCache[key]; !ok || current.loadedAt.Before(loadedAt) {
+		bannedImagesCache[key] = cachedBannedImages{tree: tree, loadedAt: loadedAt}
+	}
+	bannedImagesMu.Unlock()
+	return tree, nil
+}
+
+// Сбрасывает кеш запрещённых изображений группы или сайта. Вызывается после фиксации изменений.
+func resetBannedImages(groupID *uuid.UUID) {
+	key := uuid.Nil
+	if groupID != nil {
+		key = *groupID
+	}
+	bannedImagesMu.Lock()
+	delete(bannedImagesCache, key)
+	bannedImagesMu.Unlock()
+}
+
+// Оставляет жалобу от имени проверки изображений, чтобы модераторы видели причину удержания поста.
+func reportImageHold(tx *gorm.DB, groupID *uuid.UUID, postID uuid.UUID, reason string) error {
+	return tx.Create(&models.Report{
+		GroupID:   groupID,
+		PostID:    &postID,
+		Reason:    "Image check: " + reason,
+		CreatedAt: time.Now(),
+	}).Error
+}
+
+// Запрещает изображения поста в группе или, если группа не указана, на всём сайте.
+func banPostImages(tx *gorm.DB, groupID *uuid.UUID, postID uuid.UUID, bannedByID uuid.UUID, reason string) ([]models.BannedImage, error) {
+	var media []models.Media
+	if err := tx.Joins("JOIN post_media ON post_media.media_id = media.id").
+		Where("post_media.post_id = ? AND media.p_hash IS NOT NULL", postID).
+		Find(&media).Error; err != nil {
+		return nil, err
+	}
+	return banImages(tx, groupID, &postID, media, bannedByID, reason)
+}
+
+func banImages(tx *gorm.DB, groupID *uuid.UUID, postID *uuid.UUID, media []models.Media, bannedByID uuid.UUID, reason string) ([]models.BannedImage, error) {
+	var bans []models.BannedImage
+	for _, item := range media {
+		if item.PHash == nil || item.DHash == nil {
+			continue
+		}
+		bans = append(bans, models.BannedImage{
+			ID:         uuid.New(),
+			GroupID:    groupID,
+			PHash:      *item.PHash,
+			DHash:      *item.DHash,
+			MediaID:    &item.ID,
+			PostID:     postID,
+			BannedByID: bannedByID,
+			Reason:     reason,
+			CreatedAt:  time.Now(),
+		})
+	}
+	if len(bans) == 0 {
+		return nil, nil
+	}
+	return bans, tx.Create(&bans).Error
+}
+
+func toBannedImageDTO(ban models.BannedImage) BannedImageDTO {
+	return BannedImageDTO{
+		ID:         ban.ID,
+		GroupID:    ban.GroupID,
+		PHash:      fmt.Sprintf("%016x", uint64(ban.PHash)),
+		DHash:      fmt.Sprintf("%016x", uint64(ban.DHash)),
+		MediaID:    ban.MediaID,
+		PostID:     ban.PostID,
+		BannedByID: ban.BannedByID,
+		Reason:     ban.Reason,
+		CreatedAt:  ban.CreatedAt,
+	}
+}
+
+// Находит изображения, которые нужно запретить: изображения поста или отдельный файл.
+func imagesToBan(db *gorm.DB, req BanImageRequest) ([]models.Media, string) {
+	if (req.PostID == nil) == (req.MediaID == nil) {
+		return nil, "Specify either postId or mediaId"
+	}
+	var media []models.Media
+	if req.PostID != nil {
+		db.Joins("JOIN post_media ON post_media.media_id = media.id").
+			Where("post_media.post_id = ? AND media.p_hash IS NOT NULL", *req.PostID).
+			Find(&media)
+	} else {
+		db.Where("id = ? AND p_hash IS NOT NULL", *req.MediaID).Find(&media)
+	}
+	if len(media) == 0 {
+		return nil, "No images to ban were found"
+	}
+	return media, ""
+}
+
+// @Summary Получить запрещённые изображения группы
+// @Description Возвращает изображения, запрещённые в группе. Изображения удалённых модераторами постов попадают сюда автоматически
+// @Tags moderation
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID группы"
+// @Success 200 {array} routes.BannedImageDTO
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/banned-images [get]
+func listGroupBannedImagesHandler(c *gin.Context, db *gorm.DB) {
+	group, _, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var bans []models.BannedImage
+	if err := db.Where("group_id = ?", group.ID).Order("created_at DESC").Find(&bans).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve banned images"})
+		return
+	}
+
+	dtos := make([]BannedImageDTO, len(bans))
+	for i, ban := range bans {
+		dtos[i] = toBannedImageDTO(ban)
+	}
+	c.JSON(http.StatusOK, dtos)
+}
+
+// @Summary Запретить изображение в группе
+// @Description Запрещает изображения поста группы или загруженный файл. Посты с похожими изображениями будут отклоняться или уходить на проверку
+// @Tags moderation
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param data body routes.BanImageRequest true "Пост или файл"
+// @Success 201 {array} routes.BannedImageDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/banned-images [post]
+func banGroupImageHandler(c *gin.Context, db *gorm.DB) {
+	var req BanImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	group, moderatorID, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if req.PostID != nil {
+		var count int64
+		db.Model(&models.Post{}).Where("id = ? AND group_id = ?", *req.PostID, group.ID).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found in this group"})
+			return
+		}
+	}
+	media, errMsg := imagesToBan(db, req)
+	if errMsg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+
+	var bans []models.BannedImage
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if bans, err = banImages(tx, &group.ID, req.PostID, media, moderatorID, req.Reason); err != nil {
+			return err
+		}
+		for _, ban := range bans {
+			if err := recordModAction(tx, models.ModAction{
+				GroupID:     group.ID,
+				ModeratorID: moderatorID,
+				Action:      models.ModActionBanImage,
+				TargetType:  "image",
+				TargetID:    &ban.ID,
+				Reason:      req.Reason,
+			}, nil, toBannedImageDTO(ban)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to ban images"})
+		return
+	}
+	resetBannedImages(&group.ID)
+
+	dtos := make([]BannedImageDTO, len(bans))
+	for i, ban := range bans {
+		dtos[i] = toBannedImageDTO(ban)
+	}
+	c.JSON(http.StatusCreated, dtos)
+}
+
+// @Summary Снять запрет с изображения в группе
+// @Description Удаляет изображение из списка запрещённых в группе
+// @Tags moderation
+// @Security BearerAuth
+// @Param id path string true "ID группы"
+// @Param banId path string true "ID запрета"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/banned-images/{banId} [delete]
+func unbanGroupImageHandler(c *gin.Context, db *gorm.DB) {
+	group, moderatorID, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var ban models.BannedImage
+	if err := db.First(&ban, "id = ? AND group_id = ?", c.Param("banId"), group.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Banned image not found"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&ban).Error; err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionUnbanImage,
+			TargetType:  "image",
+			TargetID:    &ban.ID,
+		}, toBannedImageDTO(ban), nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unban image"})
+		return
+	}
+	resetBannedImages(&group.ID)
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Получить изображения, запрещённые на сайте
+// @Description Возвращает изображения, запрещённые во всех группах и в общей ленте
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} routes.BannedImageDTO
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /admin/banned-images [get]
+func listSiteBannedImagesHandler(c *gin.Context, db *gorm.DB) {
+	var bans []models.BannedImage
+	if err := db.Where("group_id IS NULL").Order("created_at DESC").Find(&bans).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve banned images"})
+		return
+	}
+
+	dtos := make([]BannedImageDTO, len(bans))
+	for i, ban := range bans {
+		dtos[i] = toBannedImageDTO(ban)
+	}
+	c.JSON(http.StatusOK, dtos)
+}
+
+// @Summary Запретить изображение на сайте
+// @Description Запрещает изображения поста или загруженный файл во всех группах и в общей ленте
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param data body routes.BanImageRequest true "Пост или файл"
+// @Success 201 {array} routes.BannedImageDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /admin/banned-images [post]
+func banSiteImageHandler(c *gin.Context, db *gorm.DB) {
+	var req BanImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	media, errMsg := imagesToBan(db, req)
+	if errMsg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+
+	// AdminMiddleware has already checked the user.
+	bans, err := banImages(db, nil, req.PostID, media, *optionalUserID(c), req.Reason)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to ban images"})
+		return
+	}
+	resetBannedImages(nil)
+
+	dtos := make([]BannedImageDTO, len(bans))
+	for i, ban := range bans {
+		dtos[i] = toBannedImageDTO(ban)
+	}
+	c.JSON(http.StatusCreated, dtos)
+}
+
+// @Summary Снять запрет с изображения на сайте
+// @Description Удаляет изображение из списка запрещённых на сайте
+// @Tags admin
+// @Security BearerAuth
+// @Param id path string true "ID запрета"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/banned-images/{id} [delete]
+func unbanSiteImageHandler(c *gin.Context, db *gorm.DB) {
+	result := db.Where("id = ? AND group_id IS NULL", c.Param("id")).Delete(&models.BannedImage{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unban image"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Banned image not found"})
+		return
+	}
+	resetBannedImages(nil)
+
+	c.Status(http.StatusNoContent)
+}
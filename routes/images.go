@@ -0,0 +1,397 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+// Limits for image processing.
+const (
+	// Decoding is refused above this many pixels, so a small file cannot expand into gigabytes.
+	maxImagePixels        = 50_000_000
+	imageJPEGQuality      = 85
+	imageProcessTimeout   = 2 * time.Minute
+	mediaProcessingRetry  = 5 * time.Minute
+	mediaWorkers          = 2
+	blurhashPreviewSize   = 32
+	blurhashMaxComponents = 4
+)
+
+// Variant sizes by the longest edge. Images are never upscaled: the first size that is not smaller
+// than the original gets a copy at the original size, and larger sizes are skipped.
+var imageVariantSizes = []struct {
+	name string
+	size int
+}{
+	{"small", 320},
+	{"medium", 960},
+	{"large", 2048},
+}
+
+var errTooManyPixels = errors.New("image has too many pixels")
+
+// Нужно ли строить для файла уменьшенные копии и blurhash.
+func isProcessableImage(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// Whether a pending media item was never picked up or was lost from the queue, e.g. by a restart.
+func needsProcessing(media models.Media) bool {
+	return media.ProcessingStatus == models.MediaProcessingPending &&
+		(media.ProcessingAt == nil || time.Since(*media.ProcessingAt) > mediaProcessingRetry)
+}
+
+type mediaJob struct {
+	db      *gorm.DB
+	mediaID uuid.UUID
+}
+
+var (
+	mediaQueue        = make(chan mediaJob, 256)
+	startMediaWorkers sync.Once
+)
+
+// Ставит изображение в очередь на обработку. Если очередь заполнена, задача отбрасывается:
+// изображение останется в состоянии pending и снова попадёт в очередь при следующем чтении.
+func enqueueMediaProcessing(db *gorm.DB, mediaID uuid.UUID) {
+	startMediaWorkers.Do(func() {
+		for i := 0; i < mediaWorkers; i++ {
+			go func() {
+				for job := range mediaQueue {
+					processMedia(job.db, job.mediaID)
+				}
+			}()
+		}
+	})
+	select {
+	case mediaQueue <- mediaJob{db: db, mediaID: mediaID}:
+	default:
+	}
+}
+
+// Строит уменьшенные копии изображения и сохраняет размеры и blurhash.
+func processMedia(db *gorm.DB, mediaID uuid.UUID) {
+	var media models.Media
+	if err := db.First(&media, "id = ?", mediaID).Error; err != nil || !needsProcessing(media) {
+		return
+	}
+	// Concurrent readers may queue the same media; only the first job processes it.
+	claimed := db.Model(&models.Media{}).
+		Where("id = ? AND processing_at IS NOT DISTINCT FROM ?", media.ID, media.ProcessingAt).
+		Update("processing_at", time.Now())
+	if claimed.Error != nil || claimed.RowsAffected == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), imageProcessTimeout)
+	defer cancel()
+	result, err := processImage(ctx, media)
+	if err != nil {
+		log.Printf("Failed to process media %s: %v", media.ID, err)
+		db.Model(&models.Media{}).Where("id = ?", media.ID).Updates(map[string]interface{}{
+			"processing_status": models.MediaProcessingFailed,
+			"processing_error":  err.Error(),
+		})
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("media_id = ?", media.ID).Delete(&models.MediaVariant{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&result.variants).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Media{}).Where("id = ?", media.ID).Updates(map[string]interface{}{
+			"width":             result.width,
+			"height":            result.height,
+			"blurhash":          result.blurhash,
+			"processing_status": models.MediaProcessingDone,
+			"processing_error":  "",
+		}).Error
+	})
+	if err != nil {
+		log.Println("Failed to save media variants:", err)
+	}
+}
+
+type processedImage struct {
+	width, height int
+	blurhash      string
+	variants      []models.MediaVariant
+}
+
+func processImage(ctx context.Context, media models.Media) (processedImage, error) {
+	var result processedImage
+	body, err := mediaStorage.Get(ctx, media.StorageKey)
+	if err != nil {
+		return result, err
+	}
+	data, err := io.ReadAll(io.LimitReader(body, media.Size+1))
+	body.Close()
+	if err != nil {
+		return result, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return result, err
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return result, errTooManyPixels
+	}
+	// Animated GIFs are reduced to their first frame.
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return result, err
+	}
+	if media.ContentType == "image/jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	bounds := img.Bounds()
+	result.width, result.height = bounds.Dx(), bounds.Dy()
+
+	previewWidth, previewHeight := fitWithin(result.width, result.height, blurhashPreviewSize)
+	result.blurhash = encodeBlurhash(resizeImage(img, previewWidth, previewHeight))
+
+	for _, variant := range imageVariantSizes {
+		width, height := fitWithin(result.width, result.height, variant.size)
+		resized := resizeImage(img, width, height)
+
+		fallback := "jpeg"
+		if !resized.Opaque() {
+			fallback = "png"
+		}
+		encoded := map[string]*bytes.Buffer{}
+		for _, format := range []string{"webp", fallback} {
+			data, err := encodeImage(resized, format)
+			if err != nil {
+				return result, fmt.Errorf("encode %s %s: %w", variant.name, format, err)
+			}
+			encoded[format] = data
+		}
+		// WebP copies are lossless: smaller than PNG and for flat graphics, but usually larger than
+		// JPEG for photos, where they would only cost clients bandwidth.
+		formats := []string{"webp", fallback}
+		if encoded["webp"].Len() >= encoded[fallback].Len() {
+			formats = formats[1:]
+		}
+		for _, format := range formats {
+			stored, err := storeVariant(ctx, media.ID, variant.name, format, resized.Bounds(), encoded[format])
+			if err != nil {
+				return result, err
+			}
+			result.variants = append(result.variants, stored)
+		}
+		if width == result.width && height == result.height {
+			break
+		}
+	}
+	return result, nil
+}
+
+// Content types and file extensions of variant formats.
+var imageFormats = map[string]struct{ contentType, ext string }{
+	"webp": {"image/webp", ".webp"},
+	"jpeg": {"image/jpeg", ".jpg"},
+	"png":  {"image/png", ".png"},
+}
+
+func encodeImage(img *image.RGBA, format string) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "webp":
+		err = encodeWebP(&buf, img)
+	case "png":
+		err = png.Encode(&buf, img)
+	default:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: imageJPEGQuality})
+	}
+	return &buf, err
+}
+
+func storeVariant(ctx context.Context, mediaID uuid.UUID, name, format string, bounds image.Rectangle, data *bytes.Buffer) (models.MediaVariant, error) {
+	variant := models.MediaVariant{
+		ID:          uuid.New(),
+		MediaID:     mediaID,
+		Name:        name,
+		Format:      format,
+		ContentType: imageFormats[format].contentType,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		Size:        int64(data.Len()),
+		StorageKey:  "media/" + mediaID.String() + "/" + name + imageFormats[format].ext,
+	}
+	if err := mediaStorage.Put(ctx, variant.StorageKey, data, variant.Size, variant.ContentType); err != nil {
+		return models.MediaVariant{}, err
+	}
+	return variant, nil
+}
+
+// Returns the size that fits within limit on the longest edge, keeping the aspect ratio.
+func fitWithin(width, height, limit int) (int, int) {
+	if width <= limit && height <= limit {
+		return width, height
+	}
+	if width >= height {
+		return limit, max(1, int(math.Round(float64(height)*float64(limit)/float64(width))))
+	}
+	return max(1, int(math.Round(float64(width)*float64(limit)/float64(height)))), limit
+}
+
+func resizeImage(img image.Image, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// Поворачивает и отражает изображение так, как требует ориентация из EXIF.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	var out *image.RGBA
+	if orientation >= 5 {
+		out = image.NewRGBA(image.Rect(0, 0, height, width))
+	} else {
+		out = image.NewRGBA(image.Rect(0, 0, width, height))
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = width-1-x, y
+			case 3: // rotated 180°
+				dx, dy = width-1-x, height-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, height-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = height-1-y, x
+			case 7: // transversed
+				dx, dy = height-1-y, width-1-x
+			case 8: // rotated 90° counterclockwise
+				dx, dy = y, width-1-x
+			}
+			out.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return out
+}
+
+const blurhashCharacters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Кодирует изображение в blurhash — короткую строку, из которой клиент рисует размытую заглушку.
+// Число компонент по длинной стороне равно blurhashMaxComponents, по короткой — меньше на единицу.
+func encodeBlurhash(img *image.RGBA) string {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	componentsX, componentsY := blurhashMaxComponents, blurhashMaxComponents-1
+	if height > width {
+		componentsX, componentsY = componentsY, componentsX
+	}
+
+	factors := make([][3]float64, 0, componentsX*componentsY)
+	for j := 0; j < componentsY; j++ {
+		for i := 0; i < componentsX; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var r, g, b float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := normalisation *
+						math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+					offset := img.PixOffset(x, y)
+					r += basis * srgbToLinear(img.Pix[offset])
+					g += basis * srgbToLinear(img.Pix[offset+1])
+					b += basis * srgbToLinear(img.Pix[offset+2])
+				}
+			}
+			scale := 1 / float64(width*height)
+			factors = append(factors, [3]float64{r * scale, g * scale, b * scale})
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encodeBase83((componentsX-1)+(componentsY-1)*9, 1))
+	maximum := 1.0
+	if len(factors) > 1 {
+		actual := 0.0
+		for _, factor := range factors[1:] {
+			for _, value := range factor {
+				actual = math.Max(actual, math.Abs(value))
+			}
+		}
+		quantised := int(math.Max(0, math.Min(82, math.Floor(actual*166-0.5))))
+		maximum = float64(quantised+1) / 166
+		hash.WriteString(encodeBase83(quantised, 1))
+	} else {
+		hash.WriteString(encodeBase83(0, 1))
+	}
+
+	dc := factors[0]
+	hash.WriteString(encodeBase83(linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4))
+	for _, factor := range factors[1:] {
+		quantise := func(value float64) int {
+			scaled := math.Copysign(math.Pow(math.Abs(value/maximum), 0.5), value)
+			return int(math.Max(0, math.Min(18, math.Floor(scaled*9+9.5))))
+		}
+		hash.WriteString(encodeBase83(quantise(factor[0])*19*19+quantise(factor[1])*19+quantise(factor[2]), 2))
+	}
+	return hash.String()
+}
+
+func encodeBase83(value, length int) string {
+	out := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		out[i] = blurhashCharacters[value%83]
+		value /= 83
+	}
+	return string(out)
+}
+
+func srgbToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
@@ -0,0 +1,652 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/net/html"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"chirp/models"
+)
+
+// Limits for fetching a page to unfurl.
+const (
+	maxPreviewBytes     = 1 << 20
+	maxPreviewRedirects = 3
+	previewFetchTimeout = 10 * time.Second
+	// A pending preview that has not been fetched for this long was lost from the queue, e.g. by a restart.
+	// A fetch claim expires after the same time.
+	previewPendingRetry = time.Minute
+	previewWorkers      = 4
+	// Longest edge of the preview image copy served to clients.
+	previewThumbnailSize = 640
+)
+
+var errForbiddenAddress = errors.New("address is not publicly routable")
+
+// Ranges not covered by the net.IP helpers that must not be reachable from the fetcher.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// Загружает страницы и извлекает из них метаданные для превью.
+type Unfurler struct {
+	Client   *http.Client
+	MaxBytes int64
+}
+
+var unfurler = NewUnfurler()
+
+// Заменяет используемый загрузчик превью, например на клиент для локального тестового сервера.
+func SetUnfurler(u *Unfurler) {
+	unfurler = u
+}
+
+func NewUnfurler() *Unfurler {
+	return &Unfurler{Client: newSafeHTTPClient(), MaxBytes: maxPreviewBytes}
+}
+
+// HTTP-клиент, который не подключается к внутренним адресам. Адрес проверяется при установке соединения,
+// поэтому ограничение не обойти ни перенаправлением, ни DNS-записью, указывающей во внутреннюю сеть.
+func newSafeHTTPClient() *http.Client {
+	return newPreviewHTTPClient(isPublicAddr)
+}
+
+// HTTP-клиент загрузчика превью, подключающийся только к адресам, для которых allowed возвращает true.
+func newPreviewHTTPClient(allowed func(netip.Addr) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !allowed(addrPort.Addr()) {
+				return errForbiddenAddress
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Second,
+		MaxIdleConns:          16,
+		IdleConnTimeout:       30 * time.Second,
+	}
+	return &http.Client{
+		Timeout:   previewFetchTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxPreviewRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.New("redirect to a non-http URL")
+			}
+			return nil
+		},
+	}
+}
+
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Метаданные страницы для превью.
+type unfurlResult struct {
+	Title       string
+	Description string
+	SiteName    string
+	ImageURL    string
+	Type        string
+}
+
+// Загружает страницу и извлекает метаданные OpenGraph, Twitter Card и oEmbed.
+func (u *Unfurler) Unfurl(ctx context.Context, pageURL string) (unfurlResult, error) {
+	resp, err := u.get(ctx, pageURL, "text/html,application/xhtml+xml;q=0.9,image/*;q=0.8")
+	if err != nil {
+		return unfurlResult{}, err
+	}
+	defer resp.Body.Close()
+
+	finalURL := resp.Request.URL
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return unfurlResult{ImageURL: finalURL.String(), SiteName: finalURL.Hostname(), Type: "image"}, nil
+	case mediaType != "text/html" && mediaType != "application/xhtml+xml":
+		return unfurlResult{}, fmt.Errorf("unsupported content type %q", mediaType)
+	}
+
+	meta := parsePageMeta(io.LimitReader(resp.Body, u.MaxBytes))
+	result := unfurlResult{
+		Title:       firstNonEmpty(meta["og:title"], meta["twitter:title"]),
+		Description: firstNonEmpty(meta["og:description"], meta["twitter:description"], meta["description"]),
+		SiteName:    meta["og:site_name"],
+		ImageURL:    firstNonEmpty(meta["og:image:secure_url"], meta["og:image"], meta["twitter:image"], meta["twitter:image:src"]),
+		Type:        meta["og:type"],
+	}
+
+	if oembedURL := resolveReference(finalURL, meta["oembed"]); oembedURL != "" && (result.Title == "" || result.ImageURL == "") {
+		if oembed, err := u.fetchOEmbed(ctx, oembedURL); err == nil {
+			result.Title = firstNonEmpty(result.Title, oembed.Title)
+			result.SiteName = firstNonEmpty(result.SiteName, oembed.ProviderName)
+			result.ImageURL = firstNonEmpty(result.ImageURL, oembed.ThumbnailURL)
+			result.Type = firstNonEmpty(result.Type, oembed.Type)
+		}
+	}
+
+	result.Title = truncateRunes(firstNonEmpty(result.Title, meta["title"]), 300)
+	result.Description = truncateRunes(result.Description, 1000)
+	result.SiteName = truncateRunes(firstNonEmpty(result.SiteName, finalURL.Hostname()), 128)
+	result.ImageURL = resolveReference(finalURL, result.ImageURL)
+	result.Type = truncateRunes(firstNonEmpty(result.Type, "website"), 32)
+	return result, nil
+}
+
+func (u *Unfurler) get(ctx context.Context, rawURL, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, errInvalidLinkURL
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", "ChirpBot/1.0 (+link previews)")
+
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// Загружает изображение превью и возвращает его уменьшенную копию в формате JPEG или PNG.
+// Клиентам отдаётся эта копия, а не адрес на чужом сайте, который узнал бы адреса читателей.
+func (u *Unfurler) FetchThumbnail(ctx context.Context, imageURL string) ([]byte, string, error) {
+	resp, err := u.get(ctx, imageURL, "image/*")
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, u.MaxBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > u.MaxBytes {
+		return nil, "", fmt.Errorf("image exceeds %d bytes", u.MaxBytes)
+	}
+
+	contentType, _, ok := sniffMediaType(data[:min(len(data), 512)])
+	if !ok || !isProcessableImage(contentType) {
+		return nil, "", errors.New("unsupported image type")
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, "", errTooManyPixels
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if contentType == "image/jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	bounds := img.Bounds()
+	width, height := fitWithin(bounds.Dx(), bounds.Dy(), previewThumbnailSize)
+	thumbnail := resizeImage(img, width, height)
+	format := "jpeg"
+	if !thumbnail.Opaque() {
+		format = "png"
+	}
+	encoded, err := encodeImage(thumbnail, format)
+	if err != nil {
+		return nil, "", err
+	}
+	return encoded.Bytes(), format, nil
+}
+
+type oembedResponse struct {
+	Type         string `json:"type"`
+	Title        string `json:"title"`
+	ProviderName string `json:"provider_name"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+func (u *Unfurler) fetchOEmbed(ctx context.Context, endpoint string) (oembedResponse, error) {
+	var oembed oembedResponse
+	resp, err := u.get(ctx, endpoint, "application/json")
+	if err != nil {
+		return oembed, err
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(io.LimitReader(resp.Body, u.MaxBytes)).Decode(&oembed)
+	return oembed, err
+}
+
+// Собирает из <head> заголовок, мета-теги и адрес oEmbed. Ключи мета-тегов приводятся к нижнему регистру,
+// повторные теги игнорируются.
+func parsePageMeta(r io.Reader) map[string]string {
+	meta := map[string]string{}
+	set := func(key, value string) {
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if key != "" && value != "" && meta[key] == "" {
+			meta[key] = value
+		}
+	}
+
+	tokenizer := html.NewTokenizer(r)
+	inTitle := false
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			return meta
+		case html.TextToken:
+			if inTitle {
+				set("title", string(tokenizer.Text()))
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				return meta
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			attrs := map[string]string{}
+			for hasAttr {
+				var key, value []byte
+				key, value, hasAttr = tokenizer.TagAttr()
+				attrs[string(key)] = string(value)
+			}
+			switch string(name) {
+			case "title":
+				inTitle = tokenType == html.StartTagToken
+			case "meta":
+				set(firstNonEmpty(attrs["property"], attrs["name"]), attrs["content"])
+			case "link":
+				if strings.EqualFold(attrs["rel"], "alternate") && strings.EqualFold(attrs["type"], "application/json+oembed") {
+					set("oembed", attrs["href"])
+				}
+			case "body":
+				return meta
+			}
+		}
+	}
+}
+
+// Resolves a possibly relative reference from the page and keeps it only if it is http(s).
+func resolveReference(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	resolved, err := base.Parse(ref)
+	if err != nil || (resolved.Scheme != "http" && resolved.Scheme != "https") {
+		return ""
+	}
+	return resolved.String()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// Время, после которого превью загружается заново. Задаётся переменной LINK_PREVIEW_TTL, по умолчанию сутки.
+func linkPreviewTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("LINK_PREVIEW_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return 24 * time.Hour
+}
+
+func isPreviewStale(preview models.LinkPreview, now time.Time) bool {
+	if preview.FetchingUntil != nil && now.Before(*preview.FetchingUntil) {
+		return false
+	}
+	if preview.FetchedAt == nil {
+		return now.Sub(preview.CreatedAt) > previewPendingRetry
+	}
+	return now.Sub(*preview.FetchedAt) > linkPreviewTTL()
+}
+
+// Находит или создаёт превью для адреса. Второе значение сообщает, что превью нужно загрузить.
+func linkPreviewFor(tx *gorm.DB, rawURL string) (*models.LinkPreview, bool, error) {
+	canonical, err := canonicalURL(rawURL)
+	if err != nil {
+		return nil, false, nil
+	}
+	preview := models.LinkPreview{
+		CanonicalURL: canonical,
+		URL:          strings.TrimSpace(rawURL),
+		Status:       models.PreviewPending,
+		CreatedAt:    time.Now(),
+	}
+	// Posts linking the same page may be created concurrently, so the insert must tolerate a conflict.
+	result := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "canonical_url"}}, DoNothing: true}).Create(&preview)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return &preview, true, nil
+	}
+	if err := tx.Where("canonical_url = ?", canonical).First(&preview).Error; err != nil {
+		return nil, false, err
+	}
+	return &preview, isPreviewStale(preview, time.Now()), nil
+}
+
+// Адрес, для которого строится превью поста: ссылка link-поста или первая ссылка в тексте.
+func previewURLOf(post models.Post) string {
+	if post.Type == models.PostTypeLink {
+		return post.URL
+	}
+	return linkPattern.FindString(post.Content)
+}
+
+// Привязывает к посту превью его ссылки. Возвращает ID превью, которое нужно загрузить после коммита.
+func assignLinkPreview(tx *gorm.DB, post *models.Post) (*uuid.UUID, error) {
+	post.LinkPreviewID = nil
+	rawURL := previewURLOf(*post)
+	if rawURL == "" {
+		return nil, nil
+	}
+	preview, refresh, err := linkPreviewFor(tx, rawURL)
+	if err != nil || preview == nil {
+		return nil, err
+	}
+	post.LinkPreviewID = &preview.ID
+	if refresh {
+		return &preview.ID, nil
+	}
+	return nil, nil
+}
+
+type previewJob struct {
+	db        *gorm.DB
+	previewID uuid.UUID
+}
+
+var (
+	previewQueue        = make(chan previewJob, 256)
+	startPreviewWorkers sync.Once
+)
+
+// Ставит превью в очередь на загрузку. Если очередь заполнена, задача отбрасывается:
+// превью останется устаревшим и снова попадёт в очередь при следующем чтении.
+func enqueuePreviewRefresh(db *gorm.DB, previewID uuid.UUID) {
+	startPreviewWorkers.Do(func() {
+		for i := 0; i < previewWorkers; i++ {
+			go func() {
+				for job := range previewQueue {
+					refreshLinkPreview(job.db, job.previewID)
+				}
+			}()
+		}
+	})
+	select {
+	case previewQueue <- previewJob{db: db, previewID: previewID}:
+	default:
+	}
+}
+
+// Загружает превью и сохраняет результат. Если ранее загруженное превью не удалось обновить, старые данные сохраняются.
+func refreshLinkPreview(db *gorm.DB, previewID uuid.UUID) {
+	var preview models.LinkPreview
+	if err := db.First(&preview, "id = ?", previewID).Error; err != nil {
+		return
+	}
+	now := time.Now()
+	// Concurrent readers may queue the same stale preview; only the first job fetches it. If the worker
+	// dies mid-fetch, the claim expires and the preview is due again after previewPendingRetry.
+	claimed := db.Model(&models.LinkPreview{}).
+		Where("id = ? AND fetched_at IS NOT DISTINCT FROM ? AND (fetching_until IS NULL OR fetching_until < ?)", preview.ID, preview.FetchedAt, now).
+		Update("fetching_until", now.Add(previewPendingRetry))
+	if claimed.Error != nil || claimed.RowsAffected == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), previewFetchTimeout)
+	defer cancel()
+	result, err := unfurler.Unfurl(ctx, preview.URL)
+
+	updates := map[string]interface{}{"fetched_at": time.Now(), "fetching_until": nil}
+	switch {
+	case err != nil && preview.Status == models.PreviewReady:
+		updates["error"] = err.Error()
+	case err != nil:
+		updates["status"] = models.PreviewFailed
+		updates["error"] = err.Error()
+	default:
+		updates["status"] = models.PreviewReady
+		updates["error"] = ""
+		updates["title"] = result.Title
+		updates["description"] = result.Description
+		updates["site_name"] = result.SiteName
+		updates["image_url"] = result.ImageURL
+		updates["type"] = result.Type
+		updates["image_key"] = storePreviewImage(ctx, preview, result.ImageURL)
+	}
+	if err := db.Model(&models.LinkPreview{}).Where("id = ?", preview.ID).Updates(updates).Error; err != nil {
+		log.Println("Failed to save link preview:", err)
+	}
+}
+
+// Сохраняет копию изображения превью в хранилище и возвращает её ключ. Если изображение не удалось
+// загрузить повторно, остаётся прежняя копия.
+func storePreviewImage(ctx context.Context, preview models.LinkPreview, imageURL string) string {
+	if imageURL == "" {
+		if preview.ImageKey != "" {
+			mediaStorage.Delete(ctx, preview.ImageKey)
+		}
+		return ""
+	}
+	data, format, err := unfurler.FetchThumbnail(ctx, imageURL)
+	if err != nil {
+		return preview.ImageKey
+	}
+	// Ключ зависит от содержимого: копии отдаются с бессрочным кешированием.
+	sum := sha256.Sum256(data)
+	key := "previews/" + preview.ID.String() + "/" + hex.EncodeToString(sum[:8]) + imageFormats[format].ext
+	if err := mediaStorage.Put(ctx, key, bytes.NewReader(data), int64(len(data)), imageFormats[format].contentType); err != nil {
+		log.Println("Failed to store link preview image:", err)
+		return preview.ImageKey
+	}
+	if preview.ImageKey != "" && preview.ImageKey != key {
+		mediaStorage.Delete(ctx, preview.ImageKey)
+	}
+	return key
+}
+
+// Адрес копии изображения превью или "", если копии нет.
+func previewImageURL(preview models.LinkPreview) string {
+	if preview.ImageKey == "" {
+		return ""
+	}
+	if url := mediaStorage.URL(preview.ImageKey); url != "" {
+		return url
+	}
+	return "/api/v1/" + preview.ImageKey
+}
+
+func toLinkPreviewDTO(preview models.LinkPreview) LinkPreviewDTO {
+	return LinkPreviewDTO{
+		URL:         preview.URL,
+		Status:      preview.Status,
+		Title:       preview.Title,
+		Description: preview.Description,
+		SiteName:    preview.SiteName,
+		ImageURL:    previewImageURL(preview),
+		Type:        preview.Type,
+		FetchedAt:   preview.FetchedAt,
+	}
+}
+
+// Добавляет к постам превью ссылок и ставит устаревшие превью в очередь на обновление.
+func attachLinkPreviews(db *gorm.DB, posts []PostDTO) {
+	if len(posts) == 0 {
+		return
+	}
+	ids := make([]uuid.UUID, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+
+	var rows []models.Post
+	db.Select("id", "link_preview_id").Where("id IN ? AND link_preview_id IS NOT NULL", ids).Find(&rows)
+	if len(rows) == 0 {
+		return
+	}
+	previewIDs := make([]uuid.UUID, len(rows))
+	for i, row := range rows {
+		previewIDs[i] = *row.LinkPreviewID
+	}
+
+	var previews []models.LinkPreview
+	db.Where("id IN ?", previewIDs).Find(&previews)
+	byID := map[uuid.UUID]models.LinkPreview{}
+	now := time.Now()
+	for _, preview := range previews {
+		byID[preview.ID] = preview
+		if isPreviewStale(preview, now) {
+			enqueuePreviewRefresh(db, preview.ID)
+		}
+	}
+
+	byPost := map[uuid.UUID]*LinkPreviewDTO{}
+	for _, row := range rows {
+		if preview, ok := byID[*row.LinkPreviewID]; ok {
+			dto := toLinkPreviewDTO(preview)
+			byPost[row.ID] = &dto
+		}
+	}
+	for i := range posts {
+		posts[i].LinkPreview = byPost[posts[i].ID]
+	}
+}
+
+// @Summary Получить превью ссылки
+// @Description Возвращает превью ссылки из кэша. Если превью ещё не загружено или устарело, оно загружается в фоне, а ответ содержит текущее состояние
+// @Tags posts
+// @Security BearerAuth
+// @Produce json
+// @Param url query string true "Адрес"
+// @Success 200 {object} routes.LinkPreviewDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /posts/link-preview [get]
+func getLinkPreviewHandler(c *gin.Context, db *gorm.DB) {
+	rawURL := c.Query("url")
+	if _, err := canonicalURL(rawURL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	preview, refresh, err := linkPreviewFor(db, rawURL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load link preview"})
+		return
+	}
+	if refresh {
+		enqueuePreviewRefresh(db, preview.ID)
+	}
+
+	c.JSON(http.StatusOK, toLinkPreviewDTO(*preview))
+}
+
+// @Summary Получить изображение превью ссылки
+// @Description Отдаёт сохранённую уменьшенную копию изображения превью или перенаправляет на её адрес в хранилище
+// @Tags posts
+// @Produce octet-stream
+// @Param id path string true "ID превью"
+// @Param file path string true "Имя файла изображения"
+// @Success 200 {file} file
+// @Success 302
+// @Failure 404 {object} map[string]string
+// @Router /previews/{id}/{file} [get]
+func serveLinkPreviewImageHandler(c *gin.Context, db *gorm.DB) {
+	previewID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
+	var preview models.LinkPreview
+	key := "previews/" + previewID.String() + "/" + c.Param("file")
+	if err := db.First(&preview, "id = ? AND image_key = ?", previewID, key).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
+	serveStoredObject(c, preview.ImageKey, -1, mime.TypeByExtension(path.Ext(preview.ImageKey)))
+}
+
+func RegisterLinkPreviewRoutes(r *gin.RouterGroup, db *gorm.DB) {
+	r.GET("/:id/:file", func(c *gin.Context) {
+		serveLinkPreviewImageHandler(c, db)
+	})
+}
@@ -0,0 +1,268 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"chirp/models"
+)
+
+// testUnfurler is the production fetcher except that it may reach the loopback stand-in.
+func testUnfurler(maxBytes int64) *Unfurler {
+	return &Unfurler{
+		Client:   newPreviewHTTPClient(func(addr netip.Addr) bool { return addr.IsLoopback() }),
+		MaxBytes: maxBytes,
+	}
+}
+
+func servePage(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestUnfurlOpenGraph(t *testing.T) {
+	server := servePage(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<!doctype html><html><head>
+<title>Fallback title</title>
+<meta property="og:title" content="  Open Graph title ">
+<meta property="OG:Description" content="First description">
+<meta property="og:description" content="Repeated description">
+<meta property="og:site_name" content="Example">
+<meta property="og:image" content="/images/cover.png">
+<meta name="twitter:image" content="https://cdn.example/twitter.png">
+<meta property="og:type" content="article">
+</head><body><meta property="og:title" content="Body title"></body></html>`)
+	})
+
+	result, err := testUnfurler(maxPreviewBytes).Unfurl(context.Background(), server.URL+"/article")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := unfurlResult{
+		Title:       "Open Graph title",
+		Description: "First description",
+		SiteName:    "Example",
+		ImageURL:    server.URL + "/images/cover.png",
+		Type:        "article",
+	}
+	if result != want {
+		t.Errorf("Unfurl = %+v, want %+v", result, want)
+	}
+}
+
+func TestUnfurlOEmbedFallback(t *testing.T) {
+	var server *httptest.Server
+	server = servePage(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/watch":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<html><head><title>Page</title>
+<link rel="alternate" type="application/json+oembed" href="%s/oembed?url=watch"></head></html>`, server.URL)
+		case "/oembed":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"type":"video","title":"oEmbed title","provider_name":"Tube","thumbnail_url":"https://i.tube.example/1.jpg"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	result, err := testUnfurler(maxPreviewBytes).Unfurl(context.Background(), server.URL+"/watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Title != "oEmbed title" || result.SiteName != "Tube" || result.ImageURL != "https://i.tube.example/1.jpg" || result.Type != "video" {
+		t.Errorf("Unfurl = %+v", result)
+	}
+}
+
+func TestUnfurlRejectsUnsafeImageReferences(t *testing.T) {
+	server := servePage(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<head><meta property="og:title" content="t"><meta property="og:image" content="javascript:alert(1)"></head>`)
+	})
+
+	result, err := testUnfurler(maxPreviewBytes).Unfurl(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ImageURL != "" {
+		t.Errorf("ImageURL = %q, want it dropped", result.ImageURL)
+	}
+}
+
+func TestUnfurlRedirectLimit(t *testing.T) {
+	// /hops/N redirects N more times before serving the page.
+	server := servePage(t, func(w http.ResponseWriter, r *http.Request) {
+		hops, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hops/"))
+		if hops > 0 {
+			http.Redirect(w, r, "/hops/"+strconv.Itoa(hops-1), http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<head><meta property="og:title" content="Arrived"></head>`)
+	})
+	u := testUnfurler(maxPreviewBytes)
+
+	result, err := u.Unfurl(context.Background(), server.URL+"/hops/"+strconv.Itoa(maxPreviewRedirects))
+	if err != nil || result.Title != "Arrived" {
+		t.Errorf("%d redirects: %+v, %v", maxPreviewRedirects, result, err)
+	}
+	if _, err := u.Unfurl(context.Background(), server.URL+"/hops/"+strconv.Itoa(maxPreviewRedirects+1)); err == nil || !strings.Contains(err.Error(), "too many redirects") {
+		t.Errorf("%d redirects: %v, want too many redirects", maxPreviewRedirects+1, err)
+	}
+}
+
+func TestUnfurlRejectsNonHTTPRedirect(t *testing.T) {
+	server := servePage(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+	})
+
+	if _, err := testUnfurler(maxPreviewBytes).Unfurl(context.Background(), server.URL); err == nil {
+		t.Error("redirect to a file: URL was followed")
+	}
+}
+
+func TestUnfurlReadsAtMostMaxBytes(t *testing.T) {
+	server := servePage(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<head><meta property="og:title" content="Early"><meta name="filler" content="%s">
+<meta property="og:description" content="Past the limit"></head>`, strings.Repeat("x", 4096))
+	})
+
+	result, err := testUnfurler(1024).Unfurl(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Title != "Early" || result.Description != "" {
+		t.Errorf("Unfurl = %+v, want only the metadata within the first 1024 bytes", result)
+	}
+}
+
+func encodeTestPNG(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0x80, 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFetchThumbnail(t *testing.T) {
+	cover := encodeTestPNG(t, 1600, 800)
+	server := servePage(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cover.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(cover)
+		case "/fake.png":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "<svg onload=alert(1)>")
+		}
+	})
+
+	data, format, err := testUnfurler(maxPreviewBytes).FetchThumbnail(context.Background(), server.URL+"/cover.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, decoded, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" || decoded != "jpeg" || config.Width != previewThumbnailSize || config.Height != previewThumbnailSize/2 {
+		t.Errorf("thumbnail is %s %dx%d (%s), want a %dx%d jpeg", format, config.Width, config.Height, decoded, previewThumbnailSize, previewThumbnailSize/2)
+	}
+
+	if _, _, err := testUnfurler(int64(len(cover)-1)).FetchThumbnail(context.Background(), server.URL+"/cover.png"); err == nil {
+		t.Error("image larger than MaxBytes was accepted")
+	}
+	if _, _, err := testUnfurler(maxPreviewBytes).FetchThumbnail(context.Background(), server.URL+"/fake.png"); err == nil {
+		t.Error("markup served as image/png was accepted")
+	}
+}
+
+func TestSafeClientRefusesLoopback(t *testing.T) {
+	requested := false
+	server := servePage(t, func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	})
+
+	_, err := NewUnfurler().Unfurl(context.Background(), server.URL)
+	if !errors.Is(err, errForbiddenAddress) {
+		t.Errorf("Unfurl of %s: %v, want errForbiddenAddress", server.URL, err)
+	}
+	if requested {
+		t.Error("request reached the loopback server")
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34":    true,
+		"8.8.8.8":          true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"172.31.255.255":   false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"224.0.0.1":        false,
+		"::1":              false,
+		"::":               false,
+		"fc00::1":          false,
+		"fd12:3456::1":     false,
+		"fe80::1":          false,
+		"::ffff:127.0.0.1": false,
+		"::ffff:10.0.0.1":  false,
+		"64:ff9b::a00:1":   false,
+		"2001:db8::1":      false,
+	} {
+		if got := isPublicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestIsPreviewStaleHonoursFetchClaim(t *testing.T) {
+	now := time.Now()
+	fetched := now.Add(-48 * time.Hour)
+	claimedUntil := now.Add(previewPendingRetry / 2)
+	expiredClaim := now.Add(-time.Second)
+
+	for name, tc := range map[string]struct {
+		preview models.LinkPreview
+		want    bool
+	}{
+		"fresh pending":          {models.LinkPreview{CreatedAt: now}, false},
+		"lost pending":           {models.LinkPreview{CreatedAt: now.Add(-2 * previewPendingRetry)}, true},
+		"expired":                {models.LinkPreview{FetchedAt: &fetched}, true},
+		"expired, being fetched": {models.LinkPreview{FetchedAt: &fetched, FetchingUntil: &claimedUntil}, false},
+		"expired, claim lapsed":  {models.LinkPreview{FetchedAt: &fetched, FetchingUntil: &expiredClaim}, true},
+		"pending, claim lapsed":  {models.LinkPreview{CreatedAt: now.Add(-2 * previewPendingRetry), FetchingUntil: &expiredClaim}, true},
+	} {
+		if got := isPreviewStale(tc.preview, now); got != tc.want {
+			t.Errorf("%s: isPreviewStale = %v, want %v", name, got, tc.want)
+		}
+	}
+}
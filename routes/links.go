@@ -0,0 +1,112 @@
+package routes
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"chirp/models"
+)
+
+// Максимальное число изображений в галерее.
+const maxGalleryImages = 20
+
+var errInvalidLinkURL = errors.New("link must be an absolute http or https URL")
+
+// Query parameters that only record where a visitor came from and never change the page.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"ref_src": true,
+}
+
+// Приводит адрес к канонической форме для поиска повторов. Схема, www, порт по умолчанию,
+// фрагмент, завершающий слэш и метки отслеживания отбрасываются, параметры запроса сортируются.
+func canonicalURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return "", errInvalidLinkURL
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	host = strings.TrimPrefix(host, "www.")
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+
+	query := u.Query()
+	for key := range query {
+		if trackingParams[strings.ToLower(key)] || strings.HasPrefix(strings.ToLower(key), "utm_") {
+			query.Del(key)
+		}
+	}
+
+	canonical := host + strings.TrimRight(u.EscapedPath(), "/")
+	if encoded := query.Encode(); encoded != "" {
+		canonical += "?" + encoded
+	}
+	return canonical, nil
+}
+
+// Определяет тип поста и проверяет, что переданные поля ему соответствуют.
+// Если тип не указан, он выводится из полей, как это делали клиенты до появления типов.
+func resolvePostType(req CreatePostRequest) (string, string) {
+	postType := req.Type
+	if postType == "" {
+		switch {
+		case req.URL != "":
+			postType = models.PostTypeLink
+		case req.Poll != nil:
+			postType = models.PostTypePoll
+		case len(req.MediaIDs) > 1:
+			postType = models.PostTypeGallery
+		case len(req.MediaIDs) == 1:
+			postType = models.PostTypeImage
+		default:
+			postType = models.PostTypeText
+		}
+	}
+
+	if postType != models.PostTypeLink && req.URL != "" {
+		return "", "Only link posts can have a URL"
+	}
+	if postType == models.PostTypeLink && req.URL == "" {
+		return "", "Link posts require a URL"
+	}
+	if postType != models.PostTypePoll && req.Poll != nil {
+		return "", "Only poll posts can have a poll"
+	}
+	if postType == models.PostTypePoll && req.Poll == nil {
+		return "", "Poll posts require a poll"
+	}
+	if errMsg := checkPostMedia(postType, len(req.MediaIDs)); errMsg != "" {
+		return "", errMsg
+	}
+	return postType, ""
+}
+
+// Проверяет число медиафайлов для типа поста.
+func checkPostMedia(postType string, count int) string {
+	switch postType {
+	case models.PostTypeImage:
+		if count != 1 {
+			return "Image posts require exactly one image"
+		}
+	case models.PostTypeGallery:
+		if count < 2 || count > maxGalleryImages {
+			return "Gallery posts require between 2 and 20 images"
+		}
+	default:
+		if count > 0 {
+			return "Only image and gallery posts can have media"
+		}
+	}
+	return ""
+}
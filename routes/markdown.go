@@ -0,0 +1,1021 @@
+package routes
+
+import (
+	"errors"
+	"html"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+// Limits on user-supplied markdown. Content over a limit is rejected, not truncated.
+const (
+	maxMarkdownBytes   = 40000
+	maxMarkdownNesting = 8
+	// Bounds the scan for a link destination so that many unclosed links stay cheap.
+	maxLinkLength = 2048
+)
+
+// Bump when the renderer output changes: reads render outdated HTML in memory until the backfill stores it.
+const markdownRenderVersion = 2
+
+// Rows rewritten per query by the HTML backfill.
+const markdownBackfillBatch = 500
+
+var (
+	errMarkdownTooLarge = errors.New("content must not exceed 40000 bytes")
+	errMarkdownTooDeep  = errors.New("content is nested too deeply")
+)
+
+// Преобразует markdown в безопасный HTML. HTML из исходного текста не пропускается, а экранируется.
+// Поддерживаются абзацы, заголовки, цитаты, списки, блоки кода, таблицы, выделение, ссылки и спойлеры >!текст!<.
+func renderMarkdown(src string) (string, error) {
+	if len(src) > maxMarkdownBytes {
+		return "", errMarkdownTooLarge
+	}
+	src = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\x00", "�").Replace(src)
+	lines := strings.Split(src, "\n")
+	for i, line := range lines {
+		lines[i] = expandIndentTabs(line)
+	}
+
+	var b strings.Builder
+	if err := renderBlocks(&b, lines, 0, false); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Возвращает закэшированный HTML, только если он получен текущей версией рендерера.
+func currentHTML(contentHTML string, version int) string {
+	if version != markdownRenderVersion {
+		return ""
+	}
+	return contentHTML
+}
+
+// Рендерит HTML постов, у которых нет актуального кэша.
+func renderStalePosts(posts []PostDTO) {
+	for i := range posts {
+		if posts[i].ContentHTML == "" && posts[i].Content != "" {
+			posts[i].ContentHTML = renderStoredContent(posts[i].Content)
+		}
+	}
+}
+
+// Рендерит HTML комментариев, у которых нет актуального кэша.
+func renderStaleComments(comments []CommentDTO) {
+	for i := range comments {
+		if comments[i].ContentHTML == "" && comments[i].Content != "" {
+			comments[i].ContentHTML = renderStoredContent(comments[i].Content)
+		}
+	}
+}
+
+// Content stored before the limits existed may exceed them, so it falls back to escaped plain text.
+func renderStoredContent(content string) string {
+	rendered, err := renderMarkdown(content)
+	if err != nil {
+		return "<p>" + html.EscapeString(content) + "</p>\n"
+	}
+	return rendered
+}
+
+var startMarkdownBackfill sync.Once
+
+// Запускает фоновое сохранение HTML постов и комментариев, отрендеренного прежней версией рендерера.
+func scheduleMarkdownBackfill(db *gorm.DB) {
+	startMarkdownBackfill.Do(func() {
+		go func() {
+			backfillRenderedContent(db, &models.Post{})
+			backfillRenderedContent(db, &models.Comment{})
+		}()
+	})
+}
+
+// Перерендеривает устаревший HTML пачками, пока он не закончится. При ошибке останавливается:
+// до следующего запуска такой контент рендерится при чтении.
+func backfillRenderedContent(db *gorm.DB, model interface{}) {
+	for {
+		var rows []struct {
+			ID      uuid.UUID
+			Content string
+		}
+		if err := db.Unscoped().Model(model).Select("id", "content").Where("render_version <> ?", markdownRenderVersion).
+			Limit(markdownBackfillBatch).Find(&rows).Error; err != nil {
+			log.Println("Failed to load content to re-render:", err)
+			return
+		}
+		if len(rows) == 0 {
+			return
+		}
+		for _, row := range rows {
+			if err := db.Unscoped().Model(model).Where("id = ?", row.ID).UpdateColumns(map[string]interface{}{
+				"content_html":   renderStoredContent(row.Content),
+				"render_version": markdownRenderVersion,
+			}).Error; err != nil {
+				log.Println("Failed to save re-rendered content:", err)
+				return
+			}
+		}
+	}
+}
+
+func renderBlocks(b *strings.Builder, lines []string, depth int, tight bool) error {
+	if depth > maxMarkdownNesting {
+		return errMarkdownTooDeep
+	}
+
+	var paragraph []string
+	flush := func() error {
+		if len(paragraph) == 0 {
+			return nil
+		}
+		text := strings.TrimRight(strings.Join(paragraph, "\n"), " ")
+		paragraph = nil
+		if tight {
+			return renderInline(b, text, depth)
+		}
+		b.WriteString("<p>")
+		if err := renderInline(b, text, depth); err != nil {
+			return err
+		}
+		b.WriteString("</p>\n")
+		return nil
+	}
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimLeft(line, " ")
+		if isBlank(line) {
+			if err := flush(); err != nil {
+				return err
+			}
+			i++
+			continue
+		}
+		if len(paragraph) > 0 && !interruptsParagraph(line) {
+			paragraph = append(paragraph, trimmed)
+			i++
+			continue
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+
+		fence, info, isFence := openingFence(trimmed)
+		level, heading, isHeading := parseHeading(trimmed)
+		_, isListItem := parseListMarker(line)
+		var err error
+		switch {
+		case indentOf(line) >= 4:
+			var code []string
+			for ; i < len(lines) && (indentOf(lines[i]) >= 4 || isBlank(lines[i])); i++ {
+				code = append(code, stripIndent(lines[i], 4))
+			}
+			for len(code) > 0 && isBlank(code[len(code)-1]) {
+				code = code[:len(code)-1]
+			}
+			writeCodeBlock(b, code, "")
+		case isFence:
+			indent := indentOf(line)
+			var code []string
+			for i++; i < len(lines) && !isClosingFence(lines[i], fence); i++ {
+				code = append(code, stripIndent(lines[i], indent))
+			}
+			i++
+			writeCodeBlock(b, code, info)
+		case isHeading:
+			tag := "h" + strconv.Itoa(level)
+			b.WriteString("<" + tag + ">")
+			if err = renderInline(b, heading, depth); err != nil {
+				return err
+			}
+			b.WriteString("</" + tag + ">\n")
+			i++
+		case isThematicBreak(trimmed):
+			b.WriteString("<hr>\n")
+			i++
+		case isQuoteLine(trimmed):
+			i, err = renderBlockquote(b, lines, i, depth)
+		case isListItem:
+			i, err = renderList(b, lines, i, depth)
+		case i+1 < len(lines) && isTableStart(line, lines[i+1]):
+			i, err = renderTable(b, lines, i, depth)
+		default:
+			paragraph = append(paragraph, trimmed)
+			i++
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return flush()
+}
+
+func renderBlockquote(b *strings.Builder, lines []string, i, depth int) (int, error) {
+	var quoted []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimLeft(line, " ")
+		switch {
+		case indentOf(line) < 4 && isQuoteLine(trimmed):
+			quoted = append(quoted, strings.TrimPrefix(trimmed[1:], " "))
+		case !isBlank(line) && !isBlank(quoted[len(quoted)-1]) && !interruptsParagraph(line):
+			// Lazy continuation of a quoted paragraph.
+			quoted = append(quoted, trimmed)
+		default:
+			return i, writeBlockquote(b, quoted, depth)
+		}
+	}
+	return i, writeBlockquote(b, quoted, depth)
+}
+
+func writeBlockquote(b *strings.Builder, quoted []string, depth int) error {
+	b.WriteString("<blockquote>\n")
+	if err := renderBlocks(b, quoted, depth+1, false); err != nil {
+		return err
+	}
+	b.WriteString("</blockquote>\n")
+	return nil
+}
+
+type listMarker struct {
+	ordered bool
+	delim   byte
+	start   int
+	width   int
+}
+
+// Распознаёт маркер элемента списка: -, *, + или число с точкой или скобкой.
+func parseListMarker(line string) (listMarker, bool) {
+	indent := indentOf(line)
+	if indent >= 4 {
+		return listMarker{}, false
+	}
+	rest := line[indent:]
+	var m listMarker
+	n := 0
+	if rest != "" && strings.IndexByte("-*+", rest[0]) >= 0 {
+		m.delim = rest[0]
+		n = 1
+	} else {
+		for n < len(rest) && n < 9 && rest[n] >= '0' && rest[n] <= '9' {
+			n++
+		}
+		if n == 0 || n >= len(rest) || (rest[n] != '.' && rest[n] != ')') {
+			return listMarker{}, false
+		}
+		m.ordered = true
+		m.start, _ = strconv.Atoi(rest[:n])
+		m.delim = rest[n]
+		n++
+	}
+
+	after := rest[n:]
+	if after == "" {
+		m.width = indent + n + 1
+		return m, true
+	}
+	if after[0] != ' ' {
+		return listMarker{}, false
+	}
+	spaces := indentOf(after)
+	// Content indented further than four spaces is an indented code block inside the item.
+	if spaces > 4 || spaces == len(after) {
+		spaces = 1
+	}
+	m.width = indent + n + spaces
+	return m, true
+}
+
+func (m listMarker) sameList(other listMarker) bool {
+	return m.ordered == other.ordered && m.delim == other.delim
+}
+
+func markerContent(line string, m listMarker) string {
+	if len(line) <= m.width {
+		return ""
+	}
+	return line[m.width:]
+}
+
+func renderList(b *strings.Builder, lines []string, i, depth int) (int, error) {
+	first, _ := parseListMarker(lines[i])
+	var items [][]string
+	width := 0
+	loose := false
+
+scan:
+	for i < len(lines) {
+		line := lines[i]
+		m, isItem := parseListMarker(line)
+		switch {
+		case len(items) > 0 && indentOf(line) < width && isThematicBreak(strings.TrimLeft(line, " ")):
+			break scan
+		case isItem && (len(items) == 0 || indentOf(line) < width):
+			if !m.sameList(first) {
+				break scan
+			}
+			items = append(items, []string{markerContent(line, m)})
+			width = m.width
+			i++
+		case isBlank(line):
+			// A blank line belongs to the list only if the list goes on after it.
+			next := i
+			for next < len(lines) && isBlank(lines[next]) {
+				next++
+			}
+			if next == len(lines) {
+				break scan
+			}
+			nextMarker, nextIsItem := parseListMarker(lines[next])
+			if indentOf(lines[next]) < width && !(nextIsItem && nextMarker.sameList(first)) {
+				break scan
+			}
+			loose = true
+			for ; i < next; i++ {
+				items[len(items)-1] = append(items[len(items)-1], "")
+			}
+		case indentOf(line) >= width:
+			items[len(items)-1] = append(items[len(items)-1], stripIndent(line, width))
+			i++
+		default:
+			item := items[len(items)-1]
+			if isBlank(item[len(item)-1]) || interruptsParagraph(line) {
+				break scan
+			}
+			// Lazy continuation of the item's paragraph.
+			items[len(items)-1] = append(item, strings.TrimLeft(line, " "))
+			i++
+		}
+	}
+
+	tag := "ul"
+	if first.ordered {
+		tag = "ol"
+	}
+	b.WriteString("<" + tag)
+	if first.ordered && first.start != 1 {
+		b.WriteString(` start="` + strconv.Itoa(first.start) + `"`)
+	}
+	b.WriteString(">\n")
+	for _, item := range items {
+		b.WriteString("<li>")
+		if loose {
+			b.WriteString("\n")
+		}
+		if err := renderBlocks(b, item, depth+1, !loose); err != nil {
+			return i, err
+		}
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i, nil
+}
+
+// Проверяет, что строки образуют заголовок таблицы и строку выравнивания.
+func isTableStart(header, delimiter string) bool {
+	if indentOf(header) >= 4 || !strings.Contains(header, "|") || !strings.Contains(delimiter, "|") {
+		return false
+	}
+	aligns, ok := tableAlignments(delimiter)
+	return ok && len(aligns) == len(splitTableRow(header))
+}
+
+func tableAlignments(line string) ([]string, bool) {
+	cells := splitTableRow(line)
+	aligns := make([]string, len(cells))
+	for i, cell := range cells {
+		dashes := strings.Trim(cell, ":")
+		if dashes == "" || strings.Trim(dashes, "-") != "" {
+			return nil, false
+		}
+		left, right := strings.HasPrefix(cell, ":"), strings.HasSuffix(cell, ":")
+		switch {
+		case left && right:
+			aligns[i] = "center"
+		case left:
+			aligns[i] = "left"
+		case right:
+			aligns[i] = "right"
+		}
+	}
+	return aligns, true
+}
+
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+func renderTable(b *strings.Builder, lines []string, i, depth int) (int, error) {
+	header := splitTableRow(lines[i])
+	aligns, _ := tableAlignments(lines[i+1])
+
+	b.WriteString("<table>\n<thead>\n")
+	if err := writeTableRow(b, "th", header, aligns, depth); err != nil {
+		return i, err
+	}
+	b.WriteString("</thead>\n")
+
+	i += 2
+	body := false
+	for ; i < len(lines) && !isBlank(lines[i]) && !interruptsParagraph(lines[i]); i++ {
+		if !body {
+			b.WriteString("<tbody>\n")
+			body = true
+		}
+		if err := writeTableRow(b, "td", splitTableRow(lines[i]), aligns, depth); err != nil {
+			return i, err
+		}
+	}
+	if body {
+		b.WriteString("</tbody>\n")
+	}
+	b.WriteString("</table>\n")
+	return i, nil
+}
+
+// Rows with missing cells are padded and extra cells are dropped, as in GitHub tables.
+func writeTableRow(b *strings.Builder, tag string, cells, aligns []string, depth int) error {
+	b.WriteString("<tr>\n")
+	for col, align := range aligns {
+		b.WriteString("<" + tag)
+		if align != "" {
+			b.WriteString(` align="` + align + `"`)
+		}
+		b.WriteString(">")
+		if col < len(cells) {
+			if err := renderInline(b, cells[col], depth); err != nil {
+				return err
+			}
+		}
+		b.WriteString("</" + tag + ">\n")
+	}
+	b.WriteString("</tr>\n")
+	return nil
+}
+
+func writeCodeBlock(b *strings.Builder, code []string, info string) {
+	b.WriteString("<pre><code")
+	if lang := codeLanguage(info); lang != "" {
+		b.WriteString(` class="language-` + lang + `"`)
+	}
+	b.WriteString(">")
+	for _, line := range code {
+		b.WriteString(html.EscapeString(line))
+		b.WriteString("\n")
+	}
+	b.WriteString("</code></pre>\n")
+}
+
+// The language ends up in a class attribute, so only a conservative character set is kept.
+func codeLanguage(info string) string {
+	fields := strings.Fields(info)
+	if len(fields) == 0 {
+		return ""
+	}
+	lang := strings.Map(func(r rune) rune {
+		if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_+#.-", r)) {
+			return r
+		}
+		return -1
+	}, fields[0])
+	if len(lang) > 32 {
+		lang = lang[:32]
+	}
+	return lang
+}
+
+func openingFence(line string) (string, string, bool) {
+	if !strings.HasPrefix(line, "```") && !strings.HasPrefix(line, "~~~") {
+		return "", "", false
+	}
+	n := runLength(line, 0, line[0])
+	info := strings.TrimSpace(line[n:])
+	if line[0] == '`' && strings.Contains(info, "`") {
+		return "", "", false
+	}
+	return line[:n], info, true
+}
+
+func isClosingFence(line, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return indentOf(line) < 4 && strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+func parseHeading(line string) (int, string, bool) {
+	level := runLength(line, 0, '#')
+	if level == 0 || level > 6 || (level < len(line) && line[level] != ' ') {
+		return 0, "", false
+	}
+	text := strings.TrimSpace(line[level:])
+	// An optional closing sequence of '#' is not part of the heading.
+	if trimmed := strings.TrimRight(text, "#"); trimmed == "" || strings.HasSuffix(trimmed, " ") {
+		text = strings.TrimSpace(trimmed)
+	}
+	return level, text, true
+}
+
+func isThematicBreak(line string) bool {
+	var marker byte
+	count := 0
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; ch {
+		case ' ':
+		case '-', '*', '_':
+			if marker != 0 && ch != marker {
+				return false
+			}
+			marker = ch
+			count++
+		default:
+			return false
+		}
+	}
+	return count >= 3
+}
+
+// ">!" opens an inline spoiler rather than a quote.
+func isQuoteLine(trimmed string) bool {
+	return strings.HasPrefix(trimmed, ">") && !strings.HasPrefix(trimmed, ">!")
+}
+
+// Проверяет, начинает ли строка новый блок посреди абзаца.
+func interruptsParagraph(line string) bool {
+	if indentOf(line) >= 4 {
+		return false
+	}
+	trimmed := strings.TrimLeft(line, " ")
+	if _, _, ok := openingFence(trimmed); ok {
+		return true
+	}
+	if _, _, ok := parseHeading(trimmed); ok {
+		return true
+	}
+	if isThematicBreak(trimmed) || isQuoteLine(trimmed) {
+		return true
+	}
+	// Only a non-empty item, and for ordered lists only one starting at 1, may interrupt,
+	// so that a wrapped line such as "2019. was a good year" stays in the paragraph.
+	if m, ok := parseListMarker(line); ok {
+		return (!m.ordered || m.start == 1) && !isBlank(markerContent(line, m))
+	}
+	return false
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func stripIndent(line string, n int) string {
+	if indent := indentOf(line); indent < n {
+		n = indent
+	}
+	return line[n:]
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func expandIndentTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	i := 0
+	for ; i < len(line) && (line[i] == ' ' || line[i] == '\t'); i++ {
+		if line[i] == '\t' {
+			b.WriteString(strings.Repeat(" ", 4-b.Len()%4))
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	return b.String() + line[i:]
+}
+
+func runLength(text string, i int, ch byte) int {
+	n := 0
+	for i+n < len(text) && text[i+n] == ch {
+		n++
+	}
+	return n
+}
+
+// Рендерит строчную разметку: выделение, код, ссылки и спойлеры.
+func renderInline(b *strings.Builder, text string, depth int) error {
+	r := inlineRenderer{b: b}
+	return r.render(text, depth)
+}
+
+type inlineRenderer struct {
+	b      *strings.Builder
+	inLink bool
+}
+
+func (r *inlineRenderer) render(text string, depth int) error {
+	if depth > maxMarkdownNesting {
+		return errMarkdownTooDeep
+	}
+
+	// Delimiters known to have no closer in the rest of text. Searching again from a later
+	// position cannot succeed, and skipping the search keeps rendering linear.
+	unclosed := map[string]bool{}
+	start := 0
+	flush := func(end int) {
+		r.b.WriteString(html.EscapeString(text[start:end]))
+	}
+
+	for i := 0; i < len(text); {
+		ch := text[i]
+		switch {
+		case ch == '\\' && i+1 < len(text) && (text[i+1] == '\n' || isASCIIPunct(text[i+1])):
+			flush(i)
+			if text[i+1] == '\n' {
+				r.b.WriteString("<br>\n")
+			} else {
+				r.b.WriteString(html.EscapeString(text[i+1 : i+2]))
+			}
+			i += 2
+			start = i
+			continue
+
+		case ch == '\n':
+			pending := text[start:i]
+			trimmed := strings.TrimRight(pending, " ")
+			r.b.WriteString(html.EscapeString(trimmed))
+			if len(pending)-len(trimmed) >= 2 {
+				r.b.WriteString("<br>\n")
+			} else {
+				r.b.WriteString("\n")
+			}
+			i++
+			start = i
+			continue
+
+		case ch == '`':
+			n := runLength(text, i, '`')
+			key := "`" + strconv.Itoa(n)
+			if !unclosed[key] {
+				if code, end, ok := codeSpan(text, i); ok {
+					flush(i)
+					r.b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+					i = end
+					start = i
+					continue
+				}
+				unclosed[key] = true
+			}
+			i += n
+			continue
+
+		case ch == '*' || ch == '_' || ch == '~':
+			n := runLength(text, i, ch)
+			width := 1
+			if n >= 2 {
+				width = 2
+			}
+			if ch == '~' && n != 2 {
+				i += n
+				continue
+			}
+			delim := text[i : i+width]
+			if !unclosed[delim] && canOpenEmphasis(text, i, n) {
+				if end, ok := findEmphasisCloser(text, i+width, ch, width); ok {
+					flush(i)
+					tag := emphasisTag(ch, width)
+					r.b.WriteString("<" + tag + ">")
+					if err := r.render(text[i+width:end], depth+1); err != nil {
+						return err
+					}
+					r.b.WriteString("</" + tag + ">")
+					i = end + width
+					start = i
+					continue
+				}
+				unclosed[delim] = true
+			}
+			i += n
+			continue
+
+		case ch == '>' && strings.HasPrefix(text[i:], ">!") && !unclosed[">!"]:
+			end := strings.Index(text[i+2:], "!<")
+			if end > 0 {
+				flush(i)
+				r.b.WriteString(`<span class="spoiler">`)
+				if err := r.render(text[i+2:i+2+end], depth+1); err != nil {
+					return err
+				}
+				r.b.WriteString("</span>")
+				i += end + 4
+				start = i
+				continue
+			}
+			if end < 0 {
+				unclosed[">!"] = true
+			}
+
+		case ch == '[' && !r.inLink:
+			if label, dest, end, ok := parseLink(text, i); ok {
+				flush(i)
+				if err := r.link(label, dest, depth); err != nil {
+					return err
+				}
+				i = end
+				start = i
+				continue
+			}
+
+		case ch == '<' && !r.inLink && !unclosed["<"]:
+			end := strings.IndexByte(text[i:], '>')
+			if end < 0 {
+				unclosed["<"] = true
+				break
+			}
+			target := text[i+1 : i+end]
+			if href := safeURL(target); href != "" && !strings.ContainsAny(target, " \n<") && strings.Contains(target, ":") {
+				flush(i)
+				r.b.WriteString(`<a href="` + html.EscapeString(href) + `" rel="nofollow ugc noopener noreferrer">` + html.EscapeString(target) + "</a>")
+				i += end + 1
+				start = i
+				continue
+			}
+
+		case ch == 'h' && !r.inLink && (i == 0 || !isWordByte(text[i-1])):
+			if end := bareURLEnd(text, i); end > 0 {
+				flush(i)
+				target := text[i:end]
+				r.b.WriteString(`<a href="` + html.EscapeString(safeURL(target)) + `" rel="nofollow ugc noopener noreferrer">` + html.EscapeString(target) + "</a>")
+				i = end
+				start = i
+				continue
+			}
+		}
+		i++
+	}
+	flush(len(text))
+	return nil
+}
+
+// Links with an unsafe destination keep their text but lose the anchor.
+func (r *inlineRenderer) link(label, dest string, depth int) error {
+	href := safeURL(dest)
+	if href == "" {
+		return r.render(label, depth+1)
+	}
+	r.b.WriteString(`<a href="` + html.EscapeString(href) + `" rel="nofollow ugc noopener noreferrer">`)
+	r.inLink = true
+	err := r.render(label, depth+1)
+	r.inLink = false
+	r.b.WriteString("</a>")
+	return err
+}
+
+func emphasisTag(ch byte, width int) string {
+	switch {
+	case ch == '~':
+		return "del"
+	case width == 2:
+		return "strong"
+	default:
+		return "em"
+	}
+}
+
+func canOpenEmphasis(text string, i, n int) bool {
+	if i+n >= len(text) || text[i+n] == ' ' || text[i+n] == '\n' {
+		return false
+	}
+	// Underscores inside words, as in snake_case, are not emphasis.
+	return text[i] != '_' || i == 0 || !isWordByte(text[i-1])
+}
+
+// Ищет закрывающий разделитель выделения, пропуская экранированные символы и код.
+func findEmphasisCloser(text string, from int, ch byte, width int) (int, bool) {
+	for j := from; j < len(text); {
+		switch text[j] {
+		case '\\':
+			j += 2
+			continue
+		case '`':
+			if _, end, ok := codeSpan(text, j); ok {
+				j = end
+			} else {
+				j += runLength(text, j, '`')
+			}
+			continue
+		case ch:
+		default:
+			j++
+			continue
+		}
+
+		m := runLength(text, j, ch)
+		matches := m >= width && (width == 2 || m != 2)
+		if ch == '~' {
+			matches = m == 2
+		}
+		after := j + m
+		if matches && j > from && text[j-1] != ' ' && text[j-1] != '\n' &&
+			(ch != '_' || after == len(text) || !isWordByte(text[after])) {
+			return j + m - width, true
+		}
+		j += m
+	}
+	return 0, false
+}
+
+func codeSpan(text string, i int) (string, int, bool) {
+	n := runLength(text, i, '`')
+	for j := i + n; j < len(text); {
+		if text[j] != '`' {
+			j++
+			continue
+		}
+		m := runLength(text, j, '`')
+		if m == n {
+			code := strings.ReplaceAll(text[i+n:j], "\n", " ")
+			if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+				code = code[1 : len(code)-1]
+			}
+			return code, j + m, true
+		}
+		j += m
+	}
+	return "", 0, false
+}
+
+// Разбирает ссылку вида [текст](адрес "заголовок"). Вложенные скобки в тексте ссылки не поддерживаются.
+func parseLink(text string, i int) (string, string, int, bool) {
+	closing := -1
+	for j := i + 1; j < len(text) && closing < 0; j++ {
+		switch text[j] {
+		case '\\':
+			j++
+		case '[':
+			return "", "", 0, false
+		case ']':
+			closing = j
+		}
+	}
+	if closing < 0 || closing+1 >= len(text) || text[closing+1] != '(' {
+		return "", "", 0, false
+	}
+
+	j := closing + 2
+	for j < len(text) && text[j] == ' ' {
+		j++
+	}
+	destStart := j
+	var dest string
+	if j < len(text) && text[j] == '<' {
+		end := strings.IndexAny(text[j:], ">\n")
+		if end < 0 || text[j+end] != '>' {
+			return "", "", 0, false
+		}
+		dest = text[j+1 : j+end]
+		j += end + 1
+	} else {
+		parens := 0
+	dest:
+		for ; j < len(text); j++ {
+			if j-destStart > maxLinkLength {
+				return "", "", 0, false
+			}
+			switch text[j] {
+			case '\\':
+				j++
+			case '(':
+				parens++
+			case ')':
+				if parens == 0 {
+					break dest
+				}
+				parens--
+			case ' ', '\n':
+				break dest
+			}
+		}
+		if j > len(text) {
+			j = len(text)
+		}
+		dest = text[destStart:j]
+	}
+
+	for j < len(text) && (text[j] == ' ' || text[j] == '\n') {
+		j++
+	}
+	// The title is accepted for compatibility but not rendered.
+	if j < len(text) && (text[j] == '"' || text[j] == '\'') {
+		end := strings.IndexByte(text[j+1:], text[j])
+		if end < 0 {
+			return "", "", 0, false
+		}
+		j += end + 2
+		for j < len(text) && (text[j] == ' ' || text[j] == '\n') {
+			j++
+		}
+	}
+	if j >= len(text) || text[j] != ')' {
+		return "", "", 0, false
+	}
+	// Entities are decoded as in CommonMark, so &#106;avascript: is checked as the scheme it spells.
+	return text[i+1 : closing], html.UnescapeString(unescapeMarkdown(dest)), j + 1, true
+}
+
+// Пропускает только ссылки http, https, mailto и относительные. Остальные схемы, например javascript:, отбрасываются.
+func safeURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto", "":
+		return u.String()
+	default:
+		return ""
+	}
+}
+
+// Возвращает конец адреса http(s)://, встреченного в тексте без разметки, или 0.
+func bareURLEnd(text string, i int) int {
+	rest := text[i:]
+	if !strings.HasPrefix(rest, "http://") && !strings.HasPrefix(rest, "https://") {
+		return 0
+	}
+	end := strings.IndexAny(rest, " \n<")
+	if end < 0 {
+		end = len(rest)
+	}
+	// Trailing punctuation usually belongs to the sentence; a closing parenthesis
+	// is kept only when it balances one inside the address.
+	for end > 0 {
+		last := rest[end-1]
+		if strings.IndexByte(".,:;!?\"'*_~", last) >= 0 ||
+			(last == ')' && strings.Count(rest[:end], ")") > strings.Count(rest[:end], "(")) {
+			end--
+			continue
+		}
+		break
+	}
+	if end <= strings.Index(rest, "//")+2 || safeURL(rest[:end]) == "" {
+		return 0
+	}
+	return i + end
+}
+
+func unescapeMarkdown(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isASCIIPunct(ch byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", ch) >= 0
+}
+
+func isWordByte(ch byte) bool {
+	return ch >= utf8.RuneSelf || ch == '_' || ('0' <= ch && ch <= '9') || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z')
+}
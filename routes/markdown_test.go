@@ -0,0 +1,309 @@
+package routes
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// Elements the renderer may emit and the attributes allowed on each.
+var markdownAllowedAttrs = map[string]map[string]bool{
+	"p": {}, "br": {}, "hr": {},
+	"h1": {}, "h2": {}, "h3": {}, "h4": {}, "h5": {}, "h6": {},
+	"blockquote": {}, "ul": {}, "ol": {"start": true}, "li": {},
+	"pre": {}, "code": {"class": true},
+	"table": {}, "thead": {}, "tbody": {}, "tr": {}, "th": {"align": true}, "td": {"align": true},
+	"em": {}, "strong": {}, "del": {},
+	"a":    {"href": true, "rel": true},
+	"span": {"class": true},
+}
+
+var (
+	codeClassPattern = regexp.MustCompile(`^language-[A-Za-z0-9_+#.\-]{1,32}$`)
+	numberPattern    = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// assertSafeHTML parses the output the way a browser would and checks every element,
+// attribute and link destination against what the renderer is allowed to produce.
+func assertSafeHTML(t *testing.T, src, out string) {
+	t.Helper()
+	tokenizer := html.NewTokenizer(strings.NewReader(out))
+	for {
+		tt := tokenizer.Next()
+		if tt == html.ErrorToken {
+			if !errors.Is(tokenizer.Err(), io.EOF) {
+				t.Errorf("render(%q): unparsable output: %v", src, tokenizer.Err())
+			}
+			return
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		token := tokenizer.Token()
+		allowed, ok := markdownAllowedAttrs[token.Data]
+		if !ok {
+			t.Errorf("render(%q) emitted <%s>: %s", src, token.Data, out)
+			continue
+		}
+		for _, attr := range token.Attr {
+			if !allowed[attr.Key] {
+				t.Errorf("render(%q) emitted %s=%q on <%s>: %s", src, attr.Key, attr.Val, token.Data, out)
+				continue
+			}
+			switch {
+			case attr.Key == "href":
+				u, err := url.Parse(attr.Val)
+				if err != nil {
+					t.Errorf("render(%q) emitted unparsable href %q", src, attr.Val)
+					continue
+				}
+				switch strings.ToLower(u.Scheme) {
+				case "http", "https", "mailto", "":
+				default:
+					t.Errorf("render(%q) emitted href with scheme %q: %s", src, u.Scheme, out)
+				}
+				if strings.ContainsAny(attr.Val, "\t\n\r\x00") {
+					t.Errorf("render(%q) emitted href with control characters %q", src, attr.Val)
+				}
+			case attr.Key == "rel" && attr.Val != "nofollow ugc noopener noreferrer":
+				t.Errorf("render(%q) emitted rel=%q", src, attr.Val)
+			case token.Data == "code" && !codeClassPattern.MatchString(attr.Val):
+				t.Errorf("render(%q) emitted code class %q", src, attr.Val)
+			case token.Data == "span" && attr.Val != "spoiler":
+				t.Errorf("render(%q) emitted span class %q", src, attr.Val)
+			case attr.Key == "align" && attr.Val != "left" && attr.Val != "center" && attr.Val != "right":
+				t.Errorf("render(%q) emitted align=%q", src, attr.Val)
+			case attr.Key == "start" && !numberPattern.MatchString(attr.Val):
+				t.Errorf("render(%q) emitted start=%q", src, attr.Val)
+			}
+		}
+	}
+}
+
+func renderForTest(t *testing.T, src string) string {
+	t.Helper()
+	out, err := renderMarkdown(src)
+	if err != nil {
+		t.Fatalf("render(%q): %v", src, err)
+	}
+	assertSafeHTML(t, src, out)
+	return out
+}
+
+func TestRenderMarkdownDropsUnsafeLinks(t *testing.T) {
+	for _, src := range []string{
+		"[x](javascript:alert(1))",
+		"[x](JavaScript:alert(1))",
+		"[x](JAVASCRIPT:alert(1))",
+		"[x](jAvAsCrIpT:alert(document.cookie))",
+		"[x]( javascript:alert(1))",
+		"[x](<javascript:alert(1)>)",
+		"[x](javascript&#58;alert(1))",
+		"[x](javascript&colon;alert(1))",
+		"[x](&#106;avascript:alert(1))",
+		"[x](&#x6A;&#x61;vascript:alert(1))",
+		"[x](java%0Ascript:alert(1))",
+		"[x](java\\\tscript:alert(1))",
+		"[x](javascript\\:alert(1))",
+		"[x](data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==)",
+		"[x](DATA:text/html,<script>alert(1)</script>)",
+		"[x](Data:image/svg+xml,<svg/onload=alert(1)>)",
+		"[x](vbscript:msgbox(1))",
+		"[x](VBScript:msgbox(1))",
+		"[x](file:///etc/passwd)",
+		"<javascript:alert(1)>",
+		"<JAVASCRIPT:alert(1)>",
+		"<data:text/html,x>",
+		"<vbscript:msgbox(1)>",
+		"[**bold**](javascript:alert(1))",
+		"[x](javascript:alert(1) \"title\")",
+	} {
+		out := renderForTest(t, src)
+		if strings.Contains(out, "<a ") {
+			t.Errorf("render(%q) = %q keeps an unsafe link", src, out)
+		}
+	}
+}
+
+func TestRenderMarkdownKeepsSafeLinks(t *testing.T) {
+	for src, href := range map[string]string{
+		"[x](https://example.com/a?b=c&d=e)":    `href="https://example.com/a?b=c&amp;d=e"`,
+		"[x](HTTP://example.com)":               `href="http://example.com"`,
+		"[x](https://example.com/?a=1&amp;b=2)": `href="https://example.com/?a=1&amp;b=2"`,
+		"[mail](mailto:me@example.com)":         `href="mailto:me@example.com"`,
+		"[rel](/posts/1)":                       `href="/posts/1"`,
+		"<https://example.com/path>":            `href="https://example.com/path"`,
+		"see https://example.com/a_(b).":        `href="https://example.com/a_(b)"`,
+	} {
+		out := renderForTest(t, src)
+		if !strings.Contains(out, href) {
+			t.Errorf("render(%q) = %q, want %s", src, out, href)
+		}
+	}
+}
+
+func TestRenderMarkdownEscapesRawHTML(t *testing.T) {
+	for _, src := range []string{
+		"<script>alert(1)</script>",
+		"<SCRIPT SRC=//evil.example/x.js></SCRIPT>",
+		"<img src=x onerror=alert(1)>",
+		"<svg/onload=alert(1)>",
+		"<iframe src=\"javascript:alert(1)\"></iframe>",
+		"<a href=\"javascript:alert(1)\">x</a>",
+		"<style>body{background:url(javascript:alert(1))}</style>",
+		"<!-- comment --><div>x</div>",
+		"&lt;script&gt;alert(1)&lt;/script&gt;",
+		"**<b onmouseover=alert(1)>x</b>**",
+		">!<img src=x onerror=alert(1)>!<",
+		"| a | b |\n|---|---|\n| <script>x</script> | <img src=x> |",
+		"- <script>alert(1)</script>\n- item",
+		"> <script>alert(1)</script>",
+		"# <script>alert(1)</script>",
+		"`<script>alert(1)</script>`",
+		"    <script>alert(1)</script>",
+	} {
+		out := renderForTest(t, src)
+		if strings.Contains(strings.ToLower(out), "<script") || strings.Contains(out, "<img") ||
+			strings.Contains(out, "<svg") || strings.Contains(out, "<iframe") || strings.Contains(out, "<div") {
+			t.Errorf("render(%q) = %q passes raw HTML through", src, out)
+		}
+	}
+}
+
+func TestRenderMarkdownAttributeInjection(t *testing.T) {
+	for _, src := range []string{
+		`[x](https://example.com/"onmouseover="alert(1))`,
+		`[x](https://example.com/'onmouseover='alert(1))`,
+		`[x](<https://example.com/" onmouseover="alert(1)>)`,
+		`<https://example.com/"onmouseover="alert(1)>`,
+		`https://example.com/"onmouseover="alert(1)`,
+		`https://example.com/?q=<script>`,
+		`[x](https://example.com/ "title\" onclick=\"alert(1)")`,
+		"[x](https://example.com/\u0000onclick=alert(1))",
+		"| a |\n|:-:\" onclick=\"x|\n| b |",
+	} {
+		// An attribute that escaped its quotes would show up as a separate, disallowed attribute.
+		renderForTest(t, src)
+	}
+}
+
+func TestRenderMarkdownCodeFenceLanguage(t *testing.T) {
+	for _, tt := range []struct {
+		src   string
+		class string
+	}{
+		{"```go\nx\n```", `<code class="language-go">`},
+		{"```c++ extra words\nx\n```", `<code class="language-c++">`},
+		{"~~~\" onmouseover=\"alert(1)\nx\n~~~", "<pre><code>x\n"},
+		{"~~~go\" onmouseover=\"alert(1)\nx\n~~~", `<code class="language-go">`},
+		{"```\"><script>alert(1)</script>\nx\n```", `<code class="language-scriptalert1script">`},
+		{"```js\"autofocus/onfocus=alert(1)//\nx\n```", `<code class="language-jsautofocusonfocusalert1">`},
+		{"```\"\"\"\nx\n```", `<code>`},
+		{"```" + strings.Repeat("a", 100) + "\nx\n```", `<code class="language-` + strings.Repeat("a", 32) + `">`},
+		{"```пайтон\nx\n```", `<code>`},
+		{"```go\n</code></pre><script>alert(1)</script>\n```", `<code class="language-go">&lt;/code&gt;&lt;/pre&gt;&lt;script&gt;`},
+	} {
+		out := renderForTest(t, tt.src)
+		if !strings.Contains(out, tt.class) {
+			t.Errorf("render(%q) = %q, want %s", tt.src, out, tt.class)
+		}
+	}
+}
+
+func TestRenderMarkdownLimits(t *testing.T) {
+	deep := maxMarkdownNesting + 4
+	for _, tt := range []struct {
+		name string
+		src  string
+		err  error
+	}{
+		{"size at limit", strings.Repeat("a", maxMarkdownBytes), nil},
+		{"size over limit", strings.Repeat("a", maxMarkdownBytes+1), errMarkdownTooLarge},
+		{"quotes at limit", strings.Repeat("> ", maxMarkdownNesting) + "x", nil},
+		{"quotes too deep", strings.Repeat("> ", deep) + "x", errMarkdownTooDeep},
+		{"lists too deep", nestedList(deep), errMarkdownTooDeep},
+		// Inline nesting adds to the depth of the enclosing blocks.
+		{"emphasis at limit", strings.Repeat("> ", maxMarkdownNesting-4) + "*a **b ~~c _d_ c~~ b** a*", nil},
+		{"emphasis too deep", strings.Repeat("> ", maxMarkdownNesting-3) + "*a **b ~~c _d_ c~~ b** a*", errMarkdownTooDeep},
+		{"spoilers too deep", strings.Repeat("> ", maxMarkdownNesting-1) + "x >!a *b ~~c~~ b* a!<", errMarkdownTooDeep},
+		{"links inside quotes too deep", strings.Repeat("> ", maxMarkdownNesting) + "[**x**](https://example.com)", errMarkdownTooDeep},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := renderMarkdown(tt.src)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err == nil {
+				assertSafeHTML(t, tt.name, out)
+			}
+		})
+	}
+}
+
+func nestedList(depth int) string {
+	var b strings.Builder
+	for i := 0; i < depth; i++ {
+		b.WriteString(strings.Repeat("  ", i) + "- item\n")
+	}
+	return b.String()
+}
+
+// Unclosed delimiters and links must not make rendering quadratic.
+func TestRenderMarkdownUnclosedDelimitersStayLinear(t *testing.T) {
+	for _, src := range []string{
+		strings.Repeat("[a](", maxMarkdownBytes/4),
+		strings.Repeat("*a ", maxMarkdownBytes/3),
+		strings.Repeat("`", maxMarkdownBytes),
+		strings.Repeat("<", maxMarkdownBytes),
+		strings.Repeat(">!", maxMarkdownBytes/2),
+	} {
+		if _, err := renderMarkdown(src); err != nil && !errors.Is(err, errMarkdownTooDeep) {
+			t.Errorf("render: %v", err)
+		}
+	}
+}
+
+func TestRenderStalePostsRendersInMemory(t *testing.T) {
+	oversized := strings.Repeat("<b>", maxMarkdownBytes/3+1)
+	posts := []PostDTO{
+		{Content: "**bold**"},
+		{Content: "**bold**", ContentHTML: "<p>cached</p>\n"},
+		{Content: oversized},
+	}
+	renderStalePosts(posts)
+
+	if posts[0].ContentHTML != "<p><strong>bold</strong></p>\n" {
+		t.Errorf("stale HTML = %q", posts[0].ContentHTML)
+	}
+	if posts[1].ContentHTML != "<p>cached</p>\n" {
+		t.Errorf("current HTML was replaced with %q", posts[1].ContentHTML)
+	}
+	if want := "<p>" + html.EscapeString(oversized) + "</p>\n"; posts[2].ContentHTML != want {
+		t.Error("content over the limit was not rendered as escaped text")
+	}
+}
+
+func FuzzRenderMarkdown(f *testing.F) {
+	for _, seed := range []string{
+		"[x](javascript:alert(1))",
+		"<img src=x onerror=alert(1)>",
+		"```\"><script>\nx\n```",
+		"> - **[a](https://example.com)** >!b!<",
+		"| a | b |\n|:-|-:|\n| `c` | ~~d~~ |",
+		"3. x\n4. y",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		out, err := renderMarkdown(src)
+		if err != nil {
+			return
+		}
+		assertSafeHTML(t, src, out)
+	})
+}
@@ -0,0 +1,878 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+// Default limits on uploaded files, overridable with MEDIA_MAX_IMAGE_BYTES and MEDIA_MAX_VIDEO_BYTES.
+const (
+	defaultMaxImageBytes = 20 << 20
+	defaultMaxVideoBytes = 200 << 20
+)
+
+// Возвращает максимальный размер файла данного типа.
+func mediaSizeLimit(contentType string) int64 {
+	if strings.HasPrefix(contentType, "video/") {
+		return envInt64("MEDIA_MAX_VIDEO_BYTES", defaultMaxVideoBytes)
+	}
+	return envInt64("MEDIA_MAX_IMAGE_BYTES", defaultMaxImageBytes)
+}
+
+// Upper bound on an upload whose type is not known yet.
+func maxUploadSize() int64 {
+	return max(mediaSizeLimit("image/"), mediaSizeLimit("video/"))
+}
+
+// Default limits on unfinished resumable uploads of one user, overridable with
+// MEDIA_MAX_OPEN_UPLOADS and MEDIA_MAX_OPEN_UPLOAD_BYTES.
+const (
+	defaultMaxOpenUploads     = 5
+	defaultMaxOpenUploadBytes = 1 << 30
+)
+
+// Stale upload cleanup settings.
+const (
+	uploadCleanupInterval = 10 * time.Minute
+	uploadCleanupBatch    = 500
+)
+
+func envInt64(name string, fallback int64) int64 {
+	if value, err := strconv.ParseInt(os.Getenv(name), 10, 64); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// Срок, за который нужно завершить возобновляемую загрузку. Задаётся переменной MEDIA_UPLOAD_TTL, по умолчанию сутки.
+func uploadTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("MEDIA_UPLOAD_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return 24 * time.Hour
+}
+
+// Определяет тип файла по сигнатуре в первых байтах. Заявленный клиентом тип не учитывается.
+func sniffMediaType(head []byte) (string, string, bool) {
+	switch {
+	case bytes.HasPrefix(head, []byte("\xFF\xD8\xFF")):
+		return "image/jpeg", ".jpg", true
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png", ".png", true
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return "image/gif", ".gif", true
+	case len(head) >= 12 && string(head[0:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return "image/webp", ".webp", true
+	case bytes.HasPrefix(head, []byte("\x1A\x45\xDF\xA3")):
+		return "video/webm", ".webm", true
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		switch brand := string(head[8:12]); brand {
+		case "qt  ":
+			return "video/quicktime", ".mov", true
+		// HEIF and AVIF images share the ISO container with MP4 but are not supported.
+		case "heic", "heix", "hevc", "mif1", "msf1", "avif":
+			return "", "", false
+		default:
+			return "video/mp4", ".mp4", true
+		}
+	}
+	return "", "", false
+}
+
+// Resumable uploads are staged on local disk, so all chunks of an upload must reach the same instance.
+func stagingPath(id uuid.UUID) string {
+	dir := os.Getenv("MEDIA_STAGING_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "chirp-uploads")
+	}
+	return filepath.Join(dir, id.String())
+}
+
+var uploadLocks sync.Map
+
+// Chunks of one upload are written one at a time.
+func uploadLock(id uuid.UUID) *sync.Mutex {
+	lock, _ := uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// Возвращает адрес, по которому клиенты загружают файл.
+func mediaURL(media models.Media) string {
+	if url := mediaStorage.URL(media.StorageKey); url != "" {
+		return url
+	}
+	return "/api/v1/media/" + media.ID.String()
+}
+
+func toMediaDTO(media models.Media, variants []models.MediaVariant) MediaDTO {
+	dto := MediaDTO{
+		ID:               media.ID,
+		URL:              mediaURL(media),
+		ContentType:      media.ContentType,
+		Size:             media.Size,
+		Width:            media.Width,
+		Height:           media.Height,
+		Blurhash:         media.Blurhash,
+		ProcessingStatus: media.ProcessingStatus,
+		Variants:         []MediaVariantDTO{},
+		CreatedAt:        media.CreatedAt,
+	}
+	for _, variant := range variants {
+		url := mediaStorage.URL(variant.StorageKey)
+		if url == "" {
+			url = "/api/v1/media/" + media.ID.String() + "/" + path.Base(variant.StorageKey)
+		}
+		dto.Variants = append(dto.Variants, MediaVariantDTO{
+			Name:        variant.Name,
+			Format:      variant.Format,
+			URL:         url,
+			ContentType: variant.ContentType,
+			Width:       variant.Width,
+			Height:      variant.Height,
+			Size:        variant.Size,
+		})
+	}
+	return dto
+}
+
+func toMediaUploadDTO(media models.Media) MediaUploadDTO {
+	resp := MediaUploadDTO{
+		ID:     media.ID,
+		Size:   media.Size,
+		Offset: media.Received,
+		Status: media.Status,
+	}
+	if media.Status == models.MediaReady {
+		dto := toMediaDTO(media, nil)
+		resp.Media = &dto
+	}
+	return resp
+}
+
+// Загружает готовые файлы пользователя в переданном порядке.
+func loadOwnedMedia(db *gorm.DB, ownerID uuid.UUID, ids []uuid.UUID) ([]models.Media, string) {
+	if len(ids) == 0 {
+		return nil, ""
+	}
+	seen := map[uuid.UUID]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			return nil, "Each media item can be attached only once"
+		}
+		seen[id] = true
+	}
+
+	var found []models.Media
+	if err := db.Where("id IN ? AND owner_id = ? AND status = ?", ids, ownerID, models.MediaReady).Find(&found).Error; err != nil {
+		return nil, "Failed to load media"
+	}
+	byID := map[uuid.UUID]models.Media{}
+	for _, media := range found {
+		byID[media.ID] = media
+	}
+	ordered := make([]models.Media, 0, len(ids))
+	for _, id := range ids {
+		media, ok := byID[id]
+		if !ok {
+			return nil, "Media " + id.String() + " was not found or is not fully uploaded"
+		}
+		ordered = append(ordered, media)
+	}
+	return ordered, ""
+}
+
+// Возвращает адрес баннера из загруженного пользователем изображения.
+func bannerURLFor(db *gorm.DB, ownerID, mediaID uuid.UUID) (string, string) {
+	media, errMsg := loadOwnedMedia(db, ownerID, []uuid.UUID{mediaID})
+	if errMsg != "" {
+		return "", errMsg
+	}
+	if !strings.HasPrefix(media[0].ContentType, "image/") {
+		return "", "Banner must be an image"
+	}
+	return mediaURL(media[0]), ""
+}
+
+func mediaURLs(media []models.Media) []string {
+	urls := make([]string, len(media))
+	for i, item := range media {
+		urls[i] = mediaURL(item)
+	}
+	return urls
+}
+
+// Заменяет медиафайлы поста.
+func savePostMedia(tx *gorm.DB, postID uuid.UUID, media []models.Media) error {
+	if err := tx.Where("post_id = ?", postID).Delete(&models.PostMedia{}).Error; err != nil {
+		return err
+	}
+	if len(media) == 0 {
+		return nil
+	}
+	rows := make([]models.PostMedia, len(media))
+	for i, item := range media {
+		rows[i] = models.PostMedia{PostID: postID, MediaID: item.ID, Position: i}
+	}
+	return tx.Create(&rows).Error
+}
+
+// Добавляет к постам их медиафайлы.
+func attachPostMedia(db *gorm.DB, posts []PostDTO) {
+	if len(posts) == 0 {
+		return
+	}
+	ids := make([]uuid.UUID, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+
+	var links []models.PostMedia
+	db.Where("post_id IN ?", ids).Order("position").Find(&links)
+	mediaIDs := make([]uuid.UUID, len(links))
+	for i, link := range links {
+		mediaIDs[i] = link.MediaID
+	}
+	byID := map[uuid.UUID]models.Media{}
+	variants := map[uuid.UUID][]models.MediaVariant{}
+	if len(mediaIDs) > 0 {
+		var media []models.Media
+		db.Where("id IN ?", mediaIDs).Find(&media)
+		for _, item := range media {
+			byID[item.ID] = item
+			if needsProcessing(item) {
+				enqueueMediaProcessing(db, item.ID)
+			}
+		}
+		var rows []models.MediaVariant
+		db.Where("media_id IN ?", mediaIDs).Order("media_id, width, format").Find(&rows)
+		for _, variant := range rows {
+			variants[variant.MediaID] = append(variants[variant.MediaID], variant)
+		}
+	}
+
+	byPost := map[uuid.UUID][]MediaDTO{}
+	for _, link := range links {
+		if media, ok := byID[link.MediaID]; ok {
+			byPost[link.PostID] = append(byPost[link.PostID], toMediaDTO(media, variants[media.ID]))
+		}
+	}
+	for i := range posts {
+		posts[i].Media = append([]MediaDTO{}, byPost[posts[i].ID]...)
+	}
+}
+
+// Проверяет тип и размер файла и сохраняет его в хранилище под ключом, производным от ID.
+func storeMedia(ctx context.Context, media *models.Media, file io.ReadSeeker) (int, string) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return http.StatusInternalServerError, "Failed to read file"
+	}
+	contentType, ext, ok := sniffMediaType(head[:n])
+	if !ok {
+		return http.StatusUnsupportedMediaType, "Unsupported file type. Upload a JPEG, PNG, GIF, WebP, MP4, MOV or WebM file"
+	}
+	if media.Size > mediaSizeLimit(contentType) {
+		return http.StatusRequestEntityTooLarge, "File is too large"
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return http.StatusInternalServerError, "Failed to read file"
+	}
+
+	// Metadata is stripped before the file is stored, so it is never served with the camera's location.
+	// Video containers are stored as uploaded.
+	var body io.Reader = file
+	if strings.HasPrefix(contentType, "image/") {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return http.StatusInternalServerError, "Failed to read file"
+		}
+		if data, err = stripImageMetadata(contentType, data); err != nil {
+			return http.StatusUnsupportedMediaType, "File is not a valid image"
+		}
+		pHash, dHash, err := hashImage(data, contentType)
+		if errors.Is(err, errTooManyPixels) {
+			return http.StatusRequestEntityTooLarge, "Image dimensions are too large"
+		}
+		if err != nil {
+			return http.StatusUnsupportedMediaType, "File is not a valid image"
+		}
+		p, d := int64(pHash), int64(dHash)
+		media.PHash, media.DHash = &p, &d
+		body = bytes.NewReader(data)
+		media.Size = int64(len(data))
+	}
+	if isProcessableImage(contentType) {
+		media.ProcessingStatus = models.MediaProcessingPending
+	}
+
+	media.ContentType = contentType
+	media.StorageKey = "media/" + media.ID.String() + ext
+	if err := mediaStorage.Put(ctx, media.StorageKey, body, media.Size, contentType); err != nil {
+		return http.StatusInternalServerError, "Failed to store file"
+	}
+	return 0, ""
+}
+
+// @Summary Загрузить файл
+// @Description Загружает изображение или видео одним multipart-запросом в поле file. Тип определяется по содержимому файла. Возвращённый ID используется в mediaIds поста
+// @Tags media
+// @Security BearerAuth
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "Файл"
+// @Success 201 {object} routes.MediaDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 415 {object} map[string]string
+// @Router /media [post]
+func uploadMediaHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	ownerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	// Multipart framing adds a little on top of the file itself.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize()+1<<20)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A file is required in the file field"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	now := time.Now()
+	media := models.Media{
+		ID:          uuid.New(),
+		OwnerID:     ownerID,
+		Status:      models.MediaReady,
+		Size:        fileHeader.Size,
+		Received:    fileHeader.Size,
+		Filename:    truncateRunes(filepath.Base(fileHeader.Filename), 255),
+		CreatedAt:   now,
+		CompletedAt: &now,
+	}
+	if status, errMsg := storeMedia(c.Request.Context(), &media, file); errMsg != "" {
+		c.JSON(status, gin.H{"error": errMsg})
+		return
+	}
+	media.Received = media.Size
+	if err := db.Create(&media).Error; err != nil {
+		mediaStorage.Delete(context.Background(), media.StorageKey)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save media"})
+		return
+	}
+	if media.ProcessingStatus == models.MediaProcessingPending {
+		enqueueMediaProcessing(db, media.ID)
+	}
+
+	c.JSON(http.StatusCreated, toMediaDTO(media, nil))
+}
+
+// @Summary Начать возобновляемую загрузку
+// @Description Создаёт сессию загрузки файла заданного размера. Данные отправляются частями запросами PATCH. Загрузка, не завершённая за MEDIA_UPLOAD_TTL, удаляется. Число и общий размер незавершённых загрузок пользователя ограничены
+// @Tags media
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param data body routes.CreateUploadRequest true "Параметры загрузки"
+// @Success 201 {object} routes.MediaUploadDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Router /media/uploads [post]
+func createUploadHandler(c *gin.Context, db *gorm.DB) {
+	var req CreateUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	ownerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if req.Size > maxUploadSize() {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large"})
+		return
+	}
+
+	// Unfinished uploads hold disk space until they complete or expire, so each user may keep only a few.
+	var open struct {
+		Count int64
+		Bytes int64
+	}
+	if err := db.Model(&models.Media{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(size), 0) AS bytes").
+		Where("owner_id = ? AND status = ?", ownerID, models.MediaUploading).
+		Scan(&open).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start upload"})
+		return
+	}
+	if open.Count >= envInt64("MEDIA_MAX_OPEN_UPLOADS", defaultMaxOpenUploads) ||
+		open.Bytes+req.Size > envInt64("MEDIA_MAX_OPEN_UPLOAD_BYTES", defaultMaxOpenUploadBytes) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many unfinished uploads. Complete or cancel them first"})
+		return
+	}
+
+	media := models.Media{
+		ID:        uuid.New(),
+		OwnerID:   ownerID,
+		Status:    models.MediaUploading,
+		Size:      req.Size,
+		Filename:  truncateRunes(filepath.Base(req.Filename), 255),
+		CreatedAt: time.Now(),
+	}
+	path := stagingPath(media.ID)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start upload"})
+		return
+	}
+	staging, err := os.Create(path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start upload"})
+		return
+	}
+	staging.Close()
+
+	if err := db.Create(&media).Error; err != nil {
+		os.Remove(path)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start upload"})
+		return
+	}
+
+	c.Header("Upload-Offset", "0")
+	c.Header("Upload-Expires", media.CreatedAt.Add(uploadTTL()).UTC().Format(http.TimeFormat))
+	c.JSON(http.StatusCreated, toMediaUploadDTO(media))
+}
+
+// @Summary Получить состояние загрузки
+// @Description Возвращает число уже принятых байт, с которого нужно продолжить загрузку
+// @Tags media
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID загрузки"
+// @Success 200 {object} routes.MediaUploadDTO
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /media/uploads/{id} [get]
+func getUploadHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	ownerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var media models.Media
+	if err := db.First(&media, "id = ? AND owner_id = ?", c.Param("id"), ownerID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(media.Received, 10))
+	c.JSON(http.StatusOK, toMediaUploadDTO(media))
+}
+
+// @Summary Отправить часть файла
+// @Description Дописывает тело запроса к загрузке начиная с байта из заголовка Upload-Offset. Он должен совпадать с числом принятых байт. Когда приняты все байты, файл проверяется и сохраняется, а в ответе появляется media
+// @Tags media
+// @Security BearerAuth
+// @Accept application/offset+octet-stream
+// @Produce json
+// @Param id path string true "ID загрузки"
+// @Param Upload-Offset header int true "Смещение части"
+// @Success 200 {object} routes.MediaUploadDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 410 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 415 {object} map[string]string
+// @Router /media/uploads/{id} [patch]
+func appendUploadHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	ownerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	uploadID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return
+	}
+
+	lock := uploadLock(uploadID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	var media models.Media
+	if err := db.First(&media, "id = ? AND owner_id = ?", uploadID, ownerID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return
+	}
+	if media.Status != models.MediaUploading {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload is already complete"})
+		return
+	}
+	if time.Since(media.CreatedAt) > uploadTTL() {
+		c.JSON(http.StatusGone, gin.H{"error": "Upload has expired, start a new upload"})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset header is required"})
+		return
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(media.Received, 10))
+	if offset != media.Received {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload-Offset does not match the number of received bytes"})
+		return
+	}
+
+	staging, err := os.OpenFile(stagingPath(media.ID), os.O_WRONLY, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Upload data is missing, start a new upload"})
+		return
+	}
+	written, copyErr := int64(0), error(nil)
+	if _, copyErr = staging.Seek(offset, io.SeekStart); copyErr == nil {
+		written, copyErr = io.Copy(staging, io.LimitReader(c.Request.Body, media.Size-offset))
+	}
+	if err := staging.Close(); copyErr == nil {
+		copyErr = err
+	}
+
+	// Bytes that arrived before a dropped connection still count, so the client resumes after them.
+	if written > 0 {
+		media.Received += written
+		if err := db.Model(&media).Update("received", media.Received).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save upload progress"})
+			return
+		}
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(media.Received, 10))
+	if copyErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload was interrupted"})
+		return
+	}
+	if media.Received < media.Size {
+		c.JSON(http.StatusOK, toMediaUploadDTO(media))
+		return
+	}
+
+	if status, errMsg := finishUpload(c.Request.Context(), db, &media); errMsg != "" {
+		c.JSON(status, gin.H{"error": errMsg})
+		return
+	}
+	c.JSON(http.StatusOK, toMediaUploadDTO(media))
+}
+
+// Переносит полностью принятый файл в хранилище. Файл неподходящего типа или размера удаляется вместе с загрузкой;
+// при сбое хранилища загрузку можно завершить повторным PATCH без данных.
+func finishUpload(ctx context.Context, db *gorm.DB, media *models.Media) (int, string) {
+	path := stagingPath(media.ID)
+	staging, err := os.Open(path)
+	if err != nil {
+		return http.StatusInternalServerError, "Upload data is missing, start a new upload"
+	}
+	status, errMsg := storeMedia(ctx, media, staging)
+	staging.Close()
+	if status == http.StatusUnsupportedMediaType || status == http.StatusRequestEntityTooLarge {
+		os.Remove(path)
+		db.Delete(&models.Media{}, "id = ?", media.ID)
+		uploadLocks.Delete(media.ID)
+		return status, errMsg
+	}
+	if errMsg != "" {
+		return status, errMsg
+	}
+
+	now := time.Now()
+	media.Status = models.MediaReady
+	media.Received = media.Size
+	media.CompletedAt = &now
+	if err := db.Model(media).Updates(map[string]interface{}{
+		"status":            media.Status,
+		"content_type":      media.ContentType,
+		"storage_key":       media.StorageKey,
+		"size":              media.Size,
+		"received":          media.Received,
+		"processing_status": media.ProcessingStatus,
+		"p_hash":            media.PHash,
+		"d_hash":            media.DHash,
+		"completed_at":      now,
+	}).Error; err != nil {
+		return http.StatusInternalServerError, "Failed to save media"
+	}
+	os.Remove(path)
+	uploadLocks.Delete(media.ID)
+	if media.ProcessingStatus == models.MediaProcessingPending {
+		enqueueMediaProcessing(db, media.ID)
+	}
+	return 0, ""
+}
+
+// @Summary Отменить загрузку
+// @Description Удаляет незавершённую загрузку и принятые данные
+// @Tags media
+// @Security BearerAuth
+// @Param id path string true "ID загрузки"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /media/uploads/{id} [delete]
+func cancelUploadHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	ownerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	uploadID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return
+	}
+
+	lock := uploadLock(uploadID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	var media models.Media
+	if err := db.First(&media, "id = ? AND owner_id = ?", uploadID, ownerID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return
+	}
+	if media.Status != models.MediaUploading {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload is already complete"})
+		return
+	}
+	if err := db.Delete(&media).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel upload"})
+		return
+	}
+	os.Remove(stagingPath(media.ID))
+	uploadLocks.Delete(media.ID)
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Получить файл
+// @Description Отдаёт загруженный файл или перенаправляет на его адрес в хранилище
+// @Tags media
+// @Produce octet-stream
+// @Param id path string true "ID файла"
+// @Success 200 {file} file
+// @Success 302
+// @Failure 404 {object} map[string]string
+// @Router /media/{id} [get]
+func serveMediaHandler(c *gin.Context, db *gorm.DB) {
+	var media models.Media
+	if err := db.First(&media, "id = ? AND status = ?", c.Param("id"), models.MediaReady).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+	serveStoredObject(c, media.StorageKey, media.Size, media.ContentType)
+}
+
+// @Summary Получить уменьшенную копию изображения
+// @Description Отдаёт вариант изображения, например small.webp, или перенаправляет на его адрес в хранилище
+// @Tags media
+// @Produce octet-stream
+// @Param id path string true "ID файла"
+// @Param variant path string true "Имя файла варианта"
+// @Success 200 {file} file
+// @Success 302
+// @Failure 404 {object} map[string]string
+// @Router /media/{id}/{variant} [get]
+func serveMediaVariantHandler(c *gin.Context, db *gorm.DB) {
+	mediaID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+	var variant models.MediaVariant
+	key := "media/" + mediaID.String() + "/" + c.Param("variant")
+	if err := db.First(&variant, "media_id = ? AND storage_key = ?", mediaID, key).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+	serveStoredObject(c, variant.StorageKey, variant.Size, variant.ContentType)
+}
+
+func serveStoredObject(c *gin.Context, key string, size int64, contentType string) {
+	if url := mediaStorage.URL(key); url != "" {
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+
+	body, err := mediaStorage.Get(c.Request.Context(), key)
+	if errors.Is(err, errObjectNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load media"})
+		return
+	}
+	defer body.Close()
+
+	// Media never changes once stored, and the sniffed type must not be second-guessed by the browser.
+	c.DataFromReader(http.StatusOK, size, contentType, body, map[string]string{
+		"Cache-Control":          "public, max-age=31536000, immutable",
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+var startUploadCleanup sync.Once
+
+// Запускает фоновое удаление загрузок, не завершённых за MEDIA_UPLOAD_TTL.
+func scheduleStaleUploadCleanup(db *gorm.DB) {
+	startUploadCleanup.Do(func() {
+		go func() {
+			ticker := time.NewTicker(uploadCleanupInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				removeStaleUploads(db)
+			}
+		}()
+	})
+}
+
+// Удаляет просроченные загрузки вместе с принятыми данными, а также файлы в каталоге загрузок,
+// для которых не осталось незавершённой загрузки.
+func removeStaleUploads(db *gorm.DB) {
+	cutoff := time.Now().Add(-uploadTTL())
+
+	var ids []uuid.UUID
+	if err := db.Model(&models.Media{}).Where("status = ? AND created_at < ?", models.MediaUploading, cutoff).
+		Limit(uploadCleanupBatch).Pluck("id", &ids).Error; err != nil {
+		log.Println("Failed to load stale uploads:", err)
+		return
+	}
+	for _, id := range ids {
+		removeStaleUpload(db, id)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(stagingPath(uuid.Nil)))
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		id, err := uuid.Parse(entry.Name())
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		var count int64
+		if db.Model(&models.Media{}).Where("id = ? AND status = ?", id, models.MediaUploading).Count(&count); count == 0 {
+			os.Remove(stagingPath(id))
+		}
+	}
+}
+
+func removeStaleUpload(db *gorm.DB, id uuid.UUID) {
+	// A chunk being written holds the lock; the upload is checked again once it is released.
+	lock := uploadLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	result := db.Where("id = ? AND status = ?", id, models.MediaUploading).Delete(&models.Media{})
+	if result.Error != nil {
+		log.Println("Failed to remove stale upload:", result.Error)
+		return
+	}
+	os.Remove(stagingPath(id))
+	uploadLocks.Delete(id)
+}
+
+func RegisterMediaRoutes(r *gin.RouterGroup, db *gorm.DB) {
+	r.POST("", JWTMiddleware(), func(c *gin.Context) {
+		uploadMediaHandler(c, db)
+	})
+
+	r.POST("/uploads", JWTMiddleware(), func(c *gin.Context) {
+		createUploadHandler(c, db)
+	})
+
+	r.GET("/uploads/:id", JWTMiddleware(), func(c *gin.Context) {
+		getUploadHandler(c, db)
+	})
+
+	r.PATCH("/uploads/:id", JWTMiddleware(), func(c *gin.Context) {
+		appendUploadHandler(c, db)
+	})
+
+	r.DELETE("/uploads/:id", JWTMiddleware(), func(c *gin.Context) {
+		cancelUploadHandler(c, db)
+	})
+
+	r.GET("/:id", func(c *gin.Context) {
+		serveMediaHandler(c, db)
+	})
+
+	r.GET("/:id/:variant", func(c *gin.Context) {
+		serveMediaVariantHandler(c, db)
+	})
+}
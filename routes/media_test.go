@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRemoveStaleUploadsSweepsStagingFiles(t *testing.T) {
+	t.Setenv("MEDIA_STAGING_DIR", t.TempDir())
+	t.Setenv("MEDIA_UPLOAD_TTL", "1h")
+	db, recorder := dryRunDB(t)
+
+	stale, fresh := stagingPath(uuid.New()), stagingPath(uuid.New())
+	for _, path := range []string{stale, fresh} {
+		if err := os.WriteFile(path, []byte("partial upload"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	removeStaleUploads(db)
+
+	if len(recorder.matching(`SELECT "id" FROM "media" WHERE status = 'uploading' AND created_at <`)) != 1 {
+		t.Errorf("stale upload rows were not queried: %v", recorder.statements)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("staging file older than the TTL without an upload was kept: %v", err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("staging file of a recent upload was removed: %v", err)
+	}
+}
@@ -0,0 +1,644 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+// Максимальное число участников группового диалога, включая создателя.
+const maxConversationMembers = 10
+
+// @Summary Начать диалог
+// @Description Создаёт личный диалог с одним пользователем (или возвращает существующий) либо групповой диалог с несколькими. Заблокированных пользователей добавить нельзя
+// @Tags messages
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param data body routes.CreateConversationRequest true "Участники и первое сообщение"
+// @Success 200 {object} routes.ConversationDTO
+// @Success 201 {object} routes.ConversationDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /messages/conversations [post]
+func createConversationHandler(c *gin.Context, db *gorm.DB) {
+	var req CreateConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	creatorID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	participants := map[uuid.UUID]bool{}
+	for _, participantID := range req.ParticipantIDs {
+		if participantID != creatorID {
+			participants[participantID] = true
+		}
+	}
+	if len(participants) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A conversation needs at least one other participant"})
+		return
+	}
+	if len(participants)+1 > maxConversationMembers {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many participants"})
+		return
+	}
+
+	participantIDs := make([]uuid.UUID, 0, len(participants))
+	for participantID := range participants {
+		participantIDs = append(participantIDs, participantID)
+	}
+
+	var count int64
+	db.Model(&models.User{}).Where("id IN ?", participantIDs).Count(&count)
+	if int(count) != len(participantIDs) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	for _, participantID := range participantIDs {
+		if isBlockedEitherWay(db, creatorID, participantID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot message this user"})
+			return
+		}
+	}
+
+	isGroup := len(participantIDs) > 1
+	if !isGroup {
+		// One-to-one conversations are unique per pair of users.
+		var existing models.Conversation
+		err := db.Where("is_group = ?", false).
+			Where("id IN (?)", db.Model(&models.ConversationMember{}).Select("conversation_id").Where("user_id = ?", creatorID)).
+			Where("id IN (?)", db.Model(&models.ConversationMember{}).Select("conversation_id").Where("user_id = ?", participantIDs[0])).
+			First(&existing).Error
+		if err == nil {
+			if req.Body != "" {
+				if _, err := sendDirectMessage(db, existing.ID, creatorID, req.Body); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
+					return
+				}
+			}
+			respondConversation(c, db, http.StatusOK, existing.ID, creatorID)
+			return
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create conversation"})
+			return
+		}
+	}
+
+	now := time.Now()
+	conversation := models.Conversation{
+		Title:         req.Title,
+		IsGroup:       isGroup,
+		CreatedByID:   creatorID,
+		LastMessageAt: now,
+		CreatedAt:     now,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&conversation).Error; err != nil {
+			return err
+		}
+		members := []models.ConversationMember{{ConversationID: conversation.ID, UserID: creatorID, LastReadAt: &now, JoinedAt: now}}
+		for _, participantID := range participantIDs {
+			members = append(members, models.ConversationMember{ConversationID: conversation.ID, UserID: participantID, JoinedAt: now})
+		}
+		return tx.Create(&members).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create conversation"})
+		return
+	}
+
+	if req.Body != "" {
+		if _, err := sendDirectMessage(db, conversation.ID, creatorID, req.Body); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
+			return
+		}
+	}
+
+	respondConversation(c, db, http.StatusCreated, conversation.ID, creatorID)
+}
+
+// @Summary Получить диалоги
+// @Description Возвращает диалоги текущего пользователя от последних к старым. Для следующей страницы передайте nextCursor
+// @Tags messages
+// @Security BearerAuth
+// @Produce json
+// @Param cursor query string false "Курсор"
+// @Param limit query int false "Лимит"
+// @Success 200 {object} routes.ConversationsPageResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /messages/conversations [get]
+func listConversationsHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	viewerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	limit := cursorLimit(c)
+	query := db.Preload("Members.User").
+		Where("id IN (?)", db.Model(&models.ConversationMember{}).Select("conversation_id").Where("user_id = ?", viewerID))
+	if cursor := c.Query("cursor"); cursor != "" {
+		at, id, err := decodeCursor(cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query = query.Where("(last_message_at, id) < (?, ?)", at, id)
+	}
+
+	var conversations []models.Conversation
+	if err := query.Order("last_message_at DESC, id DESC").Limit(limit + 1).Find(&conversations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve conversations"})
+		return
+	}
+
+	var resp ConversationsPageResponse
+	if len(conversations) > limit {
+		conversations = conversations[:limit]
+		last := conversations[limit-1]
+		resp.NextCursor = encodeCursor(last.LastMessageAt, last.ID)
+	}
+
+	conversationIDs := make([]uuid.UUID, len(conversations))
+	for i, conversation := range conversations {
+		conversationIDs[i] = conversation.ID
+	}
+	unread := unreadMessageCounts(db, viewerID, conversationIDs)
+
+	resp.Conversations = make([]ConversationDTO, len(conversations))
+	for i, conversation := range conversations {
+		resp.Conversations[i] = toConversationDTO(conversation, viewerID, unread[conversation.ID])
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Получить сообщения диалога
+// @Description Возвращает сообщения от новых к старым с отметками о прочтении. Сообщения заблокированных пользователей скрыты
+// @Tags messages
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID диалога"
+// @Param cursor query string false "Курсор"
+// @Param limit query int false "Лимит"
+// @Success 200 {object} routes.DirectMessagesPageResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /messages/conversations/{id}/messages [get]
+func getConversationMessagesHandler(c *gin.Context, db *gorm.DB) {
+	conversation, viewerID, ok := loadConversation(c, db)
+	if !ok {
+		return
+	}
+
+	limit := cursorLimit(c)
+	query := db.Preload("Sender").
+		Where("conversation_id = ?", conversation.ID).
+		Where("sender_id NOT IN (?)", blockedByUser(db, viewerID))
+	if cursor := c.Query("cursor"); cursor != "" {
+		at, id, err := decodeCursor(cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query = query.Where("(created_at, id) < (?, ?)", at, id)
+	}
+
+	var messages []models.DirectMessage
+	if err := query.Order("created_at DESC, id DESC").Limit(limit + 1).Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+		return
+	}
+
+	var resp DirectMessagesPageResponse
+	if len(messages) > limit {
+		messages = messages[:limit]
+		last := messages[limit-1]
+		resp.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	resp.Messages = make([]DirectMessageDTO, len(messages))
+	for i, message := range messages {
+		resp.Messages[i] = toDirectMessageDTO(message, conversation.Members)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Отправить сообщение
+// @Description Отправляет сообщение в диалог. Сообщение не отправляется, если отправитель и кто-то из участников диалога заблокировал другого
+// @Tags messages
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID диалога"
+// @Param data body routes.SendDirectMessageRequest true "Сообщение"
+// @Success 201 {object} routes.DirectMessageDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /messages/conversations/{id}/messages [post]
+func sendDirectMessageHandler(c *gin.Context, db *gorm.DB) {
+	var req SendDirectMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	conversation, senderID, ok := loadConversation(c, db)
+	if !ok {
+		return
+	}
+
+	// Blocked users cannot be added to a group conversation, so a block made later stops messages as well.
+	for _, member := range conversation.Members {
+		if member.UserID != senderID && isBlockedEitherWay(db, senderID, member.UserID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot message this user"})
+			return
+		}
+	}
+
+	message, err := sendDirectMessage(db, conversation.ID, senderID, req.Body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, toDirectMessageDTO(message, nil))
+}
+
+// @Summary Отметить диалог прочитанным
+// @Description Отмечает прочитанными сообщения до указанного (по умолчанию до последнего)
+// @Tags messages
+// @Security BearerAuth
+// @Accept json
+// @Param id path string true "ID диалога"
+// @Param data body routes.MarkConversationReadRequest false "Последнее прочитанное сообщение"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /messages/conversations/{id}/read [post]
+func markConversationReadHandler(c *gin.Context, db *gorm.DB) {
+	var req MarkConversationReadRequest
+	// The body is optional.
+	_ = c.ShouldBindJSON(&req)
+
+	conversation, viewerID, ok := loadConversation(c, db)
+	if !ok {
+		return
+	}
+
+	var message models.DirectMessage
+	query := db.Where("conversation_id = ?", conversation.ID)
+	if req.MessageID != nil {
+		query = query.Where("id = ?", *req.MessageID)
+	}
+	if err := query.Order("created_at DESC, id DESC").First(&message).Error; err != nil {
+		if req.MessageID != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	// Read markers only move forward.
+	if err := db.Model(&models.ConversationMember{}).
+		Where("conversation_id = ? AND user_id = ?", conversation.ID, viewerID).
+		Where("(last_read_at IS NULL OR last_read_at < ?)", message.CreatedAt).
+		Updates(map[string]interface{}{
+			"last_read_at":         message.CreatedAt,
+			"last_read_message_id": message.ID,
+		}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark conversation read"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Отключить уведомления диалога
+// @Description Включает или отключает уведомления диалога. Такие диалоги не учитываются в счётчике непрочитанных
+// @Tags messages
+// @Security BearerAuth
+// @Accept json
+// @Param id path string true "ID диалога"
+// @Param data body routes.MuteConversationRequest true "Состояние"
+// @Success 204 {string} string ""
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /messages/conversations/{id}/mute [put]
+func muteConversationHandler(c *gin.Context, db *gorm.DB) {
+	var req MuteConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	conversation, viewerID, ok := loadConversation(c, db)
+	if !ok {
+		return
+	}
+
+	if err := db.Model(&models.ConversationMember{}).
+		Where("conversation_id = ? AND user_id = ?", conversation.ID, viewerID).
+		Update("muted", req.Muted).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update conversation"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Покинуть групповой диалог
+// @Description Удаляет текущего пользователя из группового диалога
+// @Tags messages
+// @Security BearerAuth
+// @Param id path string true "ID диалога"
+// @Success 204 {string} string ""
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /messages/conversations/{id}/members/me [delete]
+func leaveConversationHandler(c *gin.Context, db *gorm.DB) {
+	conversation, viewerID, ok := loadConversation(c, db)
+	if !ok {
+		return
+	}
+
+	if !conversation.IsGroup {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can only leave group conversations"})
+		return
+	}
+
+	if err := db.Where("conversation_id = ? AND user_id = ?", conversation.ID, viewerID).Delete(&models.ConversationMember{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave conversation"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Получить число непрочитанных сообщений
+// @Description Возвращает число диалогов с непрочитанными сообщениями и общее число таких сообщений без учёта отключённых диалогов
+// @Tags messages
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} routes.UnreadMessagesDTO
+// @Failure 401 {object} map[string]string
+// @Router /messages/unread [get]
+func getUnreadMessagesHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	viewerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var conversationIDs []uuid.UUID
+	db.Model(&models.ConversationMember{}).Where("user_id = ? AND muted = ?", viewerID, false).Pluck("conversation_id", &conversationIDs)
+
+	var resp UnreadMessagesDTO
+	for _, count := range unreadMessageCounts(db, viewerID, conversationIDs) {
+		resp.Conversations++
+		resp.Messages += count
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Загружает диалог вместе с участниками и проверяет, что текущий пользователь в нём состоит. При ошибке ответ уже отправлен.
+func loadConversation(c *gin.Context, db *gorm.DB) (models.Conversation, uuid.UUID, bool) {
+	var conversation models.Conversation
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return conversation, uuid.Nil, false
+	}
+
+	viewerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return conversation, uuid.Nil, false
+	}
+
+	if err := db.Preload("Members.User").First(&conversation, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return conversation, uuid.Nil, false
+	}
+
+	for _, member := range conversation.Members {
+		if member.UserID == viewerID {
+			return conversation, viewerID, true
+		}
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+	return conversation, uuid.Nil, false
+}
+
+// Сохраняет сообщение, поднимает диалог наверх списка и отмечает его прочитанным для отправителя.
+func sendDirectMessage(db *gorm.DB, conversationID, senderID uuid.UUID, body string) (models.DirectMessage, error) {
+	message := models.DirectMessage{
+		ConversationID: conversationID,
+		SenderID:       senderID,
+		Body:           body,
+		CreatedAt:      time.Now(),
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&message).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Conversation{}).Where("id = ?", conversationID).
+			Update("last_message_at", message.CreatedAt).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.ConversationMember{}).
+			Where("conversation_id = ? AND user_id = ?", conversationID, senderID).
+			Updates(map[string]interface{}{
+				"last_read_at":         message.CreatedAt,
+				"last_read_message_id": message.ID,
+			}).Error
+	})
+	if err != nil {
+		return message, err
+	}
+
+	// Members who blocked the sender do not see the message, so they are not notified either.
+	var recipientIDs []uuid.UUID
+	db.Model(&models.ConversationMember{}).
+		Where("conversation_id = ? AND user_id <> ?", conversationID, senderID).
+		Where("user_id NOT IN (?)", db.Model(&models.UserBlock{}).Select("blocker_id").Where("blocked_id = ?", senderID)).
+		Pluck("user_id", &recipientIDs)
+	db.First(&message.Sender, "id = ?", senderID)
+	for _, recipientID := range recipientIDs {
+		publishEvent(userTopic(recipientID), "message.created", toDirectMessageDTO(message, nil))
+	}
+	return message, nil
+}
+
+// Считает непрочитанные пользователем сообщения в каждом из диалогов.
+func unreadMessageCounts(db *gorm.DB, userID uuid.UUID, conversationIDs []uuid.UUID) map[uuid.UUID]int64 {
+	counts := map[uuid.UUID]int64{}
+	if len(conversationIDs) == 0 {
+		return counts
+	}
+
+	var rows []struct {
+		ConversationID uuid.UUID
+		Count          int64
+	}
+	db.Table("direct_messages AS m").
+		Select("m.conversation_id, COUNT(*) AS count").
+		Joins("JOIN conversation_members AS cm ON cm.conversation_id = m.conversation_id AND cm.user_id = ?", userID).
+		Where("m.conversation_id IN ?", conversationIDs).
+		Where("m.sender_id <> ?", userID).
+		Where("m.sender_id NOT IN (?)", blockedByUser(db, userID)).
+		Where("(cm.last_read_at IS NULL OR m.created_at > cm.last_read_at)").
+		Group("m.conversation_id").
+		Scan(&rows)
+
+	for _, row := range rows {
+		counts[row.ConversationID] = row.Count
+	}
+	return counts
+}
+
+func cursorLimit(c *gin.Context) int {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if limit < 1 || limit > 100 {
+		limit = 25
+	}
+	return limit
+}
+
+func respondConversation(c *gin.Context, db *gorm.DB, status int, conversationID, viewerID uuid.UUID) {
+	var conversation models.Conversation
+	if err := db.Preload("Members.User").First(&conversation, "id = ?", conversationID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve conversation"})
+		return
+	}
+
+	unread := unreadMessageCounts(db, viewerID, []uuid.UUID{conversationID})
+	c.JSON(status, toConversationDTO(conversation, viewerID, unread[conversationID]))
+}
+
+func toConversationDTO(conversation models.Conversation, viewerID uuid.UUID, unread int64) ConversationDTO {
+	dto := ConversationDTO{
+		ID:            conversation.ID,
+		Title:         conversation.Title,
+		IsGroup:       conversation.IsGroup,
+		UnreadCount:   unread,
+		LastMessageAt: conversation.LastMessageAt,
+		CreatedAt:     conversation.CreatedAt,
+		Members:       make([]ConversationMemberDTO, len(conversation.Members)),
+	}
+	for i, member := range conversation.Members {
+		if member.UserID == viewerID {
+			dto.Muted = member.Muted
+		}
+		dto.Members[i] = ConversationMemberDTO{
+			UserID:            member.UserID,
+			Nickname:          member.User.Nickname,
+			LastReadAt:        member.LastReadAt,
+			LastReadMessageID: member.LastReadMessageID,
+		}
+	}
+	return dto
+}
+
+// Преобразует сообщение в DTO. Прочитавшими считаются участники, чья отметка о прочтении не раньше сообщения.
+func toDirectMessageDTO(message models.DirectMessage, members []models.ConversationMember) DirectMessageDTO {
+	dto := DirectMessageDTO{
+		ID:             message.ID,
+		ConversationID: message.ConversationID,
+		SenderID:       message.SenderID,
+		SenderNickname: message.Sender.Nickname,
+		Body:           message.Body,
+		CreatedAt:      message.CreatedAt,
+		ReadBy:         []uuid.UUID{},
+	}
+	for _, member := range members {
+		if member.UserID != message.SenderID && member.LastReadAt != nil && !member.LastReadAt.Before(message.CreatedAt) {
+			dto.ReadBy = append(dto.ReadBy, member.UserID)
+		}
+	}
+	return dto
+}
+
+func RegisterMessageRoutes(r *gin.RouterGroup, db *gorm.DB) {
+	r.Use(JWTMiddleware())
+
+	r.POST("/conversations", func(c *gin.Context) {
+		createConversationHandler(c, db)
+	})
+
+	r.GET("/conversations", func(c *gin.Context) {
+		listConversationsHandler(c, db)
+	})
+
+	r.GET("/conversations/:id/messages", func(c *gin.Context) {
+		getConversationMessagesHandler(c, db)
+	})
+
+	r.POST("/conversations/:id/messages", func(c *gin.Context) {
+		sendDirectMessageHandler(c, db)
+	})
+
+	r.POST("/conversations/:id/read", func(c *gin.Context) {
+		markConversationReadHandler(c, db)
+	})
+
+	r.PUT("/conversations/:id/mute", func(c *gin.Context) {
+		muteConversationHandler(c, db)
+	})
+
+	r.DELETE("/conversations/:id/members/me", func(c *gin.Context) {
+		leaveConversationHandler(c, db)
+	})
+
+	r.GET("/unread", func(c *gin.Context) {
+		getUnreadMessagesHandler(c, db)
+	})
+}
@@ -0,0 +1,243 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errInvalidImage = errors.New("file is not a valid image")
+
+// Удаляет из изображения метаданные: EXIF (в том числе координаты GPS), XMP, IPTC и текстовые комментарии.
+// Пиксели не перекодируются. У JPEG сохраняется только ориентация из EXIF, чтобы снимки не поворачивались.
+// GIF хранится как есть: координат в нём не бывает.
+func stripImageMetadata(contentType string, data []byte) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEGMetadata(data)
+	case "image/png":
+		return stripPNGMetadata(data)
+	case "image/webp":
+		return stripWebPMetadata(data)
+	}
+	return data, nil
+}
+
+// JPEG markers.
+const (
+	jpegSOS   = 0xDA
+	jpegEOI   = 0xD9
+	jpegAPP0  = 0xE0
+	jpegAPP2  = 0xE2
+	jpegAPP14 = 0xEE
+	jpegAPP15 = 0xEF
+	jpegCOM   = 0xFE
+)
+
+// Keeps the frame, tables and scans, plus JFIF (APP0), ICC profiles (APP2) and the Adobe color
+// transform (APP14). Everything after the end of the first image is dropped, which also removes
+// the extra pictures and their EXIF that some cameras append.
+func stripJPEGMetadata(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errInvalidImage
+	}
+	orientation := jpegOrientation(data)
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+	inserted := orientation == 1
+
+	pos := 2
+	for {
+		if pos+2 > len(data) || data[pos] != 0xFF {
+			return nil, errInvalidImage
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xFF:
+			pos++
+			continue
+		case marker == jpegEOI:
+			return append(out, 0xFF, jpegEOI), nil
+		case marker == 0x01 || marker >= 0xD0 && marker <= 0xD7:
+			out = append(out, 0xFF, marker)
+			pos += 2
+			continue
+		}
+		if pos+4 > len(data) {
+			return nil, errInvalidImage
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end < pos+4 || end > len(data) {
+			return nil, errInvalidImage
+		}
+
+		// The orientation goes right after JFIF, which must stay the first segment.
+		if !inserted && marker != jpegAPP0 {
+			out = append(out, exifOrientationSegment(orientation)...)
+			inserted = true
+		}
+
+		keep := true
+		switch {
+		case marker == jpegAPP2:
+			keep = bytes.HasPrefix(data[pos+4:end], []byte("ICC_PROFILE\x00"))
+		case marker > jpegAPP0 && marker <= jpegAPP15:
+			keep = marker == jpegAPP14
+		case marker == jpegCOM:
+			keep = false
+		}
+		if keep {
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+
+		if marker == jpegSOS {
+			// Entropy-coded data runs until a marker other than a stuffed 0xFF00 or a restart marker.
+			start := pos
+			for pos+1 < len(data) && !(data[pos] == 0xFF && data[pos+1] != 0 && (data[pos+1] < 0xD0 || data[pos+1] > 0xD7)) {
+				pos++
+			}
+			if pos+1 >= len(data) {
+				return nil, errInvalidImage
+			}
+			out = append(out, data[start:pos]...)
+		}
+	}
+}
+
+// Возвращает ориентацию JPEG из EXIF (от 1 до 8). Если её нет, возвращается 1.
+func jpegOrientation(data []byte) int {
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == jpegSOS || marker == jpegEOI {
+			break
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) {
+			break
+		}
+		if marker == 0xE1 && bytes.HasPrefix(data[pos+4:end], []byte("Exif\x00\x00")) {
+			if orientation := tiffOrientation(data[pos+10 : end]); orientation != 1 {
+				return orientation
+			}
+		}
+		pos = end
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if value := int(order.Uint16(tiff[entry+8:])); value >= 1 && value <= 8 {
+				return value
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// Builds an APP1 segment with an EXIF block holding only the orientation tag.
+func exifOrientationSegment(orientation int) []byte {
+	tiff := []byte{
+		'M', 'M', 0, 42, 0, 0, 0, 8,
+		0, 1,
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, byte(orientation), 0, 0,
+		0, 0, 0, 0,
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	length := len(payload) + 2
+	return append([]byte{0xFF, 0xE1, byte(length >> 8), byte(length)}, payload...)
+}
+
+// Drops the EXIF, text and timestamp chunks; image data and color chunks stay as they are.
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	if len(data) < 8 || string(data[:8]) != "\x89PNG\r\n\x1a\n" {
+		return nil, errInvalidImage
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:8]...)
+	pos := 8
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		chunkType := string(data[pos+4 : pos+8])
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, errInvalidImage
+		}
+		switch chunkType {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+		if chunkType == "IEND" {
+			return out, nil
+		}
+	}
+	return nil, errInvalidImage
+}
+
+// VP8X feature flags for metadata chunks.
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+// Drops the EXIF and XMP chunks and clears their flags in the extended header.
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errInvalidImage
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+	pos := 12
+	for pos+8 <= len(data) {
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size
+		if size < 0 || end > len(data) {
+			return nil, errInvalidImage
+		}
+		// Chunks are padded to an even size; some encoders omit the padding of the last one.
+		if size%2 == 1 && end < len(data) {
+			end++
+		}
+		switch string(data[pos : pos+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte{}, data[pos:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
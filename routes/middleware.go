@@ -1,13 +1,18 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
 )
 
 func JWTMiddleware() gin.HandlerFunc {
@@ -26,45 +31,124 @@ func JWTMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		signingKey := os.Getenv("JWT_SECRET")
-    if signingKey == "" {
-      signingKey = "default_secret"
-    }
+		parsedUUID, err := userIDFromToken(tokenString)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		c.Set("userId", parsedUUID)
+		c.Next()
+	}
+}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.NewValidationError("unexpected signing method", jwt.ValidationErrorSignatureInvalid)
+// Устанавливает userId, если передан валидный токен, но не требует авторизации.
+func OptionalJWTMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		if authHeader != "" && tokenString != authHeader {
+			if parsedUUID, err := userIDFromToken(tokenString); err == nil {
+				c.Set("userId", parsedUUID)
 			}
-			return []byte(signingKey), nil
-		})
+		}
+		c.Next()
+	}
+}
 
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
+// Проверяет JWT и возвращает ID пользователя из его claims.
+func userIDFromToken(tokenString string) (uuid.UUID, error) {
+	signingKey := os.Getenv("JWT_SECRET")
+	if signingKey == "" {
+		signingKey = "default_secret"
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.NewValidationError("unexpected signing method", jwt.ValidationErrorSignatureInvalid)
+		}
+		return []byte(signingKey), nil
+	})
+
+	if err != nil || !token.Valid {
+		return uuid.Nil, errors.New("Invalid or expired token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return uuid.Nil, errors.New("Invalid token claims")
+	}
+
+	userID, ok := claims["userId"].(string)
+	if !ok {
+		return uuid.Nil, errors.New("Invalid user ID in token")
+	}
+	parsedUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return uuid.Nil, errors.New("Invalid user ID")
+	}
+
+	return parsedUUID, nil
+}
+
+// Возвращает ID текущего пользователя, если он авторизован.
+func optionalUserID(c *gin.Context) *uuid.UUID {
+	userID, exists := c.Get("userId")
+	if !exists {
+		return nil
+	}
+	viewerID, ok := userID.(uuid.UUID)
+	if !ok {
+		return nil
+	}
+	return &viewerID
+}
+
+// Запрещает заблокированным и удалённым пользователям любые изменяющие запросы.
+func SuspensionMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-			c.Abort()
+		authHeader := c.GetHeader("Authorization")
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		if authHeader == "" || tokenString == authHeader {
+			c.Next()
+			return
+		}
+
+		userID, err := userIDFromToken(tokenString)
+		if err != nil {
+			c.Next()
 			return
 		}
 
-		userID, ok := claims["userId"].(string)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID in token"})
+		var user models.User
+		err = db.Select("id", "suspended", "suspended_until", "suspension_reason").First(&user, "id = ?", userID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "This account has been deleted"})
 			c.Abort()
 			return
 		}
-		parsedUUID, err := uuid.Parse(userID)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		if err == nil && user.IsSuspended(time.Now()) {
+			c.JSON(http.StatusForbidden, suspensionError(user))
 			c.Abort()
 			return
 		}
 
-		c.Set("userId", parsedUUID)
 		c.Next()
 	}
 }
+
+// Формирует ответ с причиной и сроком блокировки аккаунта.
+func suspensionError(user models.User) gin.H {
+	return gin.H{
+		"error":          "Account suspended",
+		"reason":         user.SuspensionReason,
+		"suspendedUntil": user.SuspendedUntil,
+	}
+}
@@ -1,7 +1,10 @@
 package routes
 
 import (
+	"encoding/json"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -16,16 +19,16 @@ import (
 // @Security BearerAuth
 // @Accept json
 // @Produce json
-// @Param groupId path string true "ID группы"
+// @Param id path string true "ID группы"
 // @Param data body routes.AddModDTO true "Данные модератора"
 // @Success 204 {string} string ""
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
 // @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
-// @Router /groups/{groupId}/moderators [post]
+// @Router /groups/{id}/moderators [post]
 func addModeratorHandler(c *gin.Context, db *gorm.DB) {
-	groupID := c.Param("groupId")
+	groupID := c.Param("id")
 	var req AddModDTO
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
@@ -63,11 +66,31 @@ func addModeratorHandler(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	if err := db.Model(&group).Association("Moderators").Append(&models.User{ID: req.UserID}); err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&group).Association("Moderators").Append(&models.User{ID: req.UserID}); err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: authorID,
+			Action:      models.ModActionAddModerator,
+			TargetType:  "user",
+			TargetID:    &req.UserID,
+		}, nil, nil)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add moderator"})
 		return
 	}
 
+	notify(db, models.Notification{
+		UserID:  req.UserID,
+		Type:    models.NotificationModeratorAdded,
+		ActorID: &authorID,
+		GroupID: &group.ID,
+		Message: "You were added as a moderator of " + group.GroupName,
+	})
+
 	c.Status(http.StatusNoContent)
 }
 
@@ -75,16 +98,16 @@ func addModeratorHandler(c *gin.Context, db *gorm.DB) {
 // @Description Удаляет пользователя из списка модераторов группы
 // @Tags moderation
 // @Security BearerAuth
-// @Param groupId path string true "ID группы"
+// @Param id path string true "ID группы"
 // @Param userId path string true "ID пользователя"
 // @Success 204 {string} string ""
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
 // @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
-// @Router /groups/{groupId}/moderators/{userId} [delete]
+// @Router /groups/{id}/moderators/{userId} [delete]
 func removeModeratorHandler(c *gin.Context, db *gorm.DB) {
-	groupID := c.Param("groupId")
+	groupID := c.Param("id")
 	userIDParam := c.Param("userId")
 
 	userID, exists := c.Get("userId")
@@ -124,7 +147,19 @@ func removeModeratorHandler(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	if err := db.Model(&group).Association("Moderators").Delete(&models.User{ID: targetUserID}); err != nil {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&group).Association("Moderators").Delete(&models.User{ID: targetUserID}); err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: authorID,
+			Action:      models.ModActionRemoveModerator,
+			TargetType:  "user",
+			TargetID:    &targetUserID,
+		}, nil, nil)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove moderator"})
 		return
 	}
@@ -132,12 +167,894 @@ func removeModeratorHandler(c *gin.Context, db *gorm.DB) {
 	c.Status(http.StatusNoContent)
 }
 
+// @Summary Удалить пост модератором
+// @Description Скрывает пост группы из лент, запрещает его изображения в группе и записывает действие в журнал модерации
+// @Tags moderation
+// @Security BearerAuth
+// @Accept json
+// @Param id path string true "ID поста"
+// @Param data body routes.ModerateContentDTO false "Причина"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /posts/{id}/remove [post]
+func removePostHandler(c *gin.Context, db *gorm.DB) {
+	moderatePostHandler(c, db, models.ContentRemoved, models.ModActionRemovePost)
+}
+
+// @Summary Одобрить пост модератором
+// @Description Восстанавливает пост группы в лентах, снимает запрет с его изображений и записывает действие в журнал модерации
+// @Tags moderation
+// @Security BearerAuth
+// @Accept json
+// @Param id path string true "ID поста"
+// @Param data body routes.ModerateContentDTO false "Причина"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /posts/{id}/approve [post]
+func approvePostHandler(c *gin.Context, db *gorm.DB) {
+	moderatePostHandler(c, db, models.ContentApproved, models.ModActionApprovePost)
+}
+
+func moderatePostHandler(c *gin.Context, db *gorm.DB, status, action string) {
+	postID := c.Param("id")
+	var req ModerateContentDTO
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+			return
+		}
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	moderatorID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var post models.Post
+	if err := db.First(&post, "id = ?", postID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	if post.GroupID == nil || !isGroupModerator(db, *post.GroupID, moderatorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to moderate this post"})
+		return
+	}
+
+	reason := req.Reason
+	if req.RuleID != nil {
+		rule, err := citedRule(db, post.GroupID, *req.RuleID, "post")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The cited rule does not exist in this group or does not apply to posts"})
+			return
+		}
+		if reason == "" {
+			reason = rule.Title
+		}
+	}
+
+	before := gin.H{"modStatus": post.ModStatus}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&post).Update("mod_status", status).Error; err != nil {
+			return err
+		}
+		if err := resolveReports(tx, "post_id = ? AND comment_id IS NULL", post.ID); err != nil {
+			return err
+		}
+		// Images of a removed post are banned in the group, so reposts of them are caught.
+		// Approving the post again lifts these bans.
+		switch {
+		case status == models.ContentRemoved && before["modStatus"] != models.ContentRemoved:
+			if _, err := banPostImages(tx, post.GroupID, post.ID, moderatorID, reason); err != nil {
+				return err
+			}
+		case status == models.ContentApproved:
+			if err := tx.Where("group_id = ? AND post_id = ?", *post.GroupID, post.ID).Delete(&models.BannedImage{}).Error; err != nil {
+				return err
+			}
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     *post.GroupID,
+			ModeratorID: moderatorID,
+			Action:      action,
+			TargetType:  "post",
+			TargetID:    &post.ID,
+			RuleID:      req.RuleID,
+			Reason:      reason,
+		}, before, gin.H{"modStatus": status})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to moderate post"})
+		return
+	}
+	resetBannedImages(post.GroupID)
+
+	learnSpamDecision(db, post.ID, nil, postSpamText(post), status == models.ContentRemoved)
+	if before["modStatus"] != status {
+		notifyModeration(db, post.AuthorID, post.GroupID, &post.ID, nil, "post", status, reason)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Удалить комментарий модератором
+// @Description Скрывает комментарий в посте группы и записывает действие в журнал модерации
+// @Tags moderation
+// @Security BearerAuth
+// @Accept json
+// @Param id path string true "ID комментария"
+// @Param data body routes.ModerateContentDTO false "Причина"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /comments/{id}/remove [post]
+func removeCommentHandler(c *gin.Context, db *gorm.DB) {
+	moderateCommentHandler(c, db, models.ContentRemoved, models.ModActionRemoveComment)
+}
+
+// @Summary Одобрить комментарий модератором
+// @Description Восстанавливает комментарий в посте группы и записывает действие в журнал модерации
+// @Tags moderation
+// @Security BearerAuth
+// @Accept json
+// @Param id path string true "ID комментария"
+// @Param data body routes.ModerateContentDTO false "Причина"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /comments/{id}/approve [post]
+func approveCommentHandler(c *gin.Context, db *gorm.DB) {
+	moderateCommentHandler(c, db, models.ContentApproved, models.ModActionApproveComment)
+}
+
+func moderateCommentHandler(c *gin.Context, db *gorm.DB, status, action string) {
+	commentID := c.Param("id")
+	var req ModerateContentDTO
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+			return
+		}
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	moderatorID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var comment models.Comment
+	if err := db.First(&comment, "id = ?", commentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	var post models.Post
+	if err := db.First(&post, "id = ?", comment.PostID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	if post.GroupID == nil || !isGroupModerator(db, *post.GroupID, moderatorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to moderate this comment"})
+		return
+	}
+
+	reason := req.Reason
+	if req.RuleID != nil {
+		rule, err := citedRule(db, post.GroupID, *req.RuleID, "comment")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The cited rule does not exist in this group or does not apply to comments"})
+			return
+		}
+		if reason == "" {
+			reason = rule.Title
+		}
+	}
+
+	before := gin.H{"modStatus": comment.ModStatus}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&comment).Update("mod_status", status).Error; err != nil {
+			return err
+		}
+		if err := resolveReports(tx, "comment_id = ?", comment.ID); err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     *post.GroupID,
+			ModeratorID: moderatorID,
+			Action:      action,
+			TargetType:  "comment",
+			TargetID:    &comment.ID,
+			RuleID:      req.RuleID,
+			Reason:      reason,
+		}, before, gin.H{"modStatus": status})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to moderate comment"})
+		return
+	}
+
+	learnSpamDecision(db, post.ID, &comment.ID, comment.Content, status == models.ContentRemoved)
+	if before["modStatus"] != status {
+		notifyModeration(db, comment.AuthorID, post.GroupID, &post.ID, &comment.ID, "comment", status, reason)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Забанить пользователя в группе
+// @Description Запрещает пользователю публиковать посты и комментарии в группе
+// @Tags moderation
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param data body routes.BanUserDTO true "Данные бана"
+// @Success 201 {object} routes.GroupBanDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/bans [post]
+func banUserHandler(c *gin.Context, db *gorm.DB) {
+	groupID := c.Param("id")
+	var req BanUserDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	moderatorID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var group models.Group
+	if err := db.First(&group, "id = ?", groupID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	if !isGroupModerator(db, group.ID, moderatorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to ban users in this group"})
+		return
+	}
+
+	if req.UserID == moderatorID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot ban yourself"})
+		return
+	}
+
+	var target models.User
+	if err := db.First(&target, "id = ?", req.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	ban := models.GroupBan{
+		GroupID:    group.ID,
+		UserID:     target.ID,
+		BannedByID: moderatorID,
+		Reason:     req.Reason,
+		CreatedAt:  time.Now(),
+	}
+	if req.DurationHours != nil {
+		expiresAt := ban.CreatedAt.Add(time.Duration(*req.DurationHours) * time.Hour)
+		ban.ExpiresAt = &expiresAt
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// A repeated ban replaces the previous one, e.g. to extend it.
+		if err := tx.Where("group_id = ? AND user_id = ?", group.ID, target.ID).Delete(&models.GroupBan{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&ban).Error; err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionBanUser,
+			TargetType:  "user",
+			TargetID:    &target.ID,
+			Reason:      req.Reason,
+		}, nil, gin.H{"expiresAt": ban.ExpiresAt})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to ban user"})
+		return
+	}
+
+	message := "You were banned from " + group.GroupName
+	if req.Reason != "" {
+		message += ": " + req.Reason
+	}
+	notify(db, models.Notification{
+		UserID:  target.ID,
+		Type:    models.NotificationModAction,
+		GroupID: &group.ID,
+		Message: message,
+	})
+
+	c.JSON(http.StatusCreated, GroupBanDTO{
+		UserID:     target.ID,
+		Nickname:   target.Nickname,
+		BannedByID: ban.BannedByID,
+		Reason:     ban.Reason,
+		ExpiresAt:  ban.ExpiresAt,
+		CreatedAt:  ban.CreatedAt,
+	})
+}
+
+// @Summary Разбанить пользователя в группе
+// @Description Снимает бан с пользователя в группе
+// @Tags moderation
+// @Security BearerAuth
+// @Param id path string true "ID группы"
+// @Param userId path string true "ID пользователя"
+// @Success 204 {string} string ""
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/bans/{userId} [delete]
+func unbanUserHandler(c *gin.Context, db *gorm.DB) {
+	groupID := c.Param("id")
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	moderatorID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	targetUserID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var group models.Group
+	if err := db.First(&group, "id = ?", groupID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	if !isGroupModerator(db, group.ID, moderatorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to unban users in this group"})
+		return
+	}
+
+	var ban models.GroupBan
+	if err := db.First(&ban, "group_id = ? AND user_id = ?", group.ID, targetUserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ban not found"})
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&ban).Error; err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionUnbanUser,
+			TargetType:  "user",
+			TargetID:    &targetUserID,
+		}, gin.H{"expiresAt": ban.ExpiresAt, "reason": ban.Reason}, nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unban user"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Получить список банов группы
+// @Description Возвращает действующие баны группы, доступно модераторам
+// @Tags moderation
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID группы"
+// @Success 200 {array} routes.GroupBanDTO
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/bans [get]
+func listGroupBansHandler(c *gin.Context, db *gorm.DB) {
+	groupID := c.Param("id")
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	moderatorID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var group models.Group
+	if err := db.First(&group, "id = ?", groupID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	if !isGroupModerator(db, group.ID, moderatorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to view bans of this group"})
+		return
+	}
+
+	var bans []models.GroupBan
+	if err := db.Preload("User").
+		Where("group_id = ? AND (expires_at IS NULL OR expires_at > ?)", group.ID, time.Now()).
+		Order("created_at DESC").Find(&bans).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bans"})
+		return
+	}
+
+	banDTOs := make([]GroupBanDTO, len(bans))
+	for i, ban := range bans {
+		banDTOs[i] = GroupBanDTO{
+			UserID:     ban.UserID,
+			Nickname:   ban.User.Nickname,
+			BannedByID: ban.BannedByID,
+			Reason:     ban.Reason,
+			ExpiresAt:  ban.ExpiresAt,
+			CreatedAt:  ban.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, banDTOs)
+}
+
+// @Summary Получить журнал модерации группы
+// @Description Возвращает действия модераторов группы. Доступно модераторам, либо всем, если журнал публичный
+// @Tags moderation
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param moderatorId query string false "ID модератора"
+// @Param action query string false "Тип действия"
+// @Param from query string false "Начало периода (RFC3339)"
+// @Param to query string false "Конец периода (RFC3339)"
+// @Param page query int false "Страница"
+// @Param limit query int false "Лимит"
+// @Success 200 {object} routes.PaginatedModActionsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/modlog [get]
+func getModLogHandler(c *gin.Context, db *gorm.DB) {
+	groupID := c.Param("id")
+
+	var group models.Group
+	if err := db.First(&group, "id = ?", groupID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	if !group.PublicModLog {
+		viewerID := optionalUserID(c)
+		if viewerID == nil || !isGroupModerator(db, group.ID, *viewerID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "The moderation log of this group is private"})
+			return
+		}
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 25
+	}
+
+	query := db.Model(&models.ModAction{}).Where("group_id = ?", group.ID)
+	if moderatorID := c.Query("moderatorId"); moderatorID != "" {
+		parsedID, err := uuid.Parse(moderatorID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid moderator ID"})
+			return
+		}
+		query = query.Where("moderator_id = ?", parsedID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if from := c.Query("from"); from != "" {
+		fromTime, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+			return
+		}
+		query = query.Where("created_at >= ?", fromTime)
+	}
+	if to := c.Query("to"); to != "" {
+		toTime, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+			return
+		}
+		query = query.Where("created_at <= ?", toTime)
+	}
+
+	query = query.Session(&gorm.Session{})
+	var totalCount int64
+	var actions []models.ModAction
+	if err := query.Count(&totalCount).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve moderation log"})
+		return
+	}
+	if err := query.Preload("Moderator").Order("created_at DESC").
+		Offset((page - 1) * limit).Limit(limit).Find(&actions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve moderation log"})
+		return
+	}
+
+	actionDTOs := make([]ModActionDTO, len(actions))
+	for i, action := range actions {
+		actionDTOs[i] = ModActionDTO{
+			ID:                action.ID,
+			GroupID:           action.GroupID,
+			ModeratorID:       action.ModeratorID,
+			ModeratorNickname: action.Moderator.Nickname,
+			Action:            action.Action,
+			TargetType:        action.TargetType,
+			TargetID:          action.TargetID,
+			RuleID:            action.RuleID,
+			Reason:            action.Reason,
+			Before:            rawJSON(action.Before),
+			After:             rawJSON(action.After),
+			CreatedAt:         action.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, PaginatedModActionsResponse{
+		Actions:    actionDTOs,
+		Page:       page,
+		Limit:      limit,
+		TotalCount: totalCount,
+	})
+}
+
+// @Summary Пожаловаться на пост
+// @Description Отправляет жалобу на пост модераторам группы
+// @Tags moderation
+// @Security BearerAuth
+// @Accept json
+// @Param id path string true "ID поста"
+// @Param data body routes.ReportContentDTO true "Причина жалобы"
+// @Success 204 {string} string ""
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /posts/{id}/report [post]
+func reportPostHandler(c *gin.Context, db *gorm.DB) {
+	postID := c.Param("id")
+	var req ReportContentDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	reporterID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var post models.Post
+	if err := db.First(&post, "id = ?", postID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	reason := req.Reason
+	if req.RuleID != nil {
+		rule, err := citedRule(db, post.GroupID, *req.RuleID, "post")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The cited rule does not exist in this group or does not apply to posts"})
+			return
+		}
+		if reason == "" {
+			reason = rule.Title
+		}
+	}
+
+	report := models.Report{
+		GroupID:    post.GroupID,
+		PostID:     &post.ID,
+		ReporterID: &reporterID,
+		RuleID:     req.RuleID,
+		Reason:     reason,
+		CreatedAt:  time.Now(),
+	}
+	if err := db.Create(&report).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to report post"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Пожаловаться на комментарий
+// @Description Отправляет жалобу на комментарий модераторам группы
+// @Tags moderation
+// @Security BearerAuth
+// @Accept json
+// @Param id path string true "ID комментария"
+// @Param data body routes.ReportContentDTO true "Причина жалобы"
+// @Success 204 {string} string ""
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /comments/{id}/report [post]
+func reportCommentHandler(c *gin.Context, db *gorm.DB) {
+	commentID := c.Param("id")
+	var req ReportContentDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	reporterID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var comment models.Comment
+	if err := db.First(&comment, "id = ?", commentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	var post models.Post
+	if err := db.First(&post, "id = ?", comment.PostID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	reason := req.Reason
+	if req.RuleID != nil {
+		rule, err := citedRule(db, post.GroupID, *req.RuleID, "comment")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The cited rule does not exist in this group or does not apply to comments"})
+			return
+		}
+		if reason == "" {
+			reason = rule.Title
+		}
+	}
+
+	report := models.Report{
+		GroupID:    post.GroupID,
+		PostID:     &post.ID,
+		CommentID:  &comment.ID,
+		ReporterID: &reporterID,
+		RuleID:     req.RuleID,
+		Reason:     reason,
+		CreatedAt:  time.Now(),
+	}
+	if err := db.Create(&report).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to report comment"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Получить очередь модерации группы
+// @Description Возвращает отфильтрованный автомодератором контент и контент с необработанными жалобами
+// @Tags moderation
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID группы"
+// @Success 200 {array} routes.ModQueueItemDTO
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/modqueue [get]
+func getModQueueHandler(c *gin.Context, db *gorm.DB) {
+	groupID := c.Param("id")
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	moderatorID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var group models.Group
+	if err := db.First(&group, "id = ?", groupID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	if !isGroupModerator(db, group.ID, moderatorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to view the moderation queue of this group"})
+		return
+	}
+
+	var reports []models.Report
+	if err := db.Where("group_id = ? AND resolved_at IS NULL", group.ID).Order("created_at ASC").Find(&reports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve moderation queue"})
+		return
+	}
+
+	reportedPosts := map[uuid.UUID][]ReportDTO{}
+	reportedComments := map[uuid.UUID][]ReportDTO{}
+	for _, report := range reports {
+		dto := ReportDTO{ID: report.ID, ReporterID: report.ReporterID, RuleID: report.RuleID, Reason: report.Reason, CreatedAt: report.CreatedAt}
+		if report.CommentID != nil {
+			reportedComments[*report.CommentID] = append(reportedComments[*report.CommentID], dto)
+		} else if report.PostID != nil {
+			reportedPosts[*report.PostID] = append(reportedPosts[*report.PostID], dto)
+		}
+	}
+
+	var posts []models.Post
+	if err := db.Where("group_id = ? AND (mod_status = ? OR id IN ?)", group.ID, models.ContentFiltered, mapKeys(reportedPosts)).
+		Order("created_at ASC").Find(&posts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve moderation queue"})
+		return
+	}
+
+	var comments []models.Comment
+	if err := db.Joins("JOIN posts ON posts.id = comments.post_id").
+		Where("posts.group_id = ? AND (comments.mod_status = ? OR comments.id IN ?)", group.ID, models.ContentFiltered, mapKeys(reportedComments)).
+		Order("comments.created_at ASC").Find(&comments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve moderation queue"})
+		return
+	}
+
+	items := make([]ModQueueItemDTO, 0, len(posts)+len(comments))
+	for _, post := range posts {
+		items = append(items, ModQueueItemDTO{
+			Type:      "post",
+			ID:        post.ID,
+			PostID:    post.ID,
+			AuthorID:  post.AuthorID,
+			Content:   post.Content,
+			ModStatus: post.ModStatus,
+			CreatedAt: post.CreatedAt,
+			Reports:   reportedPosts[post.ID],
+		})
+	}
+	for _, comment := range comments {
+		items = append(items, ModQueueItemDTO{
+			Type:      "comment",
+			ID:        comment.ID,
+			PostID:    comment.PostID,
+			AuthorID:  comment.AuthorID,
+			Content:   comment.Content,
+			ModStatus: comment.ModStatus,
+			CreatedAt: comment.CreatedAt,
+			Reports:   reportedComments[comment.ID],
+		})
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+func mapKeys(m map[uuid.UUID][]ReportDTO) []uuid.UUID {
+	// An empty IN list is invalid SQL, so a nil UUID stands in for "no reports".
+	keys := []uuid.UUID{uuid.Nil}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Отмечает жалобы на контент как обработанные.
+func resolveReports(tx *gorm.DB, query string, args ...interface{}) error {
+	return tx.Model(&models.Report{}).Where("resolved_at IS NULL").Where(query, args...).
+		Update("resolved_at", time.Now()).Error
+}
+
+// Проверяет, является ли пользователь модератором группы.
+func isGroupModerator(db *gorm.DB, groupID, userID uuid.UUID) bool {
+	var count int64
+	db.Model(&models.GroupModerator{}).Where("group_id = ? AND user_id = ?", groupID, userID).Count(&count)
+	return count > 0
+}
+
+// Проверяет, действует ли для пользователя бан в группе.
+func isBannedFromGroup(db *gorm.DB, groupID, userID uuid.UUID) bool {
+	var count int64
+	db.Model(&models.GroupBan{}).
+		Where("group_id = ? AND user_id = ? AND (expires_at IS NULL OR expires_at > ?)", groupID, userID, time.Now()).
+		Count(&count)
+	return count > 0
+}
+
+// Добавляет запись в журнал модерации. Состояния до и после сохраняются как JSON.
+func recordModAction(tx *gorm.DB, action models.ModAction, before, after interface{}) error {
+	if before != nil {
+		data, err := json.Marshal(before)
+		if err != nil {
+			return err
+		}
+		action.Before = string(data)
+	}
+	if after != nil {
+		data, err := json.Marshal(after)
+		if err != nil {
+			return err
+		}
+		action.After = string(data)
+	}
+	action.CreatedAt = time.Now()
+	return tx.Create(&action).Error
+}
+
+func rawJSON(data string) json.RawMessage {
+	if data == "" {
+		return nil
+	}
+	return json.RawMessage(data)
+}
+
 func RegisterModerationRoutes(r *gin.RouterGroup, db *gorm.DB) {
-	r.POST("/groups/:groupId/moderators", JWTMiddleware(), func(c *gin.Context) {
+	r.POST("/:id/moderators", JWTMiddleware(), func(c *gin.Context) {
 		addModeratorHandler(c, db)
 	})
 
-	r.DELETE("/groups/:groupId/moderators/:userId", JWTMiddleware(), func(c *gin.Context) {
+	r.DELETE("/:id/moderators/:userId", JWTMiddleware(), func(c *gin.Context) {
 		removeModeratorHandler(c, db)
 	})
 }
\ No newline at end of file
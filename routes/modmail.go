@@ -0,0 +1,503 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+// @Summary Написать модераторам группы
+// @Description Создаёт обращение к команде модераторов группы. Модератор может начать переписку с пользователем, указав userId
+// @Tags modmail
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param data body routes.CreateModmailRequest true "Обращение"
+// @Success 201 {object} routes.ModmailThreadDetailDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/modmail [post]
+func createModmailThreadHandler(c *gin.Context, db *gorm.DB) {
+	var req CreateModmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	authorID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var group models.Group
+	if err := db.First(&group, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	isModerator := isGroupModerator(db, group.ID, authorID)
+	now := time.Now()
+	thread := models.ModmailThread{
+		GroupID:       group.ID,
+		UserID:        authorID,
+		Subject:       req.Subject,
+		ModUnread:     true,
+		LastMessageAt: now,
+		CreatedAt:     now,
+	}
+
+	if req.UserID != nil {
+		if !isModerator {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only moderators can start a conversation with a user"})
+			return
+		}
+		var recipient models.User
+		if err := db.First(&recipient, "id = ?", *req.UserID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		thread.UserID = recipient.ID
+		thread.ModUnread = false
+		thread.UserUnread = true
+	}
+
+	message := models.ModmailMessage{
+		AuthorID:      authorID,
+		Body:          req.Body,
+		FromModerator: req.UserID != nil,
+		CreatedAt:     now,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&thread).Error; err != nil {
+			return err
+		}
+		message.ThreadID = thread.ID
+		return tx.Create(&message).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create conversation"})
+		return
+	}
+
+	resp, err := modmailThreadDetail(db, thread, isModerator)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve conversation"})
+		return
+	}
+
+	if thread.UserUnread {
+		publishEvent(userTopic(thread.UserID), "modmail.thread", resp.ModmailThreadDTO)
+		notifyModmail(db, thread)
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// @Summary Получить обращения к модераторам группы
+// @Description Возвращает переписки группы для модераторов. Фильтр state: inbox (по умолчанию), unread, highlighted, archived, all
+// @Tags modmail
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param state query string false "Фильтр (inbox|unread|highlighted|archived|all)"
+// @Param page query int false "Страница"
+// @Param limit query int false "Лимит"
+// @Success 200 {object} routes.PaginatedModmailThreadsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/modmail [get]
+func listGroupModmailHandler(c *gin.Context, db *gorm.DB) {
+	group, _, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	query := db.Model(&models.ModmailThread{}).Where("group_id = ?", group.ID)
+	switch c.DefaultQuery("state", "inbox") {
+	case "inbox":
+		query = query.Where("archived = ?", false)
+	case "unread":
+		query = query.Where("archived = ? AND mod_unread = ?", false, true)
+	case "highlighted":
+		query = query.Where("highlighted = ?", true)
+	case "archived":
+		query = query.Where("archived = ?", true)
+	case "all":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state filter"})
+		return
+	}
+
+	listModmailThreads(c, query, true)
+}
+
+// @Summary Получить переписку с модераторами
+// @Description Возвращает переписку с сообщениями. Внутренние заметки видны только модераторам. Просмотр отмечает переписку прочитанной
+// @Tags modmail
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param threadId path string true "ID переписки"
+// @Success 200 {object} routes.ModmailThreadDetailDTO
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/modmail/{threadId} [get]
+func getModmailThreadHandler(c *gin.Context, db *gorm.DB) {
+	thread, isModerator, ok := loadModmailThread(c, db)
+	if !ok {
+		return
+	}
+
+	// The moderation team reads as a collective: any moderator opening the thread marks it read for all.
+	column := "user_unread"
+	if isModerator {
+		column = "mod_unread"
+	}
+	if err := db.Model(&thread).Update(column, false).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update conversation"})
+		return
+	}
+
+	resp, err := modmailThreadDetail(db, thread, isModerator)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve conversation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Ответить в переписке с модераторами
+// @Description Добавляет сообщение в переписку. Модераторы могут оставлять внутренние заметки, которые не видит пользователь
+// @Tags modmail
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param threadId path string true "ID переписки"
+// @Param data body routes.ModmailReplyRequest true "Сообщение"
+// @Success 201 {object} routes.ModmailMessageDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/modmail/{threadId}/messages [post]
+func replyModmailHandler(c *gin.Context, db *gorm.DB) {
+	var req ModmailReplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	thread, isModerator, ok := loadModmailThread(c, db)
+	if !ok {
+		return
+	}
+
+	if req.Internal && !isModerator {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only moderators can add internal notes"})
+		return
+	}
+
+	authorID := c.MustGet("userId").(uuid.UUID)
+	now := time.Now()
+	message := models.ModmailMessage{
+		ThreadID:      thread.ID,
+		AuthorID:      authorID,
+		Body:          req.Body,
+		FromModerator: isModerator && authorID != thread.UserID,
+		Internal:      req.Internal,
+		CreatedAt:     now,
+	}
+
+	updates := map[string]interface{}{}
+	if !message.Internal {
+		updates["last_message_at"] = now
+		if message.FromModerator {
+			updates["user_unread"] = true
+		} else {
+			// A new message from the user brings an archived thread back to the inbox.
+			updates["mod_unread"] = true
+			updates["archived"] = false
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&message).Error; err != nil {
+			return err
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Model(&thread).Updates(updates).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
+		return
+	}
+
+	db.Preload("Author").First(&message, "id = ?", message.ID)
+	if message.FromModerator && !message.Internal {
+		publishEvent(userTopic(thread.UserID), "modmail.message", toModmailMessageDTO(message))
+		notifyModmail(db, thread)
+	}
+
+	c.JSON(http.StatusCreated, toModmailMessageDTO(message))
+}
+
+// @Summary Изменить состояние переписки с модераторами
+// @Description Архивирует или выделяет переписку. Доступно модераторам группы
+// @Tags modmail
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param threadId path string true "ID переписки"
+// @Param data body routes.UpdateModmailStateRequest true "Состояние"
+// @Success 200 {object} routes.ModmailThreadDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/modmail/{threadId}/state [put]
+func updateModmailStateHandler(c *gin.Context, db *gorm.DB) {
+	var req UpdateModmailStateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	thread, isModerator, ok := loadModmailThread(c, db)
+	if !ok {
+		return
+	}
+
+	if !isModerator {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a moderator of this group"})
+		return
+	}
+
+	if req.Archived != nil {
+		thread.Archived = *req.Archived
+	}
+	if req.Highlighted != nil {
+		thread.Highlighted = *req.Highlighted
+	}
+
+	if err := db.Model(&thread).Updates(map[string]interface{}{
+		"archived":    thread.Archived,
+		"highlighted": thread.Highlighted,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update conversation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toModmailThreadDTO(thread, true))
+}
+
+// @Summary Получить свои обращения к модераторам
+// @Description Возвращает переписки текущего пользователя с модераторами всех групп
+// @Tags modmail
+// @Security BearerAuth
+// @Produce json
+// @Param page query int false "Страница"
+// @Param limit query int false "Лимит"
+// @Success 200 {object} routes.PaginatedModmailThreadsResponse
+// @Failure 401 {object} map[string]string
+// @Router /modmail [get]
+func listOwnModmailHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	listModmailThreads(c, db.Model(&models.ModmailThread{}).Where("user_id = ?", userID), false)
+}
+
+// @Summary Получить число непрочитанных обращений
+// @Description Возвращает число переписок с новыми ответами модераторов и число непрочитанных обращений в группах, которые модерирует пользователь
+// @Tags modmail
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} routes.ModmailUnreadDTO
+// @Failure 401 {object} map[string]string
+// @Router /modmail/unread [get]
+func getModmailUnreadHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	var resp ModmailUnreadDTO
+	db.Model(&models.ModmailThread{}).Where("user_id = ? AND user_unread = ?", userID, true).Count(&resp.UserThreads)
+	db.Model(&models.ModmailThread{}).
+		Where("mod_unread = ? AND archived = ?", true, false).
+		Where("group_id IN (?)", db.Model(&models.GroupModerator{}).Select("group_id").Where("user_id = ?", userID)).
+		Count(&resp.ModeratorThreads)
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Загружает переписку и проверяет, что текущий пользователь её участник или модератор группы. При ошибке ответ уже отправлен.
+func loadModmailThread(c *gin.Context, db *gorm.DB) (models.ModmailThread, bool, bool) {
+	var thread models.ModmailThread
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return thread, false, false
+	}
+
+	viewerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return thread, false, false
+	}
+
+	if err := db.Preload("User").First(&thread, "id = ? AND group_id = ?", c.Param("threadId"), c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return thread, false, false
+	}
+
+	isModerator := isGroupModerator(db, thread.GroupID, viewerID)
+	if !isModerator && thread.UserID != viewerID {
+		// Do not reveal that the thread exists.
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return thread, false, false
+	}
+
+	return thread, isModerator, true
+}
+
+// Сообщает пользователю о новом сообщении модераторов. Конкретный модератор не раскрывается.
+func notifyModmail(db *gorm.DB, thread models.ModmailThread) {
+	notify(db, models.Notification{
+		UserID:  thread.UserID,
+		Type:    models.NotificationModmail,
+		GroupID: &thread.GroupID,
+		Message: "New message from the moderators: " + thread.Subject,
+	})
+}
+
+func listModmailThreads(c *gin.Context, query *gorm.DB, asModerator bool) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 25
+	}
+
+	var totalCount int64
+	var threads []models.ModmailThread
+	query = query.Session(&gorm.Session{})
+	query.Count(&totalCount)
+	if err := query.Preload("User").Order("highlighted DESC, last_message_at DESC").
+		Offset((page - 1) * limit).Limit(limit).Find(&threads).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve conversations"})
+		return
+	}
+
+	threadDTOs := make([]ModmailThreadDTO, len(threads))
+	for i, thread := range threads {
+		threadDTOs[i] = toModmailThreadDTO(thread, asModerator)
+	}
+
+	c.JSON(http.StatusOK, PaginatedModmailThreadsResponse{
+		Threads:    threadDTOs,
+		Page:       page,
+		Limit:      limit,
+		TotalCount: totalCount,
+	})
+}
+
+func modmailThreadDetail(db *gorm.DB, thread models.ModmailThread, asModerator bool) (ModmailThreadDetailDTO, error) {
+	var messages []models.ModmailMessage
+	query := db.Preload("Author").Where("thread_id = ?", thread.ID)
+	if !asModerator {
+		query = query.Where("internal = ?", false)
+	}
+	if err := query.Order("created_at ASC").Find(&messages).Error; err != nil {
+		return ModmailThreadDetailDTO{}, err
+	}
+
+	if thread.User.ID == uuid.Nil {
+		db.First(&thread.User, "id = ?", thread.UserID)
+	}
+
+	messageDTOs := make([]ModmailMessageDTO, len(messages))
+	for i, message := range messages {
+		messageDTOs[i] = toModmailMessageDTO(message)
+	}
+
+	return ModmailThreadDetailDTO{
+		ModmailThreadDTO: toModmailThreadDTO(thread, asModerator),
+		Messages:         messageDTOs,
+	}, nil
+}
+
+// Преобразует переписку в DTO. Флаг непрочитанности берётся со стороны смотрящего.
+func toModmailThreadDTO(thread models.ModmailThread, asModerator bool) ModmailThreadDTO {
+	unread := thread.UserUnread
+	if asModerator {
+		unread = thread.ModUnread
+	}
+	return ModmailThreadDTO{
+		ID:            thread.ID,
+		GroupID:       thread.GroupID,
+		UserID:        thread.UserID,
+		UserNickname:  thread.User.Nickname,
+		Subject:       thread.Subject,
+		Archived:      thread.Archived,
+		Highlighted:   thread.Highlighted,
+		Unread:        unread,
+		LastMessageAt: thread.LastMessageAt,
+		CreatedAt:     thread.CreatedAt,
+	}
+}
+
+func toModmailMessageDTO(message models.ModmailMessage) ModmailMessageDTO {
+	return ModmailMessageDTO{
+		ID:             message.ID,
+		AuthorID:       message.AuthorID,
+		AuthorNickname: message.Author.Nickname,
+		Body:           message.Body,
+		FromModerator:  message.FromModerator,
+		Internal:       message.Internal,
+		CreatedAt:      message.CreatedAt,
+	}
+}
+
+func RegisterModmailRoutes(r *gin.RouterGroup, db *gorm.DB) {
+	r.Use(JWTMiddleware())
+
+	r.GET("/", func(c *gin.Context) {
+		listOwnModmailHandler(c, db)
+	})
+
+	r.GET("/unread", func(c *gin.Context) {
+		getModmailUnreadHandler(c, db)
+	})
+}
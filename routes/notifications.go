@@ -0,0 +1,416 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"chirp/models"
+)
+
+var notificationTypes = []string{
+	models.NotificationCommentReply,
+	models.NotificationReply,
+	models.NotificationMention,
+	models.NotificationModAction,
+	models.NotificationModeratorAdded,
+	models.NotificationVoteMilestone,
+	models.NotificationModmail,
+	models.NotificationPollClosed,
+}
+
+// Пороги рейтинга, о достижении которых сообщается автору.
+var voteMilestones = []int{10, 50, 100, 500, 1000, 5000, 10000}
+
+// Создаёт уведомление, если получатель его не отключил и ни он, ни автор действия не заблокировал другого.
+// Уведомления вспомогательные, поэтому ошибки только логируются.
+func notify(db *gorm.DB, notification models.Notification) {
+	if notification.ActorID != nil && *notification.ActorID == notification.UserID {
+		return
+	}
+
+	var preference models.NotificationPreference
+	if err := db.Where("user_id = ? AND type = ?", notification.UserID, notification.Type).Limit(1).Find(&preference).Error; err != nil {
+		log.Println("Failed to load notification preferences:", err)
+		return
+	}
+	if preference.UserID != uuid.Nil && !preference.Enabled {
+		return
+	}
+
+	if notification.ActorID != nil && isBlockedEitherWay(db, notification.UserID, *notification.ActorID) {
+		return
+	}
+
+	notification.CreatedAt = time.Now()
+	if err := db.Create(&notification).Error; err != nil {
+		log.Println("Failed to create notification:", err)
+		return
+	}
+
+	if notification.ActorID != nil {
+		notification.Actor = &models.User{}
+		db.First(notification.Actor, "id = ?", *notification.ActorID)
+	}
+	publishEvent(userTopic(notification.UserID), "notification.created", toNotificationDTO(notification))
+}
+
+// Уведомляет автора поста и автора комментария, на который ответили, о новом комментарии.
+func notifyNewComment(db *gorm.DB, post models.Post, comment models.Comment) {
+	var parentAuthorID *uuid.UUID
+	if comment.ReplyToID != nil {
+		var parent models.Comment
+		if err := db.First(&parent, "id = ? AND post_id = ?", *comment.ReplyToID, post.ID).Error; err == nil {
+			parentAuthorID = &parent.AuthorID
+			notify(db, models.Notification{
+				UserID:    parent.AuthorID,
+				Type:      models.NotificationReply,
+				ActorID:   &comment.AuthorID,
+				GroupID:   post.GroupID,
+				PostID:    &post.ID,
+				CommentID: &comment.ID,
+				Message:   "replied to your comment",
+			})
+		}
+	}
+
+	if parentAuthorID == nil || *parentAuthorID != post.AuthorID {
+		notify(db, models.Notification{
+			UserID:    post.AuthorID,
+			Type:      models.NotificationCommentReply,
+			ActorID:   &comment.AuthorID,
+			GroupID:   post.GroupID,
+			PostID:    &post.ID,
+			CommentID: &comment.ID,
+			Message:   "commented on your post",
+		})
+	}
+}
+
+// Сообщает автору о решении модераторов по его посту или комментарию. Модератор не раскрывается.
+func notifyModeration(db *gorm.DB, authorID uuid.UUID, groupID, postID, commentID *uuid.UUID, kind, status, reason string) {
+	verb := "approved"
+	if status == models.ContentRemoved {
+		verb = "removed"
+	}
+	message := fmt.Sprintf("Your %s was %s by the moderators", kind, verb)
+	if reason != "" {
+		message += ": " + reason
+	}
+	notify(db, models.Notification{
+		UserID:    authorID,
+		Type:      models.NotificationModAction,
+		GroupID:   groupID,
+		PostID:    postID,
+		CommentID: commentID,
+		Message:   message,
+	})
+}
+
+// Скрывает уведомления о действиях пользователей, которых получатель заблокировал после их создания.
+// Уведомления без автора действия сравниваются с самим получателем и поэтому не скрываются.
+func hideBlockedActors(db *gorm.DB, viewerID uuid.UUID) *gorm.DB {
+	return hideBlocked(db, "COALESCE(notifications.actor_id, notifications.user_id)", &viewerID)
+}
+
+// Возвращает наибольший порог рейтинга, пройденный при изменении с before до after, или 0.
+func crossedVoteMilestone(before, after int) int {
+	crossed := 0
+	for _, milestone := range voteMilestones {
+		if before < milestone && after >= milestone {
+			crossed = milestone
+		}
+	}
+	return crossed
+}
+
+// Отмечает порог рейтинга поста или комментария как достигнутый. Возвращает true, если порог
+// достигнут впервые и автору нужно сообщить о нём. Ошибки только логируются, как и в notify.
+func firstVoteMilestone(db *gorm.DB, postID uuid.UUID, commentID *uuid.UUID, milestone int) bool {
+	// Milestones of posts and of comments have separate partial unique indexes.
+	conflict := clause.OnConflict{
+		Columns:     []clause.Column{{Name: "post_id"}, {Name: "milestone"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "comment_id IS NULL"}}},
+		DoNothing:   true,
+	}
+	if commentID != nil {
+		conflict.Columns = []clause.Column{{Name: "comment_id"}, {Name: "milestone"}}
+		conflict.TargetWhere = clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "comment_id IS NOT NULL"}}}
+	}
+
+	result := db.Clauses(conflict).Create(&models.VoteMilestone{
+		PostID:    postID,
+		CommentID: commentID,
+		Milestone: milestone,
+		CreatedAt: time.Now(),
+	})
+	if result.Error != nil {
+		log.Println("Failed to record vote milestone:", result.Error)
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
+// @Summary Получить уведомления
+// @Description Возвращает уведомления текущего пользователя от новых к старым, кроме уведомлений о действиях заблокированных им пользователей
+// @Tags notifications
+// @Security BearerAuth
+// @Produce json
+// @Param unread query bool false "Только непрочитанные"
+// @Param type query string false "Тип уведомления"
+// @Param page query int false "Страница"
+// @Param limit query int false "Лимит"
+// @Success 200 {object} routes.PaginatedNotificationsResponse
+// @Failure 401 {object} map[string]string
+// @Router /notifications [get]
+func listNotificationsHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	viewerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 25
+	}
+
+	query := hideBlockedActors(db.Model(&models.Notification{}).Where("user_id = ?", viewerID), viewerID)
+	if c.Query("unread") == "true" {
+		query = query.Where("read = ?", false)
+	}
+	if notificationType := c.Query("type"); notificationType != "" {
+		query = query.Where("type = ?", notificationType)
+	}
+
+	var resp PaginatedNotificationsResponse
+	var notifications []models.Notification
+	query = query.Session(&gorm.Session{})
+	query.Count(&resp.TotalCount)
+	if err := query.Preload("Actor").Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve notifications"})
+		return
+	}
+	hideBlockedActors(db.Model(&models.Notification{}).Where("user_id = ? AND read = ?", viewerID, false), viewerID).Count(&resp.UnreadCount)
+
+	resp.Notifications = make([]NotificationDTO, len(notifications))
+	for i, notification := range notifications {
+		resp.Notifications[i] = toNotificationDTO(notification)
+	}
+	resp.Page = page
+	resp.Limit = limit
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Отметить уведомление прочитанным
+// @Description Отмечает уведомление текущего пользователя прочитанным
+// @Tags notifications
+// @Security BearerAuth
+// @Param id path string true "ID уведомления"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /notifications/{id}/read [post]
+func markNotificationReadHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	result := db.Model(&models.Notification{}).Where("id = ? AND user_id = ?", c.Param("id"), userID).Update("read", true)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Отметить все уведомления прочитанными
+// @Description Отмечает прочитанными все уведомления текущего пользователя
+// @Tags notifications
+// @Security BearerAuth
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Router /notifications/read-all [post]
+func markAllNotificationsReadHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	if err := db.Model(&models.Notification{}).Where("user_id = ? AND read = ?", userID, false).Update("read", true).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Получить настройки уведомлений
+// @Description Возвращает для каждого типа уведомлений, включён ли он
+// @Tags notifications
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} map[string]bool
+// @Failure 401 {object} map[string]string
+// @Router /notifications/preferences [get]
+func getNotificationPreferencesHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	preferences, err := notificationPreferences(db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, preferences)
+}
+
+// @Summary Изменить настройки уведомлений
+// @Description Включает или отключает типы уведомлений. Не указанные типы не меняются
+// @Tags notifications
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param data body map[string]bool true "Тип уведомления и признак включения"
+// @Success 200 {object} map[string]bool
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /notifications/preferences [put]
+func updateNotificationPreferencesHandler(c *gin.Context, db *gorm.DB) {
+	var req map[string]bool
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	ownerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	known := map[string]bool{}
+	for _, notificationType := range notificationTypes {
+		known[notificationType] = true
+	}
+
+	var rows []models.NotificationPreference
+	for notificationType, enabled := range req {
+		if !known[notificationType] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown notification type: %s", notificationType)})
+			return
+		}
+		rows = append(rows, models.NotificationPreference{UserID: ownerID, Type: notificationType, Enabled: enabled})
+	}
+
+	if len(rows) > 0 {
+		if err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "type"}},
+			DoUpdates: clause.AssignmentColumns([]string{"enabled"}),
+		}).Create(&rows).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update preferences"})
+			return
+		}
+	}
+
+	preferences, err := notificationPreferences(db, ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, preferences)
+}
+
+func notificationPreferences(db *gorm.DB, userID interface{}) (map[string]bool, error) {
+	preferences := map[string]bool{}
+	for _, notificationType := range notificationTypes {
+		preferences[notificationType] = true
+	}
+
+	var stored []models.NotificationPreference
+	if err := db.Where("user_id = ?", userID).Find(&stored).Error; err != nil {
+		return nil, err
+	}
+	for _, preference := range stored {
+		preferences[preference.Type] = preference.Enabled
+	}
+	return preferences, nil
+}
+
+func toNotificationDTO(notification models.Notification) NotificationDTO {
+	dto := NotificationDTO{
+		ID:        notification.ID,
+		Type:      notification.Type,
+		ActorID:   notification.ActorID,
+		GroupID:   notification.GroupID,
+		PostID:    notification.PostID,
+		CommentID: notification.CommentID,
+		Message:   notification.Message,
+		Read:      notification.Read,
+		CreatedAt: notification.CreatedAt,
+	}
+	if notification.Actor != nil {
+		dto.ActorNickname = notification.Actor.Nickname
+	}
+	return dto
+}
+
+func RegisterNotificationRoutes(r *gin.RouterGroup, db *gorm.DB) {
+	r.Use(JWTMiddleware())
+
+	r.GET("/", func(c *gin.Context) {
+		listNotificationsHandler(c, db)
+	})
+
+	r.POST("/:id/read", func(c *gin.Context) {
+		markNotificationReadHandler(c, db)
+	})
+
+	r.POST("/read-all", func(c *gin.Context) {
+		markAllNotificationsReadHandler(c, db)
+	})
+
+	r.GET("/preferences", func(c *gin.Context) {
+		getNotificationPreferencesHandler(c, db)
+	})
+
+	r.PUT("/preferences", func(c *gin.Context) {
+		updateNotificationPreferencesHandler(c, db)
+	})
+}
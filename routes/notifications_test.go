@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"chirp/models"
+)
+
+func TestFirstVoteMilestoneIsRecordedOncePerTarget(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	postID, commentID := uuid.New(), uuid.New()
+
+	// The dry run inserts nothing, as when the milestone was already announced.
+	if firstVoteMilestone(db, postID, nil, 10) {
+		t.Error("milestone reported as new although no row was inserted")
+	}
+	firstVoteMilestone(db, postID, &commentID, 10)
+
+	inserts := recorder.matching(`INSERT INTO "vote_milestones"`)
+	if len(inserts) != 2 {
+		t.Fatalf("inserts = %v", inserts)
+	}
+	for i, target := range [][2]string{
+		{`("post_id","milestone")`, "WHERE comment_id IS NULL DO NOTHING"},
+		{`("comment_id","milestone")`, "WHERE comment_id IS NOT NULL DO NOTHING"},
+	} {
+		if !strings.Contains(inserts[i], "ON CONFLICT "+target[0]) || !strings.Contains(inserts[i], target[1]) {
+			t.Errorf("insert %d does not skip announced milestones: %s", i, inserts[i])
+		}
+	}
+}
+
+func TestCrossedVoteMilestone(t *testing.T) {
+	for _, tc := range []struct{ before, after, want int }{
+		{9, 10, 10},
+		{10, 11, 0},
+		{10, 9, 0},
+		{49, 50, 50},
+		{0, 100, 100},
+		{-1, 0, 0},
+	} {
+		if got := crossedVoteMilestone(tc.before, tc.after); got != tc.want {
+			t.Errorf("crossedVoteMilestone(%d, %d) = %d, want %d", tc.before, tc.after, got, tc.want)
+		}
+	}
+}
+
+func TestListNotificationsHidesBlockedActors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, recorder := dryRunDB(t)
+
+	r := gin.New()
+	r.GET("/notifications", func(c *gin.Context) {
+		c.Set("userId", uuid.New())
+		listNotificationsHandler(c, db)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/notifications", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	queries := recorder.matching(`SELECT`)
+	filtered := 0
+	for _, query := range queries {
+		if strings.Contains(query, `FROM "notifications"`) && strings.Contains(query, "COALESCE(notifications.actor_id, notifications.user_id) NOT IN (SELECT blocked_id FROM user_blocks") {
+			filtered++
+		}
+	}
+	// The page, the total and the unread count.
+	if filtered != 3 {
+		t.Errorf("%d of the notification queries hide blocked actors, want 3: %v", filtered, queries)
+	}
+}
+
+func TestVoteMilestoneIsAnnouncedOnce(t *testing.T) {
+	voter := uuid.New()
+	post := models.Post{ID: uuid.New(), AuthorID: uuid.New(), Reputation: 9}
+
+	for _, tc := range []struct {
+		name      string
+		announced bool
+	}{
+		{"first time", false},
+		{"already announced", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newStubDB(t)
+			db.returning(`FROM "posts" WHERE id = '`+post.ID.String()+`'`, post)
+			if tc.announced {
+				db.affecting("vote_milestones", 0)
+			}
+
+			w := serve(db.DB, http.MethodPost, "/posts/:id/vote", "/posts/"+post.ID.String()+"/vote", `{"value":1}`, &voter, votePostHandler)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d, body %s", w.Code, w.Body)
+			}
+			if len(db.recorder.matching(`INSERT INTO "vote_milestones"`)) != 1 {
+				t.Errorf("milestone 10 was not recorded: %v", db.recorder.statements)
+			}
+			notified := len(db.recorder.matching(`INSERT INTO "notifications"`))
+			if want := map[bool]int{false: 1, true: 0}[tc.announced]; notified != want {
+				t.Errorf("%d milestone notifications, want %d", notified, want)
+			}
+		})
+	}
+}
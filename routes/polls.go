@@ -0,0 +1,329 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"chirp/models"
+)
+
+// Limits for polls.
+const (
+	minPollDuration   = 5 * time.Minute
+	maxPollDuration   = 30 * 24 * time.Hour
+	pollCloseInterval = time.Minute
+	pollCloseBatch    = 100
+)
+
+var errAlreadyVoted = errors.New("already voted in this poll")
+
+// Проверяет варианты и время закрытия опроса. Возвращает варианты без лишних пробелов или сообщение об ошибке.
+func validatePoll(req CreatePollRequest) ([]string, string) {
+	options := make([]string, len(req.Options))
+	seen := map[string]bool{}
+	for i, option := range req.Options {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			return nil, "Poll options cannot be empty"
+		}
+		key := strings.ToLower(option)
+		if seen[key] {
+			return nil, "Poll options must be unique"
+		}
+		seen[key] = true
+		options[i] = option
+	}
+
+	duration := time.Until(req.ClosesAt)
+	if duration < minPollDuration {
+		return nil, "Poll must stay open for at least 5 minutes"
+	}
+	if duration > maxPollDuration {
+		return nil, "Poll cannot stay open for more than 30 days"
+	}
+	return options, ""
+}
+
+// Создаёт опрос поста с вариантами в заданном порядке.
+func createPoll(tx *gorm.DB, postID uuid.UUID, req CreatePollRequest, options []string) error {
+	poll := models.Poll{
+		PostID:         postID,
+		MultipleChoice: req.MultipleChoice,
+		ClosesAt:       req.ClosesAt,
+	}
+	if err := tx.Create(&poll).Error; err != nil {
+		return err
+	}
+	rows := make([]models.PollOption, len(options))
+	for i, option := range options {
+		rows[i] = models.PollOption{ID: uuid.New(), PostID: postID, Position: i, Text: option}
+	}
+	return tx.Create(&rows).Error
+}
+
+func isPollClosed(poll models.Poll) bool {
+	return poll.ClosedAt != nil || !time.Now().Before(poll.ClosesAt)
+}
+
+// Добавляет к постам опросы. Число голосов видно тем, кто уже проголосовал, и всем после закрытия опроса.
+func attachPolls(db *gorm.DB, posts []PostDTO, viewerID *uuid.UUID) {
+	var ids []uuid.UUID
+	for _, post := range posts {
+		if post.Type == models.PostTypePoll {
+			ids = append(ids, post.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	var polls []models.Poll
+	db.Where("post_id IN ?", ids).Find(&polls)
+	var options []models.PollOption
+	db.Where("post_id IN ?", ids).Order("position").Find(&options)
+	optionsByPost := map[uuid.UUID][]models.PollOption{}
+	for _, option := range options {
+		optionsByPost[option.PostID] = append(optionsByPost[option.PostID], option)
+	}
+
+	voted := map[uuid.UUID]bool{}
+	selected := map[uuid.UUID]bool{}
+	if viewerID != nil {
+		var ballots []models.PollBallot
+		db.Where("post_id IN ? AND user_id = ?", ids, *viewerID).Find(&ballots)
+		for _, ballot := range ballots {
+			voted[ballot.PostID] = true
+		}
+		var votes []models.PollVote
+		db.Where("post_id IN ? AND user_id = ?", ids, *viewerID).Find(&votes)
+		for _, vote := range votes {
+			selected[vote.OptionID] = true
+		}
+	}
+
+	byPost := map[uuid.UUID]*PollDTO{}
+	for _, poll := range polls {
+		dto := toPollDTO(poll, optionsByPost[poll.PostID], voted[poll.PostID], selected)
+		byPost[poll.PostID] = &dto
+	}
+	for i := range posts {
+		if poll, ok := byPost[posts[i].ID]; ok {
+			posts[i].Poll = poll
+		}
+	}
+}
+
+func toPollDTO(poll models.Poll, options []models.PollOption, voted bool, selected map[uuid.UUID]bool) PollDTO {
+	closed := isPollClosed(poll)
+	showResults := voted || closed
+	dto := PollDTO{
+		MultipleChoice: poll.MultipleChoice,
+		ClosesAt:       poll.ClosesAt,
+		Closed:         closed,
+		Voted:          voted,
+		ResultsVisible: showResults,
+		Options:        make([]PollOptionDTO, len(options)),
+	}
+	if showResults {
+		voters := poll.Voters
+		dto.Voters = &voters
+	}
+	for i, option := range options {
+		dto.Options[i] = PollOptionDTO{
+			ID:       option.ID,
+			Text:     option.Text,
+			Selected: selected[option.ID],
+		}
+		if showResults {
+			votes := option.Votes
+			dto.Options[i].Votes = &votes
+		}
+	}
+	return dto
+}
+
+// @Summary Проголосовать в опросе
+// @Description Голосует в опросе поста. Голосовать можно один раз; в опросе с одним ответом выбирается ровно один вариант
+// @Tags posts
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID поста"
+// @Param data body routes.PollVoteRequest true "Выбранные варианты"
+// @Success 200 {object} routes.PollDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /posts/{id}/poll/vote [post]
+func votePollHandler(c *gin.Context, db *gorm.DB) {
+	var req PollVoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	voterID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var post models.Post
+	if err := db.Scopes(visiblePosts(&voterID)).First(&post, "posts.id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+	var poll models.Poll
+	if err := db.First(&poll, "post_id = ?", post.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "This post has no poll"})
+		return
+	}
+	if post.GroupID != nil && isBannedFromGroup(db, *post.GroupID, voterID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are banned from this group"})
+		return
+	}
+	if isPollClosed(poll) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This poll is closed"})
+		return
+	}
+
+	optionIDs := []uuid.UUID{}
+	seen := map[uuid.UUID]bool{}
+	for _, id := range req.OptionIDs {
+		if !seen[id] {
+			seen[id] = true
+			optionIDs = append(optionIDs, id)
+		}
+	}
+	if !poll.MultipleChoice && len(optionIDs) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This poll allows only one choice"})
+		return
+	}
+	var known int64
+	db.Model(&models.PollOption{}).Where("post_id = ? AND id IN ?", post.ID, optionIDs).Count(&known)
+	if int(known) != len(optionIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown poll option"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// The ballot's primary key makes a second vote by the same user a no-op.
+		ballot := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.PollBallot{
+			PostID:    post.ID,
+			UserID:    voterID,
+			CreatedAt: time.Now(),
+		})
+		if ballot.Error != nil {
+			return ballot.Error
+		}
+		if ballot.RowsAffected == 0 {
+			return errAlreadyVoted
+		}
+		votes := make([]models.PollVote, len(optionIDs))
+		for i, id := range optionIDs {
+			votes[i] = models.PollVote{PostID: post.ID, UserID: voterID, OptionID: id}
+		}
+		if err := tx.Create(&votes).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.PollOption{}).Where("id IN ?", optionIDs).
+			Update("votes", gorm.Expr("votes + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Poll{}).Where("post_id = ?", post.ID).
+			Update("voters", gorm.Expr("voters + 1")).Error
+	})
+	if errors.Is(err, errAlreadyVoted) {
+		c.JSON(http.StatusConflict, gin.H{"error": "You have already voted in this poll"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save vote"})
+		return
+	}
+
+	posts := []PostDTO{{ID: post.ID, Type: post.Type}}
+	attachPolls(db, posts, &voterID)
+	c.JSON(http.StatusOK, posts[0].Poll)
+}
+
+var startPollCloser sync.Once
+
+// Запускает фоновую проверку, которая закрывает истёкшие опросы и рассылает уведомления о закрытии.
+func schedulePollClosing(db *gorm.DB) {
+	startPollCloser.Do(func() {
+		go func() {
+			ticker := time.NewTicker(pollCloseInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				closeExpiredPolls(db)
+			}
+		}()
+	})
+}
+
+func closeExpiredPolls(db *gorm.DB) {
+	var polls []models.Poll
+	if err := db.Where("closed_at IS NULL AND closes_at <= ?", time.Now()).
+		Order("closes_at").Limit(pollCloseBatch).Find(&polls).Error; err != nil {
+		log.Println("Failed to load expired polls:", err)
+		return
+	}
+	for _, poll := range polls {
+		closePoll(db, poll)
+	}
+}
+
+// Отмечает опрос закрытым и уведомляет автора и проголосовавших.
+func closePoll(db *gorm.DB, poll models.Poll) {
+	// Several instances may run the closer; only the one that marks the poll closed notifies.
+	claimed := db.Model(&models.Poll{}).
+		Where("post_id = ? AND closed_at IS NULL", poll.PostID).
+		Update("closed_at", time.Now())
+	if claimed.Error != nil || claimed.RowsAffected == 0 {
+		return
+	}
+
+	var post models.Post
+	if err := db.First(&post, "id = ?", poll.PostID).Error; err != nil {
+		return
+	}
+	if !isPubliclyVisible(db, post.AuthorID, post.ModStatus) {
+		return
+	}
+
+	notify(db, models.Notification{
+		UserID:  post.AuthorID,
+		Type:    models.NotificationPollClosed,
+		GroupID: post.GroupID,
+		PostID:  &post.ID,
+		Message: "Your poll has closed",
+	})
+	var voterIDs []uuid.UUID
+	db.Model(&models.PollBallot{}).Where("post_id = ? AND user_id <> ?", post.ID, post.AuthorID).Pluck("user_id", &voterIDs)
+	for _, voterID := range voterIDs {
+		notify(db, models.Notification{
+			UserID:  voterID,
+			Type:    models.NotificationPollClosed,
+			GroupID: post.GroupID,
+			PostID:  &post.ID,
+			Message: "A poll you voted in has closed",
+		})
+	}
+}
@@ -1,12 +1,16 @@
 package routes
 
 import (
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"chirp/models"
 
@@ -14,7 +18,7 @@ import (
 )
 
 // @Summary Создать пост
-// @Description Создаёт новый пост
+// @Description Создаёт новый пост. Текст в формате markdown, в ответе также возвращается очищенный HTML. Тип поста выводится из полей, если не указан. Повторная ссылка в той же группе отклоняется с кодом 409
 // @Tags posts
 // @Security BearerAuth
 // @Accept json
@@ -23,6 +27,10 @@ import (
 // @Success 201 {object} routes.PostDTO
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 422 {object} map[string]string
 // @Router /posts [post]
 func createPostHandler(c *gin.Context, db *gorm.DB) {
 	var req CreatePostRequest
@@ -43,40 +51,187 @@ func createPostHandler(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Title is required"})
+		return
+	}
+	postType, errMsg := resolvePostType(req)
+	if errMsg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	media, errMsg := loadOwnedMedia(db, authorID, req.MediaIDs)
+	if errMsg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	var pollOptions []string
+	if req.Poll != nil {
+		if pollOptions, errMsg = validatePoll(*req.Poll); errMsg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+			return
+		}
+	}
+	var linkURL, canonical string
+	if postType == models.PostTypeLink {
+		var err error
+		if canonical, err = canonicalURL(req.URL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		linkURL = strings.TrimSpace(req.URL)
+	}
+
+	if req.GroupID != nil && isBannedFromGroup(db, *req.GroupID, authorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are banned from this group"})
+		return
+	}
+	if mentionsBlocker(db, authorID, req.Content, nil) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot mention a user who has blocked you"})
+		return
+	}
+
+	var flair *models.PostFlair
+	if req.GroupID != nil {
+		var group models.Group
+		if err := db.First(&group, "id = ?", *req.GroupID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
+		if group.RequireFlair && req.FlairID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "This group requires a post flair"})
+			return
+		}
+		if req.FlairID != nil {
+			resolved, errMsg := resolvePostFlair(db, group.ID, *req.FlairID, authorID)
+			if errMsg != "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+				return
+			}
+			flair = &resolved
+		}
+	} else if req.FlairID != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Flair can only be set on group posts"})
+		return
+	}
+
+	if canonical != "" && req.GroupID != nil {
+		var existing models.Post
+		db.Select("id").
+			Where("group_id = ? AND canonical_url = ? AND mod_status <> ?", *req.GroupID, canonical, models.ContentRemoved).
+			Order("created_at DESC").
+			Limit(1).
+			Find(&existing)
+		if existing.ID != uuid.Nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "This link was already submitted to the group", "postId": existing.ID})
+			return
+		}
+	}
+
+	contentHTML, err := renderMarkdown(req.Content)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	verdict := checkSpam(postSpamText(models.Post{Title: req.Title, Content: req.Content}), req.GroupID != nil)
+	if verdict.Reject {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Content was rejected as spam"})
+		return
+	}
+	imageCheck := checkPostImages(db, req.GroupID, nil, media)
+	if imageCheck.Reject {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": imageCheck.Reason})
+		return
+	}
+
 	post := models.Post{
 		AuthorID:  authorID,
+		Title:     req.Title,
+		Type:      postType,
+		URL:       linkURL,
+		CanonicalURL: canonical,
 		Content:   req.Content,
-		MediaUrls:  req.MediaUrls, // Assuming single media URL for simplicity
+		MediaUrls:  mediaURLs(media),
 		CreatedAt: time.Now(),
 		GroupID:   req.GroupID,
+		ContentHTML:   contentHTML,
+		RenderVersion: markdownRenderVersion,
 	}
-
-	if err := db.Create(&post).Error; err != nil {
+	if verdict.Hold || imageCheck.Hold {
+		post.ModStatus = models.ContentFiltered
+	}
+	if flair != nil {
+		post.FlairID = &flair.ID
+		post.FlairText = flair.Text
+	}
+	var refreshPreviewID *uuid.UUID
+	var refs []models.ContentReference
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if refreshPreviewID, err = assignLinkPreview(tx, &post); err != nil {
+			return err
+		}
+		if err := tx.Create(&post).Error; err != nil {
+			return err
+		}
+		if err := savePostMedia(tx, post.ID, media); err != nil {
+			return err
+		}
+		if req.Poll != nil {
+			if err := createPoll(tx, post.ID, *req.Poll, pollOptions); err != nil {
+				return err
+			}
+		}
+		if verdict.Hold {
+			if err := reportSpamHold(tx, post.GroupID, post.ID, nil, verdict.Score); err != nil {
+				return err
+			}
+		}
+		if imageCheck.Hold {
+			if err := reportImageHold(tx, post.GroupID, post.ID, imageCheck.Reason); err != nil {
+				return err
+			}
+		}
+		if refs, err = saveContentReferences(tx, &post.ID, nil, post.Content); err != nil {
+			return err
+		}
+		return runAutoModForPost(tx, &post)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create post"})
 		return
 	}
 
-	resp := PostDTO{
-		ID:        post.ID,
-		AuthorID:  post.AuthorID,
-		Content:   post.Content,
-		MediaUrls: post.MediaUrls,
-		Reputation: post.Reputation,
-		CreatedAt: post.CreatedAt,
-		GroupID:   post.GroupID,
+	if refreshPreviewID != nil {
+		enqueuePreviewRefresh(db, *refreshPreviewID)
+	}
+
+	resp := postResponse(db, post, &authorID)
+	if isPubliclyVisible(db, post.AuthorID, post.ModStatus) {
+		if post.GroupID != nil {
+			publishEvent(groupPostsTopic(*post.GroupID), "post.created", resp)
+		}
+		notifyMentions(db, refs, nil, post.AuthorID, post.GroupID, &post.ID, nil)
 	}
 
 	c.JSON(http.StatusCreated, resp)
 }
 
 // @Summary Получить список постов
-// @Description Получает посты с пагинацией
+// @Description Получает посты с пагинацией. Для авторизованного пользователя из ленты убираются скрытые им посты, посты заглушённых пользователей и посты с ключевыми словами из его фильтров, а вне ленты группы — и посты заглушённых групп
 // @Tags posts
 // @Produce json
 // @Param page query int false "Страница"
 // @Param limit query int false "Лимит"
 // @Param sort query string false "Сортировка (createdAt|reputation)"
+// @Param feed query string false "Лента (all|home); домашняя лента — посты групп пользователя и тех, на кого он подписан"
+// @Param groupId query string false "ID группы"
+// @Param flairId query string false "ID флера постов группы"
 // @Success 200 {object} routes.PaginatedPostsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
 // @Router /posts [get]
 func getPaginatedPostsHandler(c *gin.Context, db *gorm.DB) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
@@ -91,21 +246,50 @@ func getPaginatedPostsHandler(c *gin.Context, db *gorm.DB) {
 	var posts []models.Post
 	var totalCount int64
 
-	db.Model(&models.Post{}).Count(&totalCount)
-	db.Order(sort + " DESC").Offset(offset).Limit(limit).Find(&posts)
+	viewerID := optionalUserID(c)
+	query := db.Model(&models.Post{}).Scopes(visiblePosts(viewerID))
+	groupID := c.Query("groupId")
+	if groupID != "" {
+		parsedID, err := uuid.Parse(groupID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+			return
+		}
+		query = query.Where("posts.group_id = ?", parsedID)
+	}
+	switch c.DefaultQuery("feed", "all") {
+	case "all":
+	case "home":
+		if viewerID == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+			return
+		}
+		query = query.Scopes(homeFeed(*viewerID))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feed"})
+		return
+	}
+	if viewerID != nil {
+		query = query.Scopes(filteredFeed(*viewerID, groupID == ""))
+	}
+	if flairID := c.Query("flairId"); flairID != "" {
+		parsedID, err := uuid.Parse(flairID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid flair ID"})
+			return
+		}
+		query = query.Where("posts.flair_id = ?", parsedID)
+	}
+
+	query = query.Session(&gorm.Session{})
+	query.Count(&totalCount)
+	query.Order(sort + " DESC").Offset(offset).Limit(limit).Find(&posts)
 
 	postDTOs := make([]PostDTO, len(posts))
 	for i, post := range posts {
-		postDTOs[i] = PostDTO{
-			ID:        post.ID,
-			AuthorID:  post.AuthorID,
-			Content:   post.Content,
-			MediaUrls: post.MediaUrls,
-			Reputation: post.Reputation,
-			CreatedAt: post.CreatedAt,
-			GroupID:   post.GroupID,
-		}
+		postDTOs[i] = toPostDTO(post)
 	}
+	decoratePosts(db, postDTOs, viewerID)
 
 	resp := PaginatedPostsResponse{
 		Posts:      postDTOs,
@@ -126,37 +310,29 @@ func getPaginatedPostsHandler(c *gin.Context, db *gorm.DB) {
 // @Failure 404 {object} map[string]string
 // @Router /posts/{id} [get]
 func getPostDetailHandler(c *gin.Context, db *gorm.DB) {
-	postId := c.Param("postId")
+	postId := c.Param("id")
+	viewerID := optionalUserID(c)
 	var post models.Post
-	if err := db.Preload("Comments").First(&post, "id = ?",postId).Error; err != nil {
+	query := db.Preload("Comments", visibleCommentTree(viewerID)).Scopes(viewablePost(viewerID))
+	if err := query.First(&post, "posts.id = ?", postId).Error; err != nil || !canViewModeratedPost(db, post, viewerID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+	// A deleted post stays readable as a placeholder while its thread has comments.
+	post.Comments = pruneDeletedComments(post.Comments)
+	if post.DeletedAt.Valid && len(post.Comments) == 0 {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
 		return
 	}
 
 	comments := make([]CommentDTO, len(post.Comments))
 	for i, comment := range post.Comments {
-		comments[i] = CommentDTO{
-			ID:         comment.ID,
-			PostID:     comment.PostID,
-			AuthorID:   comment.AuthorID,
-			Content:    comment.Content,
-			Reputation: comment.Reputation,
-			IsReply:    comment.IsReply,
-			ReplyToID:  comment.ReplyToID,
-			CreatedAt:  time.Now(),
-		}
+		comments[i] = toCommentDTO(comment)
 	}
+	decorateComments(db, post.GroupID, comments, viewerID)
 
 	resp := PostDetailDTO{
-		PostDTO: PostDTO{
-			ID:        post.ID,
-			AuthorID:  post.AuthorID,
-			Content:   post.Content,
-			MediaUrls: post.MediaUrls,
-			Reputation: post.Reputation,
-			CreatedAt: time.Now(),
-			GroupID:   post.GroupID,
-		},
+		PostDTO:  postResponse(db, post, viewerID),
 		Comments: comments,
 	}
 
@@ -164,7 +340,7 @@ func getPostDetailHandler(c *gin.Context, db *gorm.DB) {
 }
 
 // @Summary Обновить пост
-// @Description Обновляет пост пользователя
+// @Description Обновляет пост пользователя. Прежняя версия сохраняется в истории правок; правки после EDIT_GRACE_PERIOD отмечают пост изменённым
 // @Tags posts
 // @Security BearerAuth
 // @Accept json
@@ -178,7 +354,7 @@ func getPostDetailHandler(c *gin.Context, db *gorm.DB) {
 // @Failure 404 {object} map[string]string
 // @Router /posts/{id} [put]
 func updatePostHandler(c *gin.Context, db *gorm.DB) {
-	postId := c.Param("postId")
+	postId := c.Param("id")
 	var req UpdatePostRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
@@ -207,33 +383,132 @@ func updatePostHandler(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	var contentHTML string
 	if req.Content != nil {
-		post.Content = *req.Content
+		var err error
+		if contentHTML, err = renderMarkdown(*req.Content); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if mentionsBlocker(db, authorID, *req.Content, mentionedUserIDs(db, &post.ID, nil)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot mention a user who has blocked you"})
+			return
+		}
+	}
+	var media []models.Media
+	var imageCheck imageVerdict
+	if req.MediaIDs != nil {
+		if errMsg := checkPostMedia(post.Type, len(*req.MediaIDs)); errMsg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+			return
+		}
+		var errMsg string
+		if media, errMsg = loadOwnedMedia(db, authorID, *req.MediaIDs); errMsg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+			return
+		}
+		if imageCheck = checkPostImages(db, post.GroupID, &post.ID, media); imageCheck.Reject {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": imageCheck.Reason})
+			return
+		}
 	}
-	if req.MediaUrls != nil && len(*req.MediaUrls) > 0 {
-		post.MediaUrls = *req.MediaUrls
+	var flair models.PostFlair
+	if req.FlairID != nil {
+		if post.GroupID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Flair can only be set on group posts"})
+			return
+		}
+		var errMsg string
+		if flair, errMsg = resolvePostFlair(db, *post.GroupID, *req.FlairID, authorID); errMsg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+			return
+		}
 	}
 
-	if err := db.Save(&post).Error; err != nil {
+	previous := mentionedUserIDs(db, &post.ID, nil)
+	var refreshPreviewID *uuid.UUID
+	var refs []models.ContentReference
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Concurrent edits must see each other's result, or both would record the same previous version.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&post, "id = ?", post.ID).Error; err != nil {
+			return err
+		}
+		original := models.ContentRevision{
+			PostID:    post.ID,
+			EditorID:  post.AuthorID,
+			Content:   post.Content,
+			MediaUrls: post.MediaUrls,
+			CreatedAt: post.CreatedAt,
+		}
+		if req.Content != nil {
+			post.Content = *req.Content
+			post.ContentHTML = contentHTML
+			post.RenderVersion = markdownRenderVersion
+		}
+		if req.MediaIDs != nil {
+			if imageCheck.Hold {
+				post.ModStatus = models.ContentFiltered
+			}
+			post.MediaUrls = mediaURLs(media)
+		}
+		if req.FlairID != nil {
+			post.FlairID = &flair.ID
+			post.FlairText = flair.Text
+		}
+		changed := post.Content != original.Content || !slices.Equal(post.MediaUrls, original.MediaUrls)
+		if changed {
+			post.EditedAt = markEdited(post.CreatedAt, post.EditedAt)
+		}
+
+		var err error
+		if refreshPreviewID, err = assignLinkPreview(tx, &post); err != nil {
+			return err
+		}
+		if err := tx.Save(&post).Error; err != nil {
+			return err
+		}
+		if req.MediaIDs != nil {
+			if err := savePostMedia(tx, post.ID, media); err != nil {
+				return err
+			}
+		}
+		if changed {
+			if err := saveRevision(tx, original, models.ContentRevision{
+				PostID:    post.ID,
+				EditorID:  authorID,
+				Content:   post.Content,
+				MediaUrls: post.MediaUrls,
+			}); err != nil {
+				return err
+			}
+		}
+		if imageCheck.Hold {
+			if err := reportImageHold(tx, post.GroupID, post.ID, imageCheck.Reason); err != nil {
+				return err
+			}
+		}
+		if refs, err = saveContentReferences(tx, &post.ID, nil, post.Content); err != nil {
+			return err
+		}
+		return runAutoModForPost(tx, &post)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post"})
 		return
 	}
 
-	resp := PostDTO{
-		ID:        post.ID,
-		AuthorID:  post.AuthorID,
-		Content:   post.Content,
-		MediaUrls: post.MediaUrls,
-		Reputation: post.Reputation,
-		CreatedAt: post.CreatedAt,
-		GroupID:   post.GroupID,
+	if refreshPreviewID != nil {
+		enqueuePreviewRefresh(db, *refreshPreviewID)
+	}
+	if isPubliclyVisible(db, post.AuthorID, post.ModStatus) {
+		notifyMentions(db, refs, previous, post.AuthorID, post.GroupID, &post.ID, nil)
 	}
 
-	c.JSON(http.StatusOK, resp)
+	c.JSON(http.StatusOK, postResponse(db, post, &authorID))
 }
 
 // @Summary Удалить пост
-// @Description Удаляет пост пользователя
+// @Description Удаляет пост пользователя. Ветка комментариев остаётся, пост в ней показывается заглушкой. Автор может восстановить пост в течение SELF_RESTORE_WINDOW
 // @Tags posts
 // @Security BearerAuth
 // @Param id path string true "ID поста"
@@ -243,7 +518,7 @@ func updatePostHandler(c *gin.Context, db *gorm.DB) {
 // @Failure 404 {object} map[string]string
 // @Router /posts/{id} [delete]
 func deletePostHandler(c *gin.Context, db *gorm.DB) {
-	postId := c.Param("postId")
+	postId := c.Param("id")
 
 	userID, exists := c.Get("userId")
 	if !exists {
@@ -267,7 +542,7 @@ func deletePostHandler(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	if err := db.Delete(&models.Post{}, postId).Error; err != nil {
+	if err := softDelete(db, &models.Post{}, post.ID, authorID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete post"})
 		return
 	}
@@ -276,7 +551,7 @@ func deletePostHandler(c *gin.Context, db *gorm.DB) {
 }
 
 // @Summary Голосовать за пост
-// @Description Голосует за пост (лайк/дизлайк)
+// @Description Голосует за пост (лайк/дизлайк). Голосовать нельзя, если голосующий или автор заблокировал другого
 // @Tags posts
 // @Security BearerAuth
 // @Accept json
@@ -285,10 +560,12 @@ func deletePostHandler(c *gin.Context, db *gorm.DB) {
 // @Param data body routes.VoteRequest true "Голос"
 // @Success 200 {object} routes.VoteResponse
 // @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Router /posts/{id}/vote [post]
 func votePostHandler(c *gin.Context, db *gorm.DB) {
-	postId := c.Param("postId")
+	postId := c.Param("id")
 	var req VoteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -301,29 +578,100 @@ func votePostHandler(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	voterID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if isBlockedEitherWay(db, voterID, post.AuthorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot vote on this post"})
+		return
+	}
+
 	post.Reputation += req.Value
 	if err := db.Save(&post).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post reputation"})
 		return
 	}
+	if milestone := crossedVoteMilestone(post.Reputation-req.Value, post.Reputation); milestone > 0 && firstVoteMilestone(db, post.ID, nil, milestone) {
+		notify(db, models.Notification{
+			UserID:  post.AuthorID,
+			Type:    models.NotificationVoteMilestone,
+			GroupID: post.GroupID,
+			PostID:  &post.ID,
+			Message: fmt.Sprintf("Your post reached %d points", milestone),
+		})
+	}
 
 	resp := VoteResponse{
 		Reputation: post.Reputation,
 	}
+	publishEvent(postVotesTopic(post.ID), "post.vote", VoteEventDTO{PostID: post.ID, Reputation: post.Reputation})
 
 	c.JSON(http.StatusOK, resp)
 }
 
+// Преобразует пост в DTO со всеми связанными данными с точки зрения пользователя viewerID.
+func postResponse(db *gorm.DB, post models.Post, viewerID *uuid.UUID) PostDTO {
+	posts := []PostDTO{toPostDTO(post)}
+	decoratePosts(db, posts, viewerID)
+	return posts[0]
+}
+
+// Добавляет к постам HTML текста, флеры авторов, ссылки из текста, превью ссылок, медиафайлы, опросы
+// и отметки сохранения.
+// Содержимое удалённых постов заменяется заглушкой.
+func decoratePosts(db *gorm.DB, posts []PostDTO, viewerID *uuid.UUID) {
+	renderStalePosts(posts)
+	attachPostAuthorFlairs(db, posts)
+	attachPostEntities(db, posts)
+	attachLinkPreviews(db, posts)
+	attachPostMedia(db, posts)
+	attachPolls(db, posts, viewerID)
+	markSavedPosts(db, posts, viewerID)
+	redactDeletedPosts(posts)
+}
+
+func toPostDTO(post models.Post) PostDTO {
+	return PostDTO{
+		ID:         post.ID,
+		AuthorID:   post.AuthorID,
+		Title:      post.Title,
+		Type:       post.Type,
+		URL:        post.URL,
+		Content:    post.Content,
+		ContentHTML: currentHTML(post.ContentHTML, post.RenderVersion),
+		MediaUrls:  post.MediaUrls,
+		Reputation: post.Reputation,
+		CreatedAt:  post.CreatedAt,
+		GroupID:    post.GroupID,
+		ModStatus:  post.ModStatus,
+		FlairID:    post.FlairID,
+		FlairText:  post.FlairText,
+		EditedAt:   post.EditedAt,
+		Deleted:    post.DeletedAt.Valid,
+	}
+}
+
 func RegisterPostRoutes(r *gin.RouterGroup, db *gorm.DB) {
 	r.POST("/", JWTMiddleware(), func(c *gin.Context) {
 		createPostHandler(c, db)
 	})
 
-	r.GET("/", func(c *gin.Context) {
+	r.GET("/", OptionalJWTMiddleware(), func(c *gin.Context) {
 		getPaginatedPostsHandler(c, db)
 	})
 
-	r.GET("/:id", func(c *gin.Context) {
+	r.GET("/link-preview", JWTMiddleware(), func(c *gin.Context) {
+		getLinkPreviewHandler(c, db)
+	})
+
+	r.GET("/:id", OptionalJWTMiddleware(), func(c *gin.Context) {
 		getPostDetailHandler(c, db)
 	})
 
@@ -335,7 +683,47 @@ func RegisterPostRoutes(r *gin.RouterGroup, db *gorm.DB) {
 		deletePostHandler(c, db)
 	})
 
+	r.POST("/:id/restore", JWTMiddleware(), func(c *gin.Context) {
+		restorePostHandler(c, db)
+	})
+
+	r.GET("/:id/revisions", OptionalJWTMiddleware(), func(c *gin.Context) {
+		getPostRevisionsHandler(c, db)
+	})
+
+	r.POST("/:id/poll/vote", JWTMiddleware(), func(c *gin.Context) {
+		votePollHandler(c, db)
+	})
+
+	r.PUT("/:id/save", JWTMiddleware(), func(c *gin.Context) {
+		savePostHandler(c, db)
+	})
+
+	r.DELETE("/:id/save", JWTMiddleware(), func(c *gin.Context) {
+		unsavePostHandler(c, db)
+	})
+
+	r.PUT("/:id/hide", JWTMiddleware(), func(c *gin.Context) {
+		hidePostHandler(c, db)
+	})
+
+	r.DELETE("/:id/hide", JWTMiddleware(), func(c *gin.Context) {
+		unhidePostHandler(c, db)
+	})
+
 	r.POST("/:id/vote", JWTMiddleware(), func(c *gin.Context) {
 		votePostHandler(c, db)
 	})
+
+	r.POST("/:id/remove", JWTMiddleware(), func(c *gin.Context) {
+		removePostHandler(c, db)
+	})
+
+	r.POST("/:id/approve", JWTMiddleware(), func(c *gin.Context) {
+		approvePostHandler(c, db)
+	})
+
+	r.POST("/:id/report", JWTMiddleware(), func(c *gin.Context) {
+		reportPostHandler(c, db)
+	})
 }
\ No newline at end of file
@@ -0,0 +1,279 @@
+package routes
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+// Событие, доставляемое подписчикам темы.
+type Event struct {
+	Topic string          `json:"topic"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data" swaggertype:"object"`
+}
+
+// Подписка на события. Канал закрывается после Close.
+type Subscription interface {
+	Events() <-chan Event
+	Close()
+}
+
+// Брокер сообщений для рассылки событий. Для нескольких экземпляров сервиса
+// подключите реализацию поверх внешней шины (Redis, NATS и т.п.) через SetBroker.
+type Broker interface {
+	Publish(event Event) error
+	Subscribe(topics []string) (Subscription, error)
+}
+
+var broker Broker = NewHub()
+
+// Заменяет используемый брокер событий.
+func SetBroker(b Broker) {
+	broker = b
+}
+
+// Topic names. Each identifies a stream a client can subscribe to.
+func postCommentsTopic(postID uuid.UUID) string { return "post:" + postID.String() + ":comments" }
+func postVotesTopic(postID uuid.UUID) string    { return "post:" + postID.String() + ":votes" }
+func groupPostsTopic(groupID uuid.UUID) string  { return "group:" + groupID.String() + ":posts" }
+func userTopic(userID uuid.UUID) string         { return "user:" + userID.String() }
+
+// Публикует событие. Ошибки брокера не должны ломать основной запрос, поэтому только логируются.
+func publishEvent(topic, eventType string, data interface{}) {
+	if broker == nil {
+		return
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Println("Failed to encode event:", err)
+		return
+	}
+	if err := broker.Publish(Event{Topic: topic, Type: eventType, Data: payload}); err != nil {
+		log.Println("Failed to publish event:", err)
+	}
+}
+
+// Проверяет, что контент виден всем, и о нём можно сообщать в публичных темах.
+func isPubliclyVisible(db *gorm.DB, authorID uuid.UUID, modStatus string) bool {
+	if modStatus == models.ContentRemoved || modStatus == models.ContentFiltered {
+		return false
+	}
+	var author models.User
+	if err := db.Select("id", "shadow_banned").First(&author, "id = ?", authorID).Error; err != nil {
+		return false
+	}
+	return !author.ShadowBanned
+}
+
+// Внутрипроцессный брокер. Медленный подписчик не блокирует остальных: события, не поместившиеся в его буфер, отбрасываются.
+type Hub struct {
+	mu     sync.RWMutex
+	topics map[string]map[*hubSubscription]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{topics: map[string]map[*hubSubscription]struct{}{}}
+}
+
+type hubSubscription struct {
+	hub    *Hub
+	topics []string
+	events chan Event
+	once   sync.Once
+}
+
+const hubBufferSize = 64
+
+func (h *Hub) Publish(event Event) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.topics[event.Topic] {
+		select {
+		case sub.events <- event:
+		default:
+		}
+	}
+	return nil
+}
+
+func (h *Hub) Subscribe(topics []string) (Subscription, error) {
+	sub := &hubSubscription{hub: h, topics: topics, events: make(chan Event, hubBufferSize)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, topic := range topics {
+		if h.topics[topic] == nil {
+			h.topics[topic] = map[*hubSubscription]struct{}{}
+		}
+		h.topics[topic][sub] = struct{}{}
+	}
+	return sub, nil
+}
+
+func (s *hubSubscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *hubSubscription) Close() {
+	s.once.Do(func() {
+		s.hub.mu.Lock()
+		defer s.hub.mu.Unlock()
+		for _, topic := range s.topics {
+			delete(s.hub.topics[topic], s)
+			if len(s.hub.topics[topic]) == 0 {
+				delete(s.hub.topics, topic)
+			}
+		}
+		close(s.events)
+	})
+}
+
+// Максимальное число тем в одной подписке.
+const maxStreamTopics = 50
+
+// @Summary Подписаться на события в реальном времени
+// @Description Открывает поток Server-Sent Events. Темы через запятую: post:{id}:comments, post:{id}:votes, group:{id}:posts, user:{id} (только свои). Токен можно передать параметром token, так как EventSource не поддерживает заголовки
+// @Tags stream
+// @Produce text/event-stream
+// @Param topics query string true "Темы через запятую"
+// @Param token query string false "JWT токен"
+// @Success 200 {object} routes.Event
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /stream [get]
+func streamHandler(c *gin.Context, db *gorm.DB) {
+	var topics []string
+	seen := map[string]bool{}
+	for _, topic := range strings.Split(c.Query("topics"), ",") {
+		topic = strings.TrimSpace(topic)
+		if topic != "" && !seen[topic] {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+	if len(topics) == 0 || len(topics) > maxStreamTopics {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Specify between 1 and 50 topics"})
+		return
+	}
+
+	var viewerID *uuid.UUID
+	tokenString := c.Query("token")
+	if header := c.GetHeader("Authorization"); header != "" {
+		tokenString = strings.TrimPrefix(header, "Bearer ")
+	}
+	if tokenString != "" {
+		userID, err := userIDFromToken(tokenString)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		viewerID = &userID
+	}
+
+	for _, topic := range topics {
+		if status, errMsg := authorizeTopic(topic, viewerID); errMsg != "" {
+			c.JSON(status, gin.H{"error": errMsg})
+			return
+		}
+	}
+
+	// Blocks made while the stream is open apply after the client reconnects.
+	var blocked map[uuid.UUID]bool
+	if viewerID != nil {
+		blocked = blockedUserIDs(db, *viewerID)
+	}
+
+	sub, err := broker.Subscribe(topics)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to subscribe"})
+		return
+	}
+	defer sub.Close()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(25 * time.Second)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-heartbeat.C:
+			// A comment line keeps proxies from closing an idle connection.
+			_, err := io.WriteString(w, ": keepalive\n\n")
+			return err == nil
+		case event, ok := <-sub.Events():
+			if !ok {
+				return false
+			}
+			if isFromBlockedAuthor(event, blocked) {
+				return true
+			}
+			c.SSEvent(event.Type, event)
+			return true
+		}
+	})
+}
+
+// Проверяет, что событие касается поста или комментария пользователя, заблокированного получателем.
+func isFromBlockedAuthor(event Event, blocked map[uuid.UUID]bool) bool {
+	if len(blocked) == 0 {
+		return false
+	}
+	var content struct {
+		AuthorID uuid.UUID `json:"authorId"`
+	}
+	if err := json.Unmarshal(event.Data, &content); err != nil {
+		return false
+	}
+	return blocked[content.AuthorID]
+}
+
+// Проверяет формат темы и право подписки на неё.
+func authorizeTopic(topic string, viewerID *uuid.UUID) (int, string) {
+	parts := strings.Split(topic, ":")
+	if len(parts) < 2 {
+		return http.StatusBadRequest, "Unknown topic: " + topic
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return http.StatusBadRequest, "Unknown topic: " + topic
+	}
+
+	switch {
+	case parts[0] == "post" && len(parts) == 3 && (parts[2] == "comments" || parts[2] == "votes"):
+		return 0, ""
+	case parts[0] == "group" && len(parts) == 3 && parts[2] == "posts":
+		return 0, ""
+	case parts[0] == "user" && len(parts) == 2:
+		if viewerID == nil {
+			return http.StatusUnauthorized, "Authorization required for topic: " + topic
+		}
+		if *viewerID != id {
+			return http.StatusForbidden, "You cannot subscribe to another user's events"
+		}
+		return 0, ""
+	default:
+		return http.StatusBadRequest, "Unknown topic: " + topic
+	}
+}
+
+func RegisterStreamRoutes(r *gin.RouterGroup, db *gorm.DB) {
+	r.GET("", func(c *gin.Context) {
+		streamHandler(c, db)
+	})
+}
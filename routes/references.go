@@ -0,0 +1,212 @@
+package routes
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+// A reference must not be glued to a preceding word, so "mail@example.com" and "a/g/b" are not matched.
+var referencePattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_/@.])(@|[uU]/|[gG]/)([\p{L}\p{N}_-]{1,64})`)
+
+// Ссылка, найденная в тексте, до сопоставления с пользователем или группой.
+type parsedReference struct {
+	Kind   string
+	Name   string
+	Text   string
+	Offset int
+	Length int
+}
+
+// Находит в тексте упоминания @nickname, u/nickname и g/groupname.
+func parseReferences(content string) []parsedReference {
+	var refs []parsedReference
+	for _, match := range referencePattern.FindAllStringSubmatchIndex(content, -1) {
+		start, end := match[2], match[5]
+		kind := models.ReferenceUser
+		if strings.EqualFold(content[match[2]:match[3]], "g/") {
+			kind = models.ReferenceGroup
+		}
+		refs = append(refs, parsedReference{
+			Kind:   kind,
+			Name:   content[match[4]:match[5]],
+			Text:   content[start:end],
+			Offset: utf8.RuneCountInString(content[:start]),
+			Length: utf8.RuneCountInString(content[start:end]),
+		})
+	}
+	return refs
+}
+
+// Сопоставляет найденные ссылки с пользователями и группами. Несуществующие ссылки отбрасываются.
+func resolveReferences(db *gorm.DB, parsed []parsedReference) ([]models.ContentReference, error) {
+	names := map[string][]string{}
+	for _, ref := range parsed {
+		names[ref.Kind] = append(names[ref.Kind], strings.ToLower(ref.Name))
+	}
+
+	ids := map[string]map[string]uuid.UUID{
+		models.ReferenceUser:  {},
+		models.ReferenceGroup: {},
+	}
+	if len(names[models.ReferenceUser]) > 0 {
+		var users []models.User
+		if err := db.Select("id", "nickname").Where("LOWER(nickname) IN ?", names[models.ReferenceUser]).Find(&users).Error; err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			ids[models.ReferenceUser][strings.ToLower(user.Nickname)] = user.ID
+		}
+	}
+	if len(names[models.ReferenceGroup]) > 0 {
+		var groups []models.Group
+		if err := db.Select("id", "group_name").Where("LOWER(group_name) IN ?", names[models.ReferenceGroup]).Find(&groups).Error; err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			ids[models.ReferenceGroup][strings.ToLower(group.GroupName)] = group.ID
+		}
+	}
+
+	var refs []models.ContentReference
+	for _, ref := range parsed {
+		targetID, ok := ids[ref.Kind][strings.ToLower(ref.Name)]
+		if !ok {
+			continue
+		}
+		refs = append(refs, models.ContentReference{
+			Kind:     ref.Kind,
+			TargetID: targetID,
+			Text:     ref.Text,
+			Offset:   ref.Offset,
+			Length:   ref.Length,
+		})
+	}
+	return refs, nil
+}
+
+// Заменяет сохранённые ссылки поста (commentID == nil) или комментария на найденные в новом тексте.
+func saveContentReferences(tx *gorm.DB, postID, commentID *uuid.UUID, content string) ([]models.ContentReference, error) {
+	refs, err := resolveReferences(tx, parseReferences(content))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := referencesOf(tx, postID, commentID).Delete(&models.ContentReference{}).Error; err != nil {
+		return nil, err
+	}
+	for i := range refs {
+		refs[i].PostID = postID
+		refs[i].CommentID = commentID
+	}
+	if len(refs) > 0 {
+		if err := tx.Create(&refs).Error; err != nil {
+			return nil, err
+		}
+	}
+	return refs, nil
+}
+
+// Возвращает ID пользователей, уже упомянутых в посте или комментарии.
+func mentionedUserIDs(db *gorm.DB, postID, commentID *uuid.UUID) map[uuid.UUID]bool {
+	var ids []uuid.UUID
+	referencesOf(db.Model(&models.ContentReference{}), postID, commentID).
+		Where("kind = ?", models.ReferenceUser).
+		Pluck("target_id", &ids)
+
+	mentioned := map[uuid.UUID]bool{}
+	for _, id := range ids {
+		mentioned[id] = true
+	}
+	return mentioned
+}
+
+func referencesOf(db *gorm.DB, postID, commentID *uuid.UUID) *gorm.DB {
+	if commentID != nil {
+		return db.Where("comment_id = ?", *commentID)
+	}
+	return db.Where("post_id = ? AND comment_id IS NULL", *postID)
+}
+
+// Уведомляет упомянутых пользователей, которые не были упомянуты раньше. Блокировки учитывает notify.
+func notifyMentions(db *gorm.DB, refs []models.ContentReference, previous map[uuid.UUID]bool, authorID uuid.UUID, groupID, postID, commentID *uuid.UUID) {
+	message := "mentioned you in a post"
+	if commentID != nil {
+		message = "mentioned you in a comment"
+	}
+
+	notified := map[uuid.UUID]bool{}
+	for _, ref := range refs {
+		if ref.Kind != models.ReferenceUser || previous[ref.TargetID] || notified[ref.TargetID] {
+			continue
+		}
+		notified[ref.TargetID] = true
+		notify(db, models.Notification{
+			UserID:    ref.TargetID,
+			Type:      models.NotificationMention,
+			ActorID:   &authorID,
+			GroupID:   groupID,
+			PostID:    postID,
+			CommentID: commentID,
+			Message:   message,
+		})
+	}
+}
+
+// Добавляет к постам найденные в тексте ссылки.
+func attachPostEntities(db *gorm.DB, posts []PostDTO) {
+	if len(posts) == 0 {
+		return
+	}
+	ids := make([]uuid.UUID, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+
+	var refs []models.ContentReference
+	db.Where("post_id IN ? AND comment_id IS NULL", ids).Find(&refs)
+	entities := groupEntities(refs, func(ref models.ContentReference) uuid.UUID { return *ref.PostID })
+	for i, post := range posts {
+		posts[i].Entities = append([]ContentEntityDTO{}, entities[post.ID]...)
+	}
+}
+
+// Добавляет к комментариям найденные в тексте ссылки.
+func attachCommentEntities(db *gorm.DB, comments []CommentDTO) {
+	if len(comments) == 0 {
+		return
+	}
+	ids := make([]uuid.UUID, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+
+	var refs []models.ContentReference
+	db.Where("comment_id IN ?", ids).Find(&refs)
+	entities := groupEntities(refs, func(ref models.ContentReference) uuid.UUID { return *ref.CommentID })
+	for i, comment := range comments {
+		comments[i].Entities = append([]ContentEntityDTO{}, entities[comment.ID]...)
+	}
+}
+
+func groupEntities(refs []models.ContentReference, owner func(models.ContentReference) uuid.UUID) map[uuid.UUID][]ContentEntityDTO {
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Offset < refs[j].Offset })
+	entities := map[uuid.UUID][]ContentEntityDTO{}
+	for _, ref := range refs {
+		id := owner(ref)
+		entities[id] = append(entities[id], ContentEntityDTO{
+			Type:   ref.Kind,
+			ID:     ref.TargetID,
+			Text:   ref.Text,
+			Offset: ref.Offset,
+			Length: ref.Length,
+		})
+	}
+	return entities
+}
@@ -0,0 +1,215 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+// Время после публикации, в течение которого правки не отмечают пост или комментарий изменённым.
+// Задаётся переменной EDIT_GRACE_PERIOD, по умолчанию три минуты.
+func editGracePeriod() time.Duration {
+	if grace, err := time.ParseDuration(os.Getenv("EDIT_GRACE_PERIOD")); err == nil && grace >= 0 {
+		return grace
+	}
+	return 3 * time.Minute
+}
+
+// Видна ли история правок всем. Задаётся переменной PUBLIC_EDIT_HISTORY; по умолчанию её видят только автор,
+// модераторы группы и администраторы.
+func publicEditHistory() bool {
+	public, _ := strconv.ParseBool(os.Getenv("PUBLIC_EDIT_HISTORY"))
+	return public
+}
+
+// Возвращает отметку об изменении после правки: внутри периода после публикации она не меняется.
+func markEdited(createdAt time.Time, editedAt *time.Time) *time.Time {
+	now := time.Now()
+	if now.Sub(createdAt) <= editGracePeriod() {
+		return editedAt
+	}
+	return &now
+}
+
+// Сохраняет новую версию поста или комментария. Если ревизий ещё нет, сначала сохраняется исходная версия,
+// чтобы первую правку было с чем сравнить. Вызывается после обновления самой записи в той же транзакции:
+// блокировка строки упорядочивает одновременные правки, и номера ревизий не повторяются.
+func saveRevision(tx *gorm.DB, original, revision models.ContentRevision) error {
+	var last int
+	if err := revisionsOf(tx, revision.PostID, revision.CommentID).
+		Select("COALESCE(MAX(number), 0)").Scan(&last).Error; err != nil {
+		return err
+	}
+	if last == 0 {
+		original.Number = 1
+		if err := tx.Create(&original).Error; err != nil {
+			return err
+		}
+		last = 1
+	}
+	revision.Number = last + 1
+	revision.CreatedAt = time.Now()
+	return tx.Create(&revision).Error
+}
+
+func revisionsOf(db *gorm.DB, postID uuid.UUID, commentID *uuid.UUID) *gorm.DB {
+	query := db.Model(&models.ContentRevision{})
+	if commentID != nil {
+		return query.Where("comment_id = ?", *commentID)
+	}
+	return query.Where("post_id = ? AND comment_id IS NULL", postID)
+}
+
+// Может ли пользователь видеть историю правок независимо от настройки PUBLIC_EDIT_HISTORY.
+func canViewRevisions(db *gorm.DB, viewerID *uuid.UUID, authorID uuid.UUID, groupID *uuid.UUID) bool {
+	if viewerID == nil {
+		return false
+	}
+	return *viewerID == authorID ||
+		(groupID != nil && isGroupModerator(db, *groupID, *viewerID)) ||
+		isAdmin(db, *viewerID)
+}
+
+// @Summary Получить историю правок поста
+// @Description Возвращает версии поста от новых к старым с отличиями от предыдущей версии. По умолчанию история видна автору, модераторам группы и администраторам
+// @Tags posts
+// @Produce json
+// @Param id path string true "ID поста"
+// @Param page query int false "Страница"
+// @Param limit query int false "Лимит"
+// @Success 200 {object} routes.PaginatedRevisionsResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /posts/{id}/revisions [get]
+func getPostRevisionsHandler(c *gin.Context, db *gorm.DB) {
+	viewerID := optionalUserID(c)
+	var post models.Post
+	if err := db.First(&post, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+	if !canViewRevisions(db, viewerID, post.AuthorID, post.GroupID) {
+		if !publicEditHistory() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Edit history is visible only to moderators"})
+			return
+		}
+		var visible int64
+		db.Model(&models.Post{}).Scopes(visiblePosts(viewerID)).Where("posts.id = ?", post.ID).Count(&visible)
+		if visible == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+			return
+		}
+	}
+
+	listRevisions(c, db, post.ID, nil, fmt.Sprintf("post/%s", post.ID))
+}
+
+// @Summary Получить историю правок комментария
+// @Description Возвращает версии комментария от новых к старым с отличиями от предыдущей версии. По умолчанию история видна автору, модераторам группы и администраторам
+// @Tags comments
+// @Produce json
+// @Param id path string true "ID комментария"
+// @Param page query int false "Страница"
+// @Param limit query int false "Лимит"
+// @Success 200 {object} routes.PaginatedRevisionsResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /comments/{id}/revisions [get]
+func getCommentRevisionsHandler(c *gin.Context, db *gorm.DB) {
+	viewerID := optionalUserID(c)
+	var comment models.Comment
+	if err := db.First(&comment, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+	var post models.Post
+	if err := db.First(&post, "id = ?", comment.PostID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+	if !canViewRevisions(db, viewerID, comment.AuthorID, post.GroupID) {
+		if !publicEditHistory() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Edit history is visible only to moderators"})
+			return
+		}
+		var visible int64
+		db.Model(&models.Comment{}).Scopes(visibleComments(viewerID)).Where("comments.id = ?", comment.ID).Count(&visible)
+		if visible == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+			return
+		}
+	}
+
+	listRevisions(c, db, post.ID, &comment.ID, fmt.Sprintf("comment/%s", comment.ID))
+}
+
+// Отдаёт страницу ревизий. Для разницы с предыдущей версией догружается ревизия, предшествующая странице.
+func listRevisions(c *gin.Context, db *gorm.DB, postID uuid.UUID, commentID *uuid.UUID, name string) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 25
+	}
+
+	var totalCount int64
+	var revisions []models.ContentRevision
+	query := revisionsOf(db, postID, commentID).Session(&gorm.Session{})
+	query.Count(&totalCount)
+	if err := query.Preload("Editor").Order("number DESC").Offset((page - 1) * limit).Limit(limit).Find(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve edit history"})
+		return
+	}
+
+	var previous models.ContentRevision
+	if len(revisions) > 0 {
+		query.Where("number = ?", revisions[len(revisions)-1].Number-1).Limit(1).Find(&previous)
+	}
+
+	dtos := make([]ContentRevisionDTO, len(revisions))
+	for i, revision := range revisions {
+		before := previous
+		if i+1 < len(revisions) {
+			before = revisions[i+1]
+		}
+		dtos[i] = toContentRevisionDTO(revision, before, name)
+	}
+
+	c.JSON(http.StatusOK, PaginatedRevisionsResponse{
+		Revisions:  dtos,
+		Page:       page,
+		Limit:      limit,
+		TotalCount: totalCount,
+	})
+}
+
+// The first revision is compared against empty content.
+func toContentRevisionDTO(revision, previous models.ContentRevision, name string) ContentRevisionDTO {
+	diff, additions, deletions := unifiedDiff(
+		fmt.Sprintf("%s@%d", name, previous.Number),
+		fmt.Sprintf("%s@%d", name, revision.Number),
+		previous.Content, revision.Content,
+	)
+	return ContentRevisionDTO{
+		ID:             revision.ID,
+		Number:         revision.Number,
+		EditorID:       revision.EditorID,
+		EditorNickname: revision.Editor.Nickname,
+		Content:        revision.Content,
+		MediaUrls:      revision.MediaUrls,
+		Diff:           diff,
+		Additions:      additions,
+		Deletions:      deletions,
+		CreatedAt:      revision.CreatedAt,
+	}
+}
@@ -1,11 +1,31 @@
 package routes
 
 import (
+	"log"
+
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 func InitRoutes(r *gin.Engine, db *gorm.DB) {
+	if spamClassifier == nil {
+		spamClassifier = NewNaiveBayesClassifier(db)
+	}
+	if mediaStorage == nil {
+		storage, err := NewStorageFromEnv()
+		if err != nil {
+			log.Fatal("Failed to configure media storage: ", err)
+		}
+		mediaStorage = storage
+	}
+	grantConfiguredAdmins(db)
+	schedulePollClosing(db)
+	scheduleDeletedContentPurge(db)
+	scheduleStaleUploadCleanup(db)
+	scheduleMarkdownBackfill(db)
+
+	r.Use(SuspensionMiddleware(db))
+
 	authGroup := r.Group("/api/v1/auth")
 	RegisterAuthRoutes(authGroup, db)
 
@@ -20,4 +40,27 @@ func InitRoutes(r *gin.Engine, db *gorm.DB) {
 
 	groupsGroup := r.Group("/api/v1/groups")
 	RegisterGroupRoutes(groupsGroup, db)
+	RegisterModerationRoutes(groupsGroup, db)
+	RegisterSubscriptionRoutes(groupsGroup, db)
+
+	modmailGroup := r.Group("/api/v1/modmail")
+	RegisterModmailRoutes(modmailGroup, db)
+
+	messagesGroup := r.Group("/api/v1/messages")
+	RegisterMessageRoutes(messagesGroup, db)
+
+	notificationsGroup := r.Group("/api/v1/notifications")
+	RegisterNotificationRoutes(notificationsGroup, db)
+
+	streamGroup := r.Group("/api/v1/stream")
+	RegisterStreamRoutes(streamGroup, db)
+
+	mediaGroup := r.Group("/api/v1/media")
+	RegisterMediaRoutes(mediaGroup, db)
+
+	previewsGroup := r.Group("/api/v1/previews")
+	RegisterLinkPreviewRoutes(previewsGroup, db)
+
+	adminGroup := r.Group("/api/v1/admin")
+	RegisterAdminRoutes(adminGroup, db)
 }
\ No newline at end of file
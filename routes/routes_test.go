@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestInitRoutesRegistersGroupRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, _ := dryRunDB(t)
+	t.Setenv("MEDIA_STORAGE", "local")
+	t.Setenv("MEDIA_DIR", t.TempDir())
+
+	r := gin.New()
+	InitRoutes(r, db)
+
+	registered := map[string]bool{}
+	for _, route := range r.Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+	for _, want := range []string{
+		"POST /api/v1/groups/:id/moderators",
+		"DELETE /api/v1/groups/:id/moderators/:userId",
+		"POST /api/v1/groups/:id/subscribe",
+		"DELETE /api/v1/groups/:id/subscribe",
+	} {
+		if !registered[want] {
+			t.Errorf("route %s is not registered", want)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+// @Summary Получить правила группы
+// @Description Возвращает правила группы в заданном модераторами порядке
+// @Tags rules
+// @Produce json
+// @Param id path string true "ID группы"
+// @Success 200 {array} routes.GroupRuleDTO
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/rules [get]
+func listGroupRulesHandler(c *gin.Context, db *gorm.DB) {
+	var group models.Group
+	if err := db.First(&group, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	rules, err := groupRules(db, group.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// @Summary Добавить правило группы
+// @Description Добавляет правило в конец списка правил группы
+// @Tags rules
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param data body routes.GroupRuleRequest true "Правило"
+// @Success 201 {object} routes.GroupRuleDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/rules [post]
+func createGroupRuleHandler(c *gin.Context, db *gorm.DB) {
+	var req GroupRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	group, moderatorID, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var maxPosition *int
+	db.Model(&models.GroupRule{}).Where("group_id = ?", group.ID).Select("MAX(position)").Scan(&maxPosition)
+
+	rule := models.GroupRule{
+		GroupID:     group.ID,
+		Title:       req.Title,
+		Description: req.Description,
+		AppliesTo:   req.AppliesTo,
+		CreatedAt:   time.Now(),
+	}
+	if rule.AppliesTo == "" {
+		rule.AppliesTo = models.RuleAppliesToBoth
+	}
+	if maxPosition != nil {
+		rule.Position = *maxPosition + 1
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&rule).Error; err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionEditRules,
+			TargetType:  "rule",
+			TargetID:    &rule.ID,
+		}, nil, toGroupRuleDTO(rule))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create rule"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, toGroupRuleDTO(rule))
+}
+
+// @Summary Обновить правило группы
+// @Description Обновляет текст или область применения правила группы
+// @Tags rules
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param ruleId path string true "ID правила"
+// @Param data body routes.UpdateGroupRuleRequest true "Данные для обновления"
+// @Success 200 {object} routes.GroupRuleDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/rules/{ruleId} [put]
+func updateGroupRuleHandler(c *gin.Context, db *gorm.DB) {
+	var req UpdateGroupRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	group, moderatorID, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var rule models.GroupRule
+	if err := db.First(&rule, "id = ? AND group_id = ?", c.Param("ruleId"), group.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+
+	before := toGroupRuleDTO(rule)
+	if req.Title != nil {
+		rule.Title = *req.Title
+	}
+	if req.Description != nil {
+		rule.Description = *req.Description
+	}
+	if req.AppliesTo != nil {
+		rule.AppliesTo = *req.AppliesTo
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&rule).Error; err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionEditRules,
+			TargetType:  "rule",
+			TargetID:    &rule.ID,
+		}, before, toGroupRuleDTO(rule))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toGroupRuleDTO(rule))
+}
+
+// @Summary Изменить порядок правил группы
+// @Description Задаёт новый порядок правил. Список должен содержать все правила группы
+// @Tags rules
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param data body routes.ReorderGroupRulesRequest true "ID правил в новом порядке"
+// @Success 200 {array} routes.GroupRuleDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/rules/order [put]
+func reorderGroupRulesHandler(c *gin.Context, db *gorm.DB) {
+	var req ReorderGroupRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	group, moderatorID, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	before, err := groupRules(db, group.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve rules"})
+		return
+	}
+
+	known := map[uuid.UUID]bool{}
+	for _, rule := range before {
+		known[rule.ID] = true
+	}
+	if len(req.RuleIDs) != len(before) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "All rules of the group must be listed exactly once"})
+		return
+	}
+	for _, ruleID := range req.RuleIDs {
+		if !known[ruleID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "All rules of the group must be listed exactly once"})
+			return
+		}
+		delete(known, ruleID)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for position, ruleID := range req.RuleIDs {
+			if err := tx.Model(&models.GroupRule{}).Where("id = ?", ruleID).Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionEditRules,
+			TargetType:  "group",
+			TargetID:    &group.ID,
+		}, gin.H{"order": ruleIDs(before)}, gin.H{"order": req.RuleIDs})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder rules"})
+		return
+	}
+
+	rules, err := groupRules(db, group.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// @Summary Удалить правило группы
+// @Description Удаляет правило группы
+// @Tags rules
+// @Security BearerAuth
+// @Param id path string true "ID группы"
+// @Param ruleId path string true "ID правила"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/rules/{ruleId} [delete]
+func deleteGroupRuleHandler(c *gin.Context, db *gorm.DB) {
+	group, moderatorID, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var rule models.GroupRule
+	if err := db.First(&rule, "id = ? AND group_id = ?", c.Param("ruleId"), group.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&rule).Error; err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionEditRules,
+			TargetType:  "rule",
+			TargetID:    &rule.ID,
+		}, toGroupRuleDTO(rule), nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete rule"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Загружает группу и проверяет, что текущий пользователь её модератор. При ошибке ответ уже отправлен.
+func requireGroupModerator(c *gin.Context, db *gorm.DB, groupID string) (models.Group, uuid.UUID, bool) {
+	var group models.Group
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return group, uuid.Nil, false
+	}
+
+	moderatorID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return group, uuid.Nil, false
+	}
+
+	if err := db.First(&group, "id = ?", groupID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return group, uuid.Nil, false
+	}
+
+	if !isGroupModerator(db, group.ID, moderatorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a moderator of this group"})
+		return group, uuid.Nil, false
+	}
+
+	return group, moderatorID, true
+}
+
+var errRuleNotApplicable = errors.New("rule does not apply to this content")
+
+// Находит правило группы, на которое ссылаются при удалении или жалобе.
+func citedRule(db *gorm.DB, groupID *uuid.UUID, ruleID uuid.UUID, kind string) (models.GroupRule, error) {
+	var rule models.GroupRule
+	if groupID == nil {
+		return rule, gorm.ErrRecordNotFound
+	}
+	if err := db.First(&rule, "id = ? AND group_id = ?", ruleID, *groupID).Error; err != nil {
+		return rule, err
+	}
+	if !rule.AppliesToKind(kind) {
+		return rule, errRuleNotApplicable
+	}
+	return rule, nil
+}
+
+func groupRules(db *gorm.DB, groupID uuid.UUID) ([]GroupRuleDTO, error) {
+	var rules []models.GroupRule
+	if err := db.Where("group_id = ?", groupID).Order("position ASC, created_at ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	ruleDTOs := make([]GroupRuleDTO, len(rules))
+	for i, rule := range rules {
+		ruleDTOs[i] = toGroupRuleDTO(rule)
+	}
+	return ruleDTOs, nil
+}
+
+func ruleIDs(rules []GroupRuleDTO) []uuid.UUID {
+	ids := make([]uuid.UUID, len(rules))
+	for i, rule := range rules {
+		ids[i] = rule.ID
+	}
+	return ids
+}
+
+func toGroupRuleDTO(rule models.GroupRule) GroupRuleDTO {
+	return GroupRuleDTO{
+		ID:          rule.ID,
+		Position:    rule.Position,
+		Title:       rule.Title,
+		Description: rule.Description,
+		AppliesTo:   rule.AppliesTo,
+	}
+}
@@ -0,0 +1,594 @@
+package routes
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"chirp/models"
+)
+
+// @Summary Сохранить пост
+// @Description Сохраняет пост в список сохранённого, при необходимости в коллекцию. Повторное сохранение переносит пост в указанную коллекцию или убирает из коллекции
+// @Tags posts
+// @Security BearerAuth
+// @Accept json
+// @Param id path string true "ID поста"
+// @Param data body routes.SaveItemRequest false "Коллекция"
+// @Success 204 {string} string ""
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /posts/{id}/save [put]
+func savePostHandler(c *gin.Context, db *gorm.DB) {
+	var req SaveItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	saverID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var post models.Post
+	if err := db.Scopes(visiblePosts(&saverID)).First(&post, "posts.id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	saveItem(c, db, models.SavedItem{UserID: saverID, PostID: post.ID, CollectionID: req.CollectionID})
+}
+
+// @Summary Убрать пост из сохранённого
+// @Description Удаляет пост из списка сохранённого и из коллекции
+// @Tags posts
+// @Security BearerAuth
+// @Param id path string true "ID поста"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Router /posts/{id}/save [delete]
+func unsavePostHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	if err := db.Where("user_id = ? AND post_id = ? AND comment_id IS NULL", userID, c.Param("id")).Delete(&models.SavedItem{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsave post"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Сохранить комментарий
+// @Description Сохраняет комментарий в список сохранённого, при необходимости в коллекцию. Повторное сохранение переносит комментарий в указанную коллекцию или убирает из коллекции
+// @Tags comments
+// @Security BearerAuth
+// @Accept json
+// @Param id path string true "ID комментария"
+// @Param data body routes.SaveItemRequest false "Коллекция"
+// @Success 204 {string} string ""
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /comments/{id}/save [put]
+func saveCommentHandler(c *gin.Context, db *gorm.DB) {
+	var req SaveItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	saverID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var comment models.Comment
+	if err := db.Scopes(visibleComments(&saverID)).First(&comment, "comments.id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+	var visible int64
+	db.Model(&models.Post{}).Scopes(visiblePosts(&saverID)).Where("posts.id = ?", comment.PostID).Count(&visible)
+	if visible == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+
+	saveItem(c, db, models.SavedItem{UserID: saverID, PostID: comment.PostID, CommentID: &comment.ID, CollectionID: req.CollectionID})
+}
+
+// @Summary Убрать комментарий из сохранённого
+// @Description Удаляет комментарий из списка сохранённого и из коллекции
+// @Tags comments
+// @Security BearerAuth
+// @Param id path string true "ID комментария"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Router /comments/{id}/save [delete]
+func unsaveCommentHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	if err := db.Where("user_id = ? AND comment_id = ?", userID, c.Param("id")).Delete(&models.SavedItem{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsave comment"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Сохраняет элемент или переносит уже сохранённый в коллекцию из запроса.
+func saveItem(c *gin.Context, db *gorm.DB, item models.SavedItem) {
+	if item.CollectionID != nil {
+		var count int64
+		db.Model(&models.SavedCollection{}).Where("id = ? AND user_id = ?", *item.CollectionID, item.UserID).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+			return
+		}
+	}
+
+	// Saved posts and saved comments have separate partial unique indexes.
+	conflict := clause.OnConflict{
+		Columns:     []clause.Column{{Name: "user_id"}, {Name: "post_id"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "comment_id IS NULL"}}},
+		DoUpdates:   clause.AssignmentColumns([]string{"collection_id"}),
+	}
+	if item.CommentID != nil {
+		conflict.Columns = []clause.Column{{Name: "user_id"}, {Name: "comment_id"}}
+		conflict.TargetWhere = clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "comment_id IS NOT NULL"}}}
+	}
+
+	item.CreatedAt = time.Now()
+	if err := db.Clauses(conflict).Create(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save item"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Получить сохранённое
+// @Description Возвращает сохранённые посты и комментарии от новых к старым. Скрытые и удалённые элементы не показываются
+// @Tags users
+// @Security BearerAuth
+// @Produce json
+// @Param type query string false "Тип (post|comment)"
+// @Param groupId query string false "ID группы"
+// @Param collectionId query string false "ID коллекции"
+// @Param page query int false "Страница"
+// @Param limit query int false "Лимит"
+// @Success 200 {object} routes.PaginatedSavedResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /users/me/saved [get]
+func listSavedHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	viewerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 25
+	}
+
+	query := db.Model(&models.SavedItem{}).
+		Where("saved_items.user_id = ?", viewerID).
+		Where("saved_items.post_id IN (?)", db.Model(&models.Post{}).Scopes(visiblePosts(&viewerID)).Select("posts.id")).
+		Where("(saved_items.comment_id IS NULL OR saved_items.comment_id IN (?))", db.Model(&models.Comment{}).Scopes(visibleComments(&viewerID)).Select("comments.id"))
+
+	switch c.Query("type") {
+	case "":
+	case models.SavedPost:
+		query = query.Where("saved_items.comment_id IS NULL")
+	case models.SavedComment:
+		query = query.Where("saved_items.comment_id IS NOT NULL")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid type filter"})
+		return
+	}
+	if groupParam := c.Query("groupId"); groupParam != "" {
+		groupID, err := uuid.Parse(groupParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+			return
+		}
+		query = query.Where("saved_items.post_id IN (SELECT id FROM posts WHERE group_id = ?)", groupID)
+	}
+	if collectionParam := c.Query("collectionId"); collectionParam != "" {
+		collectionID, err := uuid.Parse(collectionParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+			return
+		}
+		query = query.Where("saved_items.collection_id = ?", collectionID)
+	}
+
+	var totalCount int64
+	var items []models.SavedItem
+	query = query.Session(&gorm.Session{})
+	query.Count(&totalCount)
+	if err := query.Order("saved_items.created_at DESC, saved_items.id DESC").Offset((page - 1) * limit).Limit(limit).Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve saved items"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedSavedResponse{
+		Items:      savedItemDTOs(db, items, viewerID),
+		Page:       page,
+		Limit:      limit,
+		TotalCount: totalCount,
+	})
+}
+
+// Загружает сохранённые посты и комментарии и оформляет их так же, как в лентах и обсуждениях.
+func savedItemDTOs(db *gorm.DB, items []models.SavedItem, viewerID uuid.UUID) []SavedItemDTO {
+	var postIDs, commentIDs []uuid.UUID
+	for _, item := range items {
+		if item.CommentID != nil {
+			commentIDs = append(commentIDs, *item.CommentID)
+		} else {
+			postIDs = append(postIDs, item.PostID)
+		}
+	}
+
+	posts := map[uuid.UUID]*PostDTO{}
+	if len(postIDs) > 0 {
+		var rows []models.Post
+		db.Where("id IN ?", postIDs).Find(&rows)
+		dtos := make([]PostDTO, len(rows))
+		for i, post := range rows {
+			dtos[i] = toPostDTO(post)
+		}
+		decoratePosts(db, dtos, &viewerID)
+		for i := range dtos {
+			posts[dtos[i].ID] = &dtos[i]
+		}
+	}
+
+	comments := map[uuid.UUID]*CommentDTO{}
+	if len(commentIDs) > 0 {
+		var rows []models.Comment
+		db.Where("id IN ?", commentIDs).Find(&rows)
+		var parentIDs []uuid.UUID
+		for _, comment := range rows {
+			parentIDs = append(parentIDs, comment.PostID)
+		}
+		var parents []models.Post
+		db.Select("id", "group_id").Where("id IN ?", parentIDs).Find(&parents)
+		groupOf := map[uuid.UUID]*uuid.UUID{}
+		for _, parent := range parents {
+			groupOf[parent.ID] = parent.GroupID
+		}
+
+		// Author flairs depend on the group, so comments are decorated group by group.
+		byGroup := map[uuid.UUID][]CommentDTO{}
+		for _, comment := range rows {
+			var key uuid.UUID
+			if groupID := groupOf[comment.PostID]; groupID != nil {
+				key = *groupID
+			}
+			byGroup[key] = append(byGroup[key], toCommentDTO(comment))
+		}
+		for key, dtos := range byGroup {
+			var groupID *uuid.UUID
+			if key != uuid.Nil {
+				groupID = &key
+			}
+			decorateComments(db, groupID, dtos, &viewerID)
+			for i := range dtos {
+				comments[dtos[i].ID] = &dtos[i]
+			}
+		}
+	}
+
+	result := make([]SavedItemDTO, 0, len(items))
+	for _, item := range items {
+		dto := SavedItemDTO{
+			ID:           item.ID,
+			Type:         models.SavedPost,
+			CollectionID: item.CollectionID,
+			SavedAt:      item.CreatedAt,
+		}
+		if item.CommentID != nil {
+			dto.Type = models.SavedComment
+			dto.Comment = comments[*item.CommentID]
+			if dto.Comment == nil {
+				continue
+			}
+		} else {
+			dto.Post = posts[item.PostID]
+			if dto.Post == nil {
+				continue
+			}
+		}
+		result = append(result, dto)
+	}
+	return result
+}
+
+// Отмечает посты, сохранённые пользователем.
+func markSavedPosts(db *gorm.DB, posts []PostDTO, viewerID *uuid.UUID) {
+	if viewerID == nil || len(posts) == 0 {
+		return
+	}
+	ids := make([]uuid.UUID, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+
+	var saved []uuid.UUID
+	db.Model(&models.SavedItem{}).Where("user_id = ? AND comment_id IS NULL AND post_id IN ?", *viewerID, ids).Pluck("post_id", &saved)
+	savedSet := map[uuid.UUID]bool{}
+	for _, id := range saved {
+		savedSet[id] = true
+	}
+	for i := range posts {
+		posts[i].Saved = savedSet[posts[i].ID]
+	}
+}
+
+// Отмечает комментарии, сохранённые пользователем.
+func markSavedComments(db *gorm.DB, comments []CommentDTO, viewerID *uuid.UUID) {
+	if viewerID == nil || len(comments) == 0 {
+		return
+	}
+	ids := make([]uuid.UUID, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+
+	var saved []uuid.UUID
+	db.Model(&models.SavedItem{}).Where("user_id = ? AND comment_id IN ?", *viewerID, ids).Pluck("comment_id", &saved)
+	savedSet := map[uuid.UUID]bool{}
+	for _, id := range saved {
+		savedSet[id] = true
+	}
+	for i := range comments {
+		comments[i].Saved = savedSet[comments[i].ID]
+	}
+}
+
+// @Summary Получить коллекции сохранённого
+// @Description Возвращает коллекции текущего пользователя по алфавиту с числом элементов в каждой
+// @Tags users
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} routes.SavedCollectionDTO
+// @Failure 401 {object} map[string]string
+// @Router /users/me/saved/collections [get]
+func listSavedCollectionsHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	var collections []models.SavedCollection
+	if err := db.Where("user_id = ?", userID).Order("name ASC").Find(&collections).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve collections"})
+		return
+	}
+
+	var counts []struct {
+		CollectionID uuid.UUID
+		Count        int64
+	}
+	db.Model(&models.SavedItem{}).Select("collection_id, COUNT(*) AS count").
+		Where("user_id = ? AND collection_id IS NOT NULL", userID).
+		Group("collection_id").Scan(&counts)
+	countOf := map[uuid.UUID]int64{}
+	for _, count := range counts {
+		countOf[count.CollectionID] = count.Count
+	}
+
+	collectionDTOs := make([]SavedCollectionDTO, len(collections))
+	for i, collection := range collections {
+		collectionDTOs[i] = toSavedCollectionDTO(collection, countOf[collection.ID])
+	}
+
+	c.JSON(http.StatusOK, collectionDTOs)
+}
+
+// @Summary Создать коллекцию сохранённого
+// @Description Создаёт именованную коллекцию. Названия коллекций пользователя не повторяются
+// @Tags users
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param data body routes.SavedCollectionRequest true "Название"
+// @Success 201 {object} routes.SavedCollectionDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /users/me/saved/collections [post]
+func createSavedCollectionHandler(c *gin.Context, db *gorm.DB) {
+	var req SavedCollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	ownerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection name cannot be empty"})
+		return
+	}
+	if collectionNameTaken(db, ownerID, name, nil) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A collection with this name already exists"})
+		return
+	}
+
+	collection := models.SavedCollection{UserID: ownerID, Name: name, CreatedAt: time.Now()}
+	if err := db.Create(&collection).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create collection"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, toSavedCollectionDTO(collection, 0))
+}
+
+// @Summary Переименовать коллекцию сохранённого
+// @Description Меняет название коллекции
+// @Tags users
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID коллекции"
+// @Param data body routes.SavedCollectionRequest true "Новое название"
+// @Success 200 {object} routes.SavedCollectionDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /users/me/saved/collections/{id} [patch]
+func renameSavedCollectionHandler(c *gin.Context, db *gorm.DB) {
+	var req SavedCollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+	ownerID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var collection models.SavedCollection
+	if err := db.First(&collection, "id = ? AND user_id = ?", c.Param("id"), ownerID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Collection name cannot be empty"})
+		return
+	}
+	if collectionNameTaken(db, ownerID, name, &collection.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A collection with this name already exists"})
+		return
+	}
+
+	collection.Name = name
+	if err := db.Model(&collection).Update("name", name).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename collection"})
+		return
+	}
+
+	var count int64
+	db.Model(&models.SavedItem{}).Where("collection_id = ?", collection.ID).Count(&count)
+	c.JSON(http.StatusOK, toSavedCollectionDTO(collection, count))
+}
+
+// @Summary Удалить коллекцию сохранённого
+// @Description Удаляет коллекцию. Её элементы остаются в списке сохранённого
+// @Tags users
+// @Security BearerAuth
+// @Param id path string true "ID коллекции"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /users/me/saved/collections/{id} [delete]
+func deleteSavedCollectionHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	var collection models.SavedCollection
+	if err := db.First(&collection, "id = ? AND user_id = ?", c.Param("id"), userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.SavedItem{}).Where("collection_id = ?", collection.ID).Update("collection_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&collection).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete collection"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func collectionNameTaken(db *gorm.DB, userID uuid.UUID, name string, exceptID *uuid.UUID) bool {
+	query := db.Model(&models.SavedCollection{}).Where("user_id = ? AND name = ?", userID, name)
+	if exceptID != nil {
+		query = query.Where("id <> ?", *exceptID)
+	}
+	var count int64
+	query.Count(&count)
+	return count > 0
+}
+
+func toSavedCollectionDTO(collection models.SavedCollection, itemCount int64) SavedCollectionDTO {
+	return SavedCollectionDTO{
+		ID:        collection.ID,
+		Name:      collection.Name,
+		ItemCount: itemCount,
+		CreatedAt: collection.CreatedAt,
+	}
+}
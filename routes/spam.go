@@ -0,0 +1,512 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"chirp/models"
+)
+
+// Классификатор спама, который проверяет посты и комментарии при создании. Если классификатор также
+// реализует Forget(text string, spam bool) error, изменённое решение модератора заменяет прежнее, а с методом
+// Retrain(lessons []SpamLesson) error его можно переобучить на всех решениях модераторов.
+type SpamClassifier interface {
+	// SpamProbability возвращает вероятность того, что текст является спамом, от 0 до 1.
+	SpamProbability(text string) (float64, error)
+	// Learn дообучает классификатор на решении модератора.
+	Learn(text string, spam bool) error
+}
+
+var spamClassifier SpamClassifier
+
+// Решение модератора, на котором переобучается классификатор.
+type SpamLesson struct {
+	Text string
+	Spam bool
+}
+
+// Заменяет используемый классификатор спама.
+func SetSpamClassifier(classifier SpamClassifier) {
+	spamClassifier = classifier
+}
+
+// Пороги вероятности спама: выше hold контент уходит на проверку модераторам, выше reject отклоняется.
+func spamThresholds() (hold float64, reject float64) {
+	hold, reject = 0.8, 0.98
+	if value, err := strconv.ParseFloat(os.Getenv("SPAM_HOLD_THRESHOLD"), 64); err == nil {
+		hold = value
+	}
+	if value, err := strconv.ParseFloat(os.Getenv("SPAM_REJECT_THRESHOLD"), 64); err == nil {
+		reject = value
+	}
+	return hold, reject
+}
+
+// Решение классификатора для нового контента.
+type spamVerdict struct {
+	Score  float64
+	Hold   bool
+	Reject bool
+}
+
+// Оценивает текст классификатором. Контент вне групп некому проверять, поэтому для него действует только порог отклонения.
+func checkSpam(text string, inGroup bool) spamVerdict {
+	if spamClassifier == nil {
+		return spamVerdict{}
+	}
+	score, err := spamClassifier.SpamProbability(text)
+	if err != nil {
+		// The classifier is advisory: a failure must not block posting.
+		return spamVerdict{}
+	}
+	hold, reject := spamThresholds()
+	return spamVerdict{
+		Score:  score,
+		Reject: score >= reject,
+		Hold:   inGroup && score >= hold,
+	}
+}
+
+// Текст поста, который оценивает и на котором обучается классификатор.
+func postSpamText(post models.Post) string {
+	return post.Title + "\n\n" + post.Content
+}
+
+// Оставляет жалобу от имени классификатора, чтобы модераторы видели причину удержания контента.
+func reportSpamHold(tx *gorm.DB, groupID *uuid.UUID, postID uuid.UUID, commentID *uuid.UUID, score float64) error {
+	return tx.Create(&models.Report{
+		GroupID:   groupID,
+		PostID:    &postID,
+		CommentID: commentID,
+		Reason:    fmt.Sprintf("Spam classifier: score %.2f", score),
+		CreatedAt: time.Now(),
+	}).Error
+}
+
+// Дообучает классификатор на решении модератора по посту или комментарию. Для каждого элемента учитывается
+// только последнее решение: повторное пропускается, а изменённое заменяет прежнее, если классификатор
+// умеет его забыть. Обучение вспомогательное, поэтому ошибки только логируются.
+func learnSpamDecision(db *gorm.DB, postID uuid.UUID, commentID *uuid.UUID, text string, spam bool) {
+	if spamClassifier == nil || strings.TrimSpace(text) == "" {
+		return
+	}
+
+	var previous models.SpamDecision
+	query := db.Where("post_id = ? AND comment_id IS NULL", postID)
+	if commentID != nil {
+		query = db.Where("comment_id = ?", *commentID)
+	}
+	if err := query.Limit(1).Find(&previous).Error; err != nil {
+		log.Println("Failed to load spam decision:", err)
+		return
+	}
+	if previous.ID != uuid.Nil {
+		if previous.Spam == spam && previous.Content == text {
+			return
+		}
+		forgetter, ok := spamClassifier.(interface{ Forget(text string, spam bool) error })
+		if !ok {
+			return
+		}
+		if err := forgetter.Forget(previous.Content, previous.Spam); err != nil {
+			log.Println("Failed to untrain spam classifier:", err)
+			return
+		}
+	}
+
+	if err := spamClassifier.Learn(text, spam); err != nil {
+		log.Println("Failed to train spam classifier:", err)
+		return
+	}
+	if err := saveSpamDecision(db, postID, commentID, text, spam); err != nil {
+		log.Println("Failed to save spam decision:", err)
+	}
+}
+
+// Запоминает решение, на котором обучен классификатор.
+func saveSpamDecision(db *gorm.DB, postID uuid.UUID, commentID *uuid.UUID, text string, spam bool) error {
+	// Decisions on posts and on comments have separate partial unique indexes.
+	conflict := clause.OnConflict{
+		Columns:     []clause.Column{{Name: "post_id"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "comment_id IS NULL"}}},
+		DoUpdates:   clause.AssignmentColumns([]string{"spam", "content", "updated_at"}),
+	}
+	if commentID != nil {
+		conflict.Columns = []clause.Column{{Name: "comment_id"}}
+		conflict.TargetWhere = clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "comment_id IS NOT NULL"}}}
+	}
+	return db.Clauses(conflict).Create(&models.SpamDecision{
+		PostID:    postID,
+		CommentID: commentID,
+		Spam:      spam,
+		Content:   text,
+		UpdatedAt: time.Now(),
+	}).Error
+}
+
+// Наивный байесовский классификатор, хранящий статистику токенов в базе данных.
+type NaiveBayesClassifier struct {
+	db *gorm.DB
+}
+
+func NewNaiveBayesClassifier(db *gorm.DB) *NaiveBayesClassifier {
+	return &NaiveBayesClassifier{db: db}
+}
+
+const spamStatsID = 1
+
+func (nb *NaiveBayesClassifier) SpamProbability(text string) (float64, error) {
+	var stats models.SpamModelStats
+	if err := nb.db.Where(models.SpamModelStats{ID: spamStatsID}).FirstOrInit(&stats).Error; err != nil {
+		return 0, err
+	}
+	if stats.SpamDocs == 0 || stats.HamDocs == 0 {
+		return 0, nil
+	}
+
+	tokens := tokenizeForSpam(text)
+	if len(tokens) == 0 {
+		return 0, nil
+	}
+
+	var known []models.SpamToken
+	if err := nb.db.Where("token IN ?", tokens).Find(&known).Error; err != nil {
+		return 0, err
+	}
+
+	// Log-space sum avoids underflow on long texts; Laplace smoothing keeps unseen tokens neutral.
+	logSpam := math.Log(float64(stats.SpamDocs) / float64(stats.SpamDocs+stats.HamDocs))
+	logHam := math.Log(float64(stats.HamDocs) / float64(stats.SpamDocs+stats.HamDocs))
+	for _, token := range known {
+		logSpam += math.Log(float64(token.SpamCount+1) / float64(stats.SpamDocs+2))
+		logHam += math.Log(float64(token.HamCount+1) / float64(stats.HamDocs+2))
+	}
+
+	return 1 / (1 + math.Exp(logHam-logSpam)), nil
+}
+
+func (nb *NaiveBayesClassifier) Learn(text string, spam bool) error {
+	tokens := tokenizeForSpam(text)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	return nb.db.Transaction(func(tx *gorm.DB) error {
+		rows := make([]models.SpamToken, len(tokens))
+		for i, token := range tokens {
+			rows[i] = models.SpamToken{Token: token}
+			if spam {
+				rows[i].SpamCount = 1
+			} else {
+				rows[i].HamCount = 1
+			}
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "token"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"spam_count": gorm.Expr("spam_tokens.spam_count + EXCLUDED.spam_count"),
+				"ham_count":  gorm.Expr("spam_tokens.ham_count + EXCLUDED.ham_count"),
+			}),
+		}).Create(&rows).Error; err != nil {
+			return err
+		}
+
+		stats := models.SpamModelStats{ID: spamStatsID, UpdatedAt: time.Now()}
+		column := "ham_docs"
+		if spam {
+			stats.SpamDocs = 1
+			column = "spam_docs"
+		} else {
+			stats.HamDocs = 1
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				column:       gorm.Expr("spam_model_stats." + column + " + 1"),
+				"updated_at": stats.UpdatedAt,
+			}),
+		}).Create(&stats).Error
+	})
+}
+
+// Отменяет обучение на тексте, выполненное Learn с тем же решением. Счётчики не опускаются ниже нуля,
+// поэтому отмена после сброса статистики безопасна.
+func (nb *NaiveBayesClassifier) Forget(text string, spam bool) error {
+	tokens := tokenizeForSpam(text)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	tokenColumn, docsColumn := "ham_count", "ham_docs"
+	if spam {
+		tokenColumn, docsColumn = "spam_count", "spam_docs"
+	}
+	return nb.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.SpamToken{}).Where("token IN ?", tokens).
+			Update(tokenColumn, gorm.Expr("GREATEST("+tokenColumn+" - 1, 0)")).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.SpamModelStats{}).Where("id = ?", spamStatsID).Updates(map[string]interface{}{
+			docsColumn:   gorm.Expr("GREATEST(" + docsColumn + " - 1, 0)"),
+			"updated_at": time.Now(),
+		}).Error
+	})
+}
+
+// Заменяет накопленную статистику обученной заново на уроках. Новая модель собирается в памяти и
+// записывается одной транзакцией, поэтому при ошибке остаётся прежняя.
+func (nb *NaiveBayesClassifier) Retrain(lessons []SpamLesson) error {
+	counts := map[string]*models.SpamToken{}
+	stats := models.SpamModelStats{ID: spamStatsID, UpdatedAt: time.Now()}
+	for _, lesson := range lessons {
+		tokens := tokenizeForSpam(lesson.Text)
+		if len(tokens) == 0 {
+			continue
+		}
+		if lesson.Spam {
+			stats.SpamDocs++
+		} else {
+			stats.HamDocs++
+		}
+		for _, token := range tokens {
+			row, ok := counts[token]
+			if !ok {
+				row = &models.SpamToken{Token: token}
+				counts[token] = row
+			}
+			if lesson.Spam {
+				row.SpamCount++
+			} else {
+				row.HamCount++
+			}
+		}
+	}
+
+	rows := make([]models.SpamToken, 0, len(counts))
+	for _, row := range counts {
+		rows = append(rows, *row)
+	}
+	return nb.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.SpamToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("1 = 1").Delete(&models.SpamModelStats{}).Error; err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			if err := tx.CreateInBatches(&rows, 500).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&stats).Error
+	})
+}
+
+// Разбивает текст на уникальные токены. Домены ссылок учитываются отдельными токенами.
+func tokenizeForSpam(text string) []string {
+	seen := map[string]bool{}
+	var tokens []string
+	add := func(token string) {
+		if len(token) < 2 || len(token) > 64 || seen[token] {
+			return
+		}
+		seen[token] = true
+		tokens = append(tokens, token)
+	}
+
+	for _, link := range linkPattern.FindAllString(text, -1) {
+		if host := hostOf(link); host != "" {
+			add("domain:" + host)
+		}
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '$'
+	})
+	for _, word := range words {
+		add(word)
+	}
+	return tokens
+}
+
+func hostOf(rawURL string) string {
+	rest := strings.TrimPrefix(strings.TrimPrefix(rawURL, "https://"), "http://")
+	if i := strings.IndexAny(rest, "/?#:"); i >= 0 {
+		rest = rest[:i]
+	}
+	return strings.TrimPrefix(strings.ToLower(rest), "www.")
+}
+
+// @Summary Переобучить классификатор спама
+// @Description Заново обучает классификатор на последних решениях модераторов по каждому посту и комментарию и заменяет им прежнюю статистику
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} routes.SpamRetrainResponse
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 501 {object} map[string]string
+// @Router /admin/spam/retrain [post]
+func retrainSpamHandler(c *gin.Context, db *gorm.DB) {
+	retrainer, ok := spamClassifier.(interface{ Retrain(lessons []SpamLesson) error })
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "The configured spam classifier does not support retraining"})
+		return
+	}
+
+	// Without the bot there are no automatic decisions to leave out.
+	bot, err := findAutoModeratorUser(db)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load moderation decisions"})
+		return
+	}
+
+	var actions []models.ModAction
+	if err := db.Where("action IN ? AND moderator_id <> ?", []string{
+		models.ModActionRemovePost, models.ModActionApprovePost,
+		models.ModActionRemoveComment, models.ModActionApproveComment,
+	}, bot.ID).Order("created_at ASC").Find(&actions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load moderation decisions"})
+		return
+	}
+
+	// Only the latest human decision on each item counts.
+	decisions := map[uuid.UUID]models.ModAction{}
+	for _, action := range actions {
+		if action.TargetID != nil {
+			decisions[*action.TargetID] = action
+		}
+	}
+
+	type trainedDecision struct {
+		postID    uuid.UUID
+		commentID *uuid.UUID
+		lesson    SpamLesson
+	}
+	var trained []trainedDecision
+	var resp SpamRetrainResponse
+	for targetID, action := range decisions {
+		decision := trainedDecision{}
+		var err error
+		if action.TargetType == "comment" {
+			var comment models.Comment
+			if err = db.First(&comment, "id = ?", targetID).Error; err == nil {
+				decision.postID, decision.commentID, decision.lesson.Text = comment.PostID, &comment.ID, comment.Content
+			}
+		} else {
+			var post models.Post
+			if err = db.First(&post, "id = ?", targetID).Error; err == nil {
+				decision.postID, decision.lesson.Text = post.ID, postSpamText(post)
+			}
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load moderation decisions"})
+			return
+		}
+
+		decision.lesson.Spam = action.Action == models.ModActionRemovePost || action.Action == models.ModActionRemoveComment
+		trained = append(trained, decision)
+		if decision.lesson.Spam {
+			resp.SpamDocs++
+		} else {
+			resp.HamDocs++
+		}
+	}
+
+	lessons := make([]SpamLesson, len(trained))
+	for i, decision := range trained {
+		lessons[i] = decision.lesson
+	}
+	if err := retrainer.Retrain(lessons); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to train spam classifier"})
+		return
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.SpamDecision{}).Error; err != nil {
+			return err
+		}
+		for _, decision := range trained {
+			if err := saveSpamDecision(tx, decision.postID, decision.commentID, decision.lesson.Text, decision.lesson.Spam); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save spam decisions"})
+		return
+	}
+
+	db.Model(&models.SpamToken{}).Count(&resp.Tokens)
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Получить вероятности токенов классификатора спама
+// @Description Возвращает статистику токенов: заданных в q через запятую, либо самых "спамных"
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param q query string false "Токены через запятую"
+// @Param limit query int false "Лимит"
+// @Success 200 {array} routes.SpamTokenDTO
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /admin/spam/tokens [get]
+func listSpamTokensHandler(c *gin.Context, db *gorm.DB) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	var stats models.SpamModelStats
+	if err := db.Where(models.SpamModelStats{ID: spamStatsID}).FirstOrInit(&stats).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve spam statistics"})
+		return
+	}
+
+	var tokens []models.SpamToken
+	query := db.Model(&models.SpamToken{})
+	if q := c.Query("q"); q != "" {
+		query = query.Where("token IN ?", tokenizeForSpam(strings.ReplaceAll(q, ",", " ")))
+	} else {
+		query = query.Order("spam_count - ham_count DESC").Limit(limit)
+	}
+	if err := query.Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve spam tokens"})
+		return
+	}
+
+	tokenDTOs := make([]SpamTokenDTO, len(tokens))
+	for i, token := range tokens {
+		pSpam := float64(token.SpamCount+1) / float64(stats.SpamDocs+2)
+		pHam := float64(token.HamCount+1) / float64(stats.HamDocs+2)
+		tokenDTOs[i] = SpamTokenDTO{
+			Token:           token.Token,
+			SpamCount:       token.SpamCount,
+			HamCount:        token.HamCount,
+			SpamProbability: pSpam / (pSpam + pHam),
+		}
+	}
+	sort.Slice(tokenDTOs, func(i, j int) bool {
+		return tokenDTOs[i].SpamProbability > tokenDTOs[j].SpamProbability
+	})
+
+	c.JSON(http.StatusOK, tokenDTOs)
+}
@@ -0,0 +1,222 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+type recordedLesson struct {
+	text string
+	spam bool
+}
+
+type fakeSpamClassifier struct {
+	learned []recordedLesson
+}
+
+func (f *fakeSpamClassifier) SpamProbability(string) (float64, error) { return 0, nil }
+
+func (f *fakeSpamClassifier) Learn(text string, spam bool) error {
+	f.learned = append(f.learned, recordedLesson{text, spam})
+	return nil
+}
+
+type forgettingSpamClassifier struct {
+	fakeSpamClassifier
+	forgotten []recordedLesson
+}
+
+func (f *forgettingSpamClassifier) Forget(text string, spam bool) error {
+	f.forgotten = append(f.forgotten, recordedLesson{text, spam})
+	return nil
+}
+
+// withStoredSpamDecision makes the dry run return previous for spam decision lookups.
+func withStoredSpamDecision(t *testing.T, db *gorm.DB, previous *models.SpamDecision) {
+	err := db.Callback().Query().After("gorm:query").Register("test:spam_decision", func(tx *gorm.DB) {
+		if decision, ok := tx.Statement.Dest.(*models.SpamDecision); ok && previous != nil {
+			*decision = *previous
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLearnSpamDecisionAppliesOnlyChanges(t *testing.T) {
+	postID := uuid.New()
+	stored := func(spam bool, content string) *models.SpamDecision {
+		return &models.SpamDecision{ID: uuid.New(), PostID: postID, Spam: spam, Content: content}
+	}
+
+	for _, tc := range []struct {
+		name          string
+		previous      *models.SpamDecision
+		spam          bool
+		wantLearned   []recordedLesson
+		wantForgotten []recordedLesson
+		wantSaved     int
+	}{
+		{"first decision", nil, true, []recordedLesson{{"buy now", true}}, nil, 1},
+		{"repeated decision", stored(true, "buy now"), true, nil, nil, 0},
+		{"reversed decision", stored(false, "buy now"), true, []recordedLesson{{"buy now", true}}, []recordedLesson{{"buy now", false}}, 1},
+		{"decision on edited text", stored(true, "buy"), true, []recordedLesson{{"buy now", true}}, []recordedLesson{{"buy", true}}, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db, recorder := dryRunDB(t)
+			withStoredSpamDecision(t, db, tc.previous)
+			classifier := &forgettingSpamClassifier{}
+			previous := spamClassifier
+			SetSpamClassifier(classifier)
+			t.Cleanup(func() { SetSpamClassifier(previous) })
+
+			learnSpamDecision(db, postID, nil, "buy now", tc.spam)
+
+			if !equalLessons(classifier.learned, tc.wantLearned) || !equalLessons(classifier.forgotten, tc.wantForgotten) {
+				t.Errorf("learned %v and forgot %v, want %v and %v", classifier.learned, classifier.forgotten, tc.wantLearned, tc.wantForgotten)
+			}
+			if got := len(recorder.matching(`INSERT INTO "spam_decisions"`)); got != tc.wantSaved {
+				t.Errorf("saved the decision %d times, want %d", got, tc.wantSaved)
+			}
+		})
+	}
+}
+
+func TestLearnSpamDecisionKeepsFirstLessonWithoutForget(t *testing.T) {
+	db, _ := dryRunDB(t)
+	postID, commentID := uuid.New(), uuid.New()
+	withStoredSpamDecision(t, db, &models.SpamDecision{ID: uuid.New(), PostID: postID, CommentID: &commentID, Spam: false, Content: "hello"})
+	classifier := &fakeSpamClassifier{}
+	previous := spamClassifier
+	SetSpamClassifier(classifier)
+	t.Cleanup(func() { SetSpamClassifier(previous) })
+
+	learnSpamDecision(db, postID, &commentID, "hello", true)
+
+	if len(classifier.learned) != 0 {
+		t.Errorf("a classifier that cannot forget learned a reversed decision: %v", classifier.learned)
+	}
+}
+
+func equalLessons(a, b []recordedLesson) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type scoringSpamClassifier struct {
+	fakeSpamClassifier
+	scored []string
+}
+
+func (f *scoringSpamClassifier) SpamProbability(text string) (float64, error) {
+	f.scored = append(f.scored, text)
+	return 0, nil
+}
+
+func TestSpamClassifierLearnsTheTextItScores(t *testing.T) {
+	author, moderator, groupID := uuid.New(), uuid.New(), uuid.New()
+	post := models.Post{ID: uuid.New(), AuthorID: author, GroupID: &groupID, Title: "Cheap watches", Content: "Visit the shop"}
+	classifier := &scoringSpamClassifier{}
+	previous := spamClassifier
+	SetSpamClassifier(classifier)
+	t.Cleanup(func() { SetSpamClassifier(previous) })
+
+	db := newStubDB(t)
+	serve(db.DB, http.MethodPost, "/posts", "/posts", `{"title":"Cheap watches","content":"Visit the shop"}`, &author, createPostHandler)
+
+	db.returning(`FROM "posts" WHERE id = '`+post.ID.String()+`'`, post)
+	db.returning(`FROM "group_moderators" WHERE group_id = '`+groupID.String()+`' AND user_id = '`+moderator.String()+`'`, int64(1))
+	w := serve(db.DB, http.MethodPost, "/posts/:id/remove", "/posts/"+post.ID.String()+"/remove", "", &moderator, removePostHandler)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("remove: status %d, body %s", w.Code, w.Body)
+	}
+
+	if len(classifier.scored) != 1 || len(classifier.learned) != 1 || classifier.scored[0] != classifier.learned[0].text {
+		t.Errorf("scored %q but learned %v", classifier.scored, classifier.learned)
+	}
+}
+
+type retrainingSpamClassifier struct {
+	fakeSpamClassifier
+	lessons []SpamLesson
+	err     error
+}
+
+func (f *retrainingSpamClassifier) Retrain(lessons []SpamLesson) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.lessons = lessons
+	return nil
+}
+
+func TestRetrainSpamUsesLatestHumanDecisions(t *testing.T) {
+	moderator := uuid.New()
+	post := models.Post{ID: uuid.New(), Title: "Cheap watches", Content: "Visit the shop"}
+	comment := models.Comment{ID: uuid.New(), PostID: post.ID, Content: "Buy followers"}
+	actions := []models.ModAction{
+		{ModeratorID: moderator, Action: models.ModActionRemovePost, TargetType: "post", TargetID: &post.ID},
+		{ModeratorID: moderator, Action: models.ModActionApprovePost, TargetType: "post", TargetID: &post.ID},
+		{ModeratorID: moderator, Action: models.ModActionRemoveComment, TargetType: "comment", TargetID: &comment.ID},
+	}
+
+	for _, tc := range []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"trained", nil, http.StatusOK},
+		{"training failed", errors.New("disk full"), http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			classifier := &retrainingSpamClassifier{err: tc.err}
+			previous := spamClassifier
+			SetSpamClassifier(classifier)
+			t.Cleanup(func() { SetSpamClassifier(previous) })
+
+			db := newStubDB(t)
+			db.returning(`FROM "mod_actions" WHERE action IN`, actions)
+			db.returning(`FROM "posts" WHERE id = '`+post.ID.String()+`'`, post)
+			db.returning(`FROM "comments" WHERE id = '`+comment.ID.String()+`'`, comment)
+
+			w := serve(db.DB, http.MethodPost, "/admin/spam/retrain", "/admin/spam/retrain", "", &moderator, retrainSpamHandler)
+			if w.Code != tc.wantStatus {
+				t.Fatalf("status %d, want %d; body %s", w.Code, tc.wantStatus, w.Body)
+			}
+			if inserts := db.recorder.matching(`INSERT INTO "users"`); len(inserts) != 0 {
+				t.Errorf("retraining created an account: %v", inserts)
+			}
+			deletes := db.recorder.matching(`DELETE FROM "spam_decisions"`)
+			if tc.err != nil {
+				if len(deletes) != 0 {
+					t.Errorf("a failed retrain dropped the stored decisions: %v", deletes)
+				}
+				return
+			}
+
+			sort.Slice(classifier.lessons, func(i, j int) bool { return classifier.lessons[i].Text < classifier.lessons[j].Text })
+			want := []SpamLesson{{Text: comment.Content, Spam: true}, {Text: postSpamText(post), Spam: false}}
+			if !reflect.DeepEqual(classifier.lessons, want) {
+				t.Errorf("retrained on %v, want %v", classifier.lessons, want)
+			}
+			if len(deletes) != 1 || len(db.recorder.matching(`INSERT INTO "spam_decisions"`)) != 2 {
+				t.Errorf("stored decisions were not replaced: %v", db.recorder.statements)
+			}
+		})
+	}
+}
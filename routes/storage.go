@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var errObjectNotFound = errors.New("object not found")
+
+// Хранилище загруженных файлов.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// Returns a URL clients can download the object from directly,
+	// or "" when the object must be served through the API.
+	URL(key string) string
+}
+
+var mediaStorage Storage
+
+// Заменяет используемое хранилище файлов.
+func SetStorage(s Storage) {
+	mediaStorage = s
+}
+
+// Создаёт хранилище по переменным окружения. MEDIA_STORAGE выбирает реализацию: local (по умолчанию) или s3.
+func NewStorageFromEnv() (Storage, error) {
+	switch os.Getenv("MEDIA_STORAGE") {
+	case "", "local":
+		dir := os.Getenv("MEDIA_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		return &LocalStorage{Dir: dir}, nil
+	case "s3":
+		s := &S3Storage{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PublicURL: os.Getenv("S3_PUBLIC_URL"),
+			Client:    &http.Client{Timeout: 5 * time.Minute},
+		}
+		if s.Region == "" {
+			s.Region = "us-east-1"
+		}
+		if s.Endpoint == "" || s.Bucket == "" || s.AccessKey == "" || s.SecretKey == "" {
+			return nil, errors.New("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required")
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown MEDIA_STORAGE %q", os.Getenv("MEDIA_STORAGE"))
+	}
+}
+
+// Хранилище в локальной файловой системе. Файлы отдаются через API.
+type LocalStorage struct {
+	Dir string
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	// Keys are generated by the server, but a key must never point outside the directory.
+	clean := filepath.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.Dir, clean), nil
+}
+
+// The file is written under a temporary name and renamed, so readers never see a partial object.
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if written != size {
+		return fmt.Errorf("wrote %d bytes, expected %d", written, size)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) URL(key string) string {
+	return ""
+}
@@ -14,13 +14,13 @@ import (
 // @Description Подписывает пользователя на группу
 // @Tags subscriptions
 // @Security BearerAuth
-// @Param groupId path string true "ID группы"
+// @Param id path string true "ID группы"
 // @Success 204 {string} string ""
 // @Failure 401 {object} map[string]string
 // @Failure 404 {object} map[string]string
-// @Router /groups/{groupId}/subscribe [post]
+// @Router /groups/{id}/subscribe [post]
 func subscribeToGroupHandler(c *gin.Context, db *gorm.DB) {
-	groupID := c.Param("groupId")
+	groupID := c.Param("id")
 
 	userID, exists := c.Get("userId")
 	if !exists {
@@ -59,13 +59,13 @@ func subscribeToGroupHandler(c *gin.Context, db *gorm.DB) {
 // @Description Отписывает пользователя от группы
 // @Tags subscriptions
 // @Security BearerAuth
-// @Param groupId path string true "ID группы"
+// @Param id path string true "ID группы"
 // @Success 204 {string} string ""
 // @Failure 401 {object} map[string]string
 // @Failure 404 {object} map[string]string
-// @Router /groups/{groupId}/subscribe [delete]
+// @Router /groups/{id}/subscribe [delete]
 func unsubscribeFromGroupHandler(c *gin.Context, db *gorm.DB) {
-	groupID := c.Param("groupId")
+	groupID := c.Param("id")
 
 	userID, exists := c.Get("userId")
 	if !exists {
@@ -93,12 +93,91 @@ func unsubscribeFromGroupHandler(c *gin.Context, db *gorm.DB) {
 	c.Status(http.StatusNoContent)
 }
 
+// @Summary Подписаться на пользователя
+// @Description Подписывает текущего пользователя на другого пользователя. Подписка невозможна, если один из них заблокировал другого
+// @Tags subscriptions
+// @Security BearerAuth
+// @Accept json
+// @Param data body routes.SubscribeDTO true "Пользователь"
+// @Success 204 {string} string ""
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /users/me/subscriptions [post]
+func followUserHandler(c *gin.Context, db *gorm.DB) {
+	var req SubscribeDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	subscriberID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var target models.User
+	if err := db.First(&target, "id = ?", req.TargetUserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if target.ID == subscriberID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot subscribe to yourself"})
+		return
+	}
+
+	if isBlockedEitherWay(db, subscriberID, target.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot subscribe to this user"})
+		return
+	}
+
+	// The join table has a composite primary key, so a repeated subscription is a no-op.
+	if err := db.Model(&models.User{ID: subscriberID}).Association("Subscriptions").Append(&models.User{ID: target.ID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to subscribe to user"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Отписаться от пользователя
+// @Description Отписывает текущего пользователя от другого пользователя
+// @Tags subscriptions
+// @Security BearerAuth
+// @Param id path string true "ID пользователя"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Router /users/me/subscriptions/{id} [delete]
+func unfollowUserHandler(c *gin.Context, db *gorm.DB) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	if err := db.Exec("DELETE FROM user_subscriptions WHERE subscriber_id = ? AND target_user_id = ?", userID, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsubscribe from user"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
 func RegisterSubscriptionRoutes(r *gin.RouterGroup, db *gorm.DB) {
-	r.POST("/groups/:groupId/subscribe", JWTMiddleware(), func(c *gin.Context) {
+	r.POST("/:id/subscribe", JWTMiddleware(), func(c *gin.Context) {
 		subscribeToGroupHandler(c, db)
 	})
 
-	r.DELETE("/groups/:groupId/subscribe", JWTMiddleware(), func(c *gin.Context) {
+	r.DELETE("/:id/subscribe", JWTMiddleware(), func(c *gin.Context) {
 		unsubscribeFromGroupHandler(c, db)
 	})
 }
\ No newline at end of file
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -52,9 +53,9 @@ type UserProfile struct {
 
 // Представляет тело запроса для обновления профиля пользователя.
 type UpdateUserProfileRequest struct {
-	Nickname  *string `json:"nickname"`
-	BannerURL *string `json:"bannerUrl"`
-	Password  *string `json:"password"`
+	Nickname      *string    `json:"nickname"`
+	BannerMediaID *uuid.UUID `json:"bannerMediaId"`
+	Password      *string    `json:"password"`
 }
 
 // Представляет публичный профиль пользователя.
@@ -78,10 +79,17 @@ type CommentDTO struct {
 	PostID     uuid.UUID `json:"postId"`
 	AuthorID   uuid.UUID `json:"authorId"`
 	Content    string    `json:"content"`
+	ContentHTML string   `json:"contentHtml"`
 	Reputation int       `json:"reputation"`
 	IsReply    bool      `json:"isReply"`
 	ReplyToID  *uuid.UUID `json:"replyToId"`
 	CreatedAt  time.Time `json:"createdAt"`
+	ModStatus  string    `json:"modStatus"`
+	AuthorFlair *AuthorFlairDTO `json:"authorFlair"`
+	Entities    []ContentEntityDTO `json:"entities"`
+	EditedAt    *time.Time `json:"editedAt"`
+	Deleted     bool       `json:"deleted"`
+	Saved       bool       `json:"saved"`
 }
 
 // Представляет тело запроса для голосования за комментарий.
@@ -107,20 +115,40 @@ type VoteDTO struct {
 // posts.go
 // Представляет тело запроса для создания поста.
 type CreatePostRequest struct {
-	Content   string    `json:"content" binding:"required"`
-	MediaUrls []string  `json:"mediaUrls"`
+	Title     string    `json:"title" binding:"required,max=300"`
+	Type      string    `json:"type" binding:"omitempty,oneof=text link image gallery poll"`
+	URL       string    `json:"url" binding:"omitempty,max=2048"`
+	Content   string    `json:"content"`
+	MediaIDs  []uuid.UUID `json:"mediaIds"`
 	GroupID   *uuid.UUID `json:"groupId"`
+	FlairID   *uuid.UUID `json:"flairId"`
+	Poll      *CreatePollRequest `json:"poll"`
 }
 
 // Представляет DTO для поста.
 type PostDTO struct {
 	ID         uuid.UUID `json:"id"`
 	AuthorID   uuid.UUID `json:"authorId"`
+	Title      string    `json:"title"`
+	Type       string    `json:"type"`
+	URL        string    `json:"url"`
 	Content    string    `json:"content"`
+	ContentHTML string   `json:"contentHtml"`
 	MediaUrls  []string  `json:"mediaUrls"`
+	Media      []MediaDTO `json:"media"`
 	Reputation int       `json:"reputation"`
 	CreatedAt  time.Time `json:"createdAt"`
 	GroupID    *uuid.UUID `json:"groupId"`
+	ModStatus  string    `json:"modStatus"`
+	FlairID    *uuid.UUID `json:"flairId"`
+	FlairText  string    `json:"flairText"`
+	AuthorFlair *AuthorFlairDTO `json:"authorFlair"`
+	Entities    []ContentEntityDTO `json:"entities"`
+	LinkPreview *LinkPreviewDTO `json:"linkPreview"`
+	Poll        *PollDTO        `json:"poll"`
+	EditedAt    *time.Time      `json:"editedAt"`
+	Deleted     bool            `json:"deleted"`
+	Saved       bool            `json:"saved"`
 }
 
 // Представляет ответ с постами с пагинацией.
@@ -140,7 +168,8 @@ type PostDetailDTO struct {
 // Представляет тело запроса для обновления поста.
 type UpdatePostRequest struct {
 	Content   *string   `json:"content"`
-	MediaUrls *[]string `json:"mediaUrls"`
+	MediaIDs  *[]uuid.UUID `json:"mediaIds"`
+	FlairID   *uuid.UUID `json:"flairId"`
 }
 
 // Представляет тело запроса для голосования за пост.
@@ -157,8 +186,8 @@ type VoteResponse struct {
 // Представляет тело запроса для создания группы.
 type CreateGroupDTO struct {
 	GroupName   string `json:"groupName" binding:"required"`
-	Description string `json:"description"`
-	BannerURL   string `json:"bannerUrl"`
+	Description   string     `json:"description"`
+	BannerMediaID *uuid.UUID `json:"bannerMediaId"`
 }
 
 // Представляет DTO для группы.
@@ -168,19 +197,26 @@ type GroupDTO struct {
 	RegisteredAt time.Time `json:"registeredAt"`
 	BannerURL    string    `json:"bannerUrl"`
 	Description  string    `json:"description"`
+	PublicModLog   bool      `json:"publicModLog"`
+	RequireFlair   bool      `json:"requireFlair"`
+	AllowUserFlair bool      `json:"allowUserFlair"`
 }
 
 // Представляет детализированный DTO для группы.
 type GroupDetailDTO struct {
 	GroupDTO
-	Moderators []UserProfile `json:"moderators"`
-	Users      []UserProfile `json:"users"`
+	Moderators []UserProfile  `json:"moderators"`
+	Users      []UserProfile  `json:"users"`
+	Rules      []GroupRuleDTO `json:"rules"`
 }
 
 // Представляет тело запроса для обновления группы.
 type UpdateGroupDTO struct {
-	Description *string `json:"description"`
-	BannerURL   *string `json:"bannerUrl"`
+	Description  *string `json:"description"`
+	BannerMediaID  *uuid.UUID `json:"bannerMediaId"`
+	PublicModLog   *bool   `json:"publicModLog"`
+	RequireFlair   *bool   `json:"requireFlair"`
+	AllowUserFlair *bool   `json:"allowUserFlair"`
 }
 
 // subscriptions.go
@@ -193,4 +229,706 @@ type SubscribeDTO struct {
 // Представляет тело запроса для добавления модератора в группу.
 type AddModDTO struct {
 	UserID uuid.UUID `json:"userId" binding:"required"`
-}
\ No newline at end of file
+}
+// Представляет тело запроса для удаления или одобрения контента модератором.
+type ModerateContentDTO struct {
+	Reason string     `json:"reason"`
+	RuleID *uuid.UUID `json:"ruleId"`
+}
+
+// Представляет тело запроса для бана пользователя в группе.
+type BanUserDTO struct {
+	UserID        uuid.UUID `json:"userId" binding:"required"`
+	Reason        string    `json:"reason"`
+	DurationHours *int      `json:"durationHours" binding:"omitempty,min=1"`
+}
+
+// Представляет DTO для бана пользователя в группе.
+type GroupBanDTO struct {
+	UserID     uuid.UUID  `json:"userId"`
+	Nickname   string     `json:"nickname"`
+	BannedByID uuid.UUID  `json:"bannedById"`
+	Reason     string     `json:"reason"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// Представляет DTO для записи журнала модерации.
+type ModActionDTO struct {
+	ID                uuid.UUID       `json:"id"`
+	GroupID           uuid.UUID       `json:"groupId"`
+	ModeratorID       uuid.UUID       `json:"moderatorId"`
+	ModeratorNickname string          `json:"moderatorNickname"`
+	Action            string          `json:"action"`
+	TargetType        string          `json:"targetType"`
+	TargetID          *uuid.UUID      `json:"targetId"`
+	RuleID            *uuid.UUID      `json:"ruleId"`
+	Reason            string          `json:"reason"`
+	Before            json.RawMessage `json:"before" swaggertype:"object"`
+	After             json.RawMessage `json:"after" swaggertype:"object"`
+	CreatedAt         time.Time       `json:"createdAt"`
+}
+
+// Представляет ответ с журналом модерации с пагинацией.
+type PaginatedModActionsResponse struct {
+	Actions    []ModActionDTO `json:"actions"`
+	Page       int            `json:"page"`
+	Limit      int            `json:"limit"`
+	TotalCount int64          `json:"totalCount"`
+}
+
+// Представляет тело запроса для жалобы на пост или комментарий.
+type ReportContentDTO struct {
+	Reason string     `json:"reason" binding:"required_without=RuleID,max=500"`
+	RuleID *uuid.UUID `json:"ruleId"`
+}
+
+// Представляет DTO для жалобы.
+type ReportDTO struct {
+	ID         uuid.UUID  `json:"id"`
+	ReporterID *uuid.UUID `json:"reporterId"`
+	RuleID     *uuid.UUID `json:"ruleId"`
+	Reason     string     `json:"reason"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// Представляет элемент очереди модерации.
+type ModQueueItemDTO struct {
+	Type      string      `json:"type"`
+	ID        uuid.UUID   `json:"id"`
+	PostID    uuid.UUID   `json:"postId"`
+	AuthorID  uuid.UUID   `json:"authorId"`
+	Content   string      `json:"content"`
+	ModStatus string      `json:"modStatus"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Reports   []ReportDTO `json:"reports"`
+}
+
+// automod.go
+// Представляет тело запроса для создания правила автомодерации.
+type AutoModRuleRequest struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	Source   string `json:"source" binding:"required"`
+	Enabled  *bool  `json:"enabled"`
+	Position *int   `json:"position"`
+}
+
+// Представляет тело запроса для обновления правила автомодерации.
+type UpdateAutoModRuleRequest struct {
+	Name     *string `json:"name" binding:"omitempty,max=100"`
+	Source   *string `json:"source"`
+	Enabled  *bool   `json:"enabled"`
+	Position *int    `json:"position"`
+}
+
+// Представляет DTO для правила автомодерации со статистикой срабатываний.
+type AutoModRuleDTO struct {
+	ID        uuid.UUID  `json:"id"`
+	Name      string     `json:"name"`
+	Source    string     `json:"source"`
+	Enabled   bool       `json:"enabled"`
+	Position  int        `json:"position"`
+	HitCount  int64      `json:"hitCount"`
+	LastHitAt *time.Time `json:"lastHitAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// Представляет тело запроса для проверки правил на примере контента.
+type AutoModTestRequest struct {
+	Source    string     `json:"source"`
+	Kind      string     `json:"kind" binding:"required,oneof=post comment"`
+	Content   string     `json:"content"`
+	MediaUrls []string   `json:"mediaUrls"`
+	AuthorID  *uuid.UUID `json:"authorId"`
+}
+
+// Представляет сработавшее при проверке правило.
+type AutoModTestMatch struct {
+	RuleID   uuid.UUID `json:"ruleId"`
+	Name     string    `json:"name"`
+	Action   string    `json:"action"`
+	SetFlair string    `json:"setFlair"`
+	Comment  string    `json:"comment"`
+}
+
+// Представляет результат проверки правил автомодерации.
+type AutoModTestResponse struct {
+	Matches     []AutoModTestMatch `json:"matches"`
+	FinalStatus string             `json:"finalStatus"`
+}
+
+// spam.go
+// Представляет результат переобучения классификатора спама.
+type SpamRetrainResponse struct {
+	SpamDocs int64 `json:"spamDocs"`
+	HamDocs  int64 `json:"hamDocs"`
+	Tokens   int64 `json:"tokens"`
+}
+
+// Представляет статистику токена классификатора спама.
+type SpamTokenDTO struct {
+	Token           string  `json:"token"`
+	SpamCount       int64   `json:"spamCount"`
+	HamCount        int64   `json:"hamCount"`
+	SpamProbability float64 `json:"spamProbability"`
+}
+
+// admin.go
+// Представляет тело запроса для блокировки аккаунта.
+type SuspendUserDTO struct {
+	Reason        string `json:"reason" binding:"required"`
+	DurationHours *int   `json:"durationHours" binding:"omitempty,min=1"`
+}
+
+// Представляет ограничения, наложенные на аккаунт.
+type UserSanctionDTO struct {
+	ID               uuid.UUID  `json:"id"`
+	Nickname         string     `json:"nickname"`
+	Email            string     `json:"email"`
+	Suspended        bool       `json:"suspended"`
+	SuspendedUntil   *time.Time `json:"suspendedUntil"`
+	SuspensionReason string     `json:"suspensionReason"`
+	ShadowBanned     bool       `json:"shadowBanned"`
+}
+
+// rules.go
+// Представляет тело запроса для создания правила группы.
+type GroupRuleRequest struct {
+	Title       string `json:"title" binding:"required,max=100"`
+	Description string `json:"description"`
+	AppliesTo   string `json:"appliesTo" binding:"omitempty,oneof=posts comments both"`
+}
+
+// Представляет тело запроса для обновления правила группы.
+type UpdateGroupRuleRequest struct {
+	Title       *string `json:"title" binding:"omitempty,max=100"`
+	Description *string `json:"description"`
+	AppliesTo   *string `json:"appliesTo" binding:"omitempty,oneof=posts comments both"`
+}
+
+// Представляет тело запроса для изменения порядка правил группы.
+type ReorderGroupRulesRequest struct {
+	RuleIDs []uuid.UUID `json:"ruleIds" binding:"required"`
+}
+
+// Представляет DTO для правила группы.
+type GroupRuleDTO struct {
+	ID          uuid.UUID `json:"id"`
+	Position    int       `json:"position"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	AppliesTo   string    `json:"appliesTo"`
+}
+
+// flairs.go
+// Представляет тело запроса для создания флера постов.
+type PostFlairRequest struct {
+	Text    string `json:"text" binding:"required,max=64"`
+	Color   string `json:"color" binding:"omitempty,hexcolor"`
+	ModOnly bool   `json:"modOnly"`
+}
+
+// Представляет тело запроса для обновления флера постов.
+type UpdatePostFlairRequest struct {
+	Text    *string `json:"text" binding:"omitempty,max=64"`
+	Color   *string `json:"color" binding:"omitempty,hexcolor"`
+	ModOnly *bool   `json:"modOnly"`
+}
+
+// Представляет DTO для флера постов.
+type PostFlairDTO struct {
+	ID      uuid.UUID `json:"id"`
+	Text    string    `json:"text"`
+	Color   string    `json:"color"`
+	ModOnly bool      `json:"modOnly"`
+}
+
+// Представляет DTO для шаблона флера пользователей.
+type UserFlairTemplateDTO struct {
+	ID      uuid.UUID `json:"id"`
+	Text    string    `json:"text"`
+	Color   string    `json:"color"`
+	ModOnly bool      `json:"modOnly"`
+}
+
+// Представляет тело запроса для выбора своего флера в группе.
+type SelectUserFlairRequest struct {
+	TemplateID *uuid.UUID `json:"templateId"`
+}
+
+// Представляет тело запроса для назначения флера пользователю модератором.
+type AssignUserFlairRequest struct {
+	TemplateID *uuid.UUID `json:"templateId"`
+	Text       string     `json:"text" binding:"max=64"`
+	Color      string     `json:"color" binding:"omitempty,hexcolor"`
+}
+
+// Представляет флер автора в группе.
+type AuthorFlairDTO struct {
+	Text  string `json:"text"`
+	Color string `json:"color"`
+}
+
+// wiki.go
+// Представляет краткую информацию о странице вики.
+type WikiPageSummaryDTO struct {
+	Path           string    `json:"path"`
+	EditPermission string    `json:"editPermission"`
+	RevisionCount  int       `json:"revisionCount"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// Представляет DTO для ревизии страницы вики.
+type WikiRevisionDTO struct {
+	ID             uuid.UUID  `json:"id"`
+	Number         int        `json:"number"`
+	AuthorID       uuid.UUID  `json:"authorId"`
+	AuthorNickname string     `json:"authorNickname"`
+	Reason         string     `json:"reason"`
+	RevertedToID   *uuid.UUID `json:"revertedToId"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+// Представляет DTO для страницы вики.
+type WikiPageDTO struct {
+	ID             uuid.UUID       `json:"id"`
+	Path           string          `json:"path"`
+	Content        string          `json:"content"`
+	EditPermission string          `json:"editPermission"`
+	Revision       WikiRevisionDTO `json:"revision"`
+	CanEdit        bool            `json:"canEdit"`
+	UpdatedAt      time.Time       `json:"updatedAt"`
+}
+
+// Представляет тело запроса для изменения страницы вики.
+type EditWikiPageRequest struct {
+	Content        string     `json:"content" binding:"required,max=100000"`
+	Reason         string     `json:"reason" binding:"max=255"`
+	BaseRevisionID *uuid.UUID `json:"baseRevisionId"`
+}
+
+// Представляет тело запроса для отката страницы вики.
+type RevertWikiPageRequest struct {
+	RevisionID uuid.UUID `json:"revisionId" binding:"required"`
+	Reason     string    `json:"reason" binding:"max=255"`
+}
+
+// Представляет тело запроса для изменения прав на редактирование страницы вики.
+type WikiPermissionRequest struct {
+	EditPermission string `json:"editPermission" binding:"required,oneof=moderators contributors everyone"`
+}
+
+// Представляет ответ с ревизиями страницы вики с пагинацией.
+type PaginatedWikiRevisionsResponse struct {
+	Revisions  []WikiRevisionDTO `json:"revisions"`
+	Page       int               `json:"page"`
+	Limit      int               `json:"limit"`
+	TotalCount int64             `json:"totalCount"`
+}
+
+// Представляет разницу между двумя ревизиями страницы вики.
+type WikiDiffDTO struct {
+	From      *WikiRevisionDTO `json:"from"`
+	To        WikiRevisionDTO  `json:"to"`
+	Diff      string           `json:"diff"`
+	Additions int              `json:"additions"`
+	Deletions int              `json:"deletions"`
+}
+
+// Представляет одобренного участника вики.
+type WikiContributorDTO struct {
+	UserID    uuid.UUID `json:"userId"`
+	Nickname  string    `json:"nickname"`
+	AddedByID uuid.UUID `json:"addedById"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// modmail.go
+// Представляет тело запроса для обращения к модераторам группы.
+type CreateModmailRequest struct {
+	Subject string     `json:"subject" binding:"required,max=200"`
+	Body    string     `json:"body" binding:"required,max=10000"`
+	UserID  *uuid.UUID `json:"userId"`
+}
+
+// Представляет тело запроса для ответа в переписке с модераторами.
+type ModmailReplyRequest struct {
+	Body     string `json:"body" binding:"required,max=10000"`
+	Internal bool   `json:"internal"`
+}
+
+// Представляет тело запроса для изменения состояния переписки с модераторами.
+type UpdateModmailStateRequest struct {
+	Archived    *bool `json:"archived"`
+	Highlighted *bool `json:"highlighted"`
+}
+
+// Представляет DTO для переписки с модераторами.
+type ModmailThreadDTO struct {
+	ID            uuid.UUID `json:"id"`
+	GroupID       uuid.UUID `json:"groupId"`
+	UserID        uuid.UUID `json:"userId"`
+	UserNickname  string    `json:"userNickname"`
+	Subject       string    `json:"subject"`
+	Archived      bool      `json:"archived"`
+	Highlighted   bool      `json:"highlighted"`
+	Unread        bool      `json:"unread"`
+	LastMessageAt time.Time `json:"lastMessageAt"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// Представляет DTO для сообщения в переписке с модераторами.
+type ModmailMessageDTO struct {
+	ID             uuid.UUID `json:"id"`
+	AuthorID       uuid.UUID `json:"authorId"`
+	AuthorNickname string    `json:"authorNickname"`
+	Body           string    `json:"body"`
+	FromModerator  bool      `json:"fromModerator"`
+	Internal       bool      `json:"internal"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// Представляет переписку с модераторами вместе с сообщениями.
+type ModmailThreadDetailDTO struct {
+	ModmailThreadDTO
+	Messages []ModmailMessageDTO `json:"messages"`
+}
+
+// Представляет ответ с переписками с модераторами с пагинацией.
+type PaginatedModmailThreadsResponse struct {
+	Threads    []ModmailThreadDTO `json:"threads"`
+	Page       int                `json:"page"`
+	Limit      int                `json:"limit"`
+	TotalCount int64              `json:"totalCount"`
+}
+
+// Представляет число непрочитанных переписок с модераторами.
+type ModmailUnreadDTO struct {
+	UserThreads      int64 `json:"userThreads"`
+	ModeratorThreads int64 `json:"moderatorThreads"`
+}
+
+// blocks.go
+// Представляет заблокированного пользователя.
+type UserBlockDTO struct {
+	UserID    uuid.UUID `json:"userId"`
+	Nickname  string    `json:"nickname"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// messages.go
+// Представляет тело запроса для создания диалога.
+type CreateConversationRequest struct {
+	ParticipantIDs []uuid.UUID `json:"participantIds" binding:"required,min=1"`
+	Title          string      `json:"title" binding:"max=100"`
+	Body           string      `json:"body" binding:"max=10000"`
+}
+
+// Представляет участника диалога с отметкой о прочтении.
+type ConversationMemberDTO struct {
+	UserID            uuid.UUID  `json:"userId"`
+	Nickname          string     `json:"nickname"`
+	LastReadAt        *time.Time `json:"lastReadAt"`
+	LastReadMessageID *uuid.UUID `json:"lastReadMessageId"`
+}
+
+// Представляет DTO для диалога.
+type ConversationDTO struct {
+	ID            uuid.UUID               `json:"id"`
+	Title         string                  `json:"title"`
+	IsGroup       bool                    `json:"isGroup"`
+	Muted         bool                    `json:"muted"`
+	UnreadCount   int64                   `json:"unreadCount"`
+	Members       []ConversationMemberDTO `json:"members"`
+	LastMessageAt time.Time               `json:"lastMessageAt"`
+	CreatedAt     time.Time               `json:"createdAt"`
+}
+
+// Представляет страницу диалогов.
+type ConversationsPageResponse struct {
+	Conversations []ConversationDTO `json:"conversations"`
+	NextCursor    string            `json:"nextCursor,omitempty"`
+}
+
+// Представляет DTO для личного сообщения.
+type DirectMessageDTO struct {
+	ID             uuid.UUID   `json:"id"`
+	ConversationID uuid.UUID   `json:"conversationId"`
+	SenderID       uuid.UUID   `json:"senderId"`
+	SenderNickname string      `json:"senderNickname"`
+	Body           string      `json:"body"`
+	ReadBy         []uuid.UUID `json:"readBy"`
+	CreatedAt      time.Time   `json:"createdAt"`
+}
+
+// Представляет страницу сообщений диалога.
+type DirectMessagesPageResponse struct {
+	Messages   []DirectMessageDTO `json:"messages"`
+	NextCursor string             `json:"nextCursor,omitempty"`
+}
+
+// Представляет тело запроса для отправки личного сообщения.
+type SendDirectMessageRequest struct {
+	Body string `json:"body" binding:"required,max=10000"`
+}
+
+// Представляет тело запроса для отметки диалога прочитанным.
+type MarkConversationReadRequest struct {
+	MessageID *uuid.UUID `json:"messageId"`
+}
+
+// Представляет тело запроса для отключения уведомлений диалога.
+type MuteConversationRequest struct {
+	Muted bool `json:"muted"`
+}
+
+// Представляет число непрочитанных личных сообщений.
+type UnreadMessagesDTO struct {
+	Conversations int64 `json:"conversations"`
+	Messages      int64 `json:"messages"`
+}
+
+// realtime.go
+// Представляет событие изменения рейтинга поста или комментария.
+type VoteEventDTO struct {
+	PostID     uuid.UUID  `json:"postId"`
+	CommentID  *uuid.UUID `json:"commentId,omitempty"`
+	Reputation int        `json:"reputation"`
+}
+
+// notifications.go
+// Представляет DTO для уведомления.
+type NotificationDTO struct {
+	ID            uuid.UUID  `json:"id"`
+	Type          string     `json:"type"`
+	ActorID       *uuid.UUID `json:"actorId"`
+	ActorNickname string     `json:"actorNickname,omitempty"`
+	GroupID       *uuid.UUID `json:"groupId"`
+	PostID        *uuid.UUID `json:"postId"`
+	CommentID     *uuid.UUID `json:"commentId"`
+	Message       string     `json:"message"`
+	Read          bool       `json:"read"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+// Представляет ответ с уведомлениями с пагинацией.
+type PaginatedNotificationsResponse struct {
+	Notifications []NotificationDTO `json:"notifications"`
+	Page          int               `json:"page"`
+	Limit         int               `json:"limit"`
+	TotalCount    int64             `json:"totalCount"`
+	UnreadCount   int64             `json:"unreadCount"`
+}
+
+// references.go
+// Представляет ссылку на пользователя или группу в тексте. Смещение и длина указаны в символах.
+type ContentEntityDTO struct {
+	Type   string    `json:"type"`
+	ID     uuid.UUID `json:"id"`
+	Text   string    `json:"text"`
+	Offset int       `json:"offset"`
+	Length int       `json:"length"`
+}
+
+// linkpreview.go
+// Представляет превью ссылки. Пока превью не загружено, status равен pending.
+type LinkPreviewDTO struct {
+	URL         string     `json:"url"`
+	Status      string     `json:"status"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	SiteName    string     `json:"siteName"`
+	// Копия изображения на нашем сервере; пусто, пока копия не сохранена.
+	ImageURL    string     `json:"imageUrl"`
+	Type        string     `json:"type"`
+	FetchedAt   *time.Time `json:"fetchedAt"`
+}
+
+// media.go
+// Представляет загруженный файл. ID передаётся в mediaIds поста или как баннер.
+type MediaDTO struct {
+	ID               uuid.UUID         `json:"id"`
+	URL              string            `json:"url"`
+	ContentType      string            `json:"contentType"`
+	Size             int64             `json:"size"`
+	Width            int               `json:"width"`
+	Height           int               `json:"height"`
+	Blurhash         string            `json:"blurhash"`
+	ProcessingStatus string            `json:"processingStatus"`
+	Variants         []MediaVariantDTO `json:"variants"`
+	CreatedAt        time.Time         `json:"createdAt"`
+}
+
+// Представляет уменьшенную копию изображения. Для каждого размера (small, medium, large) есть копия в JPEG,
+// а для изображений с прозрачностью — в PNG. Копия в WebP добавляется, если она меньше. Пока изображение обрабатывается, список пуст.
+type MediaVariantDTO struct {
+	Name        string `json:"name"`
+	Format      string `json:"format"`
+	URL         string `json:"url"`
+	ContentType string `json:"contentType"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Size        int64  `json:"size"`
+}
+
+// Представляет тело запроса для начала возобновляемой загрузки.
+type CreateUploadRequest struct {
+	Size     int64  `json:"size" binding:"required,min=1"`
+	Filename string `json:"filename" binding:"max=255"`
+}
+
+// Представляет состояние возобновляемой загрузки. После завершения media содержит загруженный файл.
+type MediaUploadDTO struct {
+	ID     uuid.UUID `json:"id"`
+	Size   int64     `json:"size"`
+	Offset int64     `json:"offset"`
+	Status string    `json:"status"`
+	Media  *MediaDTO `json:"media"`
+}
+
+// imagehash.go
+// Представляет запрещённое изображение. Без groupId запрет действует на всём сайте. Хеши указаны в шестнадцатеричном виде.
+type BannedImageDTO struct {
+	ID         uuid.UUID  `json:"id"`
+	GroupID    *uuid.UUID `json:"groupId"`
+	PHash      string     `json:"pHash"`
+	DHash      string     `json:"dHash"`
+	MediaID    *uuid.UUID `json:"mediaId"`
+	PostID     *uuid.UUID `json:"postId"`
+	BannedByID uuid.UUID  `json:"bannedById"`
+	Reason     string     `json:"reason"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// Представляет тело запроса для запрета изображения. Указывается либо пост, либо загруженный файл.
+type BanImageRequest struct {
+	PostID  *uuid.UUID `json:"postId"`
+	MediaID *uuid.UUID `json:"mediaId"`
+	Reason  string     `json:"reason" binding:"max=500"`
+}
+
+// polls.go
+// Представляет опрос в запросе на создание поста.
+type CreatePollRequest struct {
+	Options        []string  `json:"options" binding:"required,min=2,max=10,dive,max=200"`
+	MultipleChoice bool      `json:"multipleChoice"`
+	ClosesAt       time.Time `json:"closesAt" binding:"required"`
+}
+
+// Представляет тело запроса для голосования в опросе.
+type PollVoteRequest struct {
+	OptionIDs []uuid.UUID `json:"optionIds" binding:"required,min=1,max=10"`
+}
+
+// Представляет DTO для опроса. Число голосов не передаётся, пока пользователь не проголосовал или опрос не закрылся.
+type PollDTO struct {
+	MultipleChoice bool            `json:"multipleChoice"`
+	ClosesAt       time.Time       `json:"closesAt"`
+	Closed         bool            `json:"closed"`
+	Voted          bool            `json:"voted"`
+	ResultsVisible bool            `json:"resultsVisible"`
+	Voters         *int            `json:"voters"`
+	Options        []PollOptionDTO `json:"options"`
+}
+
+// Представляет вариант ответа опроса.
+type PollOptionDTO struct {
+	ID       uuid.UUID `json:"id"`
+	Text     string    `json:"text"`
+	Votes    *int      `json:"votes"`
+	Selected bool      `json:"selected"`
+}
+
+// revisions.go
+// Представляет версию поста или комментария и её отличия от предыдущей версии.
+type ContentRevisionDTO struct {
+	ID             uuid.UUID `json:"id"`
+	Number         int       `json:"number"`
+	EditorID       uuid.UUID `json:"editorId"`
+	EditorNickname string    `json:"editorNickname"`
+	Content        string    `json:"content"`
+	MediaUrls      []string  `json:"mediaUrls"`
+	Diff           string    `json:"diff"`
+	Additions      int       `json:"additions"`
+	Deletions      int       `json:"deletions"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// Представляет историю правок с пагинацией.
+type PaginatedRevisionsResponse struct {
+	Revisions  []ContentRevisionDTO `json:"revisions"`
+	Page       int                  `json:"page"`
+	Limit      int                  `json:"limit"`
+	TotalCount int64                `json:"totalCount"`
+}
+
+// saved.go
+// Представляет тело запроса для сохранения поста или комментария. Без коллекции элемент попадает только в общий список.
+type SaveItemRequest struct {
+	CollectionID *uuid.UUID `json:"collectionId"`
+}
+
+// Представляет сохранённый пост или комментарий.
+type SavedItemDTO struct {
+	ID           uuid.UUID   `json:"id"`
+	Type         string      `json:"type"`
+	CollectionID *uuid.UUID  `json:"collectionId"`
+	SavedAt      time.Time   `json:"savedAt"`
+	Post         *PostDTO    `json:"post,omitempty"`
+	Comment      *CommentDTO `json:"comment,omitempty"`
+}
+
+// Представляет сохранённое с пагинацией.
+type PaginatedSavedResponse struct {
+	Items      []SavedItemDTO `json:"items"`
+	Page       int            `json:"page"`
+	Limit      int            `json:"limit"`
+	TotalCount int64          `json:"totalCount"`
+}
+
+// Представляет тело запроса для создания или переименования коллекции сохранённого.
+type SavedCollectionRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// Представляет коллекцию сохранённого.
+type SavedCollectionDTO struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	ItemCount int64     `json:"itemCount"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// filters.go
+// Представляет заглушённую группу.
+type MutedGroupDTO struct {
+	GroupID   uuid.UUID `json:"groupId"`
+	GroupName string    `json:"groupName"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Представляет заглушённого пользователя.
+type MutedUserDTO struct {
+	UserID    uuid.UUID `json:"userId"`
+	Nickname  string    `json:"nickname"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Представляет заглушённые группы и пользователей.
+type MutesDTO struct {
+	Groups []MutedGroupDTO `json:"groups"`
+	Users  []MutedUserDTO  `json:"users"`
+}
+
+// Представляет тело запроса для добавления фильтра по ключевому слову.
+type CreateContentFilterRequest struct {
+	Keyword string `json:"keyword" binding:"required,max=100"`
+}
+
+// Представляет фильтр по ключевому слову.
+type ContentFilterDTO struct {
+	ID        uuid.UUID `json:"id"`
+	Keyword   string    `json:"keyword"`
+	CreatedAt time.Time `json:"createdAt"`
+}
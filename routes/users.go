@@ -89,10 +89,19 @@ func updateUserProfileHandler(c *gin.Context, db *gorm.DB) {
 	}
 
 	if req.Nickname != nil {
+		if isReservedNickname(*req.Nickname) && *req.Nickname != user.Nickname {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "This nickname is reserved"})
+			return
+		}
 		user.Nickname = *req.Nickname
 	}
-	if req.BannerURL != nil {
-		user.BannerURL = *req.BannerURL
+	if req.BannerMediaID != nil {
+		bannerURL, errMsg := bannerURLFor(db, user.ID, *req.BannerMediaID)
+		if errMsg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+			return
+		}
+		user.BannerURL = bannerURL
 	}
 	if req.Password != nil {
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
@@ -156,7 +165,79 @@ func RegisterUserRoutes(r *gin.RouterGroup, db *gorm.DB) {
 		updateUserProfileHandler(c, db)
 	})
 
+	r.DELETE("/me", JWTMiddleware(), func(c *gin.Context) {
+		deleteAccountHandler(c, db)
+	})
+
 	r.GET("/:id", func(c *gin.Context) {
 		getPublicUserProfileHandler(c, db)
 	})
+
+	r.GET("/me/blocks", JWTMiddleware(), func(c *gin.Context) {
+		listBlockedUsersHandler(c, db)
+	})
+
+	r.GET("/me/saved", JWTMiddleware(), func(c *gin.Context) {
+		listSavedHandler(c, db)
+	})
+
+	r.GET("/me/saved/collections", JWTMiddleware(), func(c *gin.Context) {
+		listSavedCollectionsHandler(c, db)
+	})
+
+	r.POST("/me/saved/collections", JWTMiddleware(), func(c *gin.Context) {
+		createSavedCollectionHandler(c, db)
+	})
+
+	r.PATCH("/me/saved/collections/:id", JWTMiddleware(), func(c *gin.Context) {
+		renameSavedCollectionHandler(c, db)
+	})
+
+	r.DELETE("/me/saved/collections/:id", JWTMiddleware(), func(c *gin.Context) {
+		deleteSavedCollectionHandler(c, db)
+	})
+
+	r.PUT("/:id/block", JWTMiddleware(), func(c *gin.Context) {
+		blockUserHandler(c, db)
+	})
+
+	r.DELETE("/:id/block", JWTMiddleware(), func(c *gin.Context) {
+		unblockUserHandler(c, db)
+	})
+
+	r.GET("/me/hidden", JWTMiddleware(), func(c *gin.Context) {
+		listHiddenPostsHandler(c, db)
+	})
+
+	r.GET("/me/mutes", JWTMiddleware(), func(c *gin.Context) {
+		listMutesHandler(c, db)
+	})
+
+	r.GET("/me/filters", JWTMiddleware(), func(c *gin.Context) {
+		listContentFiltersHandler(c, db)
+	})
+
+	r.POST("/me/filters", JWTMiddleware(), func(c *gin.Context) {
+		createContentFilterHandler(c, db)
+	})
+
+	r.DELETE("/me/filters/:id", JWTMiddleware(), func(c *gin.Context) {
+		deleteContentFilterHandler(c, db)
+	})
+
+	r.POST("/me/subscriptions", JWTMiddleware(), func(c *gin.Context) {
+		followUserHandler(c, db)
+	})
+
+	r.DELETE("/me/subscriptions/:id", JWTMiddleware(), func(c *gin.Context) {
+		unfollowUserHandler(c, db)
+	})
+
+	r.PUT("/:id/mute", JWTMiddleware(), func(c *gin.Context) {
+		muteUserHandler(c, db)
+	})
+
+	r.DELETE("/:id/mute", JWTMiddleware(), func(c *gin.Context) {
+		unmuteUserHandler(c, db)
+	})
 }
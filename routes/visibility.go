@@ -0,0 +1,76 @@
+package routes
+
+import (
+	"slices"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+// Статусы модерации, при которых контент не показывается в лентах.
+var hiddenModStatuses = []string{models.ContentRemoved, models.ContentFiltered}
+
+// Ограничивает выборку постами, которые видит пользователь: без скрытых модераторами,
+// без постов удалённых групп, без постов теневых банов, кроме собственных, и без постов заблокированных им пользователей.
+func visiblePosts(viewerID *uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = hideDeletedGroups(db.Where("posts.mod_status NOT IN ?", hiddenModStatuses))
+		return hideBlocked(hideShadowBanned(db, "posts.author_id", viewerID), "posts.author_id", viewerID)
+	}
+}
+
+// Ограничивает выборку постом, который можно открыть по ссылке: удалённые посты остаются заглушками,
+// а скрытые модераторами проверяет canViewModeratedPost.
+func viewablePost(viewerID *uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = hideDeletedGroups(db.Unscoped())
+		return hideBlocked(hideShadowBanned(db, "posts.author_id", viewerID), "posts.author_id", viewerID)
+	}
+}
+
+// Скрытый модераторами пост доступен только автору и модераторам его группы.
+func canViewModeratedPost(db *gorm.DB, post models.Post, viewerID *uuid.UUID) bool {
+	if !slices.Contains(hiddenModStatuses, post.ModStatus) {
+		return true
+	}
+	if viewerID == nil {
+		return false
+	}
+	return post.AuthorID == *viewerID || post.GroupID != nil && isGroupModerator(db, *post.GroupID, *viewerID)
+}
+
+// Ограничивает выборку комментариями, которые видит пользователь.
+func visibleComments(viewerID *uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Where("comments.mod_status NOT IN ?", hiddenModStatuses)
+		return hideBlocked(hideShadowBanned(db, "comments.author_id", viewerID), "comments.author_id", viewerID)
+	}
+}
+
+// Как visibleComments, но вместе с удалёнными комментариями, из которых строятся заглушки в дереве.
+func visibleCommentTree(viewerID *uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return visibleComments(viewerID)(db.Unscoped())
+	}
+}
+
+func hideDeletedGroups(db *gorm.DB) *gorm.DB {
+	return db.Where("(posts.group_id IS NULL OR posts.group_id NOT IN (SELECT id FROM groups WHERE deleted_at IS NOT NULL))")
+}
+
+func hideShadowBanned(db *gorm.DB, authorColumn string, viewerID *uuid.UUID) *gorm.DB {
+	shadowBanned := "SELECT id FROM users WHERE shadow_banned = true"
+	if viewerID != nil {
+		return db.Where("("+authorColumn+" NOT IN ("+shadowBanned+") OR "+authorColumn+" = ?)", *viewerID)
+	}
+	return db.Where(authorColumn + " NOT IN (" + shadowBanned + ")")
+}
+
+func hideBlocked(db *gorm.DB, authorColumn string, viewerID *uuid.UUID) *gorm.DB {
+	if viewerID == nil {
+		return db
+	}
+	return db.Where(authorColumn+" NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = ?)", *viewerID)
+}
@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"chirp/models"
+)
+
+func TestRemovedPostIsVisibleOnlyToAuthorAndGroupModerators(t *testing.T) {
+	author, moderator, stranger := uuid.New(), uuid.New(), uuid.New()
+	groupID := uuid.New()
+	post := models.Post{ID: uuid.New(), AuthorID: author, GroupID: &groupID, Content: "Removed text", ModStatus: models.ContentRemoved}
+	comment := models.Comment{ID: uuid.New(), PostID: post.ID, AuthorID: stranger, Content: "Reply under a removed post"}
+
+	for _, tc := range []struct {
+		name   string
+		viewer *uuid.UUID
+		want   int
+	}{
+		{"anonymous", nil, http.StatusNotFound},
+		{"stranger", &stranger, http.StatusNotFound},
+		{"author", &author, http.StatusOK},
+		{"group moderator", &moderator, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newStubDB(t)
+			db.returning(`SELECT * FROM "posts" WHERE`, post)
+			db.returning(`SELECT "id","author_id","group_id","mod_status" FROM "posts"`, post)
+			db.returning(`FROM "comments" WHERE`, []models.Comment{comment})
+			db.returning(`FROM "group_moderators" WHERE group_id = '`+groupID.String()+`' AND user_id = '`+moderator.String()+`'`, int64(1))
+
+			detail := serve(db.DB, http.MethodGet, "/posts/:id", "/posts/"+post.ID.String(), "", tc.viewer, getPostDetailHandler)
+			if detail.Code != tc.want {
+				t.Errorf("post detail: status %d, want %d; body %s", detail.Code, tc.want, detail.Body)
+			}
+			comments := serve(db.DB, http.MethodGet, "/posts/:id/comments", "/posts/"+post.ID.String()+"/comments", "", tc.viewer, getCommentsForPostHandler)
+			if comments.Code != tc.want {
+				t.Errorf("comment list: status %d, want %d; body %s", comments.Code, tc.want, comments.Body)
+			}
+			if leaked := strings.Contains(detail.Body.String()+comments.Body.String(), comment.Content); leaked != (tc.want == http.StatusOK) {
+				t.Errorf("comment shown = %v, want %v", leaked, tc.want == http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestCommentListChecksThePost(t *testing.T) {
+	db := newStubDB(t)
+	postID := uuid.New()
+	db.returning(`FROM "comments" WHERE`, []models.Comment{{ID: uuid.New(), PostID: postID, AuthorID: uuid.New(), Content: "Orphaned reply"}})
+
+	// The post query finds nothing, as for a post of a deleted group.
+	w := serve(db.DB, http.MethodGet, "/posts/:id/comments", "/posts/"+postID.String()+"/comments", "", nil, getCommentsForPostHandler)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status %d, want 404; body %s", w.Code, w.Body)
+	}
+	queries := db.recorder.matching(`SELECT "id","author_id","group_id","mod_status" FROM "posts"`)
+	if len(queries) != 1 || !strings.Contains(queries[0], "SELECT id FROM groups WHERE deleted_at IS NOT NULL") {
+		t.Errorf("post lookup does not hide deleted groups: %v", queries)
+	}
+}
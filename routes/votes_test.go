@@ -0,0 +1,94 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+func TestVotesCheckBlocks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for path, handler := range map[string]func(*gin.Context, *gorm.DB){
+		"/posts/:id/vote":    votePostHandler,
+		"/comments/:id/vote": voteCommentHandler,
+	} {
+		t.Run(path, func(t *testing.T) {
+			db, recorder := dryRunDB(t)
+			r := gin.New()
+			r.POST(path, func(c *gin.Context) {
+				c.Set("userId", uuid.New())
+				handler(c, db)
+			})
+			target := strings.Replace(path, ":id", uuid.New().String(), 1)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"value":1}`)))
+
+			if len(recorder.matching(`SELECT count(*) FROM "user_blocks"`)) != 1 {
+				t.Errorf("vote did not check blocks between the voter and the author: %v", recorder.statements)
+			}
+		})
+	}
+}
+
+func TestBlockedUsersCannotVoteOnEachOther(t *testing.T) {
+	voter, author := uuid.New(), uuid.New()
+	post := models.Post{ID: uuid.New(), AuthorID: author}
+
+	for _, tc := range []struct {
+		name       string
+		blocked    bool
+		wantStatus int
+	}{
+		{"no block", false, http.StatusOK},
+		{"blocked", true, http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newStubDB(t)
+			db.returning(`FROM "posts" WHERE id = '`+post.ID.String()+`'`, post)
+			if tc.blocked {
+				db.returning(`FROM "user_blocks" WHERE (blocker_id = '`+voter.String()+`' AND blocked_id = '`+author.String()+`')`, int64(1))
+			}
+
+			w := serve(db.DB, http.MethodPost, "/posts/:id/vote", "/posts/"+post.ID.String()+"/vote", `{"value":1}`, &voter, votePostHandler)
+			if w.Code != tc.wantStatus {
+				t.Fatalf("status %d, want %d; body %s", w.Code, tc.wantStatus, w.Body)
+			}
+			counted := len(db.recorder.matching(`UPDATE "posts"`)) > 0
+			if counted == tc.blocked {
+				t.Errorf("vote counted = %v with block = %v", counted, tc.blocked)
+			}
+		})
+	}
+}
+
+func TestBlockUserEndsSubscriptionsBothWays(t *testing.T) {
+	blocker, target := uuid.New(), uuid.New()
+	db := newStubDB(t)
+	db.returning(`FROM "users" WHERE id = '`+target.String()+`'`, models.User{ID: target})
+
+	w := serve(db.DB, http.MethodPut, "/users/:id/block", "/users/"+target.String()+"/block", "", &blocker, blockUserHandler)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status %d, body %s", w.Code, w.Body)
+	}
+	if len(db.recorder.matching(`INSERT INTO "user_blocks"`)) != 1 {
+		t.Errorf("block was not stored: %v", db.recorder.statements)
+	}
+	deletes := db.recorder.matching(`DELETE FROM user_subscriptions`)
+	if len(deletes) != 1 || !strings.Contains(deletes[0], "(subscriber_id = '"+target.String()+"' AND target_user_id = '"+blocker.String()+"')") {
+		t.Errorf("subscriptions were not ended in both directions: %v", deletes)
+	}
+
+	db.returning(`FROM "users" WHERE id = '`+blocker.String()+`'`, models.User{ID: blocker})
+	self := serve(db.DB, http.MethodPut, "/users/:id/block", "/users/"+blocker.String()+"/block", "", &blocker, blockUserHandler)
+	if self.Code != http.StatusBadRequest {
+		t.Errorf("blocking yourself: status %d, want 400", self.Code)
+	}
+}
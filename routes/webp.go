@@ -0,0 +1,547 @@
+package routes
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+)
+
+// Lossless WebP (VP8L) encoder. The standard library and x/image only decode WebP, so variants are
+// written here with the subtract-green and gradient predictor transforms, LZ77 backward references
+// and one set of prefix codes for the whole image.
+
+const (
+	vp8lMaxDimension   = 1 << 14
+	vp8lGreenAlphabet  = 256 + 24
+	vp8lDistAlphabet   = 40
+	vp8lMaxCodeLength  = 15
+	vp8lMaxCLLength    = 7
+	vp8lMaxMatch       = 4096
+	vp8lMinMatch       = 3
+	vp8lMaxDistance    = 1<<20 - 120
+	vp8lChainDepth     = 16
+	vp8lPredictorBits  = 9
+	vp8lGradientMode   = 12
+	vp8lSubtractGreen  = 2
+	vp8lPredictorXform = 0
+)
+
+var errImageTooLarge = errors.New("image is too large for WebP")
+
+var vp8lCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+type vp8lBitWriter struct {
+	buf  []byte
+	acc  uint64
+	used uint
+}
+
+func (w *vp8lBitWriter) write(value uint32, bits uint) {
+	w.acc |= uint64(value) << w.used
+	w.used += bits
+	for w.used >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.used -= 8
+	}
+}
+
+func (w *vp8lBitWriter) bytes() []byte {
+	if w.used > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.used = 0, 0
+	}
+	return w.buf
+}
+
+// A literal pixel, or a copy of length pixels from distCode back (as a VP8L plane code).
+type vp8lToken struct {
+	argb     uint32
+	length   int
+	distCode int
+}
+
+type vp8lPrefixCode struct {
+	lengths []uint8
+	codes   []uint16
+}
+
+// Кодирует изображение в WebP без потерь.
+func encodeWebP(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > vp8lMaxDimension || height > vp8lMaxDimension {
+		return errImageTooLarge
+	}
+
+	pixels, hasAlpha := argbPixels(img)
+	for i, p := range pixels {
+		green := (p >> 8) & 0xff
+		red := ((p>>16)&0xff - green) & 0xff
+		blue := (p&0xff - green) & 0xff
+		pixels[i] = p&0xff00ff00 | red<<16 | blue
+	}
+	residuals := gradientResiduals(pixels, width, height)
+	tokens := backwardReferences(residuals, width)
+
+	bw := &vp8lBitWriter{}
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if hasAlpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3)
+
+	// Transforms are undone in reverse order, so the predictor listed last is inverted first.
+	bw.write(1, 1)
+	bw.write(vp8lSubtractGreen, 2)
+	bw.write(1, 1)
+	bw.write(vp8lPredictorXform, 2)
+	bw.write(vp8lPredictorBits-2, 3)
+	// Every block uses the same mode, so the predictor sub-image costs no bits per pixel.
+	bw.write(0, 1)
+	writeSimpleCode(bw, []int{vp8lGradientMode})
+	for i := 0; i < 4; i++ {
+		writeSimpleCode(bw, []int{0})
+	}
+	bw.write(0, 1)
+
+	// Main image without a color cache or meta prefix codes.
+	bw.write(0, 1)
+	bw.write(0, 1)
+
+	green := make([]int, vp8lGreenAlphabet)
+	red := make([]int, 256)
+	blue := make([]int, 256)
+	alpha := make([]int, 256)
+	dist := make([]int, vp8lDistAlphabet)
+	for _, token := range tokens {
+		if token.length == 0 {
+			green[(token.argb>>8)&0xff]++
+			red[(token.argb>>16)&0xff]++
+			blue[token.argb&0xff]++
+			alpha[token.argb>>24]++
+			continue
+		}
+		lengthSymbol, _, _ := vp8lPrefixEncode(token.length)
+		green[256+lengthSymbol]++
+		distSymbol, _, _ := vp8lPrefixEncode(token.distCode)
+		dist[distSymbol]++
+	}
+	codes := make([]vp8lPrefixCode, 5)
+	for i, histogram := range [][]int{green, red, blue, alpha, dist} {
+		codes[i] = writePrefixCode(bw, histogram)
+	}
+
+	for _, token := range tokens {
+		if token.length == 0 {
+			writeSymbol(bw, codes[0], int((token.argb>>8)&0xff))
+			writeSymbol(bw, codes[1], int((token.argb>>16)&0xff))
+			writeSymbol(bw, codes[2], int(token.argb&0xff))
+			writeSymbol(bw, codes[3], int(token.argb>>24))
+			continue
+		}
+		symbol, extraBits, extra := vp8lPrefixEncode(token.length)
+		writeSymbol(bw, codes[0], 256+symbol)
+		bw.write(uint32(extra), uint(extraBits))
+		symbol, extraBits, extra = vp8lPrefixEncode(token.distCode)
+		writeSymbol(bw, codes[4], symbol)
+		bw.write(uint32(extra), uint(extraBits))
+	}
+
+	data := bw.bytes()
+	padding := len(data) & 1
+	header := make([]byte, 20)
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], uint32(12+len(data)+padding))
+	copy(header[8:16], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:20], uint32(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if padding == 1 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+// Returns non-premultiplied ARGB pixels and whether any of them is not fully opaque.
+func argbPixels(img image.Image) ([]uint32, bool) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	pixels := make([]uint32, width*height)
+	hasAlpha := false
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var c color.NRGBA
+			switch src := img.(type) {
+			case *image.NRGBA:
+				offset := src.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)
+				c = color.NRGBA{src.Pix[offset], src.Pix[offset+1], src.Pix[offset+2], src.Pix[offset+3]}
+			case *image.RGBA:
+				offset := src.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)
+				c = color.NRGBAModel.Convert(color.RGBA{src.Pix[offset], src.Pix[offset+1], src.Pix[offset+2], src.Pix[offset+3]}).(color.NRGBA)
+			default:
+				c = color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			}
+			if c.A != 0xff {
+				hasAlpha = true
+			}
+			pixels[y*width+x] = uint32(c.A)<<24 | uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+		}
+	}
+	return pixels, hasAlpha
+}
+
+// Subtracts the gradient prediction (L + T - TL, clamped per channel) from every pixel.
+// The first pixel is predicted as opaque black, the top row from L and the left column from T.
+func gradientResiduals(pixels []uint32, width, height int) []uint32 {
+	residuals := make([]uint32, len(pixels))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			var predicted uint32
+			switch {
+			case x == 0 && y == 0:
+				predicted = 0xff000000
+			case y == 0:
+				predicted = pixels[i-1]
+			case x == 0:
+				predicted = pixels[i-width]
+			default:
+				predicted = clampAddSubtract(pixels[i-1], pixels[i-width], pixels[i-width-1])
+			}
+			residuals[i] = subtractPixels(pixels[i], predicted)
+		}
+	}
+	return residuals
+}
+
+func clampAddSubtract(left, top, topLeft uint32) uint32 {
+	var result uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		value := int(left>>shift&0xff) + int(top>>shift&0xff) - int(topLeft>>shift&0xff)
+		value = min(max(value, 0), 255)
+		result |= uint32(value) << shift
+	}
+	return result
+}
+
+func subtractPixels(a, b uint32) uint32 {
+	var result uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		result |= ((a>>shift - b>>shift) & 0xff) << shift
+	}
+	return result
+}
+
+// Greedy LZ77 over hash chains of pixel pairs. The pixel to the left and the one above
+// are always tried, since they are the cheapest distances to code.
+func backwardReferences(pixels []uint32, width int) []vp8lToken {
+	const hashBits = 16
+	head := make([]int32, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	chain := make([]int32, len(pixels))
+	hash := func(i int) uint32 {
+		return (pixels[i]*0x1e35a7bd ^ pixels[i+1]*0x9e3779b1) >> (32 - hashBits)
+	}
+	insert := func(i int) {
+		if i+1 < len(pixels) {
+			h := hash(i)
+			chain[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+	matchLength := func(i, candidate int) int {
+		limit := min(len(pixels)-i, vp8lMaxMatch)
+		n := 0
+		for n < limit && pixels[candidate+n] == pixels[i+n] {
+			n++
+		}
+		return n
+	}
+
+	tokens := make([]vp8lToken, 0, len(pixels)/2)
+	for i := 0; i < len(pixels); {
+		bestLength, bestDist := 0, 0
+		for _, dist := range []int{1, width} {
+			if dist <= i {
+				if n := matchLength(i, i-dist); n > bestLength {
+					bestLength, bestDist = n, dist
+				}
+			}
+		}
+		if i+1 < len(pixels) {
+			candidate := head[hash(i)]
+			for depth := 0; candidate >= 0 && depth < vp8lChainDepth && bestLength < vp8lMaxMatch; depth++ {
+				dist := i - int(candidate)
+				if dist > vp8lMaxDistance {
+					break
+				}
+				if n := matchLength(i, int(candidate)); n > bestLength {
+					bestLength, bestDist = n, dist
+				}
+				candidate = chain[candidate]
+			}
+		}
+
+		if bestLength < vp8lMinMatch {
+			tokens = append(tokens, vp8lToken{argb: pixels[i]})
+			insert(i)
+			i++
+			continue
+		}
+		tokens = append(tokens, vp8lToken{length: bestLength, distCode: vp8lPlaneCode(bestDist, width)})
+		for end := i + bestLength; i < end; i++ {
+			insert(i)
+		}
+	}
+	return tokens
+}
+
+// Maps a distance to a plane code. Codes 1 and 2 stand for the pixel above and the one to the left;
+// other distances are coded directly, offset by the 120 plane codes.
+func vp8lPlaneCode(dist, width int) int {
+	switch dist {
+	case width:
+		return 1
+	case 1:
+		return 2
+	}
+	return dist + 120
+}
+
+// Splits a length or plane code into a prefix symbol and extra bits.
+func vp8lPrefixEncode(value int) (int, int, int) {
+	value--
+	if value < 4 {
+		return value, 0, 0
+	}
+	highest := 31
+	for value>>highest == 0 {
+		highest--
+	}
+	second := (value >> (highest - 1)) & 1
+	extraBits := highest - 1
+	symbol := 2*highest + second
+	return symbol, extraBits, value - (2+second)<<extraBits
+}
+
+// Writes a prefix code for the histogram and returns it. Codes with at most two symbols below 256
+// use the compact simple form; a single symbol then takes no bits at all.
+func writePrefixCode(bw *vp8lBitWriter, histogram []int) vp8lPrefixCode {
+	var used []int
+	for symbol, count := range histogram {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+	if len(used) == 0 {
+		used = []int{0}
+	}
+	if len(used) <= 2 && used[len(used)-1] < 256 {
+		writeSimpleCode(bw, used)
+		lengths := make([]uint8, len(histogram))
+		if len(used) == 2 {
+			lengths[used[0]], lengths[used[1]] = 1, 1
+		}
+		return canonicalCode(lengths)
+	}
+
+	code := canonicalCode(huffmanLengths(histogram, vp8lMaxCodeLength))
+	bw.write(0, 1)
+
+	// Code lengths are run-length coded: 17 and 18 stand for runs of zeros.
+	type clToken struct{ symbol, extra int }
+	var clTokens []clToken
+	clHistogram := make([]int, 19)
+	for i := 0; i < len(code.lengths); {
+		if code.lengths[i] != 0 {
+			clTokens = append(clTokens, clToken{symbol: int(code.lengths[i])})
+			clHistogram[code.lengths[i]]++
+			i++
+			continue
+		}
+		run := 1
+		for i+run < len(code.lengths) && code.lengths[i+run] == 0 && run < 138 {
+			run++
+		}
+		switch {
+		case run >= 11:
+			clTokens = append(clTokens, clToken{symbol: 18, extra: run - 11})
+			clHistogram[18]++
+		case run >= 3:
+			clTokens = append(clTokens, clToken{symbol: 17, extra: run - 3})
+			clHistogram[17]++
+		default:
+			run = 1
+			clTokens = append(clTokens, clToken{symbol: 0})
+			clHistogram[0]++
+		}
+		i += run
+	}
+
+	clCode := canonicalCode(huffmanLengths(clHistogram, vp8lMaxCLLength))
+	count := 4
+	for i, symbol := range vp8lCodeLengthOrder {
+		if clCode.lengths[symbol] != 0 {
+			count = max(count, i+1)
+		}
+	}
+	bw.write(uint32(count-4), 4)
+	for _, symbol := range vp8lCodeLengthOrder[:count] {
+		bw.write(uint32(clCode.lengths[symbol]), 3)
+	}
+	// Lengths follow for the whole alphabet.
+	bw.write(0, 1)
+	for _, token := range clTokens {
+		writeSymbol(bw, clCode, token.symbol)
+		switch token.symbol {
+		case 17:
+			bw.write(uint32(token.extra), 3)
+		case 18:
+			bw.write(uint32(token.extra), 7)
+		}
+	}
+	return code
+}
+
+func writeSimpleCode(bw *vp8lBitWriter, symbols []int) {
+	bw.write(1, 1)
+	bw.write(uint32(len(symbols)-1), 1)
+	if symbols[0] < 2 {
+		bw.write(0, 1)
+		bw.write(uint32(symbols[0]), 1)
+	} else {
+		bw.write(1, 1)
+		bw.write(uint32(symbols[0]), 8)
+	}
+	if len(symbols) == 2 {
+		bw.write(uint32(symbols[1]), 8)
+	}
+}
+
+func writeSymbol(bw *vp8lBitWriter, code vp8lPrefixCode, symbol int) {
+	bw.write(uint32(code.codes[symbol]), uint(code.lengths[symbol]))
+}
+
+// Builds Huffman code lengths no longer than limit. When the tree is too deep the counts
+// are flattened and the tree rebuilt. At least two symbols always get a code, so the code is complete.
+func huffmanLengths(histogram []int, limit int) []uint8 {
+	counts := append([]int{}, histogram...)
+	used := 0
+	for _, count := range counts {
+		if count > 0 {
+			used++
+		}
+	}
+	for symbol := 0; used < 2; symbol++ {
+		if counts[symbol] == 0 {
+			counts[symbol] = 1
+			used++
+		}
+	}
+
+	for {
+		lengths := huffmanTree(counts)
+		longest := uint8(0)
+		for _, length := range lengths {
+			longest = max(longest, length)
+		}
+		if int(longest) <= limit {
+			return lengths
+		}
+		for i, count := range counts {
+			if count > 0 {
+				counts[i] = (count + 1) / 2
+			}
+		}
+	}
+}
+
+func huffmanTree(counts []int) []uint8 {
+	type node struct {
+		weight      int
+		symbol      int
+		left, right int
+	}
+	var nodes []node
+	for symbol, count := range counts {
+		if count > 0 {
+			nodes = append(nodes, node{weight: count, symbol: symbol, left: -1, right: -1})
+		}
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].weight < nodes[j].weight })
+
+	// Two-queue construction: leaves sorted by weight, internal nodes created in weight order.
+	leafCount := len(nodes)
+	leaves, internal := 0, leafCount
+	pick := func() int {
+		if leaves < leafCount && (internal == len(nodes) || nodes[leaves].weight <= nodes[internal].weight) {
+			leaves++
+			return leaves - 1
+		}
+		internal++
+		return internal - 1
+	}
+	for i := 0; i < leafCount-1; i++ {
+		a := pick()
+		b := pick()
+		nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, symbol: -1, left: a, right: b})
+	}
+
+	lengths := make([]uint8, len(counts))
+	var walk func(index int, depth uint8)
+	walk = func(index int, depth uint8) {
+		if nodes[index].symbol >= 0 {
+			lengths[nodes[index].symbol] = depth
+			return
+		}
+		walk(nodes[index].left, depth+1)
+		walk(nodes[index].right, depth+1)
+	}
+	walk(len(nodes)-1, 0)
+	return lengths
+}
+
+// Assigns canonical codes for the lengths, bit-reversed because VP8L reads codes least significant bit first.
+func canonicalCode(lengths []uint8) vp8lPrefixCode {
+	var lengthCount [vp8lMaxCodeLength + 1]int
+	for _, length := range lengths {
+		if length > 0 {
+			lengthCount[length]++
+		}
+	}
+	var next [vp8lMaxCodeLength + 2]int
+	code := 0
+	for length := 1; length <= vp8lMaxCodeLength; length++ {
+		code = (code + lengthCount[length-1]) << 1
+		next[length] = code
+	}
+	codes := make([]uint16, len(lengths))
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		value := next[length]
+		next[length]++
+		reversed := 0
+		for bit := 0; bit < int(length); bit++ {
+			reversed = reversed<<1 | (value>>bit)&1
+		}
+		codes[symbol] = uint16(reversed)
+	}
+	return vp8lPrefixCode{lengths: lengths, codes: codes}
+}
@@ -0,0 +1,698 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"chirp/models"
+)
+
+var wikiSegmentPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+var errWikiPath = errors.New("wiki path segments may contain only letters, digits, '-' and '_'")
+
+// Приводит путь страницы вики к каноническому виду: нижний регистр, без крайних и повторных слэшей.
+func normalizeWikiPath(raw string) (string, error) {
+	var segments []string
+	for _, segment := range strings.Split(strings.ToLower(raw), "/") {
+		if segment == "" {
+			continue
+		}
+		if !wikiSegmentPattern.MatchString(segment) {
+			return "", errWikiPath
+		}
+		segments = append(segments, segment)
+	}
+	if len(segments) == 0 {
+		return "index", nil
+	}
+	path := strings.Join(segments, "/")
+	if len(path) > 255 {
+		return "", errors.New("wiki path is too long")
+	}
+	return path, nil
+}
+
+// @Summary Получить список страниц вики
+// @Description Возвращает все страницы вики группы
+// @Tags wiki
+// @Produce json
+// @Param id path string true "ID группы"
+// @Success 200 {array} routes.WikiPageSummaryDTO
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/wiki [get]
+func listWikiPagesHandler(c *gin.Context, db *gorm.DB) {
+	var group models.Group
+	if err := db.First(&group, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	var pages []models.WikiPage
+	if err := db.Where("group_id = ?", group.ID).Order("path ASC").Find(&pages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve wiki pages"})
+		return
+	}
+
+	pageDTOs := make([]WikiPageSummaryDTO, len(pages))
+	for i, page := range pages {
+		pageDTOs[i] = WikiPageSummaryDTO{
+			Path:           page.Path,
+			EditPermission: page.EditPermission,
+			RevisionCount:  page.RevisionCount,
+			UpdatedAt:      page.UpdatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, pageDTOs)
+}
+
+// @Summary Получить страницу вики
+// @Description Возвращает текущую версию страницы вики или указанную ревизию
+// @Tags wiki
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param path path string true "Путь страницы"
+// @Param revision query string false "ID ревизии"
+// @Success 200 {object} routes.WikiPageDTO
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/wiki/{path} [get]
+func getWikiPageHandler(c *gin.Context, db *gorm.DB) {
+	group, page, ok := loadWikiPage(c, db)
+	if !ok {
+		return
+	}
+
+	var revision models.WikiRevision
+	query := db.Preload("Author").Where("page_id = ?", page.ID)
+	if revisionID := c.Query("revision"); revisionID != "" {
+		query = query.Where("id = ?", revisionID)
+	} else {
+		query = query.Where("id = ?", page.CurrentRevisionID)
+	}
+	if err := query.First(&revision).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		return
+	}
+
+	resp := WikiPageDTO{
+		ID:             page.ID,
+		Path:           page.Path,
+		Content:        revision.Content,
+		EditPermission: page.EditPermission,
+		Revision:       toWikiRevisionDTO(revision),
+		UpdatedAt:      page.UpdatedAt,
+	}
+	if viewerID := optionalUserID(c); viewerID != nil {
+		resp.CanEdit = canEditWikiPage(db, group.ID, page.EditPermission, *viewerID)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Создать или изменить страницу вики
+// @Description Сохраняет новую ревизию страницы. Несуществующая страница создаётся модератором или одобренным участником. При указании baseRevisionId правка отклоняется, если страницу уже изменили
+// @Tags wiki
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param path path string true "Путь страницы"
+// @Param data body routes.EditWikiPageRequest true "Содержимое страницы"
+// @Success 200 {object} routes.WikiPageDTO
+// @Success 201 {object} routes.WikiPageDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /groups/{id}/wiki/{path} [put]
+func editWikiPageHandler(c *gin.Context, db *gorm.DB) {
+	var req EditWikiPageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	authorID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	path, err := normalizeWikiPath(c.Param("path"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var group models.Group
+	if err := db.First(&group, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	var page models.WikiPage
+	created := false
+	if err := db.Where("group_id = ? AND path = ?", group.ID, path).First(&page).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve wiki page"})
+			return
+		}
+		// New pages start editable by approved contributors, so only they may create them.
+		page = models.WikiPage{
+			GroupID:        group.ID,
+			Path:           path,
+			EditPermission: models.WikiEditContributors,
+			CreatedAt:      time.Now(),
+		}
+		created = true
+	}
+
+	if !canEditWikiPage(db, group.ID, page.EditPermission, authorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to edit this wiki page"})
+		return
+	}
+
+	if !created && req.BaseRevisionID != nil && (page.CurrentRevisionID == nil || *req.BaseRevisionID != *page.CurrentRevisionID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "The page was changed since this revision"})
+		return
+	}
+
+	revision, err := saveWikiRevision(db, &page, authorID, req.Content, req.Reason, nil)
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "The page was changed since this revision"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save wiki page"})
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, WikiPageDTO{
+		ID:             page.ID,
+		Path:           page.Path,
+		Content:        page.Content,
+		EditPermission: page.EditPermission,
+		Revision:       toWikiRevisionDTO(revision),
+		CanEdit:        true,
+		UpdatedAt:      page.UpdatedAt,
+	})
+}
+
+// @Summary Получить историю страницы вики
+// @Description Возвращает ревизии страницы вики от новых к старым
+// @Tags wiki
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param path path string true "Путь страницы"
+// @Param page query int false "Страница"
+// @Param limit query int false "Лимит"
+// @Success 200 {object} routes.PaginatedWikiRevisionsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/wiki-history/{path} [get]
+func getWikiHistoryHandler(c *gin.Context, db *gorm.DB) {
+	_, page, ok := loadWikiPage(c, db)
+	if !ok {
+		return
+	}
+
+	pageNum, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "25"))
+	if pageNum < 1 {
+		pageNum = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 25
+	}
+
+	var totalCount int64
+	var revisions []models.WikiRevision
+	query := db.Model(&models.WikiRevision{}).Where("page_id = ?", page.ID).Session(&gorm.Session{})
+	query.Count(&totalCount)
+	if err := query.Preload("Author").Order("number DESC").Offset((pageNum - 1) * limit).Limit(limit).Find(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve wiki history"})
+		return
+	}
+
+	revisionDTOs := make([]WikiRevisionDTO, len(revisions))
+	for i, revision := range revisions {
+		revisionDTOs[i] = toWikiRevisionDTO(revision)
+	}
+
+	c.JSON(http.StatusOK, PaginatedWikiRevisionsResponse{
+		Revisions:  revisionDTOs,
+		Page:       pageNum,
+		Limit:      limit,
+		TotalCount: totalCount,
+	})
+}
+
+// @Summary Сравнить ревизии страницы вики
+// @Description Возвращает unified diff между двумя ревизиями. По умолчанию сравнивается текущая ревизия с предыдущей
+// @Tags wiki
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param path path string true "Путь страницы"
+// @Param from query string false "ID старой ревизии"
+// @Param to query string false "ID новой ревизии"
+// @Success 200 {object} routes.WikiDiffDTO
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/wiki-diff/{path} [get]
+func getWikiDiffHandler(c *gin.Context, db *gorm.DB) {
+	_, page, ok := loadWikiPage(c, db)
+	if !ok {
+		return
+	}
+
+	var to models.WikiRevision
+	toID := c.Query("to")
+	if toID == "" && page.CurrentRevisionID != nil {
+		toID = page.CurrentRevisionID.String()
+	}
+	if err := db.Preload("Author").First(&to, "id = ? AND page_id = ?", toID, page.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		return
+	}
+
+	// Without an explicit base the first revision is compared against an empty page.
+	var from models.WikiRevision
+	if fromID := c.Query("from"); fromID != "" {
+		if err := db.Preload("Author").First(&from, "id = ? AND page_id = ?", fromID, page.ID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+			return
+		}
+	} else {
+		db.Preload("Author").Where("page_id = ? AND number = ?", page.ID, to.Number-1).Limit(1).Find(&from)
+	}
+
+	diff, additions, deletions := unifiedDiff(
+		fmt.Sprintf("%s@%d", page.Path, from.Number),
+		fmt.Sprintf("%s@%d", page.Path, to.Number),
+		from.Content, to.Content,
+	)
+
+	resp := WikiDiffDTO{
+		To:        toWikiRevisionDTO(to),
+		Diff:      diff,
+		Additions: additions,
+		Deletions: deletions,
+	}
+	if from.ID != uuid.Nil {
+		fromDTO := toWikiRevisionDTO(from)
+		resp.From = &fromDTO
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Откатить страницу вики
+// @Description Создаёт новую ревизию с содержимым указанной ревизии
+// @Tags wiki
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param path path string true "Путь страницы"
+// @Param data body routes.RevertWikiPageRequest true "Ревизия"
+// @Success 200 {object} routes.WikiPageDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/wiki-revert/{path} [post]
+func revertWikiPageHandler(c *gin.Context, db *gorm.DB) {
+	var req RevertWikiPageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	authorID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	group, page, ok := loadWikiPage(c, db)
+	if !ok {
+		return
+	}
+
+	if !canEditWikiPage(db, group.ID, page.EditPermission, authorID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to edit this wiki page"})
+		return
+	}
+
+	var target models.WikiRevision
+	if err := db.First(&target, "id = ? AND page_id = ?", req.RevisionID, page.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		return
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("Revert to revision %d", target.Number)
+	}
+
+	revision, err := saveWikiRevision(db, &page, authorID, target.Content, reason, &target.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert wiki page"})
+		return
+	}
+
+	c.JSON(http.StatusOK, WikiPageDTO{
+		ID:             page.ID,
+		Path:           page.Path,
+		Content:        page.Content,
+		EditPermission: page.EditPermission,
+		Revision:       toWikiRevisionDTO(revision),
+		CanEdit:        true,
+		UpdatedAt:      page.UpdatedAt,
+	})
+}
+
+// @Summary Изменить права на редактирование страницы вики
+// @Description Задаёт, кто может редактировать страницу: moderators, contributors (одобренные участники) или everyone
+// @Tags wiki
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID группы"
+// @Param path path string true "Путь страницы"
+// @Param data body routes.WikiPermissionRequest true "Права"
+// @Success 200 {object} routes.WikiPageSummaryDTO
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/wiki-permissions/{path} [put]
+func updateWikiPermissionHandler(c *gin.Context, db *gorm.DB) {
+	var req WikiPermissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	group, moderatorID, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	_, page, ok := loadWikiPage(c, db)
+	if !ok {
+		return
+	}
+
+	before := gin.H{"editPermission": page.EditPermission}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&page).Update("edit_permission", req.EditPermission).Error; err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionEditWiki,
+			TargetType:  "wiki_page",
+			TargetID:    &page.ID,
+			Reason:      page.Path,
+		}, before, gin.H{"editPermission": req.EditPermission})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update wiki page"})
+		return
+	}
+	page.EditPermission = req.EditPermission
+
+	c.JSON(http.StatusOK, WikiPageSummaryDTO{
+		Path:           page.Path,
+		EditPermission: page.EditPermission,
+		RevisionCount:  page.RevisionCount,
+		UpdatedAt:      page.UpdatedAt,
+	})
+}
+
+// @Summary Получить одобренных участников вики
+// @Description Возвращает пользователей, которым разрешено редактировать страницы вики с правами contributors
+// @Tags wiki
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID группы"
+// @Success 200 {array} routes.WikiContributorDTO
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/wiki-contributors [get]
+func listWikiContributorsHandler(c *gin.Context, db *gorm.DB) {
+	group, _, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var contributors []models.WikiContributor
+	if err := db.Preload("User").Where("group_id = ?", group.ID).Order("created_at ASC").Find(&contributors).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve wiki contributors"})
+		return
+	}
+
+	contributorDTOs := make([]WikiContributorDTO, len(contributors))
+	for i, contributor := range contributors {
+		contributorDTOs[i] = WikiContributorDTO{
+			UserID:    contributor.UserID,
+			Nickname:  contributor.User.Nickname,
+			AddedByID: contributor.AddedByID,
+			CreatedAt: contributor.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, contributorDTOs)
+}
+
+// @Summary Одобрить участника вики
+// @Description Разрешает пользователю редактировать страницы вики с правами contributors
+// @Tags wiki
+// @Security BearerAuth
+// @Param id path string true "ID группы"
+// @Param userId path string true "ID пользователя"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/wiki-contributors/{userId} [put]
+func addWikiContributorHandler(c *gin.Context, db *gorm.DB) {
+	group, moderatorID, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, "id = ?", c.Param("userId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		contributor := models.WikiContributor{
+			GroupID:   group.ID,
+			UserID:    user.ID,
+			AddedByID: moderatorID,
+			CreatedAt: time.Now(),
+		}
+		result := tx.Where(models.WikiContributor{GroupID: group.ID, UserID: user.ID}).FirstOrCreate(&contributor)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionEditWiki,
+			TargetType:  "user",
+			TargetID:    &user.ID,
+		}, gin.H{"contributor": false}, gin.H{"contributor": true})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add wiki contributor"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Отозвать права участника вики
+// @Description Убирает пользователя из одобренных участников вики
+// @Tags wiki
+// @Security BearerAuth
+// @Param id path string true "ID группы"
+// @Param userId path string true "ID пользователя"
+// @Success 204 {string} string ""
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /groups/{id}/wiki-contributors/{userId} [delete]
+func removeWikiContributorHandler(c *gin.Context, db *gorm.DB) {
+	group, moderatorID, ok := requireGroupModerator(c, db, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var contributor models.WikiContributor
+	if err := db.First(&contributor, "group_id = ? AND user_id = ?", group.ID, c.Param("userId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Contributor not found"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&contributor).Error; err != nil {
+			return err
+		}
+		return recordModAction(tx, models.ModAction{
+			GroupID:     group.ID,
+			ModeratorID: moderatorID,
+			Action:      models.ModActionEditWiki,
+			TargetType:  "user",
+			TargetID:    &contributor.UserID,
+		}, gin.H{"contributor": true}, gin.H{"contributor": false})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove wiki contributor"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Загружает группу и страницу вики по пути из запроса. При ошибке ответ уже отправлен.
+func loadWikiPage(c *gin.Context, db *gorm.DB) (models.Group, models.WikiPage, bool) {
+	var group models.Group
+	var page models.WikiPage
+
+	path, err := normalizeWikiPath(c.Param("path"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return group, page, false
+	}
+
+	if err := db.First(&group, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return group, page, false
+	}
+
+	if err := db.Where("group_id = ? AND path = ?", group.ID, path).First(&page).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wiki page not found"})
+		return group, page, false
+	}
+
+	return group, page, true
+}
+
+// Проверяет, может ли пользователь редактировать страницу вики с указанными правами.
+func canEditWikiPage(db *gorm.DB, groupID uuid.UUID, permission string, userID uuid.UUID) bool {
+	if isBannedFromGroup(db, groupID, userID) {
+		return false
+	}
+	if isGroupModerator(db, groupID, userID) {
+		return true
+	}
+	switch permission {
+	case models.WikiEditEveryone:
+		return true
+	case models.WikiEditContributors:
+		var count int64
+		db.Model(&models.WikiContributor{}).Where("group_id = ? AND user_id = ?", groupID, userID).Count(&count)
+		return count > 0
+	default:
+		return false
+	}
+}
+
+// Сохраняет новую ревизию страницы и делает её текущей. Новая страница создаётся в той же транзакции.
+func saveWikiRevision(db *gorm.DB, page *models.WikiPage, authorID uuid.UUID, content, reason string, revertedToID *uuid.UUID) (models.WikiRevision, error) {
+	revision := models.WikiRevision{
+		AuthorID:     authorID,
+		Content:      content,
+		Reason:       reason,
+		RevertedToID: revertedToID,
+		CreatedAt:    time.Now(),
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if page.ID == uuid.Nil {
+			if err := tx.Create(page).Error; err != nil {
+				return err
+			}
+		}
+
+		// Bumping the counter only if it is unchanged serialises concurrent edits of the same page.
+		result := tx.Model(&models.WikiPage{}).
+			Where("id = ? AND revision_count = ?", page.ID, page.RevisionCount).
+			Update("revision_count", page.RevisionCount+1)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrDuplicatedKey
+		}
+
+		revision.PageID = page.ID
+		revision.Number = page.RevisionCount + 1
+		if err := tx.Create(&revision).Error; err != nil {
+			return err
+		}
+
+		page.Content = content
+		page.CurrentRevisionID = &revision.ID
+		page.RevisionCount = revision.Number
+		page.UpdatedAt = time.Now()
+		return tx.Model(page).Updates(map[string]interface{}{
+			"content":             page.Content,
+			"current_revision_id": page.CurrentRevisionID,
+			"updated_at":          page.UpdatedAt,
+		}).Error
+	})
+	if err != nil {
+		return revision, err
+	}
+
+	db.Preload("Author").First(&revision, "id = ?", revision.ID)
+	return revision, nil
+}
+
+func toWikiRevisionDTO(revision models.WikiRevision) WikiRevisionDTO {
+	return WikiRevisionDTO{
+		ID:             revision.ID,
+		Number:         revision.Number,
+		AuthorID:       revision.AuthorID,
+		AuthorNickname: revision.Author.Nickname,
+		Reason:         revision.Reason,
+		RevertedToID:   revision.RevertedToID,
+		CreatedAt:      revision.CreatedAt,
+	}
+}